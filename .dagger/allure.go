@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+)
+
+const (
+	allureVersion = "2.30.0"
+	// allureJavaImage runs the Allure CLI, a Java application
+	allureJavaImage = "eclipse-temurin:21-jre"
+)
+
+// allureGenerateScript merges the previous report's history into the results, so
+// the new report shows trends and flaky tests across runs, then generates it
+// TestResults writes every run as both TRX and JUnit; only the TRX is kept, or
+// Allure would count each test twice
+const allureGenerateScript = `set -e
+mkdir -p /results
+for junit in /results/*.junit.xml; do
+  if [ -f "${junit%.junit.xml}.trx" ]; then rm "$junit"; fi
+done
+if [ -d /previous/history ]; then
+  cp -r /previous/history /results/history
+fi
+/opt/allure/bin/allure generate /results -o /report --clean
+`
+
+// allureCli is a Java container with the Allure command line unpacked at /opt/allure
+func allureCli() *dagger.Container {
+	archive := dag.HTTP(fmt.Sprintf("https://repo.maven.apache.org/maven2/io/qameta/allure/allure-commandline/%[1]s/allure-commandline-%[1]s.tgz", allureVersion))
+	return dag.Container().
+		From(allureJavaImage).
+		WithFile("/tmp/allure.tgz", archive).
+		WithExec([]string{"sh", "-c", "mkdir -p /opt/allure && tar xzf /tmp/allure.tgz -C /opt/allure --strip-components=1"})
+}
+
+// AllureReport generates the static Allure HTML report from the results of the test
+// steps: allure-results JSON, TRX (TestResults) and JUnit XML (TestResults, FuzzApi)
+// can be mixed in one directory. Given the previous report, its history is carried
+// over so the report shows trends, retries and flaky tests across runs
+func (m *SearchApi) AllureReport(
+	ctx context.Context,
+	// Test results (e.g., from TestResults)
+	resultsDir *dagger.Directory,
+	// Report generated by the previous run, for history
+	// +optional
+	previousReport *dagger.Directory,
+) (*dagger.Directory, error) {
+	generate := allureCli().
+		WithDirectory("/results", resultsDir)
+	if previousReport != nil {
+		generate = generate.WithDirectory("/previous", previousReport)
+	}
+	report, err := generate.
+		WithExec([]string{"sh", "-c", allureGenerateScript}).
+		Directory("/report").
+		Sync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the Allure report: %w", err)
+	}
+	return report, nil
+}
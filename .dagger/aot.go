@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// runtimeDepsDistroless has only the native dependencies of a self-contained app:
+// no .NET runtime, no shell, no package manager
+const runtimeDepsDistroless = "mcr.microsoft.com/dotnet/runtime-deps:8.0-jammy-chiseled"
+
+// aotPublishScript installs the native toolchain ILCompiler links with, then
+// publishes natively; the log is printed either way so trim warnings can be reported
+// TrimmerSingleWarn=false reports every call site instead of one warning per assembly
+const aotPublishScript = `apt-get update -qq >/dev/null && apt-get install -y -qq clang zlib1g-dev >/dev/null || exit 1
+dotnet publish "$PROJECT" -c "$CONFIGURATION" -r "$RID" -o /app/publish "$@" > /tmp/publish.log 2>&1
+status=$?
+cat /tmp/publish.log
+exit $status
+`
+
+// aotWarningPattern matches trimming (IL2xxx) and AOT (IL3xxx) analysis warnings
+var aotWarningPattern = regexp.MustCompile(`warning (IL[23]\d{3}): (.*?)(?: \[[^\]]*\])?$`)
+
+// aotWarningReport groups the trim and AOT warnings in a publish log by code, with
+// a few example messages each; these point at the code that blocks native AOT
+func aotWarningReport(log string) string {
+	examples := map[string][]string{}
+	counts := map[string]int{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(log, "\n") {
+		match := aotWarningPattern.FindStringSubmatch(strings.TrimSpace(line))
+		// MSBuild repeats every warning in its summary
+		if match == nil || seen[match[0]] {
+			continue
+		}
+		seen[match[0]] = true
+		code, message := match[1], match[2]
+		counts[code]++
+		if len(examples[code]) < 3 {
+			examples[code] = append(examples[code], message)
+		}
+	}
+	if len(counts) == 0 {
+		return "No trim or AOT warnings\n"
+	}
+
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	var sb strings.Builder
+	sb.WriteString("Trim/AOT warnings:\n")
+	for _, code := range codes {
+		fmt.Fprintf(&sb, "  %s (%d)\n", code, counts[code])
+		for _, message := range examples[code] {
+			fmt.Fprintf(&sb, "    • %s\n", message)
+		}
+	}
+	return sb.String()
+}
+
+// aotPublish runs the native publish after the unit tests pass on the JIT build;
+// the publish restores for its runtime identifier itself
+func (m *SearchApi) aotPublish(source *dagger.Directory, runtimeIdentifier string, build buildMetadata, publishFlags ...string) *dagger.Container {
+	buildContainer := m.buildAndTest(source, dotnetSDK).
+		WithEnvVariable("PROJECT", mainProject).
+		WithEnvVariable("CONFIGURATION", buildConfig).
+		WithEnvVariable("RID", runtimeIdentifier)
+	if build.sourceDateEpoch > 0 {
+		buildContainer = buildContainer.WithEnvVariable("SOURCE_DATE_EPOCH", fmt.Sprint(build.sourceDateEpoch))
+	}
+	args := []string{"sh", "-c", aotPublishScript, "publish", "/p:PublishAot=true", "/p:TrimmerSingleWarn=false"}
+	args = append(args, build.publishFlags()...)
+	args = append(args, publishFlags...)
+	return buildContainer.WithExec(args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+}
+
+// BuildContainerAot builds a Native AOT variant: the API is compiled to a single
+// native executable and runs on the runtime-deps chiseled base, without the .NET
+// runtime, for images well under the distroless size and near-instant startup
+// Code that relies on unbounded reflection can't be compiled natively; when the
+// publish fails the error lists the trim and AOT warnings that point at it
+func (m *SearchApi) BuildContainerAot(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Version stamped into the executable (e.g., from ComputeVersion)
+	// +optional
+	version string,
+	// Git commit SHA, recorded as org.opencontainers.image.revision
+	// +optional
+	revision string,
+	// Build time in Unix seconds (e.g., the commit time), recorded as
+	// org.opencontainers.image.created and exported to the build as SOURCE_DATE_EPOCH
+	// +optional
+	sourceDateEpoch int,
+	// Runtime identifier to compile for; native code only runs on this platform
+	// +default="linux-x64"
+	runtimeIdentifier string,
+) (*dagger.Container, error) {
+	build := buildMetadata{version: version, revision: revision, sourceDateEpoch: sourceDateEpoch}
+	published := m.aotPublish(source, runtimeIdentifier, build,
+		"/p:StripSymbols=true",           // Keep debug symbols out of the image
+		"/p:InvariantGlobalization=true", // No ICU in runtime-deps chiseled
+		"/p:OptimizationPreference=Size", // Favor image size over throughput
+	)
+
+	code, err := published.ExitCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("native AOT publish did not run: %w", err)
+	}
+	if code != 0 {
+		log, _ := published.Stdout(ctx)
+		return nil, fmt.Errorf("native AOT publish failed (exit code %d)\n%s", code, aotWarningReport(log))
+	}
+
+	return build.stamp(dag.Container().From(runtimeDepsDistroless)).
+		WithWorkdir("/app").
+		WithFile("/app/SearchApi", published.File("/app/publish/SearchApi")).
+		// Chiseled images run as non-root by default (APP_UID=1654)
+		WithEnvVariable("ASPNETCORE_URLS", aspnetURL).
+		WithEnvVariable("DOTNET_RUNNING_IN_CONTAINER", "true").
+		WithExposedPort(containerPort).
+		WithEntrypoint([]string{"/app/SearchApi"}), nil
+}
+
+// AotWarnings publishes the API natively and reports its trim and AOT warnings,
+// the code to fix before the AOT variant is safe to run, whether or not the
+// publish succeeds
+func (m *SearchApi) AotWarnings(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// +default="linux-x64"
+	runtimeIdentifier string,
+) (string, error) {
+	log, err := m.aotPublish(source, runtimeIdentifier, buildMetadata{}).Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("native AOT publish did not run: %w", err)
+	}
+	return aotWarningReport(log), nil
+}
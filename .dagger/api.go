@@ -0,0 +1,56 @@
+package main
+
+import (
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// apiConfig is runtime configuration applied to the API container before it starts
+type apiConfig struct {
+	// ASPNETCORE_ENVIRONMENT (image default when empty)
+	environment string
+	// Plain KEY=VALUE environment variables
+	env []string
+	// Non-secret settings mounted as appsettings.Override.json
+	appsettings *dagger.File
+	// Secret settings (JSON) mounted as appsettings.Secrets.json
+	secretSettings *dagger.Secret
+	// Environment variables backed by secrets, paired by index
+	secretNames []string
+	secrets     []*dagger.Secret
+}
+
+// apply configures the container; the app loads both JSON files on top of
+// appsettings.json, with environment variables taking precedence over all of them
+func (c apiConfig) apply(container *dagger.Container) (*dagger.Container, error) {
+	if len(c.secretNames) != len(c.secrets) {
+		return nil, fmt.Errorf("got %d secret names for %d secrets", len(c.secretNames), len(c.secrets))
+	}
+
+	if c.environment != "" {
+		container = container.WithEnvVariable("ASPNETCORE_ENVIRONMENT", c.environment)
+	}
+	for _, kv := range c.env {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid environment variable %q: expected KEY=VALUE", kv)
+		}
+		container = container.WithEnvVariable(key, value)
+	}
+	if c.appsettings != nil {
+		container = container.WithFile("/app/appsettings.Override.json", c.appsettings, dagger.ContainerWithFileOpts{
+			Permissions: 0o444,
+		})
+	}
+	// Secrets are mounted rather than copied so they never end up in an image layer
+	if c.secretSettings != nil {
+		container = container.WithMountedSecret("/app/appsettings.Secrets.json", c.secretSettings, dagger.ContainerWithMountedSecretOpts{
+			Mode: 0o444,
+		})
+	}
+	for i, name := range c.secretNames {
+		container = container.WithSecretVariable(name, c.secrets[i])
+	}
+	return container, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// openApiArtifactType marks the OpenAPI document attached to released images
+const openApiArtifactType = "application/vnd.search-api.openapi+json"
+
+// oasdiffLevels names oasdiff's numeric change levels
+var oasdiffLevels = map[int]string{1: "INFO", 2: "WARN", 3: "ERR"}
+
+// ApiChange is one difference between two OpenAPI documents
+type ApiChange struct {
+	// oasdiff check ID (e.g., "api-path-removed-without-deprecation")
+	Id string
+	// ERR (breaking), WARN (potentially breaking) or INFO (non-breaking)
+	Level     string
+	Operation string
+	Path      string
+	Text      string
+}
+
+// ApiCompatibilityReport classifies the API changes since the last release
+type ApiCompatibilityReport struct {
+	// What the current API was compared against (image or "provided document")
+	Baseline string
+	// Changes by level
+	Breaking            int
+	PotentiallyBreaking int
+	NonBreaking         int
+	// Whether a commit since the last release is marked breaking ("feat!:" or BREAKING CHANGE)
+	Announced bool
+	Changes   []*ApiChange
+}
+
+// text renders the report for pipeline reports
+func (r *ApiCompatibilityReport) text() string {
+	text := fmt.Sprintf("Compared with %s: %d breaking, %d potentially breaking, %d non-breaking\n",
+		r.Baseline, r.Breaking, r.PotentiallyBreaking, r.NonBreaking)
+	for _, c := range r.Changes {
+		if c.Level == "INFO" {
+			continue
+		}
+		text += fmt.Sprintf("   • [%s] %s %s: %s\n", c.Level, c.Operation, c.Path, c.Text)
+	}
+	return text
+}
+
+// orasClient is an oras container logged in to the registry when credentials are given
+func orasClient(registryUrl, username string, password *dagger.Secret) *dagger.Container {
+	client := dag.Container().
+		From(orasImage).
+		WithEnvVariable("REGISTRY_URL", registryUrl).
+		WithEnvVariable("REGISTRY_USERNAME", username)
+	if password != nil {
+		client = client.
+			WithSecretVariable("REGISTRY_PASSWORD", password).
+			WithExec([]string{"sh", "-c", `echo "$REGISTRY_PASSWORD" | oras login "$REGISTRY_URL" -u "$REGISTRY_USERNAME" --password-stdin`})
+	}
+	return client
+}
+
+// attachArtifact pushes a file as an OCI artifact referring to the image, so it
+// travels with the image digest and shows up in `oras discover`
+func attachArtifact(ctx context.Context, address, registryUrl, username string, password *dagger.Secret, file *dagger.File, name, artifactType, mediaType string) error {
+	_, err := orasClient(registryUrl, username, password).
+		WithMountedFile("/work/"+name, file).
+		WithWorkdir("/work").
+		WithExec([]string{"oras", "attach", "--artifact-type", artifactType, address, name + ":" + mediaType}).
+		Sync(ctx)
+	return err
+}
+
+// releasedOpenApiSpec pulls the OpenAPI document attached to a released image, or
+// returns nil when the image has none
+func releasedOpenApiSpec(ctx context.Context, image, registryUrl, username string, password *dagger.Secret) (*dagger.File, error) {
+	client := orasClient(registryUrl, username, password)
+	output, err := client.
+		WithExec([]string{"oras", "discover", "--format", "json", "--artifact-type", openApiArtifactType, image}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts of %s: %w", image, err)
+	}
+
+	// oras 1.2 lists referrers as "manifests"; older versions used "referrers"
+	var discovered struct {
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+		Referrers []struct {
+			Digest string `json:"digest"`
+		} `json:"referrers"`
+	}
+	if err := json.Unmarshal([]byte(output), &discovered); err != nil {
+		return nil, fmt.Errorf("invalid oras discover output: %w", err)
+	}
+	manifests := append(discovered.Manifests, discovered.Referrers...)
+	if len(manifests) == 0 {
+		return nil, nil
+	}
+
+	repository := image
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		repository = image[:i]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository = image[:i]
+	}
+	// The most recently attached document wins if the release was re-attached
+	artifact := repository + "@" + manifests[len(manifests)-1].Digest
+	return client.
+		WithWorkdir("/out").
+		WithExec([]string{"oras", "pull", artifact}).
+		File("/out/openapi.json"), nil
+}
+
+// diffOpenApi classifies the changes between two OpenAPI documents with oasdiff
+func diffOpenApi(ctx context.Context, baseline, current *dagger.File, baselineName string) (*ApiCompatibilityReport, error) {
+	output, err := dag.Oasdiff().Changelog(ctx, baseline, current, dagger.OasdiffChangelogOpts{
+		Format: "json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oasdiff failed: %w", err)
+	}
+	var changes []struct {
+		Id        string `json:"id"`
+		Text      string `json:"text"`
+		Level     int    `json:"level"`
+		Operation string `json:"operation"`
+		Path      string `json:"path"`
+	}
+	if strings.TrimSpace(output) != "" {
+		if err := json.Unmarshal([]byte(output), &changes); err != nil {
+			return nil, fmt.Errorf("invalid oasdiff report: %w", err)
+		}
+	}
+
+	report := &ApiCompatibilityReport{Baseline: baselineName}
+	for _, c := range changes {
+		level := oasdiffLevels[c.Level]
+		switch level {
+		case "ERR":
+			report.Breaking++
+		case "WARN":
+			report.PotentiallyBreaking++
+		default:
+			level = "INFO"
+			report.NonBreaking++
+		}
+		report.Changes = append(report.Changes, &ApiChange{
+			Id:        c.Id,
+			Level:     level,
+			Operation: c.Operation,
+			Path:      c.Path,
+			Text:      c.Text,
+		})
+	}
+	return report, nil
+}
+
+// apiCompatibility diffs the current OpenAPI document against the baseline and
+// checks the commit log for an announced breaking change
+func apiCompatibility(ctx context.Context, repo *dagger.Directory, baseline, current *dagger.File, baselineName, sinceTag string) (*ApiCompatibilityReport, error) {
+	report, err := diffOpenApi(ctx, baseline, current, baselineName)
+	if err != nil || report.Breaking == 0 {
+		return report, err
+	}
+
+	// Without history nothing can be announced, so the breaking changes still block
+	_, _, commits, err := commitLog(ctx, repo, sinceTag)
+	if err == nil {
+		for _, c := range commits {
+			report.Announced = report.Announced || c.breaking
+		}
+	}
+	if !report.Announced {
+		return report, fmt.Errorf("%d breaking API change(s) without a breaking commit (\"feat!:\" or BREAKING CHANGE) since the last release:\n%s",
+			report.Breaking, report.text())
+	}
+	return report, nil
+}
+
+// ApiCompatibility compares the API's OpenAPI document with the one attached to the
+// last released image and classifies the changes with oasdiff
+// Breaking changes fail the check unless a commit since that release announces them
+// as breaking, so they show up in the release notes and the version bump
+func (m *SearchApi) ApiCompatibility(
+	ctx context.Context,
+	// API container image to compare
+	container *dagger.Container,
+	// Repository including .git, checked for commits announcing breaking changes
+	// +defaultPath="/"
+	repo *dagger.Directory,
+	// OpenAPI document of the last release; fetched from baselineImage when omitted
+	// +optional
+	baseline *dagger.File,
+	// Released image the OpenAPI document is attached to (e.g., "ghcr.io/myorg/search-api:v1.4.1")
+	// +optional
+	baselineImage string,
+	// Registry of the baseline image, for private registries
+	// +optional
+	registryUrl string,
+	// +optional
+	username string,
+	// +optional
+	password *dagger.Secret,
+	// Tag of the last release (defaults to the most recent tag)
+	// +optional
+	sinceTag string,
+) (*ApiCompatibilityReport, error) {
+	baselineName := "provided document"
+	if baseline == nil {
+		if baselineImage == "" {
+			return nil, fmt.Errorf("either baseline or baselineImage is required")
+		}
+		spec, err := releasedOpenApiSpec(ctx, baselineImage, registryUrl, username, password)
+		if err != nil {
+			return nil, err
+		}
+		if spec == nil {
+			return nil, fmt.Errorf("%s has no OpenAPI document attached", baselineImage)
+		}
+		baseline, baselineName = spec, baselineImage
+	}
+
+	current := openApiSpec(container, solrService("", nil, "api-compat"))
+	return apiCompatibility(ctx, repo, baseline, current, baselineName, sinceTag)
+}
+
+// ApiDiff compares two OpenAPI documents and fails on any breaking change, such as a
+// removed endpoint or a changed response schema. Unlike ApiCompatibility it doesn't
+// consult the commit log, so announced breaking changes fail too
+func (m *SearchApi) ApiDiff(
+	ctx context.Context,
+	// OpenAPI document of the API being released (e.g., from GenerateOpenApiSpec)
+	currentSpec *dagger.File,
+	// OpenAPI document of the last release
+	baselineSpec *dagger.File,
+) (*ApiCompatibilityReport, error) {
+	report, err := diffOpenApi(ctx, baselineSpec, currentSpec, "provided document")
+	if err != nil {
+		return nil, err
+	}
+	if report.Breaking > 0 {
+		return report, fmt.Errorf("%d breaking API change(s):\n%s", report.Breaking, report.text())
+	}
+	return report, nil
+}
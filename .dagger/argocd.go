@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// argoCd calls the Argo CD API
+type argoCd struct {
+	server string
+	token  *dagger.Secret
+}
+
+func (a argoCd) request(ctx context.Context, method, path string, body string, out any) error {
+	headers := []string{"Accept: application/json"}
+	if body != "" {
+		headers = append(headers, "Content-Type: application/json")
+	}
+	response, err := httpRequest{
+		method:     method,
+		url:        a.server + path,
+		headers:    headers,
+		body:       body,
+		token:      a.token,
+		authPrefix: "Authorization: Bearer",
+	}.do(ctx)
+	if err != nil {
+		return fmt.Errorf("Argo CD %s %s failed: %w", method, path, err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(response), out); err != nil {
+		return fmt.Errorf("invalid Argo CD response to %s: %w", path, err)
+	}
+	return nil
+}
+
+// argoApplication is the subset of an Argo CD application's status used to follow a sync
+type argoApplication struct {
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"health"`
+		OperationState *struct {
+			Phase   string `json:"phase"`
+			Message string `json:"message"`
+		} `json:"operationState"`
+		Resources []struct {
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+			Health    *struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"health"`
+		} `json:"resources"`
+	} `json:"status"`
+}
+
+// ArgoSyncStatus is the state of an Argo CD application after ArgoSync
+type ArgoSyncStatus struct {
+	App string
+	// Git revision the application is synced to
+	Revision string
+	// Synced or OutOfSync
+	Sync string
+	// Healthy, Progressing, Degraded, Suspended, Missing or Unknown
+	Health string
+	// Phase of the sync operation (Succeeded, Failed, Error, Running)
+	Phase   string
+	Message string
+	// Resources that aren't healthy, as "Kind/name: status (message)"
+	UnhealthyResources []string
+}
+
+func (s *ArgoSyncStatus) text() string {
+	text := fmt.Sprintf("%s: %s, %s at %s", s.App, s.Sync, s.Health, cmp.Or(s.Revision, "unknown revision"))
+	if s.Message != "" {
+		text += " (" + s.Message + ")"
+	}
+	for _, r := range s.UnhealthyResources {
+		text += "\n   • " + r
+	}
+	return text
+}
+
+// status summarizes the application
+func (a *argoApplication) status(app string) *ArgoSyncStatus {
+	s := &ArgoSyncStatus{
+		App:      app,
+		Revision: a.Status.Sync.Revision,
+		Sync:     a.Status.Sync.Status,
+		Health:   a.Status.Health.Status,
+		Message:  a.Status.Health.Message,
+	}
+	if op := a.Status.OperationState; op != nil {
+		s.Phase = op.Phase
+		s.Message = cmp.Or(op.Message, s.Message)
+	}
+	for _, r := range a.Status.Resources {
+		if r.Health == nil || r.Health.Status == "Healthy" {
+			continue
+		}
+		resource := fmt.Sprintf("%s/%s: %s", r.Kind, r.Name, r.Health.Status)
+		if r.Health.Message != "" {
+			resource += " (" + r.Health.Message + ")"
+		}
+		s.UnhealthyResources = append(s.UnhealthyResources, resource)
+	}
+	return s
+}
+
+// ArgoSync triggers an Argo CD sync of an application (e.g., after BumpGitopsRepo)
+// and waits until it reports Synced and Healthy, failing as soon as the sync fails or
+// the application becomes Degraded, with the resources that aren't healthy
+func (m *SearchApi) ArgoSync(
+	ctx context.Context,
+	// Argo CD server (e.g., "https://argocd.example.com")
+	argoServer string,
+	// Argo CD API token (e.g., of a project role allowed to sync)
+	token *dagger.Secret,
+	// Application name
+	appName string,
+	// Git revision to sync to and wait for (e.g., the GitOps bump's commit);
+	// defaults to the application's target revision
+	// +optional
+	revision string,
+	// Delete resources that are no longer in git
+	// +default=false
+	prune bool,
+	// How long to wait for Synced and Healthy (e.g., "5m", "10m")
+	// +default="5m"
+	timeout string,
+) (*ArgoSyncStatus, error) {
+	wait, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout %q: %w", timeout, err)
+	}
+	argo := argoCd{server: strings.TrimSuffix(argoServer, "/"), token: token}
+	path := "/api/v1/applications/" + url.PathEscape(appName)
+
+	payload, err := json.Marshal(map[string]any{"revision": revision, "prune": prune})
+	if err != nil {
+		return nil, err
+	}
+	if err := argo.request(ctx, "POST", path+"/sync", string(payload), nil); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		var app argoApplication
+		// refresh=normal makes Argo CD compare with git instead of its cached state
+		if err := argo.request(ctx, "GET", path+"?refresh=normal", "", &app); err != nil {
+			return nil, err
+		}
+		status := app.status(appName)
+		switch {
+		case status.Phase == "Failed" || status.Phase == "Error":
+			return status, fmt.Errorf("Argo CD sync of %s failed: %s", appName, status.text())
+		case status.Health == "Degraded":
+			return status, fmt.Errorf("%s is degraded after the sync: %s", appName, status.text())
+		case status.Phase != "Running" && status.Sync == "Synced" && status.Health == "Healthy" &&
+			(revision == "" || status.Revision == revision):
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("%s not Synced and Healthy after %s: %s", appName, timeout, status.text())
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// baselineTools are the scanners a security baseline can suppress findings of, with
+// the kind of ID each one uses
+var baselineTools = map[string]string{
+	"trivy":   "vulnerability or check ID (e.g., CVE-2024-1234)",
+	"semgrep": "rule ID (e.g., csharp.lang.security.sqli.csharp-sqli)",
+	"checkov": "check ID (e.g., CKV_K8S_43)",
+	"zap":     "alert ID (e.g., 10038)",
+}
+
+// SecuritySuppression is one suppressed finding in the security baseline
+type SecuritySuppression struct {
+	// Scanner the ID belongs to: trivy, semgrep, checkov or zap
+	Tool string
+	// Finding ID in the scanner's own terms
+	Id string
+	// Why the finding is suppressed
+	Justification string
+	// Last day the suppression applies (YYYY-MM-DD)
+	Expires string
+	// Whether the suppression has expired
+	Expired bool
+}
+
+// securityBaseline is the parsed .security-baseline.yaml
+type securityBaseline struct {
+	Suppressions []SecuritySuppression
+}
+
+// loadSecurityBaseline reads and validates a security baseline (YAML or JSON)
+// Entries without a justification or expiry are rejected so nothing is suppressed forever
+func loadSecurityBaseline(ctx context.Context, file *dagger.File, now time.Time) (*securityBaseline, error) {
+	baseline := &securityBaseline{}
+	if err := decodeYAML(ctx, file, baseline); err != nil {
+		return nil, fmt.Errorf("failed to load security baseline: %w", err)
+	}
+
+	for i := range baseline.Suppressions {
+		s := &baseline.Suppressions[i]
+		s.Tool = strings.ToLower(s.Tool)
+		entry := fmt.Sprintf("security baseline entry %d", i+1)
+		expired, err := checkWaiver(entry, s.Id, s.Expires, now,
+			waiverField{"tool", s.Tool},
+			waiverField{"id", s.Id},
+			waiverField{"justification", s.Justification})
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := baselineTools[s.Tool]; !ok {
+			return nil, fmt.Errorf("%s (%s): unknown tool %q (expected checkov, semgrep, trivy or zap)", entry, s.Id, s.Tool)
+		}
+		s.Expired = expired
+	}
+	return baseline, nil
+}
+
+// ids returns the IDs of a tool's suppressions that still apply
+func (b *securityBaseline) ids(tool string) []string {
+	if b == nil {
+		return nil
+	}
+	var ids []string
+	for _, s := range b.Suppressions {
+		if s.Tool == tool && !s.Expired && !slices.Contains(ids, s.Id) {
+			ids = append(ids, s.Id)
+		}
+	}
+	return ids
+}
+
+// trivyIgnore renders the Trivy suppressions as a .trivyignore file, or nil when
+// there are none
+func (b *securityBaseline) trivyIgnore() *dagger.File {
+	ids := b.ids("trivy")
+	if len(ids) == 0 {
+		return nil
+	}
+	content := "# Generated from the security baseline\n" + strings.Join(ids, "\n") + "\n"
+	return dag.Directory().WithNewFile(".trivyignore", content).File(".trivyignore")
+}
+
+// checkExpired fails when a suppression has expired, so it is renewed or the
+// finding fixed instead of the scanner silently reporting it again
+func (b *securityBaseline) checkExpired() error {
+	if b == nil {
+		return nil
+	}
+	var expired []string
+	for _, s := range b.Suppressions {
+		if s.Expired {
+			expired = append(expired, fmt.Sprintf("%s %s (expired %s)", s.Tool, s.Id, s.Expires))
+		}
+	}
+	if len(expired) > 0 {
+		return fmt.Errorf("%d security baseline suppression(s) expired; fix the findings or renew them:\n   • %s",
+			len(expired), strings.Join(expired, "\n   • "))
+	}
+	return nil
+}
+
+// summary renders the active suppressions for the pipeline report
+func (b *securityBaseline) summary() string {
+	var active []SecuritySuppression
+	for _, s := range b.Suppressions {
+		if !s.Expired {
+			active = append(active, s)
+		}
+	}
+	if len(active) == 0 {
+		return "🧾 Security baseline: no active suppressions\n"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧾 Security baseline: %d active suppression(s)\n", len(active))
+	for _, s := range active {
+		fmt.Fprintf(&sb, "   • %s %s (expires %s): %s\n", s.Tool, s.Id, s.Expires, s.Justification)
+	}
+	return sb.String()
+}
+
+// SecurityBaseline validates a security baseline file and lists its suppressions with
+// expiry status; the pipeline passes them to each scanner's own ignore mechanism
+func (m *SearchApi) SecurityBaseline(
+	ctx context.Context,
+	// Security baseline file (YAML or JSON)
+	// +defaultPath="/.security-baseline.yaml"
+	baseline *dagger.File,
+	// Fail when a suppression has expired
+	// +default=false
+	failOnExpired bool,
+) ([]*SecuritySuppression, error) {
+	parsed, err := loadSecurityBaseline(ctx, baseline, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*SecuritySuppression, len(parsed.Suppressions))
+	for i := range parsed.Suppressions {
+		result[i] = &parsed.Suppressions[i]
+	}
+	if failOnExpired {
+		if err := parsed.checkExpired(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const benchmarkProject = "SearchApi.Benchmarks/SearchApi.Benchmarks.csproj"
+
+// benchmarkScript runs every benchmark as one joined run, so BenchmarkDotNet writes a
+// single JSON report, and copies it to a fixed path
+const benchmarkScript = `set -e
+dotnet run --project "$PROJECT" -c "$CONFIGURATION" --no-build -- \
+  --filter '*' --join --job "$JOB" --exporters json --artifacts /benchmarks
+cp /benchmarks/results/*-report-full-compressed.json /benchmarks/benchmarks.json
+`
+
+// benchmarkDotNetReport is the subset of BenchmarkDotNet's JSON report used for comparing runs
+type benchmarkDotNetReport struct {
+	Benchmarks []struct {
+		FullName    string
+		Type        string
+		MethodTitle string
+		Parameters  string
+		Statistics  *struct {
+			Mean              float64
+			StandardDeviation float64
+		}
+		Memory *struct {
+			BytesAllocatedPerOperation int64
+		}
+	}
+}
+
+// parseBenchmarks reads a BenchmarkDotNet JSON report; benchmarks that failed to run
+// have no statistics and are left out
+func parseBenchmarks(content string) ([]*MicroBenchmark, error) {
+	var report benchmarkDotNetReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid BenchmarkDotNet report: %w", err)
+	}
+	var benchmarks []*MicroBenchmark
+	for _, b := range report.Benchmarks {
+		if b.Statistics == nil {
+			continue
+		}
+		name := b.Type + "." + b.MethodTitle
+		if b.Parameters != "" {
+			name += " (" + b.Parameters + ")"
+		}
+		benchmark := &MicroBenchmark{
+			Id:       b.FullName,
+			Name:     name,
+			MeanNs:   b.Statistics.Mean,
+			StdDevNs: b.Statistics.StandardDeviation,
+		}
+		if b.Memory != nil {
+			benchmark.AllocatedBytes = b.Memory.BytesAllocatedPerOperation
+		}
+		benchmarks = append(benchmarks, benchmark)
+	}
+	slices.SortFunc(benchmarks, func(a, b *MicroBenchmark) int { return strings.Compare(a.Name, b.Name) })
+	return benchmarks, nil
+}
+
+// MicroBenchmark is the result of one benchmark, compared with the baseline run
+type MicroBenchmark struct {
+	// BenchmarkDotNet's full name, which identifies the benchmark across runs
+	Id   string
+	Name string
+	// Mean and standard deviation of one operation in nanoseconds
+	MeanNs         float64
+	StdDevNs       float64
+	AllocatedBytes int64
+	// Mean in the baseline run (0 when the benchmark is new)
+	BaselineMeanNs float64
+	// Change of the mean since the baseline in percent
+	ChangePercent float64
+	// Whether the mean grew by more than the allowed regression
+	Regressed bool
+}
+
+// MicroBenchmarkReport is the result of MicroBenchmarks
+type MicroBenchmarkReport struct {
+	Benchmarks           []*MicroBenchmark
+	MaxRegressionPercent float64
+	Regressions          int
+	// BenchmarkDotNet's JSON report; store it as the next run's baseline
+	Results *dagger.File
+}
+
+// compare sets each benchmark's change against the baseline run and counts the regressions
+func (r *MicroBenchmarkReport) compare(baseline []*MicroBenchmark) {
+	previous := map[string]*MicroBenchmark{}
+	for _, b := range baseline {
+		previous[b.Id] = b
+	}
+	for _, b := range r.Benchmarks {
+		before, ok := previous[b.Id]
+		if !ok || before.MeanNs == 0 {
+			continue
+		}
+		b.BaselineMeanNs = before.MeanNs
+		b.ChangePercent = (b.MeanNs - before.MeanNs) / before.MeanNs * 100
+		if b.ChangePercent > r.MaxRegressionPercent {
+			b.Regressed = true
+			r.Regressions++
+		}
+	}
+}
+
+// formatNs renders nanoseconds in the unit BenchmarkDotNet's summary would use
+func formatNs(ns float64) string {
+	switch {
+	case ns >= 1e6:
+		return fmt.Sprintf("%.2f ms", ns/1e6)
+	case ns >= 1e3:
+		return fmt.Sprintf("%.2f μs", ns/1e3)
+	}
+	return fmt.Sprintf("%.1f ns", ns)
+}
+
+// Summary renders a table of the benchmarks with their change since the baseline
+func (r *MicroBenchmarkReport) Summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⏱️  Micro-benchmarks (BenchmarkDotNet), max regression %.0f%%\n\n", r.MaxRegressionPercent)
+	sb.WriteString("| Benchmark | Mean | StdDev | Allocated | Baseline | Change |\n|---|---|---|---|---|---|\n")
+	for _, b := range r.Benchmarks {
+		baseline, change := "-", "new"
+		if b.BaselineMeanNs > 0 {
+			baseline = formatNs(b.BaselineMeanNs)
+			change = fmt.Sprintf("%+.1f%%", b.ChangePercent)
+			if b.Regressed {
+				change += " ❌"
+			}
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %d B | %s | %s |\n",
+			b.Name, formatNs(b.MeanNs), formatNs(b.StdDevNs), b.AllocatedBytes, baseline, change)
+	}
+	if r.Regressions > 0 {
+		fmt.Fprintf(&sb, "\n❌ %d benchmark(s) regressed by more than %.0f%%\n", r.Regressions, r.MaxRegressionPercent)
+	}
+	return sb.String()
+}
+
+// MicroBenchmarks runs the SearchApi.Benchmarks project with BenchmarkDotNet and
+// compares the mean of every benchmark with a baseline run (the Results of a previous
+// run, e.g. from main), failing when one regresses beyond maxRegressionPercent
+// Benchmarks on shared CI runners are noisy; keep the allowed regression well above
+// the benchmarks' standard deviation
+func (m *SearchApi) MicroBenchmarks(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// BenchmarkDotNet JSON report of a previous run to compare against
+	// +optional
+	baseline *dagger.File,
+	// Allowed growth of a benchmark's mean latency in percent
+	// +default=10
+	maxRegressionPercent float64,
+	// BenchmarkDotNet job: short (fast, noisier), medium or long
+	// +default="short"
+	job string,
+) (*MicroBenchmarkReport, error) {
+	results := buildBase(source).
+		WithEnvVariable("PROJECT", benchmarkProject).
+		WithEnvVariable("CONFIGURATION", buildConfig).
+		WithEnvVariable("JOB", job).
+		// Timings differ between runs, so a cached result would hide regressions
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", benchmarkScript}).
+		File("/benchmarks/benchmarks.json")
+	content, err := results.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("benchmarks failed: %w", err)
+	}
+	benchmarks, err := parseBenchmarks(content)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MicroBenchmarkReport{Benchmarks: benchmarks, MaxRegressionPercent: maxRegressionPercent, Results: results}
+	if baseline != nil {
+		previous, err := baseline.Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read benchmark baseline: %w", err)
+		}
+		previousBenchmarks, err := parseBenchmarks(previous)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark baseline: %w", err)
+		}
+		report.compare(previousBenchmarks)
+	}
+	if report.Regressions > 0 {
+		return report, fmt.Errorf("❌ BLOCKED - PERFORMANCE REGRESSION:\n%s", report.Summary())
+	}
+	return report, nil
+}
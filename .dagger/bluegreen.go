@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayRequest is a single recorded request from the query corpus
+type replayRequest struct {
+	Method string
+	Path   string
+	Body   json.RawMessage
+}
+
+// parseQueryCorpus reads a JSONL query corpus
+// Lines with a "path" are replayed as-is ({"method":"GET","path":"/api/search/123"});
+// anything else is treated as a SearchRequest body for POST /api/search/search
+func parseQueryCorpus(content string) ([]replayRequest, error) {
+	var requests []replayRequest
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var req replayRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return nil, fmt.Errorf("corpus line %d: %w", n, err)
+		}
+		if req.Path == "" {
+			req = replayRequest{Method: "POST", Path: "/api/search/search", Body: json.RawMessage(line)}
+		}
+		if req.Method == "" {
+			req.Method = "GET"
+		}
+		requests = append(requests, req)
+	}
+	return requests, scanner.Err()
+}
+
+// replayScript sends every request in /corpus/manifest to blue and green in turn,
+// saving each response body and a "<index> <status> <seconds>" line per target
+const replayScript = `set -e
+mkdir -p /out/blue /out/green
+while read -r i method path; do
+  for target in blue green; do
+    data=""
+    [ -s "/corpus/$i.json" ] && data="--data-binary @/corpus/$i.json"
+    result=$(curl -s -o "/out/$target/$i.json" -w '%{http_code} %{time_total}' \
+      -X "$method" -H 'Content-Type: application/json' $data "http://$target:8080$path" || echo "000 0")
+    echo "$i $result" >> "/out/$target.tsv"
+  done
+done < /corpus/manifest
+`
+
+// replayResult is one side's response to a replayed request
+type replayResult struct {
+	status  int
+	latency time.Duration
+	results int64
+}
+
+// parseReplay reads one target's results from the replay output directory
+func parseReplay(ctx context.Context, out *dagger.Directory, target string, count int) ([]replayResult, error) {
+	tsv, err := out.File(target + ".tsv").Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s replay results: %w", target, err)
+	}
+
+	results := make([]replayResult, count)
+	for _, line := range strings.Split(strings.TrimSpace(tsv), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		i, err := strconv.Atoi(fields[0])
+		if err != nil || i >= count {
+			continue
+		}
+		status, _ := strconv.Atoi(fields[1])
+		seconds, _ := strconv.ParseFloat(fields[2], 64)
+		results[i] = replayResult{status: status, latency: time.Duration(seconds * float64(time.Second)), results: -1}
+
+		// Search responses carry a total; other endpoints are compared on status only
+		body, err := out.File(fmt.Sprintf("%s/%d.json", target, i)).Contents(ctx)
+		if err == nil {
+			var response struct {
+				TotalResults *int64 `json:"totalResults"`
+			}
+			if json.Unmarshal([]byte(body), &response) == nil && response.TotalResults != nil {
+				results[i].results = *response.TotalResults
+			}
+		}
+	}
+	return results, nil
+}
+
+// percentile returns the p-th percentile latency (nearest rank)
+func percentile(results []replayResult, p float64) time.Duration {
+	if len(results) == 0 {
+		return 0
+	}
+	latencies := make([]time.Duration, len(results))
+	for i, r := range results {
+		latencies[i] = r.latency
+	}
+	slices.Sort(latencies)
+	rank := int(math.Ceil(p/100*float64(len(latencies)))) - 1
+	return latencies[max(rank, 0)]
+}
+
+// BlueGreenVerify replays a recorded query corpus against the production image (blue)
+// and the candidate (green), each bound to its own Solr restored from the same seeded
+// snapshot, and fails when response codes or result counts differ or when the
+// candidate's p95 latency regresses beyond the allowed margin
+func (m *SearchApi) BlueGreenVerify(
+	ctx context.Context,
+	// Current production image (e.g., ghcr.io/myorg/search-api:1.4.0)
+	production *dagger.Container,
+	// Candidate image to promote
+	candidate *dagger.Container,
+	// Seeded Solr data directory from SnapshotSolr
+	solrSnapshot *dagger.Directory,
+	// Recorded queries, one JSON object per line
+	corpus *dagger.File,
+	// Allowed p95 latency increase of the candidate, as a fraction of production's p95
+	// +default=0.2
+	maxLatencyRegression float64,
+) (string, error) {
+	content, err := corpus.Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read query corpus: %w", err)
+	}
+	requests, err := parseQueryCorpus(content)
+	if err != nil {
+		return "", err
+	}
+	if len(requests) == 0 {
+		return "", fmt.Errorf("query corpus is empty")
+	}
+
+	corpusDir := dag.Directory()
+	var manifest strings.Builder
+	for i, req := range requests {
+		fmt.Fprintf(&manifest, "%d %s %s\n", i, req.Method, req.Path)
+		corpusDir = corpusDir.WithNewFile(fmt.Sprintf("%d.json", i), string(req.Body))
+	}
+	corpusDir = corpusDir.WithNewFile("manifest", manifest.String())
+
+	out := dag.Container().
+		From(curlImage).
+		WithServiceBinding("blue", restoredApiService(production, "", solrSnapshot, "blue")).
+		WithServiceBinding("green", restoredApiService(candidate, "", solrSnapshot, "green")).
+		WithDirectory("/corpus", corpusDir).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", replayScript}).
+		Directory("/out")
+
+	blue, err := parseReplay(ctx, out, "blue", len(requests))
+	if err != nil {
+		return "", err
+	}
+	green, err := parseReplay(ctx, out, "green", len(requests))
+	if err != nil {
+		return "", err
+	}
+
+	var diffs []string
+	for i, req := range requests {
+		b, g := blue[i], green[i]
+		switch {
+		case b.status != g.status:
+			diffs = append(diffs, fmt.Sprintf("#%d %s %s: status %d → %d", i, req.Method, req.Path, b.status, g.status))
+		case b.results != g.results:
+			diffs = append(diffs, fmt.Sprintf("#%d %s %s: results %d → %d", i, req.Method, req.Path, b.results, g.results))
+		}
+	}
+
+	blueP50, greenP50 := percentile(blue, 50), percentile(green, 50)
+	blueP95, greenP95 := percentile(blue, 95), percentile(green, 95)
+	latencyBudget := time.Duration(float64(blueP95) * (1 + maxLatencyRegression))
+
+	report := "🔵🟢 Blue/Green Verification\n\n"
+	report += fmt.Sprintf("Replayed %d requests against production and candidate\n", len(requests))
+	report += fmt.Sprintf("Latency p50: %v → %v\n", blueP50.Round(time.Millisecond), greenP50.Round(time.Millisecond))
+	report += fmt.Sprintf("Latency p95: %v → %v (budget %v)\n", blueP95.Round(time.Millisecond), greenP95.Round(time.Millisecond), latencyBudget.Round(time.Millisecond))
+	report += fmt.Sprintf("Response differences: %d\n", len(diffs))
+	for _, d := range diffs {
+		report += "  " + d + "\n"
+	}
+
+	if len(diffs) > 0 {
+		return report, fmt.Errorf("❌ BLOCKED - candidate responses differ from production in %d of %d requests", len(diffs), len(requests))
+	}
+	if greenP95 > latencyBudget {
+		return report, fmt.Errorf("❌ BLOCKED - candidate p95 latency %v exceeds budget %v", greenP95.Round(time.Millisecond), latencyBudget.Round(time.Millisecond))
+	}
+
+	report += "\n✅ Candidate matches production - safe to promote\n"
+	return report, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imageSourceUrl is the org.opencontainers.image.source of every built image
+const imageSourceUrl = "https://github.com/carpelan/search-api"
+
+// buildMetadata identifies a build in the assemblies and the image
+type buildMetadata struct {
+	version  string
+	revision string
+	// Build time in Unix seconds (SOURCE_DATE_EPOCH); 0 records no timestamp, so
+	// rebuilding the same source produces the same image
+	sourceDateEpoch int
+}
+
+// publishFlags stamps the version and commit into the assemblies; with a
+// SOURCE_DATE_EPOCH the build also normalizes paths so its output is reproducible
+func (b buildMetadata) publishFlags() []string {
+	var flags []string
+	if b.version != "" {
+		flags = append(flags, "/p:Version="+b.version)
+	}
+	if b.revision != "" {
+		flags = append(flags, "/p:SourceRevisionId="+b.revision)
+	}
+	if b.sourceDateEpoch > 0 {
+		flags = append(flags, "/p:ContinuousIntegrationBuild=true")
+	}
+	return flags
+}
+
+// created is the build time as the OCI annotations record it
+func (b buildMetadata) created() string {
+	return time.Unix(int64(b.sourceDateEpoch), 0).UTC().Format(time.RFC3339)
+}
+
+// stamp adds the standard OCI annotations, and the same labels for tools that only
+// read the image config, to a runtime image
+func (b buildMetadata) stamp(container *dagger.Container) *dagger.Container {
+	metadata := [][2]string{{"org.opencontainers.image.source", imageSourceUrl}}
+	if b.revision != "" {
+		metadata = append(metadata, [2]string{"org.opencontainers.image.revision", b.revision})
+	}
+	if b.version != "" {
+		metadata = append(metadata, [2]string{"org.opencontainers.image.version", b.version})
+	}
+	if b.sourceDateEpoch > 0 {
+		metadata = append(metadata, [2]string{"org.opencontainers.image.created", b.created()})
+	}
+	for _, kv := range metadata {
+		container = container.WithLabel(kv[0], kv[1]).WithAnnotation(kv[0], kv[1])
+	}
+	return container
+}
+
+// commitMetadata reads the checked out commit and its commit time, the usual
+// SOURCE_DATE_EPOCH of a reproducible build
+func commitMetadata(ctx context.Context, source *dagger.Directory, version string) (buildMetadata, error) {
+	output, err := dag.Container().
+		From(gitImage).
+		WithDirectory("/repo", source).
+		WithWorkdir("/repo").
+		WithExec([]string{"git", "log", "-1", "--format=%H %ct"}).
+		Stdout(ctx)
+	if err != nil {
+		return buildMetadata{version: version}, fmt.Errorf("failed to read the commit: %w", err)
+	}
+	sha, epoch, _ := strings.Cut(strings.TrimSpace(output), " ")
+	seconds, err := strconv.Atoi(epoch)
+	if err != nil {
+		return buildMetadata{version: version}, fmt.Errorf("invalid commit time %q", epoch)
+	}
+	return buildMetadata{version: version, revision: sha, sourceDateEpoch: seconds}, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// sloConfig is the service level objective a canary is judged against
+type sloConfig struct {
+	// Availability target (e.g., 0.995); the error budget is 1 - availability
+	Availability float64
+	// Maximum p99 latency in milliseconds
+	LatencyP99Ms float64
+	// Maximum rate at which the canary may burn the error budget (1 = exactly on budget)
+	MaxBurnRate float64
+	// Minimum number of requests for a meaningful verdict
+	MinRequests int
+}
+
+// CanaryVerdict is the outcome of a canary analysis
+type CanaryVerdict struct {
+	// Whether the canary meets the SLO and can be promoted
+	Passed bool
+	// Requests sent to the canary
+	Requests int
+	// Fraction of requests that failed (5xx or connection errors)
+	ErrorRate float64
+	// Observed p99 latency in milliseconds
+	LatencyP99Ms float64
+	// Error budget burn rate (error rate / error budget)
+	BurnRate float64
+	// Why the canary failed, empty when it passed
+	Reasons []string
+	// Human-readable summary
+	Report string
+}
+
+// k6Request is a corpus request as embedded in the canary k6 script
+type k6Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// canaryScript drives a constant request rate at the canary, picking requests from
+// the corpus at random; only 5xx responses and connection errors count as failures
+const canaryScript = `
+import http from 'k6/http';
+
+const requests = %s;
+
+http.setResponseCallback(http.expectedStatuses({ min: 200, max: 499 }));
+
+export const options = {
+  scenarios: {
+    canary: {
+      executor: 'constant-arrival-rate',
+      rate: %d,
+      timeUnit: '1s',
+      duration: '%s',
+      preAllocatedVUs: %d,
+    },
+  },
+};
+
+export default function () {
+  const r = requests[Math.floor(Math.random() * requests.length)];
+  const body = r.body ? JSON.stringify(r.body) : null;
+  http.request(r.method, 'http://api:8080' + r.path, body, {
+    headers: { 'Content-Type': 'application/json' },
+  });
+}
+`
+
+// k6Summary is the subset of k6's --summary-export output used for the verdict
+type k6Summary struct {
+	Metrics struct {
+		Duration struct {
+			P99 float64 `json:"p(99)"`
+		} `json:"http_req_duration"`
+		Failed struct {
+			Value float64 `json:"value"`
+		} `json:"http_req_failed"`
+		Requests struct {
+			Count int `json:"count"`
+		} `json:"http_reqs"`
+	} `json:"metrics"`
+}
+
+// judgeCanary compares the observed metrics against the SLO
+func judgeCanary(summary k6Summary, slo sloConfig) *CanaryVerdict {
+	verdict := &CanaryVerdict{
+		Requests:     summary.Metrics.Requests.Count,
+		ErrorRate:    summary.Metrics.Failed.Value,
+		LatencyP99Ms: summary.Metrics.Duration.P99,
+	}
+
+	budget := 1 - slo.Availability
+	if budget > 0 {
+		verdict.BurnRate = verdict.ErrorRate / budget
+	} else if verdict.ErrorRate > 0 {
+		verdict.BurnRate = verdict.ErrorRate * 1e6
+	}
+
+	if verdict.Requests < slo.MinRequests {
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("only %d requests completed (minimum %d)", verdict.Requests, slo.MinRequests))
+	}
+	if verdict.BurnRate > slo.MaxBurnRate {
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("error rate %.2f%% burns the error budget at %.1fx (max %.1fx)",
+			verdict.ErrorRate*100, verdict.BurnRate, slo.MaxBurnRate))
+	}
+	if slo.LatencyP99Ms > 0 && verdict.LatencyP99Ms > slo.LatencyP99Ms {
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("p99 latency %.0fms exceeds %.0fms", verdict.LatencyP99Ms, slo.LatencyP99Ms))
+	}
+	verdict.Passed = len(verdict.Reasons) == 0
+
+	report := "🐤 Canary Analysis\n\n"
+	report += fmt.Sprintf("Requests: %d\n", verdict.Requests)
+	report += fmt.Sprintf("Error rate: %.2f%% (budget %.2f%%, burn rate %.1fx)\n", verdict.ErrorRate*100, budget*100, verdict.BurnRate)
+	report += fmt.Sprintf("p99 latency: %.0fms (SLO %.0fms)\n", verdict.LatencyP99Ms, slo.LatencyP99Ms)
+	if verdict.Passed {
+		report += "\n✅ Canary within SLO - safe to promote\n"
+	} else {
+		report += "\n❌ Canary violates SLO:\n   • " + strings.Join(verdict.Reasons, "\n   • ") + "\n"
+	}
+	verdict.Report = report
+
+	return verdict
+}
+
+// CanaryAnalysis drives partial load at a candidate build and judges its error rate
+// and p99 latency against an SLO config, returning a verdict for the promotion workflow
+func (m *SearchApi) CanaryAnalysis(
+	ctx context.Context,
+	// Candidate API image
+	candidate *dagger.Container,
+	// SLO config (availability, latencyP99Ms, maxBurnRate, minRequests)
+	// +defaultPath="/slo.yaml"
+	slo *dagger.File,
+	// Canary load in requests per second
+	// +default=10
+	rate int,
+	// How long to observe the canary
+	// +default="2m"
+	duration string,
+	// Recorded queries to replay, one JSON object per line (see BlueGreenVerify)
+	// +optional
+	corpus *dagger.File,
+	// Seeded Solr data directory from SnapshotSolr
+	// +optional
+	solrSnapshot *dagger.Directory,
+) (*CanaryVerdict, error) {
+	config := sloConfig{Availability: 0.995, LatencyP99Ms: 1000, MaxBurnRate: 1, MinRequests: 100}
+	if err := decodeYAML(ctx, slo, &config); err != nil {
+		return nil, fmt.Errorf("failed to load SLO config: %w", err)
+	}
+
+	requests := []k6Request{{Method: "POST", Path: "/api/search/search", Body: json.RawMessage(`{"query":"*:*"}`)}}
+	if corpus != nil {
+		content, err := corpus.Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read query corpus: %w", err)
+		}
+		recorded, err := parseQueryCorpus(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(recorded) > 0 {
+			requests = requests[:0]
+			for _, r := range recorded {
+				requests = append(requests, k6Request{Method: r.Method, Path: r.Path, Body: r.Body})
+			}
+		}
+	}
+	requestsJSON, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(canaryScript, requestsJSON, rate, duration, max(rate, 1))
+	output, err := dag.K6().Summary(ctx,
+		restoredApiService(candidate, "", solrSnapshot, "canary"),
+		dag.Directory().WithNewFile("canary.js", script).File("canary.js"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("canary load test failed: %w", err)
+	}
+
+	var summary k6Summary
+	if err := json.Unmarshal([]byte(output), &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse k6 summary: %w", err)
+	}
+	return judgeCanary(summary, config), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CisComplianceSummary is the container hardening result of CisBenchmark
+type CisComplianceSummary struct {
+	// Hardening checks that passed
+	Passed int
+	// Hardening checks that failed
+	Failed int
+	// Failed checks by severity
+	Critical int
+	High     int
+	Medium   int
+	Low      int
+	// Secrets found in the image (not part of the score)
+	Secrets int
+	// Percentage of checks passed (0-100)
+	Score float64
+	// Failed checks as "ID [SEVERITY] title"
+	FailedChecks []string
+	// Raw Trivy JSON report
+	Report string
+}
+
+// cisReport is the subset of Trivy's JSON report CisBenchmark scores
+type cisReport struct {
+	Results []struct {
+		MisconfSummary *struct {
+			Successes int `json:"Successes"`
+			Failures  int `json:"Failures"`
+		} `json:"MisconfSummary"`
+		Misconfigurations []struct {
+			ID       string `json:"ID"`
+			Title    string `json:"Title"`
+			Severity string `json:"Severity"`
+			Status   string `json:"Status"`
+		} `json:"Misconfigurations"`
+		Secrets []json.RawMessage `json:"Secrets"`
+	} `json:"Results"`
+}
+
+// parseCisReport scores a Trivy misconfiguration/secret report
+func parseCisReport(content string) (*CisComplianceSummary, error) {
+	var report cisReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Trivy report: %w", err)
+	}
+
+	summary := &CisComplianceSummary{Report: content}
+	for _, result := range report.Results {
+		if result.MisconfSummary != nil {
+			summary.Passed += result.MisconfSummary.Successes
+			summary.Failed += result.MisconfSummary.Failures
+		}
+		summary.Secrets += len(result.Secrets)
+		for _, misconfig := range result.Misconfigurations {
+			if misconfig.Status != "" && misconfig.Status != "FAIL" {
+				continue
+			}
+			severity := normalizeSeverity(misconfig.Severity)
+			switch severity {
+			case "CRITICAL":
+				summary.Critical++
+			case "HIGH":
+				summary.High++
+			case "MEDIUM":
+				summary.Medium++
+			default:
+				summary.Low++
+			}
+			summary.FailedChecks = append(summary.FailedChecks, fmt.Sprintf("%s [%s] %s", misconfig.ID, severity, misconfig.Title))
+		}
+	}
+
+	summary.Score = 100
+	if total := summary.Passed + summary.Failed; total > 0 {
+		summary.Score = float64(summary.Passed) * 100 / float64(total)
+	}
+	return summary, nil
+}
+
+// text renders the summary for pipeline reports
+func (s *CisComplianceSummary) text() string {
+	text := fmt.Sprintf("Score: %.1f%% (%d passed, %d failed: %d critical, %d high, %d medium, %d low; %d secrets)\n",
+		s.Score, s.Passed, s.Failed, s.Critical, s.High, s.Medium, s.Low, s.Secrets)
+	if len(s.FailedChecks) > 0 {
+		text += "   • " + strings.Join(s.FailedChecks, "\n   • ") + "\n"
+	}
+	return text
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// coberturaReport is the subset of a Cobertura XML report (as written by coverlet)
+// needed for line, branch and method coverage; coverlet writes one package per assembly
+type coberturaReport struct {
+	Sources  []string `xml:"sources>source"`
+	Packages []struct {
+		Name    string `xml:"name,attr"`
+		Classes []struct {
+			Filename string `xml:"filename,attr"`
+			Methods  []struct {
+				Lines []struct {
+					Hits int `xml:"hits,attr"`
+				} `xml:"lines>line"`
+			} `xml:"methods>method"`
+			Lines []struct {
+				Number            int    `xml:"number,attr"`
+				Hits              int    `xml:"hits,attr"`
+				Branch            bool   `xml:"branch,attr"`
+				ConditionCoverage string `xml:"condition-coverage,attr"`
+			} `xml:"lines>line"`
+		} `xml:"classes>class"`
+	} `xml:"packages>package"`
+}
+
+// lineCoverage maps a repository-relative file path to the hit count of each coverable line
+type lineCoverage map[string]map[int]int
+
+// AssemblyCoverage is the line, branch and method coverage of one assembly
+type AssemblyCoverage struct {
+	Name            string
+	LineRate        float64
+	LinesCovered    int
+	LinesValid      int
+	BranchRate      float64
+	BranchesCovered int
+	BranchesValid   int
+	// A method is covered when any of its lines runs
+	MethodRate     float64
+	MethodsCovered int
+	MethodsValid   int
+}
+
+// CoverageResult is the result of CodeCoverage; rates are percentages
+type CoverageResult struct {
+	LineRate        float64
+	LinesCovered    int
+	LinesValid      int
+	BranchRate      float64
+	BranchesCovered int
+	BranchesValid   int
+	MethodRate      float64
+	MethodsCovered  int
+	MethodsValid    int
+	// Per-assembly breakdown, sorted by name
+	Assemblies []*AssemblyCoverage
+	// Ref changed-line coverage was computed against ("" when not computed)
+	BaseRef             string
+	ChangedLineRate     float64
+	ChangedLinesCovered int
+	ChangedLinesValid   int
+	// Changed lines no test executes, as "file: lines"
+	UncoveredChangedLines []string
+	// Human-readable report
+	Report string
+}
+
+// conditionCoverage matches coverlet's condition-coverage attribute, e.g. "50% (1/2)"
+var conditionCoverage = regexp.MustCompile(`\((\d+)/(\d+)\)`)
+
+// parseCobertura reads line hits per file and the per-assembly line, branch and
+// method counts; paths are made relative to the source root mounted at /src so they match
+// git's paths
+func parseCobertura(content string) (lineCoverage, []*AssemblyCoverage, error) {
+	var report coberturaReport
+	if err := xml.Unmarshal([]byte(content), &report); err != nil {
+		return nil, nil, fmt.Errorf("invalid Cobertura report: %w", err)
+	}
+	source := "/src/"
+	if len(report.Sources) > 0 {
+		source = report.Sources[0]
+	}
+
+	coverage := lineCoverage{}
+	assemblies := map[string]*AssemblyCoverage{}
+	type branchCount struct{ covered, valid int }
+	for _, pkg := range report.Packages {
+		assembly := assemblies[pkg.Name]
+		if assembly == nil {
+			assembly = &AssemblyCoverage{Name: pkg.Name}
+			assemblies[pkg.Name] = assembly
+		}
+		hits := lineCoverage{}
+		branches := map[string]map[int]branchCount{}
+		for _, class := range pkg.Classes {
+			file := class.Filename
+			if !path.IsAbs(file) {
+				file = path.Join(source, file)
+			}
+			file = strings.TrimPrefix(file, "/src/")
+			if coverage[file] == nil {
+				coverage[file] = map[int]int{}
+			}
+			if hits[file] == nil {
+				hits[file] = map[int]int{}
+				branches[file] = map[int]branchCount{}
+			}
+			for _, method := range class.Methods {
+				assembly.MethodsValid++
+				for _, line := range method.Lines {
+					if line.Hits > 0 {
+						assembly.MethodsCovered++
+						break
+					}
+				}
+			}
+			// Partial and nested classes list the same file more than once
+			for _, line := range class.Lines {
+				coverage[file][line.Number] = max(coverage[file][line.Number], line.Hits)
+				hits[file][line.Number] = max(hits[file][line.Number], line.Hits)
+				if m := conditionCoverage.FindStringSubmatch(line.ConditionCoverage); line.Branch && m != nil {
+					covered, _ := strconv.Atoi(m[1])
+					valid, _ := strconv.Atoi(m[2])
+					if existing, ok := branches[file][line.Number]; !ok || covered > existing.covered {
+						branches[file][line.Number] = branchCount{covered, valid}
+					}
+				}
+			}
+		}
+		covered, valid := hits.rate(nil)
+		assembly.LinesCovered += covered
+		assembly.LinesValid += valid
+		for _, lines := range branches {
+			for _, b := range lines {
+				assembly.BranchesCovered += b.covered
+				assembly.BranchesValid += b.valid
+			}
+		}
+	}
+
+	var result []*AssemblyCoverage
+	for _, name := range slices.Sorted(maps.Keys(assemblies)) {
+		a := assemblies[name]
+		a.LineRate = percent(a.LinesCovered, a.LinesValid)
+		a.BranchRate = percent(a.BranchesCovered, a.BranchesValid)
+		a.MethodRate = percent(a.MethodsCovered, a.MethodsValid)
+		result = append(result, a)
+	}
+	return coverage, result, nil
+}
+
+// rate returns covered and coverable lines, limited to the given lines per file when
+// lines is not nil
+func (c lineCoverage) rate(lines map[string][]int) (covered int, coverable int) {
+	for file, hits := range c {
+		for number, count := range hits {
+			if lines != nil && !slices.Contains(lines[file], number) {
+				continue
+			}
+			coverable++
+			if count > 0 {
+				covered++
+			}
+		}
+	}
+	return covered, coverable
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiffLines returns the added or modified line numbers per file from a
+// zero-context unified diff
+func parseDiffLines(diff string) map[string][]int {
+	changed := map[string][]int{}
+	var file string
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "+++ "); ok {
+			file = strings.TrimPrefix(name, "b/")
+			if name == "/dev/null" {
+				file = ""
+			}
+			continue
+		}
+		m := hunkHeader.FindStringSubmatch(line)
+		if m == nil || file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		for n := start; n < start+count; n++ {
+			changed[file] = append(changed[file], n)
+		}
+	}
+	return changed
+}
+
+// changedLines diffs the source's HEAD against the merge base with baseRef
+func changedLines(ctx context.Context, source *dagger.Directory, baseRef string) (map[string][]int, error) {
+	diff, err := dag.Container().
+		From(gitImage).
+		WithDirectory("/src", source).
+		WithWorkdir("/src").
+		WithExec([]string{"git", "config", "--global", "--add", "safe.directory", "*"}).
+		WithExec([]string{"git", "diff", "--unified=0", "--no-color", baseRef + "...HEAD", "--", "*.cs"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s (source must include .git history): %w", baseRef, err)
+	}
+	return parseDiffLines(diff), nil
+}
+
+// percent returns covered/coverable as a percentage, treating nothing to cover as fully covered
+func percent(covered int, coverable int) float64 {
+	if coverable == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(coverable)
+}
+
+// CodeCoverage runs the unit tests with coverage and enforces minimum line and
+// branch coverage, reporting both per assembly
+// With a base ref it also enforces a separate, usually higher, threshold on the lines
+// changed since that ref, so new code must be tested while legacy files don't block
+func (m *SearchApi) CodeCoverage(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Minimum total line coverage (percent)
+	// +default=80
+	minimumCoverage float64,
+	// Git ref to compute changed-line coverage against (e.g., "origin/main"); source must include .git history
+	// +optional
+	baseRef string,
+	// Minimum line coverage of changed lines (percent)
+	// +default=90
+	minimumDiffCoverage float64,
+	// Minimum total branch coverage (percent); 0 only reports
+	// +optional
+	minimumBranchCoverage float64,
+) (*CoverageResult, error) {
+	cobertura, err := dag.Dotnet().GetCoverage(ctx, testProject, dagger.DotnetGetCoverageOpts{
+		Configuration: buildConfig,
+		Base:          buildBase(source),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tests with coverage failed: %w", err)
+	}
+	coverage, assemblies, err := parseCobertura(cobertura)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CoverageResult{Assemblies: assemblies}
+	for _, a := range assemblies {
+		result.LinesCovered += a.LinesCovered
+		result.LinesValid += a.LinesValid
+		result.BranchesCovered += a.BranchesCovered
+		result.BranchesValid += a.BranchesValid
+		result.MethodsCovered += a.MethodsCovered
+		result.MethodsValid += a.MethodsValid
+	}
+	result.LineRate = percent(result.LinesCovered, result.LinesValid)
+	result.BranchRate = percent(result.BranchesCovered, result.BranchesValid)
+	result.MethodRate = percent(result.MethodsCovered, result.MethodsValid)
+
+	report := "📊 Code Coverage\n\n"
+	var failures []string
+
+	report += fmt.Sprintf("Total: %.1f%% lines (%d/%d, threshold %.0f%%), %.1f%% branches (%d/%d",
+		result.LineRate, result.LinesCovered, result.LinesValid, minimumCoverage,
+		result.BranchRate, result.BranchesCovered, result.BranchesValid)
+	if minimumBranchCoverage > 0 {
+		report += fmt.Sprintf(", threshold %.0f%%", minimumBranchCoverage)
+	}
+	report += fmt.Sprintf("), %.1f%% methods (%d/%d)\n", result.MethodRate, result.MethodsCovered, result.MethodsValid)
+	for _, a := range assemblies {
+		report += fmt.Sprintf("  • %s: %.1f%% lines (%d/%d), %.1f%% branches (%d/%d), %.1f%% methods (%d/%d)\n",
+			a.Name, a.LineRate, a.LinesCovered, a.LinesValid, a.BranchRate, a.BranchesCovered, a.BranchesValid,
+			a.MethodRate, a.MethodsCovered, a.MethodsValid)
+	}
+	if result.LineRate < minimumCoverage {
+		failures = append(failures, fmt.Sprintf("line coverage %.1f%% is below %.0f%%", result.LineRate, minimumCoverage))
+	}
+	if result.BranchRate < minimumBranchCoverage {
+		failures = append(failures, fmt.Sprintf("branch coverage %.1f%% is below %.0f%%", result.BranchRate, minimumBranchCoverage))
+	}
+
+	if baseRef != "" {
+		changed, err := changedLines(ctx, source, baseRef)
+		if err != nil {
+			return nil, err
+		}
+		result.BaseRef = baseRef
+		result.ChangedLinesCovered, result.ChangedLinesValid = coverage.rate(changed)
+		result.ChangedLineRate = percent(result.ChangedLinesCovered, result.ChangedLinesValid)
+		report += fmt.Sprintf("Changed lines since %s: %.1f%% (%d/%d coverable lines, threshold %.0f%%)\n",
+			baseRef, result.ChangedLineRate, result.ChangedLinesCovered, result.ChangedLinesValid, minimumDiffCoverage)
+		if result.ChangedLineRate < minimumDiffCoverage {
+			failures = append(failures, fmt.Sprintf("changed-line coverage %.1f%% is below %.0f%%", result.ChangedLineRate, minimumDiffCoverage))
+		}
+
+		// Point reviewers at the new code that no test executes
+		for _, file := range slices.Sorted(maps.Keys(changed)) {
+			var uncovered []string
+			for _, n := range changed[file] {
+				if hits, ok := coverage[file][n]; ok && hits == 0 {
+					uncovered = append(uncovered, strconv.Itoa(n))
+				}
+			}
+			if len(uncovered) > 0 {
+				result.UncoveredChangedLines = append(result.UncoveredChangedLines, file+": "+strings.Join(uncovered, ", "))
+				report += fmt.Sprintf("  ⚠️  %s: lines %s not covered\n", file, strings.Join(uncovered, ", "))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		result.Report = report
+		return result, fmt.Errorf("coverage below threshold: %s\n%s", strings.Join(failures, "; "), report)
+	}
+	report += "\n✅ Coverage meets thresholds\n"
+	result.Report = report
+	return result, nil
+}
+
+// reportGeneratorVersion is the ReportGenerator global tool CoverageReport installs
+const reportGeneratorVersion = "5.3.11"
+
+// CoverageReport runs the unit tests with coverage and renders the Cobertura output
+// with ReportGenerator: an HTML report with the covered source highlighted
+// (index.html), coverage badges (badge_*.svg), a Markdown summary for PR comments or
+// job summaries (SummaryGithub.md) and the totals as JSON (Summary.json)
+func (m *SearchApi) CoverageReport(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+) (*dagger.Directory, error) {
+	cobertura, err := dag.Dotnet().GetCoverage(ctx, testProject, dagger.DotnetGetCoverageOpts{
+		Configuration: buildConfig,
+		Base:          buildBase(source),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tests with coverage failed: %w", err)
+	}
+
+	report, err := dag.Container().
+		From(dotnetSDK).
+		WithExec([]string{"dotnet", "tool", "install", "-g", "dotnet-reportgenerator-globaltool", "--version", reportGeneratorVersion}).
+		WithEnvVariable("PATH", "/root/.dotnet/tools:$PATH", dagger.ContainerWithEnvVariableOpts{Expand: true}).
+		// Cobertura paths point into /src, where the tests ran
+		WithDirectory("/src", source).
+		WithNewFile("/coverage/coverage.cobertura.xml", cobertura).
+		WithExec([]string{
+			"reportgenerator",
+			"-reports:/coverage/coverage.cobertura.xml",
+			"-targetdir:/report",
+			"-sourcedirs:/src",
+			"-reporttypes:Html;Badges;MarkdownSummaryGithub;JsonSummary",
+		}).
+		Directory("/report").
+		Sync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ReportGenerator failed: %w", err)
+	}
+	return report, nil
+}
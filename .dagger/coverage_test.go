@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiffLines(t *testing.T) {
+	diff := `diff --git a/SearchApi/Query.cs b/SearchApi/Query.cs
+index 1111111..2222222 100644
+--- a/SearchApi/Query.cs
++++ b/SearchApi/Query.cs
+@@ -10 +10 @@ public class Query
+-    return a;
++    return b;
+@@ -20,0 +21,3 @@ public class Query
++    one();
++    two();
++    three();
+@@ -40,2 +43,0 @@ public class Query
+-    removed();
+-    removed();
+diff --git a/SearchApi/New.cs b/SearchApi/New.cs
+new file mode 100644
+--- /dev/null
++++ b/SearchApi/New.cs
+@@ -0,0 +1,2 @@
++namespace SearchApi;
++public class New {}
+diff --git a/SearchApi/Old.cs b/SearchApi/Old.cs
+deleted file mode 100644
+--- a/SearchApi/Old.cs
++++ /dev/null
+@@ -1,2 +0,0 @@
+-namespace SearchApi;
+-public class Old {}
+`
+	want := map[string][]int{
+		"SearchApi/Query.cs": {10, 21, 22, 23},
+		"SearchApi/New.cs":   {1, 2},
+	}
+	if got := parseDiffLines(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiffLines() = %v, want %v", got, want)
+	}
+	if got := parseDiffLines(""); len(got) != 0 {
+		t.Errorf("parseDiffLines(\"\") = %v, want none", got)
+	}
+}
+
+func TestLineCoverageRate(t *testing.T) {
+	coverage := lineCoverage{
+		"SearchApi/Query.cs": {10: 3, 11: 0, 21: 1, 22: 0},
+		"SearchApi/Hit.cs":   {5: 1},
+	}
+	tests := []struct {
+		name                       string
+		lines                      map[string][]int
+		wantCovered, wantCoverable int
+	}{
+		{"all lines", nil, 3, 5},
+		{"changed lines", map[string][]int{"SearchApi/Query.cs": {10, 11, 12}, "SearchApi/Other.cs": {1}}, 1, 2},
+		{"no changed lines", map[string][]int{}, 0, 0},
+	}
+	for _, tt := range tests {
+		covered, coverable := coverage.rate(tt.lines)
+		if covered != tt.wantCovered || coverable != tt.wantCoverable {
+			t.Errorf("%s: rate() = %d/%d, want %d/%d", tt.name, covered, coverable, tt.wantCovered, tt.wantCoverable)
+		}
+	}
+	if got := percent(0, 0); got != 100 {
+		t.Errorf("percent(0, 0) = %v, want 100", got)
+	}
+	if got := percent(1, 4); got != 25 {
+		t.Errorf("percent(1, 4) = %v, want 25", got)
+	}
+}
+
+func TestParseCobertura(t *testing.T) {
+	content := `<?xml version="1.0" encoding="utf-8"?>
+<coverage line-rate="0.6" branch-rate="0.5" version="1.9">
+  <sources><source>/src/</source></sources>
+  <packages>
+    <package name="SearchApi">
+      <classes>
+        <class name="SearchApi.Query" filename="SearchApi/Query.cs">
+          <methods>
+            <method name="Run"><lines><line number="10" hits="2" /><line number="11" hits="0" /></lines></method>
+            <method name="Unused"><lines><line number="20" hits="0" /></lines></method>
+          </methods>
+          <lines>
+            <line number="10" hits="2" branch="true" condition-coverage="50% (1/2)" />
+            <line number="11" hits="0" branch="false" />
+            <line number="20" hits="0" branch="false" />
+          </lines>
+        </class>
+        <class name="SearchApi.Query/&lt;&gt;c" filename="SearchApi/Query.cs">
+          <methods />
+          <lines>
+            <line number="10" hits="0" branch="true" condition-coverage="100% (2/2)" />
+            <line number="11" hits="4" branch="false" />
+          </lines>
+        </class>
+      </classes>
+    </package>
+    <package name="SearchApi.Core">
+      <classes>
+        <class name="SearchApi.Core.Hit" filename="/src/SearchApi.Core/Hit.cs">
+          <methods />
+          <lines><line number="5" hits="1" branch="false" /></lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>`
+	coverage, assemblies, err := parseCobertura(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Partial classes of one file keep the highest hit count of each line
+	wantCoverage := lineCoverage{
+		"SearchApi/Query.cs":    {10: 2, 11: 4, 20: 0},
+		"SearchApi.Core/Hit.cs": {5: 1},
+	}
+	if !reflect.DeepEqual(coverage, wantCoverage) {
+		t.Errorf("coverage = %v, want %v", coverage, wantCoverage)
+	}
+
+	wantAssemblies := []*AssemblyCoverage{
+		{
+			Name:     "SearchApi",
+			LineRate: 200.0 / 3, LinesCovered: 2, LinesValid: 3,
+			BranchRate: 100, BranchesCovered: 2, BranchesValid: 2,
+			MethodRate: 50, MethodsCovered: 1, MethodsValid: 2,
+		},
+		{
+			Name:     "SearchApi.Core",
+			LineRate: 100, LinesCovered: 1, LinesValid: 1,
+			BranchRate: 100,
+			MethodRate: 100,
+		},
+	}
+	if !reflect.DeepEqual(assemblies, wantAssemblies) {
+		for _, a := range assemblies {
+			t.Logf("%+v", *a)
+		}
+		t.Errorf("assemblies don't match %+v", wantAssemblies)
+	}
+
+	if _, _, err := parseCobertura("not xml"); err == nil {
+		t.Error("parseCobertura accepted an invalid report")
+	}
+}
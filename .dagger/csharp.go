@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// csharpSecurityTool is the SARIF driver name of the merged analyzer log, so its
+// findings are attributed to the security analyzers rather than the C# compiler
+const csharpSecurityTool = "dotnet-security-analyzers"
+
+// isSecurityRule reports whether an analyzer rule is a security rule: anything in the
+// Security category (CA2100, CA3xxx, CA5xxx, SecurityCodeScan, Puma Scan), plus the
+// SecurityCodeScan (SCS) and Puma Scan (SEC) IDs in case the category is missing
+func isSecurityRule(rule sarifRule) bool {
+	var props struct {
+		Category string `json:"category"`
+	}
+	if json.Unmarshal(rule.Properties, &props) == nil && strings.EqualFold(props.Category, "Security") {
+		return true
+	}
+	return strings.HasPrefix(rule.ID, "SCS") || strings.HasPrefix(rule.ID, "SEC")
+}
+
+// mergeSecuritySarif combines the per-project analyzer logs into one SARIF document
+// containing only security rules and their results
+func mergeSecuritySarif(logs []string) (string, error) {
+	merged := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+	}
+	for _, content := range logs {
+		log, err := parseSarif(content)
+		if err != nil {
+			return "", err
+		}
+		for _, run := range log.Runs {
+			security := map[string]bool{}
+			var rules []sarifRule
+			for _, rule := range run.Tool.Driver.Rules {
+				if isSecurityRule(rule) {
+					security[rule.ID] = true
+					rules = append(rules, rule)
+				}
+			}
+			results := []sarifResult{}
+			for _, result := range run.Results {
+				if security[result.RuleID] || isSecurityRule(sarifRule{ID: result.RuleID}) {
+					results = append(results, result)
+				}
+			}
+			run.Tool.Driver.Name = csharpSecurityTool
+			run.Tool.Driver.Rules = rules
+			run.Results = results
+			merged.Runs = append(merged.Runs, run)
+		}
+	}
+
+	content, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// csharpSecuritySarif builds the solution with the security analyzers injected and
+// returns their merged SARIF log
+func csharpSecuritySarif(ctx context.Context, source *dagger.Directory, pumaScanVersion string) (string, error) {
+	logs := dag.Dotnet().BuildWithSecurityAnalyzers(solutionFile, dagger.DotnetBuildWithSecurityAnalyzersOpts{
+		Configuration:   buildConfig,
+		PumaScanVersion: pumaScanVersion,
+		Base:            buildBase(source),
+	})
+	entries, err := logs.Entries(ctx)
+	if err != nil {
+		return "", fmt.Errorf("security analyzer build failed: %w", err)
+	}
+
+	var contents []string
+	for _, name := range entries {
+		if !strings.HasSuffix(name, ".sarif") {
+			continue
+		}
+		content, err := logs.File(name).Contents(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read analyzer log %s: %w", name, err)
+		}
+		contents = append(contents, content)
+	}
+	return mergeSecuritySarif(contents)
+}
+
+// CSharpSecurityAnalysis builds the solution with SecurityCodeScan (and optionally Puma
+// Scan) analyzers injected at build time and returns their security findings
+// The source is not modified; the analyzers' SARIF output is normalized like any other
+// scanner's, so findings can be deduplicated, gated and uploaded with the rest
+func (m *SearchApi) CSharpSecurityAnalysis(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Puma.Security.Rules.2022 package version to add Puma Scan (e.g., "2.4.9")
+	// +optional
+	pumaScanVersion string,
+) ([]*Finding, error) {
+	content, err := csharpSecuritySarif(ctx, source, pumaScanVersion)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := parseSarifFindings(content)
+	if err != nil {
+		return nil, err
+	}
+	findings = dedupeFindings(findings)
+
+	result := make([]*Finding, len(findings))
+	for i := range findings {
+		result[i] = &findings[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dashboardSeverities are the severities the dashboard charts, most severe first
+var dashboardSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFO"}
+
+// severityColors are the chart colors of each severity
+var severityColors = map[string]string{
+	"CRITICAL": "#7b0000",
+	"HIGH":     "#d03020",
+	"MEDIUM":   "#e89020",
+	"LOW":      "#d8c030",
+	"INFO":     "#6090c0",
+}
+
+// severityCounts counts findings per severity
+func severityCounts(findings []Finding) map[string]int {
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+// findingsByTool groups findings by the scanner that reported them, most severe first
+func findingsByTool(findings []Finding) map[string][]Finding {
+	byTool := map[string][]Finding{}
+	for _, f := range findings {
+		byTool[f.Tool] = append(byTool[f.Tool], f)
+	}
+	for _, list := range byTool {
+		sort.SliceStable(list, func(i, j int) bool { return severityRank[list[i].Severity] > severityRank[list[j].Severity] })
+	}
+	return byTool
+}
+
+// severityChart renders severity counts as an inline SVG bar chart
+func severityChart(counts map[string]int) string {
+	largest := 1
+	for _, severity := range dashboardSeverities {
+		largest = max(largest, counts[severity])
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, "<svg width=\"480\" height=\"%d\" role=\"img\">\n", len(dashboardSeverities)*28)
+	for i, severity := range dashboardSeverities {
+		y := i * 28
+		width := counts[severity] * 340 / largest
+		fmt.Fprintf(&svg, "<text x=\"0\" y=\"%d\">%s</text>", y+18, severity)
+		fmt.Fprintf(&svg, "<rect x=\"90\" y=\"%d\" width=\"%d\" height=\"20\" fill=\"%s\"/>", y+4, width, severityColors[severity])
+		fmt.Fprintf(&svg, "<text x=\"%d\" y=\"%d\">%d</text>\n", 96+width, y+18, counts[severity])
+	}
+	svg.WriteString("</svg>\n")
+	return svg.String()
+}
+
+// trendSection compares the findings with the previous run's, per severity and by
+// fingerprint
+func trendSection(previous, current []Finding) string {
+	before, after := severityCounts(previous), severityCounts(current)
+	known := map[string]bool{}
+	for _, f := range previous {
+		known[f.Fingerprint] = true
+	}
+	introduced := 0
+	for _, f := range current {
+		if !known[f.Fingerprint] {
+			introduced++
+		}
+		delete(known, f.Fingerprint)
+	}
+
+	var section strings.Builder
+	section.WriteString("<h2>Trend vs previous run</h2>\n")
+	fmt.Fprintf(&section, "<p>%d new, %d resolved (%d → %d findings)</p>\n", introduced, len(known), len(previous), len(current))
+	section.WriteString("<table>\n<tr><th>Severity</th><th>Previous</th><th>Current</th><th>Change</th></tr>\n")
+	for _, severity := range dashboardSeverities {
+		delta := after[severity] - before[severity]
+		class := ""
+		switch {
+		case delta > 0:
+			class = " class=\"worse\""
+		case delta < 0:
+			class = " class=\"better\""
+		}
+		fmt.Fprintf(&section, "<tr><td>%s</td><td>%d</td><td>%d</td><td%s>%+d</td></tr>\n",
+			severity, before[severity], after[severity], class, delta)
+	}
+	section.WriteString("</table>\n")
+	return section.String()
+}
+
+// renderDashboard renders the findings as a single self-contained HTML page
+func renderDashboard(current, previous []Finding, hasPrevious bool) string {
+	counts := severityCounts(current)
+	byTool := findingsByTool(current)
+	tools := make([]string, 0, len(byTool))
+	for tool := range byTool {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Security dashboard</title>\n")
+	page.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse;margin-bottom:1em}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}svg text{font-size:13px}.worse{color:#b00}.better{color:#080}</style>\n")
+	fmt.Fprintf(&page, "</head><body>\n<h1>Security dashboard</h1>\n<p>Generated %s: %d findings from %d tools</p>\n",
+		time.Now().UTC().Format(time.RFC3339), len(current), len(tools))
+
+	page.WriteString("<h2>Findings by severity</h2>\n")
+	page.WriteString(severityChart(counts))
+	if hasPrevious {
+		page.WriteString(trendSection(previous, current))
+	}
+
+	page.WriteString("<h2>Findings by tool</h2>\n<table>\n<tr><th>Tool</th>")
+	for _, severity := range dashboardSeverities {
+		fmt.Fprintf(&page, "<th>%s</th>", severity)
+	}
+	page.WriteString("<th>Total</th></tr>\n")
+	for _, tool := range tools {
+		toolCounts := severityCounts(byTool[tool])
+		fmt.Fprintf(&page, "<tr><td><a href=\"#%s\">%s</a></td>", html.EscapeString(tool), html.EscapeString(tool))
+		for _, severity := range dashboardSeverities {
+			fmt.Fprintf(&page, "<td>%d</td>", toolCounts[severity])
+		}
+		fmt.Fprintf(&page, "<td>%d</td></tr>\n", len(byTool[tool]))
+	}
+	page.WriteString("</table>\n")
+
+	for _, tool := range tools {
+		fmt.Fprintf(&page, "<h3 id=\"%s\">%s</h3>\n<table>\n", html.EscapeString(tool), html.EscapeString(tool))
+		page.WriteString("<tr><th>Severity</th><th>Rule</th><th>Title</th><th>Location</th><th>Package</th><th>Fixed in</th></tr>\n")
+		for _, f := range byTool[tool] {
+			rule := html.EscapeString(f.RuleID)
+			if f.URL != "" {
+				rule = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(f.URL), rule)
+			}
+			location := f.Location
+			if f.Line > 0 {
+				location = fmt.Sprintf("%s:%d", location, f.Line)
+			}
+			pkg := f.Package
+			if f.Version != "" {
+				pkg += " " + f.Version
+			}
+			fmt.Fprintf(&page, "<tr><td style=\"color:%s\">%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				severityColors[f.Severity], f.Severity, rule, html.EscapeString(f.Title),
+				html.EscapeString(location), html.EscapeString(pkg), html.EscapeString(f.FixedVersion))
+		}
+		page.WriteString("</table>\n")
+	}
+	page.WriteString("</body></html>\n")
+	return page.String()
+}
+
+// GenerateDashboard renders all JSON and SARIF scan reports in a directory as a
+// single static HTML page: a severity chart, a table per tool and, given the
+// previous run's reports, the trend since then. Publish it as a CI artifact
+func (m *SearchApi) GenerateDashboard(
+	ctx context.Context,
+	// Directory of scan reports (e.g., output of ExportPipelineReports)
+	reportsDir *dagger.Directory,
+	// Scan reports of the previous run, to show the trend
+	// +optional
+	previousReports *dagger.Directory,
+) (*dagger.File, error) {
+	current, err := collectFindings(ctx, reportsDir)
+	if err != nil {
+		return nil, err
+	}
+	var previous []Finding
+	if previousReports != nil {
+		previous, err = collectFindings(ctx, previousReports)
+		if err != nil {
+			return nil, fmt.Errorf("previous reports: %w", err)
+		}
+	}
+
+	page := renderDashboard(current, previous, previousReports != nil)
+	return dag.Directory().WithNewFile("dashboard.html", page).File("dashboard.html"), nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// warmupScript waits for the API to become healthy, then exercises the search and
+// lookup endpoints so caches, JIT and Solr searchers are warm before the scan starts
+const warmupScript = `set -e
+for i in $(seq 1 60); do
+  curl -sf http://api:8080/health >/dev/null && break
+  sleep 2
+done
+curl -sSf http://api:8080/health
+echo
+for query in '*:*' 'title:*' 'metadata'; do
+  curl -s -o /dev/null -w "search $query: %{http_code} %{time_total}s\n" \
+    -X POST -H 'Content-Type: application/json' \
+    --data "{\"query\":\"$query\",\"rows\":20}" http://api:8080/api/search/search
+done
+`
+
+// openApiSpec fetches the Swagger document from a Development instance of the API,
+// the only environment that serves it
+func openApiSpec(container *dagger.Container, solr *dagger.Service) *dagger.File {
+	return fetchOpenApiSpec(apiWithSolr(container.WithEnvVariable("ASPNETCORE_ENVIRONMENT", "Development"), solr))
+}
+
+// fetchOpenApiSpec downloads the Swagger document from a running API, waiting for it
+// to come up
+func fetchOpenApiSpec(api *dagger.Service) *dagger.File {
+	return dag.Container().
+		From(curlImage).
+		WithServiceBinding("api", api).
+		WithExec([]string{"sh", "-c", `for i in $(seq 1 60); do
+  curl -sf http://api:8080/swagger/v1/swagger.json -o /tmp/openapi.json && exit 0
+  sleep 2
+done
+echo "API did not serve /swagger/v1/swagger.json" >&2
+exit 1`}).
+		File("/tmp/openapi.json")
+}
+
+// GenerateOpenApiSpec exports the API's OpenAPI document, for ZAP's API scan,
+// contract tests and client generation. It is fetched from the given service, which
+// must run in the Development environment to serve Swagger, or else from a
+// Development instance of the container
+func (m *SearchApi) GenerateOpenApiSpec(
+	ctx context.Context,
+	// Running API, listening on port 8080
+	// +optional
+	apiService *dagger.Service,
+	// API container image, started with Solr when apiService is omitted
+	// +optional
+	container *dagger.Container,
+) (*dagger.File, error) {
+	var spec *dagger.File
+	switch {
+	case apiService != nil:
+		spec = fetchOpenApiSpec(apiService)
+	case container != nil:
+		spec = openApiSpec(container, solrService("", nil, "openapi"))
+	default:
+		return nil, fmt.Errorf("either apiService or container is required")
+	}
+
+	content, err := spec.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OpenAPI document: %w", err)
+	}
+	if !json.Valid([]byte(content)) {
+		return nil, fmt.Errorf("/swagger/v1/swagger.json is not a JSON document")
+	}
+	return spec, nil
+}
+
+// zapRiskLevels orders ZAP risk names by their riskcode
+var zapRiskLevels = []string{"Informational", "Low", "Medium", "High"}
+
+// zapReport is the subset of ZAP's traditional JSON report used for gating and findings
+type zapReport struct {
+	Site []struct {
+		Name   string `json:"@name"`
+		Alerts []struct {
+			PluginID  string
+			Name      string
+			RiskCode  string
+			RiskDesc  string
+			Count     string
+			Desc      string
+			Reference string
+			CweID     string
+			Instances []struct {
+				URI string
+			}
+		}
+	}
+}
+
+// DastDeepScan runs a full active ZAP scan against an API seeded with representative
+// documents: Solr is restored from the fixtures, the API is warmed up, and ZAP imports
+// the OpenAPI spec and crawls within the given scope before attacking every request
+// it found. The baseline scan in FullPipeline runs against an empty index, so most
+// search code paths never execute there.
+func (m *SearchApi) DastDeepScan(
+	ctx context.Context,
+	// API container image to scan
+	container *dagger.Container,
+	// Fixture documents to seed Solr with (see SnapshotSolr)
+	fixtures *dagger.Directory,
+	// OpenAPI definition; fetched from a Development instance of the API when omitted
+	// +optional
+	apiDefinition *dagger.File,
+	// Regexes of URLs in scope
+	// +default=["http://api:8080/api/.*"]
+	includePaths []string,
+	// Regexes of URLs excluded from crawling and attacks
+	// +optional
+	excludePaths []string,
+	// Maximum active scan duration in minutes
+	// +default=30
+	scanMinutes int,
+	// Lowest ZAP risk that fails the scan (Informational, Low, Medium, High)
+	// +default="High"
+	failOnRisk string,
+) (string, error) {
+	threshold := slices.Index(zapRiskLevels, failOnRisk)
+	if threshold < 0 {
+		return "", fmt.Errorf("unknown risk %q: expected one of %v", failOnRisk, zapRiskLevels)
+	}
+
+	snapshot, err := m.SnapshotSolr(ctx, fixtures, solrCore, defaultSolrVersion)
+	if err != nil {
+		return "", fmt.Errorf("failed to seed Solr: %w", err)
+	}
+	if apiDefinition == nil {
+		apiDefinition = openApiSpec(container, solrService("", snapshot, "dast-spec"))
+	}
+	apiService := restoredApiService(container, "", snapshot, "dast-deep")
+
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return "", err
+	}
+
+	report := "🎯 Deep DAST Scan (OWASP ZAP active scan)\n\n"
+	warmup, err := dag.Container().
+		From(curlImage).
+		WithServiceBinding("api", apiService).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", warmupScript}).
+		Stdout(ctx)
+	if err != nil {
+		return report, fmt.Errorf("API warm-up failed: %w", err)
+	}
+	report += "🔥 Warm-up:\n" + warmup + "\n"
+
+	output, err := dag.Zap().AutomationScan(ctx, apiService, dagger.ZapAutomationScanOpts{
+		APIDefinition: apiDefinition,
+		IncludePaths:  includePaths,
+		ExcludePaths:  excludePaths,
+		ScanMinutes:   scanMinutes,
+	})
+	if err != nil {
+		return report, fmt.Errorf("ZAP active scan failed: %w", err)
+	}
+
+	var result zapReport
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return report, fmt.Errorf("invalid ZAP report: %w", err)
+	}
+
+	counts := make([]int, len(zapRiskLevels))
+	var blocking []string
+	for _, site := range result.Site {
+		for _, alert := range site.Alerts {
+			risk, err := strconv.Atoi(alert.RiskCode)
+			if err != nil || risk < 0 || risk >= len(zapRiskLevels) {
+				continue
+			}
+			counts[risk]++
+			if risk >= threshold {
+				blocking = append(blocking, fmt.Sprintf("[%s] %s (%s instances)", zapRiskLevels[risk], alert.Name, alert.Count))
+			}
+		}
+	}
+
+	report += "Alerts by risk:\n"
+	for risk := len(zapRiskLevels) - 1; risk >= 0; risk-- {
+		report += fmt.Sprintf("  %s: %d\n", zapRiskLevels[risk], counts[risk])
+	}
+	for _, alert := range blocking {
+		report += "  ❌ " + alert + "\n"
+	}
+
+	if len(blocking) > 0 {
+		return report, fmt.Errorf("❌ BLOCKED - deep DAST found %d alerts at or above %s risk", len(blocking), failOnRisk)
+	}
+	report += "\n✅ Deep DAST passed\n"
+	return report, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"slices"
+)
+
+// DeepScan settings: the runtime scans get time the per-PR pipeline can't spend
+const (
+	// ZAP full scan spider limit in minutes
+	deepScanSpiderMinutes = 30
+	// k6 soak test: five times the per-PR request rate, for half an hour
+	deepScanRate     = 50
+	deepScanDuration = "30m"
+)
+
+// deepScanSteps are the steps DeepScan always runs, whatever the config's modes
+var deepScanSteps = []string{"dast", "api-security", "performance", "mutation", "dependencies", "container-scan"}
+
+// withSeverity adds a severity to a list, keeping it free of duplicates
+func withSeverity(severities []string, severity string) []string {
+	if slices.Contains(severities, severity) {
+		return severities
+	}
+	return append(severities, severity)
+}
+
+// DeepScan runs the pipeline with the slow, thorough checks we can't afford per PR:
+// a ZAP full (active) scan, the full Nuclei template set, mutation testing, a k6
+// soak test and Trivy scans including MEDIUM vulnerabilities
+// It returns the same report as FullPipeline, for a nightly or weekly schedule;
+// nothing is pushed to a registry
+func (m *SearchApi) DeepScan(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Pipeline config for modes and thresholds (e.g., pipeline.yaml); the deep scan
+	// steps run even where it skips them
+	// +optional
+	configFile *dagger.File,
+	// Slack or Teams incoming webhook to post the result to
+	// +optional
+	notifyWebhook *dagger.Secret,
+	// OTLP/HTTP endpoint to export a span per step to
+	// +optional
+	otlpEndpoint string,
+) (*PipelineReport, error) {
+	config := defaultPipelineConfig()
+	if configFile != nil {
+		var err error
+		if config, err = loadPipelineConfig(ctx, configFile); err != nil {
+			return nil, err
+		}
+	}
+	config.deep = true
+	if otlpEndpoint != "" {
+		config.OtlpEndpoint = otlpEndpoint
+	}
+	for _, step := range deepScanSteps {
+		if config.mode(step) == "skip" {
+			if config.Steps == nil {
+				config.Steps = map[string]string{}
+			}
+			config.Steps[step] = pipelineStepModes[step]
+		}
+	}
+	config.Severities.Dependencies = withSeverity(config.Severities.Dependencies, "MEDIUM")
+	config.Severities.Container = withSeverity(config.Severities.Container, "MEDIUM")
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return m.runPipeline(ctx, source, config, nil, nil, notifyWebhook, nil, nil, config.inputs(source))
+}
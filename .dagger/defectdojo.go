@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defectDojoScanTypes maps report formats onto DefectDojo parsers
+// DefectDojo only parses ZAP and Dependency-Check XML; their JSON reports are
+// converted to SARIF first
+var defectDojoScanTypes = map[string]string{
+	"sarif":   "SARIF",
+	"trivy":   "Trivy Scan",
+	"grype":   "Anchore Grype",
+	"semgrep": "Semgrep JSON Report",
+	"checkov": "Checkov Scan",
+	"nuclei":  "Nuclei Scan",
+}
+
+// ExportToDefectDojo imports every scan report in a directory into a DefectDojo
+// engagement through the import-scan API, each with the scan type of its tool
+// Reports without findings (SBOMs, plain text) are left out; an import that fails
+// doesn't stop the others
+func (m *SearchApi) ExportToDefectDojo(
+	ctx context.Context,
+	// Directory of scan reports (e.g., the reports of FullPipeline or ExportPipelineReports)
+	reports *dagger.Directory,
+	// DefectDojo URL (e.g., "https://defectdojo.example.com")
+	url string,
+	// DefectDojo API v2 key
+	apiKey *dagger.Secret,
+	// Engagement to import into
+	engagementId int,
+	// Lowest severity imported: Info, Low, Medium, High or Critical
+	// +default="Info"
+	minimumSeverity string,
+	// Close findings of earlier imports of the same scan type that are no longer reported
+	// +optional
+	closeOldFindings bool,
+	// Version or commit the reports were produced for
+	// +optional
+	version string,
+) (string, error) {
+	entries, err := reports.Entries(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list reports: %w", err)
+	}
+	sort.Strings(entries)
+
+	summary := fmt.Sprintf("📥 DefectDojo import (engagement %d)\n\n", engagementId)
+	var errs []error
+	for _, name := range entries {
+		switch path.Ext(name) {
+		case ".json", ".jsonl", ".sarif":
+		default:
+			continue
+		}
+		content, err := reports.File(name).Contents(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read report %s: %w", name, err)
+		}
+
+		format := reportFormat(content)
+		if format == "" {
+			continue
+		}
+		file, upload := reports.File(name), name
+		scanType, ok := defectDojoScanTypes[format]
+		if !ok {
+			findings, err := parseFindings(content)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			run, err := findingsRun(format, findings)
+			if err != nil {
+				return "", err
+			}
+			converted, err := json.Marshal(sarifLog{Version: "2.1.0", Runs: []sarifRun{run}})
+			if err != nil {
+				return "", err
+			}
+			scanType, upload = "SARIF", strings.TrimSuffix(name, path.Ext(name))+".sarif"
+			file = dag.Directory().WithNewFile(upload, string(converted)).File(upload)
+		}
+
+		form := []string{
+			"scan_type=" + scanType,
+			"engagement=" + strconv.Itoa(engagementId),
+			"test_title=" + strings.TrimSuffix(name, path.Ext(name)),
+			"minimum_severity=" + minimumSeverity,
+			"active=true",
+			"verified=false",
+			"close_old_findings=" + strconv.FormatBool(closeOldFindings),
+		}
+		if version != "" {
+			form = append(form, "version="+version)
+		}
+		response, err := httpRequest{
+			method:     "POST",
+			url:        strings.TrimSuffix(url, "/") + "/api/v2/import-scan/",
+			headers:    []string{"Accept: application/json"},
+			form:       form,
+			files:      []formFile{{field: "file", name: upload, file: file}},
+			token:      apiKey,
+			authPrefix: "Authorization: Token",
+		}.do(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: import failed: %w", name, err))
+			summary += fmt.Sprintf("❌ %s (%s): import failed\n", name, scanType)
+			continue
+		}
+
+		var imported struct {
+			Test int `json:"test"`
+		}
+		_ = json.Unmarshal([]byte(response), &imported)
+		summary += fmt.Sprintf("✅ %s → %s (test %d)\n", name, scanType, imported.Test)
+	}
+
+	if len(errs) > 0 {
+		return summary, fmt.Errorf("%d report(s) could not be imported into DefectDojo: %w", len(errs), errors.Join(errs...))
+	}
+	return summary, nil
+}
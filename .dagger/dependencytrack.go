@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DependencyTrackResult is the outcome of an SBOM upload to Dependency-Track
+type DependencyTrackResult struct {
+	Project string
+	Version string
+	// Upload token, for looking up the BOM processing event
+	Token string
+	// Project metrics after the BOM was processed (only when waited for)
+	Critical                int
+	High                    int
+	PolicyViolationsFail    int
+	PolicyViolationsWarn    int
+	PolicyViolationsInfo    int
+	InheritedRiskScore      float64
+	ProcessedBeforeDeadline bool
+}
+
+// text renders the result for pipeline reports
+func (r *DependencyTrackResult) text() string {
+	text := fmt.Sprintf("📤 SBOM uploaded to Dependency-Track as %s %s\n", r.Project, r.Version)
+	if r.ProcessedBeforeDeadline {
+		text += fmt.Sprintf("   %d critical, %d high vulnerabilities; policy violations: %d fail, %d warn, %d info\n",
+			r.Critical, r.High, r.PolicyViolationsFail, r.PolicyViolationsWarn, r.PolicyViolationsInfo)
+	}
+	return text
+}
+
+// dependencyTrack calls the Dependency-Track REST API with an API key
+type dependencyTrack struct {
+	url    string
+	apiKey *dagger.Secret
+}
+
+// request calls an API endpoint and decodes the JSON response into out, if given
+func (d dependencyTrack) request(ctx context.Context, method, path, body string, out any) error {
+	response, err := httpRequest{
+		method:     method,
+		url:        strings.TrimSuffix(d.url, "/") + path,
+		headers:    []string{"Content-Type: application/json"},
+		body:       body,
+		token:      d.apiKey,
+		authPrefix: "X-Api-Key:",
+	}.do(ctx)
+	if err != nil {
+		return fmt.Errorf("Dependency-Track %s %s failed: %w", method, path, err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(response), out); err != nil {
+		return fmt.Errorf("invalid Dependency-Track response to %s: %w", path, err)
+	}
+	return nil
+}
+
+// waitForBom polls the BOM processing event until Dependency-Track has analyzed the
+// upload, returning false when the deadline passes first
+func (d dependencyTrack) waitForBom(ctx context.Context, token string, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var event struct {
+			Processing bool `json:"processing"`
+		}
+		if err := d.request(ctx, "GET", "/api/v1/event/token/"+token, "", &event); err != nil {
+			return false, err
+		}
+		if !event.Processing {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// uploadToDependencyTrack uploads a CycloneDX SBOM, creating the project version when
+// it doesn't exist, and with a timeout waits for the analysis to read the project's
+// vulnerability and policy violation metrics
+func uploadToDependencyTrack(ctx context.Context, d dependencyTrack, sbom, project, version string, timeout time.Duration) (*DependencyTrackResult, error) {
+	payload, err := json.Marshal(map[string]any{
+		"projectName":    project,
+		"projectVersion": version,
+		"autoCreate":     true,
+		"bom":            base64.StdEncoding.EncodeToString([]byte(sbom)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var upload struct {
+		Token string `json:"token"`
+	}
+	if err := d.request(ctx, "PUT", "/api/v1/bom", string(payload), &upload); err != nil {
+		return nil, err
+	}
+	result := &DependencyTrackResult{Project: project, Version: version, Token: upload.Token}
+	if timeout <= 0 {
+		return result, nil
+	}
+
+	processed, err := d.waitForBom(ctx, upload.Token, timeout)
+	if err != nil || !processed {
+		return result, err
+	}
+	var lookup struct {
+		Uuid string `json:"uuid"`
+	}
+	query := url.Values{"name": {project}, "version": {version}}
+	if err := d.request(ctx, "GET", "/api/v1/project/lookup?"+query.Encode(), "", &lookup); err != nil {
+		return result, err
+	}
+	// Metrics are recalculated on a schedule; refresh them for the new BOM
+	if err := d.request(ctx, "GET", "/api/v1/metrics/project/"+lookup.Uuid+"/refresh", "", nil); err != nil {
+		return result, err
+	}
+	var metrics struct {
+		Critical             int     `json:"critical"`
+		High                 int     `json:"high"`
+		PolicyViolationsFail int     `json:"policyViolationsFail"`
+		PolicyViolationsWarn int     `json:"policyViolationsWarn"`
+		PolicyViolationsInfo int     `json:"policyViolationsInfo"`
+		InheritedRiskScore   float64 `json:"inheritedRiskScore"`
+	}
+	if err := d.request(ctx, "GET", "/api/v1/metrics/project/"+lookup.Uuid+"/current", "", &metrics); err != nil {
+		return result, err
+	}
+	result.ProcessedBeforeDeadline = true
+	result.Critical, result.High = metrics.Critical, metrics.High
+	result.PolicyViolationsFail, result.PolicyViolationsWarn, result.PolicyViolationsInfo = metrics.PolicyViolationsFail, metrics.PolicyViolationsWarn, metrics.PolicyViolationsInfo
+	result.InheritedRiskScore = metrics.InheritedRiskScore
+	return result, nil
+}
+
+// UploadSbomToDependencyTrack uploads a CycloneDX SBOM to a Dependency-Track project
+// version, creating it when needed. With waitSeconds it waits for the analysis and
+// reports the project's metrics; failOnViolations then fails on policy violations
+// of the FAIL state, so Dependency-Track's policies can gate the pipeline
+func (m *SearchApi) UploadSbomToDependencyTrack(
+	ctx context.Context,
+	// CycloneDX SBOM (JSON or XML), e.g. from Syft with the cyclonedx-json format
+	sbom string,
+	// Dependency-Track API server URL (e.g., "https://dtrack.example.com")
+	url string,
+	// API key of a team with the BOM_UPLOAD and PROJECT_CREATION_UPLOAD permissions
+	apiKey *dagger.Secret,
+	// +default="search-api"
+	projectName string,
+	// Project version (e.g., from ComputeVersion)
+	projectVersion string,
+	// Seconds to wait for the analysis before reading the metrics; 0 only uploads
+	// +optional
+	waitSeconds int,
+	// Fail on FAIL-state policy violations (needs waitSeconds)
+	// +optional
+	failOnViolations bool,
+) (*DependencyTrackResult, error) {
+	if failOnViolations && waitSeconds <= 0 {
+		return nil, fmt.Errorf("failOnViolations needs waitSeconds to wait for the analysis")
+	}
+	result, err := uploadToDependencyTrack(ctx, dependencyTrack{url: url, apiKey: apiKey}, sbom, projectName, projectVersion, time.Duration(waitSeconds)*time.Second)
+	if err != nil {
+		return result, err
+	}
+	if failOnViolations {
+		if !result.ProcessedBeforeDeadline {
+			return result, fmt.Errorf("Dependency-Track did not analyze the SBOM within %ds", waitSeconds)
+		}
+		if result.PolicyViolationsFail > 0 {
+			return result, fmt.Errorf("❌ BLOCKED - %d Dependency-Track policy violation(s) in %s %s", result.PolicyViolationsFail, projectName, projectVersion)
+		}
+	}
+	return result, nil
+}
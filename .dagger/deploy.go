@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// kubectlImage runs kubectl against the target cluster
+const kubectlImage = "alpine/k8s:1.30.4"
+
+// manifestImage matches the image placeholder in k8s/api-deployment.yaml
+var manifestImage = regexp.MustCompile(`image: \$\{REGISTRY\}/search-api:\$\{TAG\}`)
+
+// DeploymentStatus is the state of the API deployment after Deploy
+type DeploymentStatus struct {
+	Namespace string
+	// Deployment name
+	Name string
+	// Image the pods run
+	Image string
+	// Deployment revision (increases with every rollout)
+	Revision string
+	// Desired, updated, ready and available replicas
+	Replicas  int
+	Updated   int
+	Ready     int
+	Available int
+	// helm or kubectl output of the rollout
+	Output string
+}
+
+// splitImageRef splits an image reference into its repository and either its tag or
+// its digest
+func splitImageRef(imageRef string) (repository, tag, digest string) {
+	if repository, digest, ok := strings.Cut(imageRef, "@"); ok {
+		return repository, "", digest
+	}
+	if i := strings.LastIndex(imageRef, ":"); i > strings.LastIndex(imageRef, "/") {
+		return imageRef[:i], imageRef[i+1:], ""
+	}
+	return imageRef, "latest", ""
+}
+
+// kubectl is a kubectl container using the kubeconfig, never served from cache
+func kubectl(kubeconfig *dagger.Secret) *dagger.Container {
+	return dag.Container().
+		From(kubectlImage).
+		WithMountedSecret("/root/.kube/config", kubeconfig).
+		WithEnvVariable("CACHEBUSTER", time.Now().String())
+}
+
+// deploymentStatus reads the rolled out deployment
+func deploymentStatus(ctx context.Context, kubeconfig *dagger.Secret, namespace, name string) (*DeploymentStatus, error) {
+	output, err := kubectl(kubeconfig).
+		WithExec([]string{"kubectl", "get", "deployment", name, "--namespace", namespace, "--output", "json"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployment %s: %w", name, err)
+	}
+	var deployment struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Image string `json:"image"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+		Status struct {
+			Replicas          int `json:"replicas"`
+			UpdatedReplicas   int `json:"updatedReplicas"`
+			ReadyReplicas     int `json:"readyReplicas"`
+			AvailableReplicas int `json:"availableReplicas"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(output), &deployment); err != nil {
+		return nil, fmt.Errorf("invalid deployment %s: %w", name, err)
+	}
+
+	status := &DeploymentStatus{
+		Namespace: namespace,
+		Name:      name,
+		Revision:  deployment.Metadata.Annotations["deployment.kubernetes.io/revision"],
+		Replicas:  deployment.Status.Replicas,
+		Updated:   deployment.Status.UpdatedReplicas,
+		Ready:     deployment.Status.ReadyReplicas,
+		Available: deployment.Status.AvailableReplicas,
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		status.Image = containers[0].Image
+	}
+	return status, nil
+}
+
+// Deploy rolls the API out to a Kubernetes cluster and waits until it's ready, so
+// the pipeline can go all the way to a dev or staging cluster
+// The helm method upgrades the release from the chart (rolled back if it doesn't
+// become ready); the manifests method applies k8s/api-deployment.yaml. Solr is
+// expected to run in the cluster already
+func (m *SearchApi) Deploy(
+	ctx context.Context,
+	// Kubeconfig of the target cluster
+	kubeconfig *dagger.Secret,
+	// Namespace to deploy to
+	// +default="search-system"
+	namespace string,
+	// Image to deploy, by tag or digest (e.g., "ghcr.io/myorg/search-api@sha256:...")
+	imageRef string,
+	// Repository with the chart and manifests
+	// +defaultPath="/"
+	source *dagger.Directory,
+	// helm or manifests
+	// +default="helm"
+	method string,
+	// Chart directory within the source
+	// +default="helm/search-api"
+	chartDir string,
+	// Release (and deployment) name
+	// +default="search-api"
+	releaseName string,
+	// How long to wait for the rollout
+	// +default="5m"
+	timeout string,
+) (*DeploymentStatus, error) {
+	repository, tag, digest := splitImageRef(imageRef)
+	deploymentName := releaseName
+
+	var output string
+	var err error
+	switch method {
+	case "helm":
+		output, err = dag.Helm().Upgrade(ctx, source.Directory(chartDir), releaseName, namespace, kubeconfig, dagger.HelmUpgradeOpts{
+			Set:     []string{"image.repository=" + repository, "image.tag=" + tag, "image.digest=" + digest},
+			Timeout: timeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("helm upgrade failed: %w", err)
+		}
+	case "manifests":
+		manifest, err := source.File("k8s/api-deployment.yaml").Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read k8s/api-deployment.yaml: %w", err)
+		}
+		if !manifestImage.MatchString(manifest) {
+			return nil, fmt.Errorf("k8s/api-deployment.yaml has no ${REGISTRY}/search-api:${TAG} image to replace")
+		}
+		manifest = manifestImage.ReplaceAllLiteralString(manifest, "image: "+imageRef)
+		manifest = strings.ReplaceAll(manifest, "namespace: search-system", "namespace: "+namespace)
+		deploymentName = "search-api"
+
+		output, err = kubectl(kubeconfig).
+			WithNewFile("/work/api-deployment.yaml", manifest).
+			WithExec([]string{"sh", "-c", `set -e
+kubectl create namespace "$0" --dry-run=client --output yaml | kubectl apply --filename -
+kubectl apply --filename /work/api-deployment.yaml
+kubectl rollout status deployment/search-api --namespace "$0" --timeout "$1"`, namespace, timeout}).
+			Stdout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("rollout failed: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid method %q: expected helm or manifests", method)
+	}
+
+	status, err := deploymentStatus(ctx, kubeconfig, namespace, deploymentName)
+	if err != nil {
+		return nil, err
+	}
+	status.Output = output
+	if status.Ready < status.Replicas {
+		return status, fmt.Errorf("deployment %s has %d of %d replicas ready", deploymentName, status.Ready, status.Replicas)
+	}
+	return status, nil
+}
+
+// GetDeployedDigest looks up the last known-good release: the digest a tag that is
+// only moved after a deployment passed its smoke test (e.g., with RetagImage) points
+// at, returned as the image pinned by that digest for Rollback
+func (m *SearchApi) GetDeployedDigest(
+	ctx context.Context,
+	// Registry URL (e.g., "ghcr.io"); prefixed to repo unless it already includes it
+	registryUrl string,
+	// Image repository (e.g., "ghcr.io/myorg/search-api" or "myorg/search-api")
+	repo string,
+	// Tag recording the last known-good release
+	// +default="known-good"
+	tag string,
+	// +optional
+	username *dagger.Secret,
+	// +optional
+	password *dagger.Secret,
+) (string, error) {
+	repository := repo
+	if registryUrl != "" && !strings.HasPrefix(repo, registryUrl+"/") {
+		repository = registryUrl + "/" + repo
+	}
+	login, err := registryCredentials(ctx, repository, username, password)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	if login != nil {
+		name = login.username
+	}
+	digest, err := remoteTagDigest(ctx, repository+":"+tag, name, password)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return "", fmt.Errorf("%s:%s doesn't exist; no known-good release recorded", repository, tag)
+	}
+	return repository + "@" + digest, nil
+}
+
+// Rollback points the API deployment back at a previous image, pinned by digest, and
+// waits for the rollout, e.g. when the smoke test after Deploy fails
+// The image is set on the deployment directly; a later helm upgrade replaces it
+func (m *SearchApi) Rollback(
+	ctx context.Context,
+	// Kubeconfig of the target cluster
+	kubeconfig *dagger.Secret,
+	// Last known-good image pinned by digest (e.g., from GetDeployedDigest)
+	previousDigest string,
+	// +default="search-system"
+	namespace string,
+	// Deployment name
+	// +default="search-api"
+	deployment string,
+	// How long to wait for the rollout
+	// +default="5m"
+	timeout string,
+) (*DeploymentStatus, error) {
+	if _, _, digest := splitImageRef(previousDigest); !digestPattern.MatchString(digest) {
+		return nil, fmt.Errorf("%q must be an image pinned by digest (repository@sha256:...)", previousDigest)
+	}
+
+	output, err := kubectl(kubeconfig).
+		WithExec([]string{"sh", "-c", `set -e
+kubectl set image "deployment/$1" "*=$2" --namespace "$0"
+kubectl annotate "deployment/$1" kubernetes.io/change-cause="rollback to $2" --overwrite --namespace "$0"
+kubectl rollout status "deployment/$1" --namespace "$0" --timeout "$3"`, namespace, deployment, previousDigest, timeout}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rollback of %s failed: %w", deployment, err)
+	}
+
+	status, err := deploymentStatus(ctx, kubeconfig, namespace, deployment)
+	if err != nil {
+		return nil, err
+	}
+	status.Output = output
+	if status.Image != previousDigest {
+		return status, fmt.Errorf("deployment %s runs %s after the rollback, not %s", deployment, status.Image, previousDigest)
+	}
+	if status.Ready < status.Replicas {
+		return status, fmt.Errorf("deployment %s has %d of %d replicas ready", deployment, status.Ready, status.Replicas)
+	}
+	return status, nil
+}
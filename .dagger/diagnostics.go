@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"time"
+)
+
+// Components whose logs are kept for a pipeline run, each in its own cache volume
+// so the API, Solr and proxy users can all own the directory they write to
+var diagnosticsParts = []string{"integration-api", "integration-solr", "dast-api", "dast-solr", "dast-har"}
+
+// failureDiagnostics collects service-side logs for one pipeline run
+// Services write straight into cache volumes, because a service's own filesystem and
+// output are gone once Dagger stops it. Every run reuses the same volumes and clears
+// them first, so they hold the logs of the latest run
+type failureDiagnostics struct {
+	run string
+}
+
+func newFailureDiagnostics() *failureDiagnostics {
+	return &failureDiagnostics{run: time.Now().UTC().Format("20060102T150405.000Z")}
+}
+
+func diagnosticsVolume(part string) *dagger.CacheVolume {
+	return dag.CacheVolume("search-api-diagnostics-" + part)
+}
+
+// withDiagnosticsVolumes mounts the volume of every part under /volumes
+func withDiagnosticsVolumes(container *dagger.Container) *dagger.Container {
+	for _, part := range diagnosticsParts {
+		container = container.WithMountedCache("/volumes/"+part, diagnosticsVolume(part))
+	}
+	return container
+}
+
+// clear removes the previous run's logs and marks the volumes with this run's ID
+// The volumes are left writable by everyone, since the API, Solr and proxy each
+// write to theirs as a different user
+func (d *failureDiagnostics) clear(ctx context.Context) error {
+	_, err := withDiagnosticsVolumes(dag.Container().From("alpine:latest")).
+		WithEnvVariable("RUN", d.run).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", `for dir in /volumes/*; do find "$dir" -mindepth 1 -delete && chmod 0777 "$dir" && echo "$RUN" > "$dir/run"; done`}).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to clear failure diagnostics: %w", err)
+	}
+	return nil
+}
+
+// apiService starts the API and a Solr restored from snapshot (empty when nil), with
+// the API's Serilog output also written to a file and Solr logging to the volume
+func (d *failureDiagnostics) apiService(ctx context.Context, container *dagger.Container, snapshot *dagger.Directory, stage string) (*dagger.Service, error) {
+	user, err := container.User(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API container user: %w", err)
+	}
+
+	// Index 1 keeps the Console sink from appsettings.json at index 0
+	api := container.
+		WithMountedCache("/diagnostics", diagnosticsVolume(stage+"-api"), dagger.ContainerWithMountedCacheOpts{
+			Owner: user,
+		}).
+		WithEnvVariable("Serilog__Using__1", "Serilog.Sinks.File").
+		WithEnvVariable("Serilog__WriteTo__1__Name", "File").
+		WithEnvVariable("Serilog__WriteTo__1__Args__path", "/diagnostics/api.log")
+
+	solr := solrContainer(defaultSolrVersion, snapshot, stage).
+		WithMountedCache("/diagnostics", diagnosticsVolume(stage+"-solr"), dagger.ContainerWithMountedCacheOpts{
+			Owner: "solr",
+		}).
+		WithEnvVariable("SOLR_LOGS_DIR", "/diagnostics")
+
+	return apiWithSolr(api, solr.AsService()), nil
+}
+
+// recordingProxy puts a reverse proxy in front of the API that records all traffic;
+// the HAR file is written when the proxy is stopped
+func (d *failureDiagnostics) recordingProxy(apiService *dagger.Service) *dagger.Service {
+	return dag.Container().
+		From(mitmproxyImage).
+		WithServiceBinding("api", apiService).
+		WithMountedCache("/diagnostics", diagnosticsVolume("dast-har")).
+		WithExposedPort(8080).
+		AsService(dagger.ContainerAsServiceOpts{Args: []string{
+			"mitmdump", "--mode", "reverse:http://api:8080", "--listen-port", "8080",
+			"--set", "hardump=/diagnostics/dast.har",
+		}})
+}
+
+// attach adds the logs to the pipeline's reports as diagnostics/ and tells the user
+// where to find them; they're copied out of the volumes when the reports are read,
+// after the recording proxy has stopped and written its HAR
+func (d *failureDiagnostics) attach(m *SearchApi, run *pipelineRun) {
+	run.attachDirectory("diagnostics", m.FailureDiagnostics(d.run))
+	run.log(d.summary())
+}
+
+// summary tells the user how to retrieve the diagnostics
+func (d *failureDiagnostics) summary() string {
+	return fmt.Sprintf("🩺 Failure diagnostics (API/Solr logs) of run %s attached to the reports as diagnostics/\n"+
+		"   Or export them with: dagger call failure-diagnostics --run=%s export --path=./diagnostics\n", d.run, d.run)
+}
+
+// FailureDiagnostics returns the logs FullPipeline kept for a run whose integration
+// tests or DAST failed: API and Solr logs per stage, and the recorded DAST traffic
+// (dast-har/dast.har) when captureDastHar was enabled. Only the latest run's logs
+// are kept; an earlier run's ID fails
+func (m *SearchApi) FailureDiagnostics(
+	// Run ID printed by FullPipeline
+	run string,
+) *dagger.Directory {
+	// Cache mounts aren't part of the container filesystem, so copy them out
+	return withDiagnosticsVolumes(dag.Container().From("alpine:latest")).
+		WithEnvVariable("RUN", run).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", `for dir in /volumes/*; do
+  [ "$(cat "$dir/run" 2>/dev/null)" = "$RUN" ] || { echo "no diagnostics for run $RUN; only the latest run's are kept" >&2; exit 1; }
+done
+mkdir -p /out && cp -R /volumes/. /out/`}).
+		Directory("/out")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default file names in the threat intel directory, matching the upstream downloads:
+// https://epss.cyentia.com/epss_scores-current.csv.gz
+// https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json
+const (
+	epssFile = "epss_scores-current.csv"
+	kevFile  = "known_exploited_vulnerabilities.json"
+)
+
+// downloadThreatIntel fetches the current EPSS scores and CISA KEV catalog under
+// their default names; both change daily, so the download is never served from cache
+func downloadThreatIntel() *dagger.Directory {
+	return dag.Container().
+		From(curlImage).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithWorkdir("/tmp/intel").
+		WithExec([]string{"sh", "-c", `set -e
+curl -sSfL https://epss.cyentia.com/epss_scores-current.csv.gz -o ` + epssFile + `.gz
+curl -sSfL https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json -o ` + kevFile}).
+		Directory("/tmp/intel")
+}
+
+// DownloadThreatIntel downloads the EPSS scores and the CISA KEV catalog, as the
+// offline snapshot EnrichFindings and SecurityGate read
+func (m *SearchApi) DownloadThreatIntel() *dagger.Directory {
+	return downloadThreatIntel()
+}
+
+// epssScore is the exploit prediction for a single CVE
+type epssScore struct {
+	probability float64
+	percentile  float64
+}
+
+// exploitData holds the offline EPSS and KEV datasets, keyed by upper-case CVE ID
+type exploitData struct {
+	epss map[string]epssScore
+	kev  map[string]bool
+}
+
+// loadThreatIntel reads the EPSS CSV (optionally gzipped) and the CISA KEV catalog
+// Either file may be missing; findings then simply lack that signal
+func loadThreatIntel(ctx context.Context, dir *dagger.Directory) (*exploitData, error) {
+	intel := &exploitData{epss: map[string]epssScore{}, kev: map[string]bool{}}
+
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list threat intel directory: %w", err)
+	}
+
+	for _, name := range entries {
+		switch name {
+		case epssFile, epssFile + ".gz":
+			content, err := dir.File(name).Contents(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			var r io.Reader = strings.NewReader(content)
+			if strings.HasSuffix(name, ".gz") {
+				if r, err = gzip.NewReader(bytes.NewReader([]byte(content))); err != nil {
+					return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+				}
+			}
+			if intel.epss, err = parseEpss(r); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+		case kevFile:
+			content, err := dir.File(name).Contents(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if intel.kev, err = parseKev(content); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+		}
+	}
+	return intel, nil
+}
+
+// parseEpss reads the EPSS CSV export ("#model_version..." comment, then cve,epss,percentile)
+func parseEpss(r io.Reader) (map[string]epssScore, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	scores := map[string]epssScore{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return scores, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 || record[0] == "cve" {
+			continue
+		}
+		probability, err1 := strconv.ParseFloat(record[1], 64)
+		percentile, err2 := strconv.ParseFloat(record[2], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		scores[strings.ToUpper(record[0])] = epssScore{probability: probability, percentile: percentile}
+	}
+}
+
+// parseKev reads the CISA Known Exploited Vulnerabilities catalog
+func parseKev(content string) (map[string]bool, error) {
+	var catalog struct {
+		Vulnerabilities []struct {
+			CveID string `json:"cveID"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal([]byte(content), &catalog); err != nil {
+		return nil, err
+	}
+
+	kev := map[string]bool{}
+	for _, v := range catalog.Vulnerabilities {
+		kev[strings.ToUpper(v.CveID)] = true
+	}
+	return kev, nil
+}
+
+// severityWeight is the contribution of the scanner's severity label to the risk score
+var severityWeight = map[string]float64{
+	"CRITICAL": 1.0,
+	"HIGH":     0.75,
+	"MEDIUM":   0.5,
+	"LOW":      0.25,
+	"INFO":     0,
+}
+
+// riskScore computes a normalized 0-10 risk score
+// Severity contributes up to 6 points and EPSS percentile up to 4; findings without
+// EPSS data (code findings, non-CVE advisories) get a neutral percentile of 0.5.
+// Membership in CISA KEV means active exploitation and adds 3 points.
+func riskScore(f Finding) float64 {
+	percentile := 0.5
+	if f.EpssPercentile > 0 || f.Epss > 0 {
+		percentile = f.EpssPercentile
+	}
+
+	score := 6*severityWeight[f.Severity] + 4*percentile
+	if f.Kev {
+		score += 3
+	}
+	return math.Round(math.Min(score, 10)*10) / 10
+}
+
+// enrich adds EPSS/KEV data and the risk score to findings
+func (t *exploitData) enrich(findings []Finding) []Finding {
+	enriched := make([]Finding, len(findings))
+	for i, f := range findings {
+		id := strings.ToUpper(f.RuleID)
+		if score, ok := t.epss[id]; ok {
+			f.Epss = score.probability
+			f.EpssPercentile = score.percentile
+		}
+		f.Kev = t.kev[id]
+		f.RiskScore = riskScore(f)
+		enriched[i] = f
+	}
+
+	// Most urgent first
+	slices.SortStableFunc(enriched, func(a, b Finding) int {
+		switch {
+		case a.RiskScore > b.RiskScore:
+			return -1
+		case a.RiskScore < b.RiskScore:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return enriched
+}
+
+// EnrichFindings augments deduplicated findings with EPSS scores, CISA KEV
+// membership and a normalized risk score, ordered from highest to lowest risk
+func (m *SearchApi) EnrichFindings(
+	ctx context.Context,
+	// Directory of scan reports (e.g., output of ExportPipelineReports)
+	reports *dagger.Directory,
+	// Offline threat intel: epss_scores-current.csv[.gz] and known_exploited_vulnerabilities.json
+	threatIntel *dagger.Directory,
+) ([]*Finding, error) {
+	findings, err := collectFindings(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+	intel, err := loadThreatIntel(ctx, threatIntel)
+	if err != nil {
+		return nil, err
+	}
+
+	enriched := intel.enrich(findings)
+	result := make([]*Finding, len(enriched))
+	for i := range enriched {
+		result[i] = &enriched[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"dagger/search-api/internal/dagger"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Finding is a single security finding normalized across scanners
+type Finding struct {
+	// Stable identifier used to track the finding across runs
+	Fingerprint string
+	// Scanner that reported the finding (e.g., "trivy", "semgrep")
+	Tool string
+	// Rule or vulnerability ID (e.g., "CVE-2024-1234", "csharp.lang.security.xss")
+	RuleID string
+	// CWE identifier (e.g., "CWE-79"), if the scanner provides one
+	CWE string
+	// Normalized severity: CRITICAL, HIGH, MEDIUM, LOW or INFO
+	Severity string
+	// Short human-readable title
+	Title string
+	// Longer description, if the scanner provides one
+	Description string
+	// File path or scan target the finding was reported for
+	Location string
+	// Line number within Location (0 when not applicable)
+	Line int
+	// Affected package, for dependency findings
+	Package string
+	// Installed version of the affected package
+	Version string
+	// Version that fixes the finding, if known
+	FixedVersion string
+	// Reference URL with more information
+	URL string
+	// All scanners that reported this finding after deduplication
+	Sources []string
+	// EPSS probability of exploitation in the next 30 days (0-1), when enriched
+	Epss float64
+	// EPSS percentile (0-1), when enriched
+	EpssPercentile float64
+	// Listed in the CISA Known Exploited Vulnerabilities catalog, when enriched
+	Kev bool
+	// Normalized 0-10 risk score combining severity and exploitability, when enriched
+	RiskScore float64
+}
+
+// severityRank orders normalized severities from least to most severe
+var severityRank = map[string]int{
+	"INFO":     0,
+	"LOW":      1,
+	"MEDIUM":   2,
+	"HIGH":     3,
+	"CRITICAL": 4,
+}
+
+// normalizeSeverity maps scanner-specific severity labels onto the pipeline's scale
+func normalizeSeverity(severity string) string {
+	switch strings.ToUpper(strings.TrimSpace(severity)) {
+	case "CRITICAL":
+		return "CRITICAL"
+	case "HIGH", "ERROR":
+		return "HIGH"
+	case "MEDIUM", "MODERATE", "WARNING":
+		return "MEDIUM"
+	case "LOW", "NOTE":
+		return "LOW"
+	default:
+		return "INFO"
+	}
+}
+
+// severityFromScore maps a CVSS-style 0-10 score onto a normalized severity
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9.0:
+		return "CRITICAL"
+	case score >= 7.0:
+		return "HIGH"
+	case score >= 4.0:
+		return "MEDIUM"
+	case score > 0:
+		return "LOW"
+	default:
+		return "INFO"
+	}
+}
+
+// containsSeverity reports whether severity is in the given list (case-insensitive)
+func containsSeverity(severities []string, severity string) bool {
+	for _, s := range severities {
+		if normalizeSeverity(s) == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprint derives a stable ID from the parts that identify a finding
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(parts, "|"))))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+var (
+	cvePattern = regexp.MustCompile(`(?i)^CVE-\d{4}-\d+$`)
+	cwePattern = regexp.MustCompile(`(?i)CWE-(\d+)`)
+)
+
+// normalizeCWE extracts "CWE-<n>" from labels such as "CWE-79: Improper Neutralization..."
+func normalizeCWE(label string) string {
+	if match := cwePattern.FindStringSubmatch(label); match != nil {
+		return "CWE-" + match[1]
+	}
+	return ""
+}
+
+// normalizeLocation strips scanner-specific path prefixes so paths compare equal
+func normalizeLocation(location string) string {
+	location = strings.TrimPrefix(location, "file://")
+	location = strings.TrimPrefix(location, "/src/")
+	return strings.TrimPrefix(location, "./")
+}
+
+// preferCVE returns the CVE among a vulnerability's aliases, since scanners disagree
+// on whether to report GHSA or CVE identifiers for the same advisory
+func preferCVE(id string, aliases ...string) string {
+	if cvePattern.MatchString(id) {
+		return strings.ToUpper(id)
+	}
+	for _, alias := range aliases {
+		if cvePattern.MatchString(alias) {
+			return strings.ToUpper(alias)
+		}
+	}
+	return id
+}
+
+// withFingerprint fills in the fingerprint of a finding
+// The key identifies the underlying issue rather than the report it came from:
+// dependency findings by vulnerability + package, code findings by CWE (or rule)
+// + location, so the same issue from different scanners collapses into one
+func withFingerprint(f Finding) Finding {
+	f.Location = normalizeLocation(f.Location)
+	if len(f.Sources) == 0 {
+		f.Sources = []string{f.Tool}
+	}
+
+	switch {
+	case f.Package != "":
+		f.Fingerprint = fingerprint(f.RuleID, f.Package, f.Version)
+	case f.CWE != "":
+		f.Fingerprint = fingerprint(f.CWE, f.Location, strconv.Itoa(f.Line))
+	default:
+		f.Fingerprint = fingerprint(f.RuleID, f.Location, strconv.Itoa(f.Line))
+	}
+	return f
+}
+
+// dedupeFindings merges findings that share a fingerprint
+// The merged finding keeps the highest severity, the union of reporting scanners
+// and the first non-empty value of every descriptive field
+func dedupeFindings(findings []Finding) []Finding {
+	index := map[string]int{}
+	var merged []Finding
+	for _, f := range findings {
+		i, ok := index[f.Fingerprint]
+		if !ok {
+			index[f.Fingerprint] = len(merged)
+			merged = append(merged, f)
+			continue
+		}
+
+		m := &merged[i]
+		if severityRank[f.Severity] > severityRank[m.Severity] {
+			m.Severity = f.Severity
+		}
+		for _, source := range f.Sources {
+			if !slices.Contains(m.Sources, source) {
+				m.Sources = append(m.Sources, source)
+			}
+		}
+		for _, field := range []struct {
+			dst *string
+			src string
+		}{
+			{&m.Title, f.Title},
+			{&m.Description, f.Description},
+			{&m.CWE, f.CWE},
+			{&m.FixedVersion, f.FixedVersion},
+			{&m.URL, f.URL},
+		} {
+			if *field.dst == "" {
+				*field.dst = field.src
+			}
+		}
+	}
+	return merged
+}
+
+// reportFormat detects the format of a scan report: sarif, trivy, grype,
+// dependency-check, semgrep, checkov, zap or nuclei ("" when it isn't a scan report)
+func reportFormat(content string) string {
+	// Nuclei writes one JSON result per line
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(firstLine), &probe); err == nil && probe["template-id"] != nil {
+		return "nuclei"
+	}
+	// Checkov reports a list when it scans several frameworks
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &list); err == nil {
+		if len(list) > 0 && list[0]["check_type"] != nil {
+			return "checkov"
+		}
+		return ""
+	}
+	probe = nil
+	if err := json.Unmarshal([]byte(content), &probe); err != nil {
+		return ""
+	}
+
+	switch {
+	case probe["runs"] != nil:
+		return "sarif"
+	case probe["Results"] != nil || probe["ArtifactName"] != nil:
+		return "trivy"
+	case probe["matches"] != nil:
+		return "grype"
+	case probe["dependencies"] != nil && probe["reportSchema"] != nil:
+		return "dependency-check"
+	case probe["results"] != nil && probe["errors"] != nil:
+		return "semgrep"
+	case probe["check_type"] != nil:
+		return "checkov"
+	case probe["site"] != nil:
+		return "zap"
+	default:
+		return ""
+	}
+}
+
+// parseFindings detects the report format and extracts normalized findings
+// Reports in formats that carry no findings (SBOMs, plain text) yield nil
+func parseFindings(content string) ([]Finding, error) {
+	switch reportFormat(content) {
+	case "sarif":
+		return parseSarifFindings(content)
+	case "trivy":
+		return parseTrivyFindings(content)
+	case "grype":
+		return parseGrypeFindings(content)
+	case "dependency-check":
+		return parseDependencyCheckFindings(content)
+	case "semgrep":
+		return parseSemgrepFindings(content)
+	case "checkov":
+		return parseCheckovFindings(content)
+	case "zap":
+		return parseZapFindings(content)
+	case "nuclei":
+		return parseNucleiFindings(content)
+	default:
+		return nil, nil
+	}
+}
+
+// parseSarifFindings extracts findings from a SARIF 2.1.0 document
+func parseSarifFindings(content string) ([]Finding, error) {
+	log, err := parseSarif(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, run := range log.Runs {
+		rules := map[string]sarifRule{}
+		for _, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = rule
+		}
+
+		for _, result := range run.Results {
+			f := Finding{
+				Tool:        strings.ToLower(run.Tool.Driver.Name),
+				RuleID:      result.RuleID,
+				Severity:    normalizeSeverity(result.Level),
+				Title:       result.RuleID,
+				Description: result.Message.Text,
+			}
+			if rule, ok := rules[result.RuleID]; ok {
+				if rule.ShortDescription != nil && rule.ShortDescription.Text != "" {
+					f.Title = rule.ShortDescription.Text
+				}
+				f.URL = rule.HelpURI
+				// GitHub's security-severity property is more precise than the level
+				var props struct {
+					SecuritySeverity string   `json:"security-severity"`
+					Tags             []string `json:"tags"`
+				}
+				if json.Unmarshal(rule.Properties, &props) == nil {
+					if score, err := strconv.ParseFloat(props.SecuritySeverity, 64); err == nil {
+						f.Severity = severityFromScore(score)
+					}
+					for _, tag := range props.Tags {
+						if cwe := normalizeCWE(tag); cwe != "" {
+							f.CWE = cwe
+							break
+						}
+					}
+				}
+			}
+			if len(result.Locations) > 0 {
+				loc := result.Locations[0].PhysicalLocation
+				f.Location = loc.ArtifactLocation.URI
+				if loc.Region != nil {
+					f.Line = loc.Region.StartLine
+				}
+			}
+			findings = append(findings, withFingerprint(f))
+		}
+	}
+	return findings, nil
+}
+
+// trivyReport is the subset of Trivy's JSON report format the pipeline reads
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string   `json:"VulnerabilityID"`
+			PkgName          string   `json:"PkgName"`
+			InstalledVersion string   `json:"InstalledVersion"`
+			FixedVersion     string   `json:"FixedVersion"`
+			Severity         string   `json:"Severity"`
+			Title            string   `json:"Title"`
+			Description      string   `json:"Description"`
+			PrimaryURL       string   `json:"PrimaryURL"`
+			CweIDs           []string `json:"CweIDs"`
+		} `json:"Vulnerabilities"`
+		Misconfigurations []struct {
+			ID         string `json:"ID"`
+			Title      string `json:"Title"`
+			Message    string `json:"Message"`
+			Severity   string `json:"Severity"`
+			PrimaryURL string `json:"PrimaryURL"`
+		} `json:"Misconfigurations"`
+		Secrets []struct {
+			RuleID    string `json:"RuleID"`
+			Title     string `json:"Title"`
+			Severity  string `json:"Severity"`
+			StartLine int    `json:"StartLine"`
+		} `json:"Secrets"`
+		Licenses []struct {
+			Name     string `json:"Name"`
+			PkgName  string `json:"PkgName"`
+			Category string `json:"Category"`
+			Severity string `json:"Severity"`
+			FilePath string `json:"FilePath"`
+		} `json:"Licenses"`
+	} `json:"Results"`
+}
+
+// parseTrivyFindings extracts findings from a Trivy JSON report
+func parseTrivyFindings(content string) ([]Finding, error) {
+	var report trivyReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Trivy report: %w", err)
+	}
+
+	var findings []Finding
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			cwe := ""
+			if len(v.CweIDs) > 0 {
+				cwe = normalizeCWE(v.CweIDs[0])
+			}
+			findings = append(findings, withFingerprint(Finding{
+				Tool:         "trivy",
+				RuleID:       preferCVE(v.VulnerabilityID),
+				CWE:          cwe,
+				Severity:     normalizeSeverity(v.Severity),
+				Title:        v.Title,
+				Description:  v.Description,
+				Location:     result.Target,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				URL:          v.PrimaryURL,
+			}))
+		}
+		for _, c := range result.Misconfigurations {
+			findings = append(findings, withFingerprint(Finding{
+				Tool:        "trivy",
+				RuleID:      c.ID,
+				Severity:    normalizeSeverity(c.Severity),
+				Title:       c.Title,
+				Description: c.Message,
+				Location:    result.Target,
+				URL:         c.PrimaryURL,
+			}))
+		}
+		for _, s := range result.Secrets {
+			findings = append(findings, withFingerprint(Finding{
+				Tool:     "trivy",
+				RuleID:   s.RuleID,
+				Severity: normalizeSeverity(s.Severity),
+				Title:    s.Title,
+				Location: result.Target,
+				Line:     s.StartLine,
+			}))
+		}
+		for _, l := range result.Licenses {
+			location := l.FilePath
+			if location == "" {
+				location = result.Target
+			}
+			findings = append(findings, withFingerprint(Finding{
+				Tool:     "trivy",
+				RuleID:   "license:" + l.Name,
+				Severity: normalizeSeverity(l.Severity),
+				Title:    fmt.Sprintf("%s license (%s)", l.Name, l.Category),
+				Location: location,
+				Package:  l.PkgName,
+			}))
+		}
+	}
+	return findings, nil
+}
+
+// grypeReport is the subset of Grype's JSON report format the pipeline reads
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string   `json:"id"`
+			Severity    string   `json:"severity"`
+			Description string   `json:"description"`
+			DataSource  string   `json:"dataSource"`
+			URLs        []string `json:"urls"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		RelatedVulnerabilities []struct {
+			ID string `json:"id"`
+		} `json:"relatedVulnerabilities"`
+		Artifact struct {
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Locations []struct {
+				Path string `json:"path"`
+			} `json:"locations"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// parseGrypeFindings extracts findings from a Grype JSON report
+func parseGrypeFindings(content string) ([]Finding, error) {
+	var report grypeReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Grype report: %w", err)
+	}
+
+	var findings []Finding
+	for _, match := range report.Matches {
+		v := match.Vulnerability
+		var aliases []string
+		for _, related := range match.RelatedVulnerabilities {
+			aliases = append(aliases, related.ID)
+		}
+		f := Finding{
+			Tool:        "grype",
+			RuleID:      preferCVE(v.ID, aliases...),
+			Severity:    normalizeSeverity(v.Severity),
+			Title:       v.ID,
+			Description: v.Description,
+			Package:     match.Artifact.Name,
+			Version:     match.Artifact.Version,
+			URL:         v.DataSource,
+		}
+		if len(v.Fix.Versions) > 0 {
+			f.FixedVersion = strings.Join(v.Fix.Versions, ", ")
+		}
+		if len(match.Artifact.Locations) > 0 {
+			f.Location = match.Artifact.Locations[0].Path
+		}
+		findings = append(findings, withFingerprint(f))
+	}
+	return findings, nil
+}
+
+// dependencyCheckReport is the subset of OWASP Dependency-Check's JSON report the pipeline reads
+type dependencyCheckReport struct {
+	Dependencies []struct {
+		FileName string `json:"fileName"`
+		FilePath string `json:"filePath"`
+		Packages []struct {
+			ID string `json:"id"`
+		} `json:"packages"`
+		Vulnerabilities []struct {
+			Name        string   `json:"name"`
+			Severity    string   `json:"severity"`
+			Description string   `json:"description"`
+			Cwes        []string `json:"cwes"`
+			References  []struct {
+				URL string `json:"url"`
+			} `json:"references"`
+		} `json:"vulnerabilities"`
+	} `json:"dependencies"`
+}
+
+// parsePurl splits a package URL such as "pkg:nuget/Newtonsoft.Json@12.0.1" into name and version
+func parsePurl(purl string) (name, version string) {
+	purl = strings.TrimPrefix(purl, "pkg:")
+	if i := strings.Index(purl, "/"); i >= 0 {
+		purl = purl[i+1:]
+	}
+	purl, _, _ = strings.Cut(purl, "?")
+	name, version, _ = strings.Cut(purl, "@")
+	return name, version
+}
+
+// parseDependencyCheckFindings extracts findings from an OWASP Dependency-Check JSON report
+func parseDependencyCheckFindings(content string) ([]Finding, error) {
+	var report dependencyCheckReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Dependency-Check report: %w", err)
+	}
+
+	var findings []Finding
+	for _, dep := range report.Dependencies {
+		name, version := dep.FileName, ""
+		if len(dep.Packages) > 0 {
+			name, version = parsePurl(dep.Packages[0].ID)
+		}
+		for _, v := range dep.Vulnerabilities {
+			f := Finding{
+				Tool:        "dependency-check",
+				RuleID:      preferCVE(v.Name),
+				Severity:    normalizeSeverity(v.Severity),
+				Title:       v.Name,
+				Description: v.Description,
+				Location:    dep.FilePath,
+				Package:     name,
+				Version:     version,
+			}
+			if len(v.Cwes) > 0 {
+				f.CWE = normalizeCWE(v.Cwes[0])
+			}
+			if len(v.References) > 0 {
+				f.URL = v.References[0].URL
+			}
+			findings = append(findings, withFingerprint(f))
+		}
+	}
+	return findings, nil
+}
+
+// semgrepReport is the subset of Semgrep's JSON output format the pipeline reads
+type semgrepReport struct {
+	Results []struct {
+		CheckID string `json:"check_id"`
+		Path    string `json:"path"`
+		Start   struct {
+			Line int `json:"line"`
+		} `json:"start"`
+		Extra struct {
+			Message  string `json:"message"`
+			Severity string `json:"severity"`
+			Metadata struct {
+				// Semgrep rules use either a string or a list for CWE
+				CWE        json.RawMessage `json:"cwe"`
+				References []string        `json:"references"`
+			} `json:"metadata"`
+		} `json:"extra"`
+	} `json:"results"`
+}
+
+// parseSemgrepFindings extracts findings from Semgrep's JSON output
+func parseSemgrepFindings(content string) ([]Finding, error) {
+	var report semgrepReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Semgrep report: %w", err)
+	}
+
+	var findings []Finding
+	for _, r := range report.Results {
+		f := Finding{
+			Tool:        "semgrep",
+			RuleID:      r.CheckID,
+			CWE:         normalizeCWE(string(r.Extra.Metadata.CWE)),
+			Severity:    normalizeSeverity(r.Extra.Severity),
+			Title:       r.CheckID,
+			Description: r.Extra.Message,
+			Location:    r.Path,
+			Line:        r.Start.Line,
+		}
+		if len(r.Extra.Metadata.References) > 0 {
+			f.URL = r.Extra.Metadata.References[0]
+		}
+		findings = append(findings, withFingerprint(f))
+	}
+	return findings, nil
+}
+
+// checkovReport is the subset of Checkov's JSON output (one framework) the pipeline reads
+type checkovReport struct {
+	CheckType string `json:"check_type"`
+	Results   struct {
+		FailedChecks []struct {
+			CheckID       string `json:"check_id"`
+			CheckName     string `json:"check_name"`
+			FilePath      string `json:"file_path"`
+			FileAbsPath   string `json:"file_abs_path"`
+			FileLineRange []int  `json:"file_line_range"`
+			Resource      string `json:"resource"`
+			Severity      string `json:"severity"`
+			Guideline     string `json:"guideline"`
+		} `json:"failed_checks"`
+	} `json:"results"`
+}
+
+// parseCheckovFindings extracts the failed checks of Checkov's JSON output
+func parseCheckovFindings(content string) ([]Finding, error) {
+	var reports []checkovReport
+	if strings.HasPrefix(strings.TrimSpace(content), "[") {
+		if err := json.Unmarshal([]byte(content), &reports); err != nil {
+			return nil, fmt.Errorf("invalid Checkov report: %w", err)
+		}
+	} else {
+		var report checkovReport
+		if err := json.Unmarshal([]byte(content), &report); err != nil {
+			return nil, fmt.Errorf("invalid Checkov report: %w", err)
+		}
+		reports = []checkovReport{report}
+	}
+
+	var findings []Finding
+	for _, report := range reports {
+		for _, c := range report.Results.FailedChecks {
+			// Checkov only rates checks with a Prisma Cloud API key; misconfigurations
+			// without a rating count as MEDIUM
+			severity := "MEDIUM"
+			if c.Severity != "" {
+				severity = normalizeSeverity(c.Severity)
+			}
+			location := c.FileAbsPath
+			if location == "" {
+				location = strings.TrimPrefix(c.FilePath, "/")
+			}
+			f := Finding{
+				Tool:        "checkov",
+				RuleID:      c.CheckID,
+				Severity:    severity,
+				Title:       c.CheckName,
+				Description: fmt.Sprintf("%s (%s)", c.CheckName, c.Resource),
+				Location:    location,
+				URL:         c.Guideline,
+			}
+			if len(c.FileLineRange) > 0 {
+				f.Line = c.FileLineRange[0]
+			}
+			findings = append(findings, withFingerprint(f))
+		}
+	}
+	return findings, nil
+}
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]+>`)
+	urlPattern = regexp.MustCompile(`https?://[^\s<"]+`)
+)
+
+// parseZapFindings extracts findings from ZAP's JSON report, one per alert and URL
+func parseZapFindings(content string) ([]Finding, error) {
+	var report zapReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid ZAP report: %w", err)
+	}
+
+	var findings []Finding
+	for _, site := range report.Site {
+		for _, alert := range site.Alerts {
+			f := Finding{
+				Tool:        "zap",
+				RuleID:      alert.PluginID,
+				Severity:    "INFO",
+				Title:       alert.Name,
+				Description: strings.TrimSpace(htmlTag.ReplaceAllString(alert.Desc, " ")),
+				URL:         urlPattern.FindString(alert.Reference),
+			}
+			if risk, err := strconv.Atoi(alert.RiskCode); err == nil && risk >= 0 && risk < len(zapRiskLevels) {
+				f.Severity = normalizeSeverity(zapRiskLevels[risk])
+			}
+			// ZAP uses -1 or 0 when an alert has no CWE
+			if id, err := strconv.Atoi(alert.CweID); err == nil && id > 0 {
+				f.CWE = "CWE-" + alert.CweID
+			}
+			if len(alert.Instances) == 0 {
+				f.Location = site.Name
+				findings = append(findings, withFingerprint(f))
+				continue
+			}
+			for _, instance := range alert.Instances {
+				f.Location = instance.URI
+				findings = append(findings, withFingerprint(f))
+			}
+		}
+	}
+	return findings, nil
+}
+
+// nucleiResult is the subset of a Nuclei JSONL result the pipeline reads
+type nucleiResult struct {
+	TemplateID string `json:"template-id"`
+	MatchedAt  string `json:"matched-at"`
+	Info       struct {
+		Name           string   `json:"name"`
+		Severity       string   `json:"severity"`
+		Description    string   `json:"description"`
+		Reference      []string `json:"reference"`
+		Classification struct {
+			CweID []string `json:"cwe-id"`
+		} `json:"classification"`
+	} `json:"info"`
+}
+
+// parseNucleiFindings extracts findings from Nuclei's JSONL output
+func parseNucleiFindings(content string) ([]Finding, error) {
+	var findings []Finding
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var r nucleiResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, fmt.Errorf("invalid Nuclei result: %w", err)
+		}
+		f := Finding{
+			Tool:        "nuclei",
+			RuleID:      r.TemplateID,
+			Severity:    normalizeSeverity(r.Info.Severity),
+			Title:       r.Info.Name,
+			Description: strings.TrimSpace(r.Info.Description),
+			Location:    r.MatchedAt,
+		}
+		if len(r.Info.Classification.CweID) > 0 {
+			f.CWE = normalizeCWE(r.Info.Classification.CweID[0])
+		}
+		if len(r.Info.Reference) > 0 {
+			f.URL = r.Info.Reference[0]
+		}
+		findings = append(findings, withFingerprint(f))
+	}
+	return findings, nil
+}
+
+// loadFindings parses every JSON/SARIF report in a directory
+func loadFindings(ctx context.Context, reports *dagger.Directory) ([]Finding, error) {
+	entries, err := reports.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	sort.Strings(entries)
+
+	var findings []Finding
+	for _, name := range entries {
+		switch path.Ext(name) {
+		case ".json", ".jsonl", ".sarif":
+		default:
+			continue
+		}
+
+		content, err := reports.File(name).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", name, err)
+		}
+		parsed, err := parseFindings(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report %s: %w", name, err)
+		}
+		findings = append(findings, parsed...)
+	}
+	return findings, nil
+}
+
+// reportedTools lists the scanners a report comes from, whether or not they found
+// anything
+func reportedTools(name, content string) []string {
+	switch format := reportFormat(content); format {
+	case "sarif":
+		log, err := parseSarif(content)
+		if err != nil {
+			return nil
+		}
+		var tools []string
+		for _, run := range log.Runs {
+			tools = append(tools, strings.ToLower(run.Tool.Driver.Name))
+		}
+		return tools
+	case "":
+		// Nuclei writes nothing at all when nothing matches
+		if path.Ext(name) == ".jsonl" && strings.TrimSpace(content) == "" {
+			return []string{"nuclei"}
+		}
+		return nil
+	default:
+		return []string{format}
+	}
+}
+
+// scannedTools lists the scanners with a report in a directory; a scanner whose
+// report is missing (e.g., because the scan failed) has no say on which findings
+// are gone
+func scannedTools(ctx context.Context, reports *dagger.Directory) (map[string]bool, error) {
+	entries, err := reports.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	tools := map[string]bool{}
+	for _, name := range entries {
+		switch path.Ext(name) {
+		case ".json", ".jsonl", ".sarif":
+		default:
+			continue
+		}
+		content, err := reports.File(name).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", name, err)
+		}
+		for _, tool := range reportedTools(name, content) {
+			tools[tool] = true
+		}
+	}
+	return tools, nil
+}
+
+// collectFindings loads all reports in a directory and merges duplicate findings
+func collectFindings(ctx context.Context, reports *dagger.Directory) ([]Finding, error) {
+	findings, err := loadFindings(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+	return dedupeFindings(findings), nil
+}
+
+// DeduplicateFindings normalizes the findings of all scan reports in a directory
+// Trivy, Grype, Dependency-Check and Semgrep (JSON or SARIF) frequently report the
+// same underlying issue; those are merged into one finding listing every source
+func (m *SearchApi) DeduplicateFindings(
+	ctx context.Context,
+	// Directory of scan reports (e.g., output of ExportPipelineReports)
+	reports *dagger.Directory,
+) ([]*Finding, error) {
+	findings, err := collectFindings(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Finding, len(findings))
+	for i := range findings {
+		result[i] = &findings[i]
+	}
+	return result, nil
+}
+
+// filterBySeverity keeps findings whose severity is in the given list
+func filterBySeverity(findings []Finding, severities []string) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if containsSeverity(severities, f.Severity) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := map[string]string{
+		"critical": "CRITICAL",
+		"HIGH":     "HIGH",
+		"error":    "HIGH",
+		"Moderate": "MEDIUM",
+		"WARNING":  "MEDIUM",
+		"medium":   "MEDIUM",
+		" low ":    "LOW",
+		"note":     "LOW",
+		"info":     "INFO",
+		"UNKNOWN":  "INFO",
+		"":         "INFO",
+	}
+	for severity, want := range tests {
+		if got := normalizeSeverity(severity); got != want {
+			t.Errorf("normalizeSeverity(%q) = %s, want %s", severity, got, want)
+		}
+	}
+}
+
+func TestSeverityFromScore(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{10, "CRITICAL"},
+		{9.0, "CRITICAL"},
+		{8.9, "HIGH"},
+		{7.0, "HIGH"},
+		{6.9, "MEDIUM"},
+		{4.0, "MEDIUM"},
+		{0.1, "LOW"},
+		{0, "INFO"},
+	}
+	for _, tt := range tests {
+		if got := severityFromScore(tt.score); got != tt.want {
+			t.Errorf("severityFromScore(%v) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizers(t *testing.T) {
+	cwes := map[string]string{
+		"CWE-79: Improper Neutralization of Input": "CWE-79",
+		`["cwe-89"]`:       "CWE-89",
+		"CWE-1333":         "CWE-1333",
+		"not a weakness":   "",
+		"":                 "",
+		"CWE-: incomplete": "",
+	}
+	for label, want := range cwes {
+		if got := normalizeCWE(label); got != want {
+			t.Errorf("normalizeCWE(%q) = %q, want %q", label, got, want)
+		}
+	}
+
+	locations := map[string]string{
+		"file:///src/SearchApi/Program.cs": "SearchApi/Program.cs",
+		"/src/SearchApi/Program.cs":        "SearchApi/Program.cs",
+		"./SearchApi/Program.cs":           "SearchApi/Program.cs",
+		"SearchApi/Program.cs":             "SearchApi/Program.cs",
+		"http://api:8080/search":           "http://api:8080/search",
+	}
+	for location, want := range locations {
+		if got := normalizeLocation(location); got != want {
+			t.Errorf("normalizeLocation(%q) = %q, want %q", location, got, want)
+		}
+	}
+
+	cves := []struct {
+		id      string
+		aliases []string
+		want    string
+	}{
+		{"cve-2024-1234", nil, "CVE-2024-1234"},
+		{"GHSA-abcd-efgh-ijkl", []string{"GHSA-other", "CVE-2024-5678"}, "CVE-2024-5678"},
+		{"GHSA-abcd-efgh-ijkl", nil, "GHSA-abcd-efgh-ijkl"},
+		{"CVE-2024-1234-extra", nil, "CVE-2024-1234-extra"},
+	}
+	for _, tt := range cves {
+		if got := preferCVE(tt.id, tt.aliases...); got != tt.want {
+			t.Errorf("preferCVE(%q, %q) = %q, want %q", tt.id, tt.aliases, got, tt.want)
+		}
+	}
+
+	purls := []struct {
+		purl, name, version string
+	}{
+		{"pkg:nuget/Newtonsoft.Json@12.0.1", "Newtonsoft.Json", "12.0.1"},
+		{"pkg:npm/lodash@4.17.20?arch=any", "lodash", "4.17.20"},
+		{"pkg:nuget/Serilog", "Serilog", ""},
+	}
+	for _, tt := range purls {
+		if name, version := parsePurl(tt.purl); name != tt.name || version != tt.version {
+			t.Errorf("parsePurl(%q) = %q, %q; want %q, %q", tt.purl, name, version, tt.name, tt.version)
+		}
+	}
+}
+
+func TestReportFormat(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"sarif", `{"version": "2.1.0", "runs": []}`, "sarif"},
+		{"trivy", `{"ArtifactName": "search-api", "Results": []}`, "trivy"},
+		{"grype", `{"matches": []}`, "grype"},
+		{"dependency-check", `{"reportSchema": "1.1", "dependencies": []}`, "dependency-check"},
+		{"semgrep", `{"results": [], "errors": []}`, "semgrep"},
+		{"checkov", `{"check_type": "kubernetes", "results": {}}`, "checkov"},
+		{"checkov frameworks", `[{"check_type": "kubernetes"}, {"check_type": "dockerfile"}]`, "checkov"},
+		{"zap", `{"site": []}`, "zap"},
+		{"nuclei", "{\"template-id\": \"cors\"}\n{\"template-id\": \"xss\"}\n", "nuclei"},
+		{"spdx", `{"spdxVersion": "SPDX-2.3"}`, ""},
+		{"list", `[1, 2]`, ""},
+		{"text", "all good", ""},
+	}
+	for _, tt := range tests {
+		if got := reportFormat(tt.content); got != tt.want {
+			t.Errorf("reportFormat(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithFingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Finding
+		same bool
+	}{
+		{
+			"dependency across scanners",
+			Finding{Tool: "trivy", RuleID: "CVE-2024-1234", Package: "Newtonsoft.Json", Version: "12.0.1", Location: "SearchApi/obj/project.assets.json"},
+			Finding{Tool: "grype", RuleID: "CVE-2024-1234", Package: "newtonsoft.json", Version: "12.0.1", Location: "/src/SearchApi/SearchApi.csproj"},
+			true,
+		},
+		{
+			"dependency in another version",
+			Finding{Tool: "trivy", RuleID: "CVE-2024-1234", Package: "Newtonsoft.Json", Version: "12.0.1"},
+			Finding{Tool: "trivy", RuleID: "CVE-2024-1234", Package: "Newtonsoft.Json", Version: "13.0.1"},
+			false,
+		},
+		{
+			"code finding by CWE and location",
+			Finding{Tool: "semgrep", RuleID: "csharp.lang.security.sqli", CWE: "CWE-89", Location: "/src/SearchApi/Query.cs", Line: 12},
+			Finding{Tool: "sarif", RuleID: "CA3001", CWE: "CWE-89", Location: "file:///src/SearchApi/Query.cs", Line: 12},
+			true,
+		},
+		{
+			"code finding on another line",
+			Finding{Tool: "semgrep", RuleID: "rule", Location: "Query.cs", Line: 12},
+			Finding{Tool: "semgrep", RuleID: "rule", Location: "Query.cs", Line: 13},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		a, b := withFingerprint(tt.a), withFingerprint(tt.b)
+		if a.Fingerprint == "" || (a.Fingerprint == b.Fingerprint) != tt.same {
+			t.Errorf("%s: fingerprints %q and %q, want same=%v", tt.name, a.Fingerprint, b.Fingerprint, tt.same)
+		}
+	}
+
+	f := withFingerprint(Finding{Tool: "zap", RuleID: "10038", Location: "./index.html"})
+	if f.Location != "index.html" || !reflect.DeepEqual(f.Sources, []string{"zap"}) {
+		t.Errorf("withFingerprint() = %+v, want the location normalized and the tool as source", f)
+	}
+}
+
+func TestDedupeFindings(t *testing.T) {
+	findings := []Finding{
+		{Fingerprint: "a", Severity: "MEDIUM", Sources: []string{"trivy"}, Title: "Trivy title", FixedVersion: "2.0"},
+		{Fingerprint: "b", Severity: "LOW", Sources: []string{"semgrep"}},
+		{Fingerprint: "a", Severity: "CRITICAL", Sources: []string{"grype"}, Title: "Grype title", CWE: "CWE-79", URL: "https://example.com"},
+		{Fingerprint: "a", Severity: "LOW", Sources: []string{"trivy"}, Description: "From the second Trivy report"},
+	}
+	want := []Finding{
+		{
+			Fingerprint:  "a",
+			Severity:     "CRITICAL",
+			Sources:      []string{"trivy", "grype"},
+			Title:        "Trivy title",
+			Description:  "From the second Trivy report",
+			CWE:          "CWE-79",
+			FixedVersion: "2.0",
+			URL:          "https://example.com",
+		},
+		{Fingerprint: "b", Severity: "LOW", Sources: []string{"semgrep"}},
+	}
+	if got := dedupeFindings(findings); !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeFindings() =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := dedupeFindings(nil); got != nil {
+		t.Errorf("dedupeFindings(nil) = %v, want nil", got)
+	}
+}
+
+func TestFilterBySeverity(t *testing.T) {
+	findings := []Finding{{RuleID: "a", Severity: "CRITICAL"}, {RuleID: "b", Severity: "MEDIUM"}, {RuleID: "c", Severity: "HIGH"}}
+	got := filterBySeverity(findings, []string{"high", "critical"})
+	if want := []Finding{findings[0], findings[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterBySeverity() = %+v, want %+v", got, want)
+	}
+}
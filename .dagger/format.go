@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// formattedSource runs dotnet format on a copy of the source and returns the
+// formatted tree, without the build output; with files, only those are formatted
+func formattedSource(source *dagger.Directory, files []string) *dagger.Directory {
+	args := []string{"dotnet", "format", solutionFile, "--no-restore", "--verbosity", "minimal"}
+	if len(files) > 0 {
+		args = append(append(args, "--include"), files...)
+	}
+	formatted := buildBase(source).
+		WithExec(args).
+		Directory("/src")
+
+	return dag.Directory().WithDirectory(".", formatted, dagger.DirectoryWithDirectoryOpts{
+		Exclude: []string{"**/bin", "**/obj"},
+	})
+}
+
+// formatPatch returns the unified diff from source to formatted, applicable with
+// git apply or patch -p1; it is empty when the source is already formatted
+func formatPatch(source *dagger.Directory, formatted *dagger.Directory) *dagger.File {
+	return dag.Container().
+		From(gitImage).
+		WithDirectory("/repo", source, dagger.ContainerWithDirectoryOpts{
+			Exclude: []string{".git", "**/bin", "**/obj"},
+		}).
+		WithWorkdir("/repo").
+		WithExec([]string{"git", "init", "--quiet"}).
+		WithExec([]string{"git", "add", "--all"}).
+		WithDirectory("/repo", formatted).
+		WithExec([]string{"sh", "-c", "git add --all && git diff --cached --no-color > /format.patch"}).
+		File("/format.patch")
+}
+
+// StaticAnalysis verifies code formatting with dotnet format
+// When formatting is off it fails with the diff in the report; FormatDiff and
+// FormatFix return the same change as a patch file or a fixed source tree
+func (m *SearchApi) StaticAnalysis(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Files to check (e.g., those changed in a pull request); all when empty
+	// +optional
+	files []string,
+) (string, error) {
+	if files != nil {
+		var csharp []string
+		for _, file := range files {
+			if strings.HasSuffix(file, ".cs") {
+				csharp = append(csharp, file)
+			}
+		}
+		if len(csharp) == 0 {
+			return "✅ No C# files to check\n", nil
+		}
+		files = csharp
+	}
+	patch, err := formatPatch(source, formattedSource(source, files)).Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("dotnet format failed: %w", err)
+	}
+	if strings.TrimSpace(patch) == "" {
+		return "✅ Code formatting is correct\n", nil
+	}
+
+	var unformatted []string
+	for _, line := range strings.Split(patch, "\n") {
+		if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+			unformatted = append(unformatted, name)
+		}
+	}
+	report := fmt.Sprintf("❌ %d file(s) need formatting:\n   • %s\n\n", len(unformatted), strings.Join(unformatted, "\n   • "))
+	report += "Apply with: dagger call format-diff export --path=format.patch && git apply format.patch\n\n"
+	report += patch
+	return report, fmt.Errorf("%d file(s) need formatting", len(unformatted))
+}
+
+// FormatDiff returns the formatting changes dotnet format would make as a unified
+// patch (empty when the source is formatted), for review or git apply
+func (m *SearchApi) FormatDiff(
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+) *dagger.File {
+	return formatPatch(source, formattedSource(source, nil))
+}
+
+// FormatFix returns the source with dotnet format applied, e.g. for a bot to commit
+// into a fix PR
+func (m *SearchApi) FormatFix(
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+) *dagger.Directory {
+	return source.WithDirectory(".", formattedSource(source, nil))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemathesisImage is pinned to 3.x, whose CLI flags and JUnit output FuzzApi relies on
+const schemathesisImage = "schemathesis/schemathesis:v3.39.16"
+
+// junitProblem is a failure or error of a JUnit test case
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// schemathesisJunit is the subset of Schemathesis' JUnit report used per endpoint
+type schemathesisJunit struct {
+	Suites []struct {
+		Cases []struct {
+			// Operation, e.g. "POST /api/search/search"
+			Name     string         `xml:"name,attr"`
+			Failures []junitProblem `xml:"failure"`
+			Errors   []junitProblem `xml:"error"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+// FuzzEndpoint is the Schemathesis result of one API operation
+type FuzzEndpoint struct {
+	// Operation (e.g., "POST /api/search/search")
+	Endpoint string
+	Passed   bool
+	// 5xx responses and responses not matching the documented schema
+	ServerErrors     int
+	SchemaViolations int
+	// Failing checks with the request that reproduces them
+	Failures []string
+}
+
+// FuzzReport is the outcome of FuzzApi
+type FuzzReport struct {
+	Passed           int
+	Failed           int
+	ServerErrors     int
+	SchemaViolations int
+	Endpoints        []*FuzzEndpoint
+}
+
+// text renders the report for pipeline reports
+func (r *FuzzReport) text() string {
+	text := fmt.Sprintf("%d endpoints passed, %d failed (%d server errors, %d schema violations)\n",
+		r.Passed, r.Failed, r.ServerErrors, r.SchemaViolations)
+	for _, e := range r.Endpoints {
+		if e.Passed {
+			continue
+		}
+		text += fmt.Sprintf("   ✗ %s: %d server errors, %d schema violations\n", e.Endpoint, e.ServerErrors, e.SchemaViolations)
+	}
+	return text
+}
+
+// parseFuzzReport reads Schemathesis' JUnit report into per-endpoint results
+func parseFuzzReport(content string) (*FuzzReport, error) {
+	var junit schemathesisJunit
+	if err := xml.Unmarshal([]byte(content), &junit); err != nil {
+		return nil, fmt.Errorf("invalid Schemathesis report: %w", err)
+	}
+
+	report := &FuzzReport{}
+	for _, suite := range junit.Suites {
+		for _, c := range suite.Cases {
+			endpoint := &FuzzEndpoint{Endpoint: c.Name}
+			for _, p := range append(c.Failures, c.Errors...) {
+				detail := strings.TrimSpace(p.Message + "\n" + p.Text)
+				switch lower := strings.ToLower(detail); {
+				case strings.Contains(lower, "server error"):
+					endpoint.ServerErrors++
+				case strings.Contains(lower, "schema"):
+					endpoint.SchemaViolations++
+				}
+				endpoint.Failures = append(endpoint.Failures, detail)
+			}
+			endpoint.Passed = len(endpoint.Failures) == 0
+			if endpoint.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+			report.ServerErrors += endpoint.ServerErrors
+			report.SchemaViolations += endpoint.SchemaViolations
+			report.Endpoints = append(report.Endpoints, endpoint)
+		}
+	}
+	return report, nil
+}
+
+// FuzzApi generates requests from the OpenAPI document with Schemathesis and sends
+// them to the running API, reporting 5xx responses and responses that don't match
+// the documented schema, per endpoint. Complements ZAP and Nuclei, which look for
+// known vulnerabilities rather than inputs the API mishandles
+func (m *SearchApi) FuzzApi(
+	ctx context.Context,
+	// Running API, listening on port 8080 (e.g., from RunApiWithServices)
+	apiService *dagger.Service,
+	// OpenAPI document; fetched from the API when omitted, which needs it to run in the
+	// Development environment
+	// +optional
+	openApiSpec *dagger.File,
+	// Examples generated per operation
+	// +default=100
+	maxExamples int,
+) (*FuzzReport, error) {
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return nil, err
+	}
+	if openApiSpec == nil {
+		openApiSpec = fetchOpenApiSpec(apiService)
+	}
+
+	content, err := dag.Container().
+		From(schemathesisImage).
+		WithServiceBinding("api", apiService).
+		WithMountedFile("/spec/openapi.json", openApiSpec).
+		WithDirectory("/out", dag.Directory()).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{
+			"st", "run", "/spec/openapi.json",
+			"--base-url", "http://api:8080",
+			"--checks", "not_a_server_error",
+			"--checks", "response_schema_conformance",
+			"--hypothesis-max-examples", strconv.Itoa(maxExamples),
+			"--junit-xml", "/out/junit.xml",
+		}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		File("/out/junit.xml").
+		Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Schemathesis produced no report: %w", err)
+	}
+
+	report, err := parseFuzzReport(content)
+	if err != nil {
+		return nil, err
+	}
+	if report.Failed > 0 {
+		return report, fmt.Errorf("❌ BLOCKED - fuzzing found problems in %d endpoint(s):\n%s", report.Failed, report.text())
+	}
+	return report, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// gatePolicy decides which findings block the pipeline
+type gatePolicy struct {
+	// Severities that block when no threat intel is available
+	failOn []string
+	// Risk score at or above which an enriched finding blocks
+	riskThreshold float64
+	// Block enriched CVE findings only when they are in CISA KEV or their EPSS
+	// probability exceeds epssThreshold, whatever their severity or risk score;
+	// findings without a CVE block on failOn
+	exploitable   bool
+	epssThreshold float64
+}
+
+// blocking returns the findings that violate the policy
+// Enriched findings are judged on risk score so that an actively exploited MEDIUM
+// outranks a HIGH nobody is exploiting; everything else falls back to severity
+func (p gatePolicy) blocking(findings []Finding, enriched bool) []Finding {
+	if !enriched {
+		return filterBySeverity(findings, p.failOn)
+	}
+
+	var blocked []Finding
+	for _, f := range findings {
+		if p.blocks(f) {
+			blocked = append(blocked, f)
+		}
+	}
+	return blocked
+}
+
+// blocks reports whether an enriched finding violates the policy
+func (p gatePolicy) blocks(f Finding) bool {
+	switch {
+	case p.exploitable && cvePattern.MatchString(f.RuleID):
+		return f.Kev || f.Epss > p.epssThreshold
+	case p.exploitable:
+		// EPSS and KEV only cover CVEs, so exploitability says nothing about the rest
+		return containsSeverity(p.failOn, f.Severity)
+	case f.Kev || f.Epss > 0 || f.EpssPercentile > 0:
+		return f.RiskScore >= p.riskThreshold
+	default:
+		// No EPSS or KEV match (code findings, advisories without a CVE): the
+		// neutral risk score would let a HIGH through, so gate on severity
+		return containsSeverity(p.failOn, f.Severity)
+	}
+}
+
+// gateReport renders the findings that blocked the gate as a markdown table
+func gateReport(blocked []Finding, enriched bool) string {
+	var sb strings.Builder
+	if enriched {
+		sb.WriteString("| Risk | Severity | EPSS | KEV | Rule | Location | Sources |\n")
+		sb.WriteString("|------|----------|------|-----|------|----------|---------|\n")
+	} else {
+		sb.WriteString("| Severity | Rule | Location | Sources |\n")
+		sb.WriteString("|----------|------|----------|---------|\n")
+	}
+
+	for _, f := range blocked {
+		location := f.Location
+		if f.Package != "" {
+			location = f.Package + "@" + f.Version
+		} else if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.Location, f.Line)
+		}
+
+		sources := strings.Join(f.Sources, ", ")
+		if enriched {
+			kev := ""
+			if f.Kev {
+				kev = "yes"
+			}
+			fmt.Fprintf(&sb, "| %.1f | %s | %.3f | %s | %s | %s | %s |\n",
+				f.RiskScore, f.Severity, f.Epss, kev, f.RuleID, location, sources)
+		} else {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", f.Severity, f.RuleID, location, sources)
+		}
+	}
+	return sb.String()
+}
+
+// gateScanOutput applies the risk register, vulnerability waivers and severity policy
+// to a single scanner's output. It returns what was waived, for the step's summary,
+// and the accepted risk the waivers cover, for the report
+func gateScanOutput(output string, failOn []string, register *acceptanceRegister, waivers *vulnWaivers) (waived, acceptedRisk string, err error) {
+	findings, err := parseFindings(output)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse scan output: %w", err)
+	}
+
+	remaining, accepted := waivers.accept(dedupeFindings(findings))
+	remaining, registered, expired := register.waive(remaining)
+	blocked := gatePolicy{failOn: failOn}.blocking(remaining, false)
+	if len(blocked) > 0 {
+		msg := fmt.Sprintf("%d finding(s) block", len(blocked))
+		if len(expired) > 0 {
+			msg += fmt.Sprintf(" (%d with expired waivers)", len(expired))
+		}
+		return "", "", fmt.Errorf("%s\n%s", msg, gateReport(blocked, false))
+	}
+
+	var summary []string
+	if register != nil {
+		summary = append(summary, fmt.Sprintf("%d finding(s) waived by the risk register", len(registered)))
+	}
+	if waivers != nil {
+		summary = append(summary, fmt.Sprintf("%d accepted by vulnerability waivers", len(accepted)))
+	}
+	return strings.Join(summary, ", "), waivers.acceptedRisk(accepted), nil
+}
+
+// SecurityGate fails when deduplicated findings violate the policy
+// Without threat intel any finding of a failOn severity blocks. With an EPSS/KEV
+// dataset, findings are scored and only those at or above riskThreshold block, or
+// with exploitableOnly, only those in CISA KEV or above the EPSS threshold; findings
+// the dataset doesn't cover still block on a failOn severity.
+// Findings with an active acceptance in the risk register never block; once the
+// acceptance expires the finding blocks again.
+func (m *SearchApi) SecurityGate(
+	ctx context.Context,
+	// Directory of scan reports (e.g., output of ExportPipelineReports)
+	reports *dagger.Directory,
+	// Severities that block when no threat intel is provided
+	// +default=["HIGH","CRITICAL"]
+	failOn []string,
+	// Offline threat intel: epss_scores-current.csv[.gz] and known_exploited_vulnerabilities.json
+	// +optional
+	threatIntel *dagger.Directory,
+	// Risk score (0-10) at or above which a finding blocks when threat intel is provided
+	// +default=7
+	riskThreshold float64,
+	// Risk register with expiring waivers (YAML or JSON)
+	// +optional
+	riskRegister *dagger.File,
+	// Block only known exploited (CISA KEV) CVEs and those whose EPSS probability
+	// exceeds epssThreshold, instead of gating on risk score; findings without a CVE
+	// still block on failOn. Needs threat intel
+	// +optional
+	exploitableOnly bool,
+	// EPSS probability (0-1) above which a finding blocks with exploitableOnly
+	// +default=0.1
+	epssThreshold float64,
+) (string, error) {
+	if exploitableOnly && threatIntel == nil {
+		return "", fmt.Errorf("exploitableOnly needs threatIntel (see download-threat-intel)")
+	}
+	findings, err := collectFindings(ctx, reports)
+	if err != nil {
+		return "", err
+	}
+
+	var register *acceptanceRegister
+	if riskRegister != nil {
+		if register, err = loadRiskRegister(ctx, riskRegister, time.Now()); err != nil {
+			return "", err
+		}
+	}
+
+	enriched := threatIntel != nil
+	if enriched {
+		intel, err := loadThreatIntel(ctx, threatIntel)
+		if err != nil {
+			return "", err
+		}
+		findings = intel.enrich(findings)
+	}
+
+	remaining, waived, expired := register.waive(findings)
+	policy := gatePolicy{failOn: failOn, riskThreshold: riskThreshold, exploitable: exploitableOnly, epssThreshold: epssThreshold}
+	blocked := policy.blocking(remaining, enriched)
+	if len(blocked) > 0 {
+		msg := fmt.Sprintf("security gate failed: %d of %d findings block", len(blocked), len(findings))
+		if len(expired) > 0 {
+			msg += fmt.Sprintf(" (%d with expired waivers)", len(expired))
+		}
+		return "", fmt.Errorf("%s\n%s", msg, gateReport(blocked, enriched))
+	}
+
+	var result string
+	switch {
+	case exploitableOnly:
+		result = fmt.Sprintf("Security gate passed: %d findings, none in CISA KEV or above EPSS %.2f\n", len(findings), epssThreshold)
+	case enriched:
+		result = fmt.Sprintf("Security gate passed: %d findings, none at or above risk %.1f\n", len(findings), riskThreshold)
+	default:
+		result = fmt.Sprintf("Security gate passed: %d findings, none of severity %s\n", len(findings), strings.Join(failOn, ", "))
+	}
+	if register != nil {
+		result += fmt.Sprintf("%d finding(s) waived\n", len(waived)) + register.summary()
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGatePolicyBlocking(t *testing.T) {
+	policy := gatePolicy{failOn: []string{"HIGH", "CRITICAL"}, riskThreshold: 7}
+	sast := Finding{Tool: "semgrep", RuleID: "csharp.lang.security.xss", Severity: "HIGH"}
+	sast.RiskScore = riskScore(sast)
+	exploited := Finding{RuleID: "CVE-2024-1234", Severity: "MEDIUM", Epss: 0.9, EpssPercentile: 0.99, Kev: true}
+	exploited.RiskScore = riskScore(exploited)
+	unlikely := Finding{RuleID: "CVE-2024-5678", Severity: "HIGH", Epss: 0.001, EpssPercentile: 0.05}
+	unlikely.RiskScore = riskScore(unlikely)
+	low := Finding{Tool: "semgrep", RuleID: "csharp.lang.best-practice", Severity: "LOW"}
+	findings := []Finding{sast, exploited, unlikely, low}
+
+	// A HIGH code finding has no threat intel and blocks on severity
+	if got, want := policy.blocking(findings, true), []Finding{sast, exploited}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blocking(enriched) = %+v, want %+v", got, want)
+	}
+	if got, want := policy.blocking(findings, false), []Finding{sast, unlikely}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blocking() = %+v, want %+v", got, want)
+	}
+
+	// Exploitability only judges CVEs; the code finding still blocks on severity
+	policy.exploitable, policy.epssThreshold = true, 0.1
+	if got, want := policy.blocking(findings, true), []Finding{sast, exploited}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blocking(exploitable) = %+v, want %+v", got, want)
+	}
+	policy.failOn = []string{"CRITICAL"}
+	if got, want := policy.blocking(findings, true), []Finding{exploited}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blocking(exploitable, CRITICAL) = %+v, want %+v", got, want)
+	}
+}
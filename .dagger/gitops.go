@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kustomizeImage provides git and kustomize for editing the GitOps repository
+const kustomizeImage = "alpine:3.20"
+
+// gitopsBumpScript clones the GitOps repository, points the overlay's image at the
+// new digest and pushes the commit; the token is sent as an HTTP header, so it never
+// appears in a remote URL or git's output
+const gitopsBumpScript = `set -e
+apk add --no-cache git kustomize >/dev/null
+git config --global http.extraHeader "Authorization: Basic $(printf 'x-access-token:%s' "$GIT_TOKEN" | base64 | tr -d '\n')"
+git config --global user.name "$GIT_AUTHOR"
+git config --global user.email "$GIT_EMAIL"
+git clone --quiet --depth 1 --branch "$BASE_BRANCH" "$REPO_URL" /repo
+cd "/repo/$OVERLAY"
+kustomize edit set image "$IMAGE_NAME=$NEW_IMAGE"
+cd /repo
+if git diff --quiet; then
+  echo unchanged
+  exit 0
+fi
+git commit --quiet --all --message "$COMMIT_MESSAGE"
+git push --quiet origin "HEAD:refs/heads/$PUSH_BRANCH"
+echo "commit $(git rev-parse HEAD)"
+`
+
+// GitopsBump is the result of BumpGitopsRepo
+type GitopsBump struct {
+	// Kustomization directory that was edited
+	Path string
+	// Image set in the kustomization (repository@sha256:...)
+	Image string
+	// false when the overlay already deployed the image
+	Changed bool
+	// Branch the commit was pushed to, and the commit
+	Branch string
+	Commit string
+	// Pull request opened for the commit ("" when pushed to the base branch)
+	PullRequestUrl string
+}
+
+// githubRepository returns owner/repo of a GitHub clone URL
+func githubRepository(repoUrl string) (string, error) {
+	parsed, err := url.Parse(repoUrl)
+	if err != nil || parsed.Scheme != "https" {
+		return "", fmt.Errorf("invalid repository URL %q: expected https://<host>/<owner>/<repo>", repoUrl)
+	}
+	repo := strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git")
+	if strings.Count(repo, "/") != 1 {
+		return "", fmt.Errorf("invalid repository URL %q: expected https://<host>/<owner>/<repo>", repoUrl)
+	}
+	return repo, nil
+}
+
+// BumpGitopsRepo closes the loop from CI to CD: it clones the GitOps repository,
+// runs kustomize edit set image in the environment's overlay to deploy the image by
+// digest, commits and pushes to the base branch or, with openPr, to a new branch
+// with a pull request, so Argo CD or Flux rolls out the pipeline's image
+func (m *SearchApi) BumpGitopsRepo(
+	ctx context.Context,
+	// GitOps repository clone URL (e.g., "https://github.com/myorg/search-gitops")
+	gitopsRepoUrl string,
+	// Token allowed to push (and open pull requests)
+	token *dagger.Secret,
+	// Image pinned by digest (e.g., the pipeline report's Image)
+	imageDigest string,
+	// Environment whose overlay to bump (e.g., "staging")
+	env string,
+	// Kustomization directory (defaults to overlays/<env>)
+	// +optional
+	path string,
+	// Image name in the kustomization to replace
+	// +default="search-api"
+	imageName string,
+	// Branch to bump
+	// +default="main"
+	baseBranch string,
+	// Push to a new branch and open a pull request instead of pushing to the base branch
+	// +default=false
+	openPr bool,
+	// GitHub API base URL, for opening the pull request (GitHub Enterprise)
+	// +default="https://api.github.com"
+	apiUrl string,
+) (*GitopsBump, error) {
+	repository, _, digest := splitImageRef(imageDigest)
+	if !digestPattern.MatchString(digest) {
+		return nil, fmt.Errorf("image %q must be pinned by digest (repository@sha256:...)", imageDigest)
+	}
+	if env == "" {
+		return nil, fmt.Errorf("env is required")
+	}
+	path = cmp.Or(path, "overlays/"+env)
+	image := repository + "@" + digest
+	shortDigest := strings.TrimPrefix(digest, "sha256:")[:12]
+
+	bump := &GitopsBump{Path: path, Image: image, Branch: baseBranch}
+	if openPr {
+		bump.Branch = fmt.Sprintf("bump/%s-%s-%s", imageName, env, shortDigest)
+	}
+	title := fmt.Sprintf("Deploy %s %s to %s", imageName, shortDigest, env)
+
+	output, err := dag.Container().
+		From(kustomizeImage).
+		WithSecretVariable("GIT_TOKEN", token).
+		WithEnvVariable("GIT_AUTHOR", "search-api-ci").
+		WithEnvVariable("GIT_EMAIL", "search-api-ci@users.noreply.github.com").
+		WithEnvVariable("REPO_URL", gitopsRepoUrl).
+		WithEnvVariable("BASE_BRANCH", baseBranch).
+		WithEnvVariable("PUSH_BRANCH", bump.Branch).
+		WithEnvVariable("OVERLAY", path).
+		WithEnvVariable("IMAGE_NAME", imageName).
+		WithEnvVariable("NEW_IMAGE", image).
+		WithEnvVariable("COMMIT_MESSAGE", title).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", gitopsBumpScript}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bump %s in %s: %w", path, gitopsRepoUrl, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	commit, changed := strings.CutPrefix(lines[len(lines)-1], "commit ")
+	if !changed {
+		bump.Branch = baseBranch
+		return bump, nil
+	}
+	bump.Changed, bump.Commit = true, commit
+	if !openPr {
+		return bump, nil
+	}
+
+	repo, err := githubRepository(gitopsRepoUrl)
+	if err != nil {
+		return bump, err
+	}
+	payload, err := json.Marshal(map[string]string{
+		"title": title,
+		"head":  bump.Branch,
+		"base":  baseBranch,
+		"body":  fmt.Sprintf("Sets `%s` in `%s` to `%s`.", imageName, path, image),
+	})
+	if err != nil {
+		return bump, err
+	}
+	response, err := httpRequest{
+		method: "POST",
+		url:    fmt.Sprintf("%s/repos/%s/pulls", strings.TrimSuffix(apiUrl, "/"), repo),
+		headers: []string{
+			"Accept: application/vnd.github+json",
+			"X-GitHub-Api-Version: 2022-11-28",
+			"Content-Type: application/json",
+		},
+		body:       string(payload),
+		token:      token,
+		authPrefix: "Authorization: Bearer",
+	}.do(ctx)
+	if err != nil {
+		return bump, fmt.Errorf("pushed %s but failed to open the pull request: %w", bump.Branch, err)
+	}
+	var pr struct {
+		HtmlUrl string `json:"html_url"`
+	}
+	if err := json.Unmarshal([]byte(response), &pr); err != nil {
+		return bump, fmt.Errorf("invalid pull request response: %w", err)
+	}
+	bump.PullRequestUrl = pr.HtmlUrl
+	return bump, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// hardeningLevels ranks Dockle levels; checks at or above the gate level fail it
+var hardeningLevels = map[string]int{
+	"PASS":  0,
+	"SKIP":  0,
+	"INFO":  1,
+	"WARN":  2,
+	"FATAL": 3,
+}
+
+// HardeningCheck is one image config check evaluated by ConfigHardening
+type HardeningCheck struct {
+	// Check code (e.g., "CIS-DI-0001" or "SA-DI-0001")
+	Code  string
+	Title string
+	// FATAL, WARN, INFO, SKIP or PASS
+	Level string
+	// Whether the check is below the gate level
+	Passed bool
+	// What the check found (e.g., "Last user should not be root")
+	Alerts []string
+}
+
+// ConfigHardeningResult is the image config hardening result of ConfigHardening
+type ConfigHardeningResult struct {
+	// Level that fails the gate (FATAL, WARN or INFO)
+	FailOn string
+	// Checks that passed, including those Dockle reports only as a count
+	Passed int
+	// Checks at or above the gate level
+	Failed int
+	// Checks that reported something, in report order
+	Checks []*HardeningCheck
+	// Raw Dockle JSON report
+	Report string
+}
+
+// dockleReport is the subset of Dockle's JSON report ConfigHardening reads
+type dockleReport struct {
+	Summary struct {
+		Pass int `json:"pass"`
+	} `json:"summary"`
+	Details []struct {
+		Code   string   `json:"code"`
+		Title  string   `json:"title"`
+		Level  string   `json:"level"`
+		Alerts []string `json:"alerts"`
+	} `json:"details"`
+}
+
+// imageConfigChecks covers the config Dockle doesn't check: exposed ports must be
+// bindable by a non-root user and the entrypoint must run the app directly, so
+// signals reach it instead of a shell
+func imageConfigChecks(ctx context.Context, container *dagger.Container) ([]*HardeningCheck, error) {
+	ports, err := container.ExposedPorts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exposed ports: %w", err)
+	}
+	portCheck := &HardeningCheck{Code: "SA-DI-0001", Title: "Expose only unprivileged ports", Level: "PASS"}
+	for _, p := range ports {
+		port, err := p.Port(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if port < 1024 {
+			portCheck.Level = "WARN"
+			portCheck.Alerts = append(portCheck.Alerts, fmt.Sprintf("Port %d requires root or CAP_NET_BIND_SERVICE", port))
+		}
+	}
+
+	entrypoint, err := container.Entrypoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entrypoint: %w", err)
+	}
+	entrypointCheck := &HardeningCheck{Code: "SA-DI-0002", Title: "Use an exec-form entrypoint", Level: "PASS"}
+	switch {
+	case len(entrypoint) == 0:
+		entrypointCheck.Level = "WARN"
+		entrypointCheck.Alerts = []string{"No entrypoint is set"}
+	case len(entrypoint) > 1 && entrypoint[1] == "-c" && strings.HasSuffix(entrypoint[0], "sh"):
+		entrypointCheck.Level = "WARN"
+		entrypointCheck.Alerts = []string{fmt.Sprintf("Entrypoint runs through a shell: %s", strings.Join(entrypoint, " "))}
+	}
+
+	return []*HardeningCheck{portCheck, entrypointCheck}, nil
+}
+
+// text renders the result for pipeline reports
+func (r *ConfigHardeningResult) text() string {
+	text := fmt.Sprintf("%d passed, %d failed at %s or above\n", r.Passed, r.Failed, r.FailOn)
+	for _, check := range r.Checks {
+		if check.Level == "PASS" {
+			continue
+		}
+		mark := "•"
+		if !check.Passed {
+			mark = "✗"
+		}
+		text += fmt.Sprintf("   %s %s [%s] %s", mark, check.Code, check.Level, check.Title)
+		if len(check.Alerts) > 0 {
+			text += ": " + strings.Join(check.Alerts, "; ")
+		}
+		text += "\n"
+	}
+	return text
+}
+
+// ConfigHardening checks the built image's config against CIS Docker image best
+// practices with Dockle: non-root user, healthcheck, credentials in environment
+// variables, setuid/setgid files, plus exposed ports and entrypoint
+// Independent of Trivy, so the result still gates when Trivy's checks change
+// Capabilities aren't part of the image; they are dropped by the pod securityContext
+func (m *SearchApi) ConfigHardening(
+	ctx context.Context,
+	container *dagger.Container,
+	// Level that fails the check: FATAL, WARN or INFO
+	// +default="FATAL"
+	failOn string,
+	// Check codes to skip (e.g., "CIS-DI-0005" when content trust isn't used)
+	// +optional
+	ignore []string,
+) (*ConfigHardeningResult, error) {
+	failOn = strings.ToUpper(failOn)
+	threshold, ok := hardeningLevels[failOn]
+	if !ok || threshold == 0 {
+		return nil, fmt.Errorf("invalid failOn level %q: expected FATAL, WARN or INFO", failOn)
+	}
+
+	output, err := dag.Dockle().Scan(ctx, container, dagger.DockleScanOpts{
+		Format: "json",
+		Ignore: ignore,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Dockle scan failed: %w", err)
+	}
+	var report dockleReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("invalid Dockle report: %w", err)
+	}
+
+	result := &ConfigHardeningResult{FailOn: failOn, Passed: report.Summary.Pass, Report: output}
+	for _, detail := range report.Details {
+		result.Checks = append(result.Checks, &HardeningCheck{
+			Code:   detail.Code,
+			Title:  detail.Title,
+			Level:  strings.ToUpper(detail.Level),
+			Alerts: detail.Alerts,
+		})
+	}
+
+	configChecks, err := imageConfigChecks(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range configChecks {
+		skipped := false
+		for _, code := range ignore {
+			skipped = skipped || code == check.Code
+		}
+		if !skipped {
+			result.Checks = append(result.Checks, check)
+		}
+	}
+
+	for _, check := range result.Checks {
+		check.Passed = hardeningLevels[check.Level] < threshold
+		switch {
+		case !check.Passed:
+			result.Failed++
+		case check.Level == "PASS":
+			result.Passed++
+		}
+	}
+	if result.Failed > 0 {
+		return result, fmt.Errorf("%d image config check(s) failed at %s or above:\n%s", result.Failed, failOn, result.text())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"time"
+)
+
+// apiStartupTimeout is how long pipeline steps wait for a started API to become healthy
+const apiStartupTimeout = 2 * time.Minute
+
+// healthScript polls the API until the path answers 200 or the deadline passes,
+// reporting the last status so a 503 (Solr down) is told apart from no answer at all
+const healthScript = `deadline=$(( $(date +%s) + TIMEOUT_SECONDS ))
+while :; do
+  status=$(curl -s -o /dev/null -w '%{http_code}' --max-time 5 "http://api:8080$HEALTH_PATH" || true)
+  [ "$status" = "200" ] && exit 0
+  if [ "$(date +%s)" -ge "$deadline" ]; then
+    echo "$HEALTH_PATH answered ${status:-000} after ${TIMEOUT_SECONDS}s" >&2
+    exit 1
+  fi
+  sleep 2
+done
+`
+
+// waitForHealthy starts the API and waits until the path answers 200
+// Starting it explicitly keeps the instance running for the steps that follow, so
+// they don't each bind a cold API that is still connecting to Solr
+func waitForHealthy(ctx context.Context, api *dagger.Service, path string, timeout time.Duration) error {
+	if _, err := api.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start the API: %w", err)
+	}
+	_, err := dag.Container().
+		From(curlImage).
+		WithServiceBinding("api", api).
+		WithEnvVariable("HEALTH_PATH", path).
+		WithEnvVariable("TIMEOUT_SECONDS", fmt.Sprint(int(timeout.Seconds()))).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", healthScript}).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("API did not become healthy: %w", err)
+	}
+	return nil
+}
+
+// WaitForHealthy starts the API and polls a health endpoint until it answers 200,
+// failing after the timeout; use it before running tests against a service from
+// RunApiWithServices, which returns before the API and Solr have started
+func (m *SearchApi) WaitForHealthy(
+	ctx context.Context,
+	// Running API, listening on port 8080
+	apiService *dagger.Service,
+	// +default="/health"
+	path string,
+	// How long to wait (e.g., "90s", "2m")
+	// +default="2m"
+	timeout string,
+) error {
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q: %w", timeout, err)
+	}
+	return waitForHealthy(ctx, apiService, path, duration)
+}
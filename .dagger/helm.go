@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// kubeconformImage validates rendered manifests against the Kubernetes schemas
+const kubeconformImage = "ghcr.io/yannh/kubeconform:v0.6.7-alpine"
+
+// helmPushOutput matches the reference and digest helm push reports
+var helmPushOutput = regexp.MustCompile(`(?m)^Pushed:\s*(\S+)\s*\nDigest:\s*(sha256:[a-f0-9]{64})`)
+
+// PackageHelmChart lints the chart, renders and validates its manifests, and
+// packages it with the release version as both chart and app version, so the
+// chart deploys the image built from the same commit
+func (m *SearchApi) PackageHelmChart(
+	ctx context.Context,
+	// Repository including .git (the version is computed from its history)
+	// +defaultPath="/"
+	source *dagger.Directory,
+	// Chart directory within the source
+	// +default="helm/search-api"
+	chartDir string,
+	// Chart and app version (defaults to the computed version, see ComputeVersion)
+	// +optional
+	version string,
+) (*dagger.File, error) {
+	if version == "" {
+		computed, err := computeVersion(ctx, source, "")
+		if err != nil {
+			return nil, err
+		}
+		version = computed.Version
+	}
+	version = strings.TrimPrefix(version, "v")
+
+	chart := source.Directory(chartDir)
+	set := []string{"image.tag=" + version}
+	if _, err := dag.Helm().Lint(ctx, chart, dagger.HelmLintOpts{Strict: true, Set: set}); err != nil {
+		return nil, fmt.Errorf("helm lint failed: %w", err)
+	}
+
+	manifests, err := dag.Helm().Template(ctx, chart, dagger.HelmTemplateOpts{
+		ReleaseName: "search-api",
+		Namespace:   "search-system",
+		Set:         set,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
+	if _, err := dag.Container().
+		From(kubeconformImage).
+		WithNewFile("/work/manifests.yaml", manifests).
+		WithExec([]string{"/kubeconform", "-strict", "-summary", "/work/manifests.yaml"}).
+		Stdout(ctx); err != nil {
+		return nil, fmt.Errorf("rendered chart manifests are invalid: %w", err)
+	}
+
+	return dag.Helm().Package(chart, dagger.HelmPackageOpts{
+		Version:    version,
+		AppVersion: version,
+	}), nil
+}
+
+// PushHelmChart pushes a packaged chart to an OCI registry, next to the image
+// The chart is pushed to <registryUrl>/<repository>/<chart name>:<version>; keep
+// charts in their own repository so a chart tag can't overwrite an image tag
+func (m *SearchApi) PushHelmChart(
+	ctx context.Context,
+	// Chart archive (see PackageHelmChart)
+	chart *dagger.File,
+	registryUrl string,
+	username *dagger.Secret,
+	password *dagger.Secret,
+	// Repository path the chart is pushed under (e.g., "myorg/charts")
+	repository string,
+	// Push attempts; network errors are retried with exponential backoff
+	// +default=3
+	retries int,
+) (*PushedImage, error) {
+	usernameStr, err := username.Plaintext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read username: %w", err)
+	}
+	remote := "oci://" + strings.TrimSuffix(registryUrl, "/") + "/" + strings.Trim(repository, "/")
+
+	var output string
+	_, err = retryPolicy(retries).retry(ctx, "Chart push", func() (err error) {
+		output, err = dag.Helm().Push(ctx, chart, remote, dagger.HelmPushOpts{
+			RegistryURL: registryUrl,
+			Username:    usernameStr,
+			Password:    password,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("helm push failed: %w", err)
+	}
+
+	match := helmPushOutput.FindStringSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("helm push output has no pushed reference and digest:\n%s", output)
+	}
+	ref, digest := match[1], match[2]
+	chartRepository, tag := ref, ""
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		chartRepository, tag = ref[:i], ref[i+1:]
+	}
+	return &PushedImage{
+		Address:    ref + "@" + digest,
+		Repository: chartRepository,
+		Tags:       []string{tag},
+		Digest:     digest,
+		Ref:        chartRepository + "@" + digest,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// httpRequest describes a call to an external HTTP API made with curl
+type httpRequest struct {
+	method string
+	url    string
+	// URL kept secret (e.g., a webhook URL that embeds its credential), instead of url
+	secretUrl *dagger.Secret
+	headers   []string
+	body      string
+	// File sent as the raw request body, instead of body
+	upload *dagger.File
+	// Multipart form fields ("name=value"), sent instead of body
+	form []string
+	// Files sent as multipart form fields
+	files []formFile
+	// Secret sent as "<authPrefix> <token>" header (e.g. "Authorization: Bearer")
+	token      *dagger.Secret
+	authPrefix string
+}
+
+// formFile is a file uploaded as a multipart form field
+type formFile struct {
+	field string
+	name  string
+	file  *dagger.File
+}
+
+// do executes the request and returns the response body
+// Calls to external systems must never be served from the Dagger cache, so every
+// invocation busts it; the token is injected as a secret variable to keep it out of logs
+func (r httpRequest) do(ctx context.Context) (string, error) {
+	args := []string{"curl", "-sS", "--fail-with-body", "-X", r.method}
+	for _, h := range r.headers {
+		args = append(args, "-H", h)
+	}
+
+	ctr := dag.Container().
+		From(curlImage).
+		WithEnvVariable("CACHEBUSTER", time.Now().Format(time.RFC3339Nano))
+
+	if r.body != "" {
+		ctr = ctr.WithNewFile("/tmp/request-body", r.body)
+		args = append(args, "--data-binary", "@/tmp/request-body")
+	}
+	if r.upload != nil {
+		ctr = ctr.WithMountedFile("/tmp/upload-body", r.upload)
+		args = append(args, "--data-binary", "@/tmp/upload-body")
+	}
+	for _, field := range r.form {
+		// --form-string doesn't treat values starting with @ or < as files
+		args = append(args, "--form-string", field)
+	}
+	for _, f := range r.files {
+		ctr = ctr.WithMountedFile("/tmp/upload/"+f.name, f.file)
+		args = append(args, "-F", fmt.Sprintf("%s=@/tmp/upload/%s", f.field, f.name))
+	}
+	// Secrets are expanded inside the shell so they never appear in the exec args
+	var expanded []string
+	if r.secretUrl != nil {
+		ctr = ctr.WithSecretVariable("REQUEST_URL", r.secretUrl)
+		expanded = append(expanded, `"$REQUEST_URL"`)
+	} else {
+		args = append(args, r.url)
+	}
+	if r.token != nil {
+		ctr = ctr.
+			WithSecretVariable("API_TOKEN", r.token).
+			WithEnvVariable("AUTH_PREFIX", r.authPrefix)
+		expanded = append(expanded, `-H "$AUTH_PREFIX $API_TOKEN"`)
+	}
+	if len(expanded) > 0 {
+		args = append([]string{"sh", "-c", `exec "$@" ` + strings.Join(expanded, " "), "curl"}, args...)
+	}
+
+	return ctr.WithExec(args).Stdout(ctx)
+}
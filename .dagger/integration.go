@@ -0,0 +1,456 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"dagger/search-api/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const integrationTestProject = "SearchApi.IntegrationTests/SearchApi.IntegrationTests.csproj"
+
+// testClass returns the class part of a fully qualified test name
+func testClass(name string) string {
+	if i := strings.Index(name, "("); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// listTestClasses returns the sorted test classes of the integration test project
+func listTestClasses(ctx context.Context, build *dagger.Container) ([]string, error) {
+	output, err := build.
+		WithExec([]string{"dotnet", "test", integrationTestProject, "-c", buildConfig, "--no-build", "--list-tests"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list integration tests: %w", err)
+	}
+
+	seen := map[string]bool{}
+	listing := false
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "The following Tests are available") {
+			listing = true
+			continue
+		}
+		name := strings.TrimSpace(line)
+		if !listing || name == "" || !strings.HasPrefix(line, "    ") {
+			continue
+		}
+		seen[testClass(name)] = true
+	}
+
+	classes := make([]string, 0, len(seen))
+	for class := range seen {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes, nil
+}
+
+// assignShards distributes test classes over shards
+// With prior timings the slowest classes are placed first, each on the currently
+// lightest shard; without timings classes are dealt out round-robin
+func assignShards(classes []string, shardCount int, timings map[string]time.Duration) [][]string {
+	shards := make([][]string, shardCount)
+	if len(timings) == 0 {
+		for i, class := range classes {
+			shards[i%shardCount] = append(shards[i%shardCount], class)
+		}
+		return shards
+	}
+
+	// Classes without timing data (new tests) are assumed to take the average
+	var total time.Duration
+	for _, d := range timings {
+		total += d
+	}
+	average := total / time.Duration(len(timings))
+	duration := func(class string) time.Duration {
+		if d, ok := timings[class]; ok {
+			return d
+		}
+		return average
+	}
+
+	ordered := slices.Clone(classes)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return cmp.Compare(duration(b), duration(a))
+	})
+
+	load := make([]time.Duration, shardCount)
+	for _, class := range ordered {
+		lightest := slices.Index(load, slices.Min(load))
+		shards[lightest] = append(shards[lightest], class)
+		load[lightest] += duration(class)
+	}
+	return shards
+}
+
+// shardFilter builds a dotnet test --filter expression selecting the given classes
+// The trailing dot keeps "FooTests" from also matching "FooTestsExtended"
+func shardFilter(classes []string) string {
+	terms := make([]string, len(classes))
+	for i, class := range classes {
+		terms[i] = "FullyQualifiedName~" + class + "."
+	}
+	return strings.Join(terms, "|")
+}
+
+// trxInner captures an element's children verbatim for merging
+type trxInner struct {
+	Inner string `xml:",innerxml"`
+}
+
+// trxCounters is the ResultSummary/Counters element of a TRX file
+type trxCounters struct {
+	Total        int `xml:"total,attr"`
+	Executed     int `xml:"executed,attr"`
+	Passed       int `xml:"passed,attr"`
+	Failed       int `xml:"failed,attr"`
+	Error        int `xml:"error,attr"`
+	Timeout      int `xml:"timeout,attr"`
+	Aborted      int `xml:"aborted,attr"`
+	Inconclusive int `xml:"inconclusive,attr"`
+	NotExecuted  int `xml:"notExecuted,attr"`
+}
+
+// trxRun is the subset of a Visual Studio TRX file needed to merge shard results
+// and convert them to JUnit
+type trxRun struct {
+	Results struct {
+		Inner       string `xml:",innerxml"`
+		TestResults []struct {
+			TestName string `xml:"testName,attr"`
+			Duration string `xml:"duration,attr"`
+			Outcome  string `xml:"outcome,attr"`
+			Output   struct {
+				StdOut    string `xml:"StdOut"`
+				ErrorInfo struct {
+					Message    string `xml:"Message"`
+					StackTrace string `xml:"StackTrace"`
+				} `xml:"ErrorInfo"`
+			} `xml:"Output"`
+		} `xml:"UnitTestResult"`
+	} `xml:"Results"`
+	Definitions trxInner `xml:"TestDefinitions"`
+	Entries     trxInner `xml:"TestEntries"`
+	TestLists   trxInner `xml:"TestLists"`
+	Summary     struct {
+		Outcome  string      `xml:"outcome,attr"`
+		Counters trxCounters `xml:"Counters"`
+	} `xml:"ResultSummary"`
+}
+
+func parseTrx(content string) (*trxRun, error) {
+	var run trxRun
+	if err := xml.Unmarshal([]byte(content), &run); err != nil {
+		return nil, fmt.Errorf("invalid TRX: %w", err)
+	}
+	return &run, nil
+}
+
+// parseTrxDuration parses TRX durations ("00:00:01.2345678")
+func parseTrxDuration(value string) time.Duration {
+	var hours, minutes int
+	var seconds float64
+	if _, err := fmt.Sscanf(value, "%d:%d:%f", &hours, &minutes, &seconds); err != nil {
+		return 0
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
+
+// classTimings sums test durations per class from a previous TRX run
+func classTimings(run *trxRun) map[string]time.Duration {
+	timings := map[string]time.Duration{}
+	for _, r := range run.Results.TestResults {
+		timings[testClass(r.TestName)] += parseTrxDuration(r.Duration)
+	}
+	return timings
+}
+
+// failedTests lists the tests of a TRX run that neither passed nor were left out on
+// purpose (errors, timeouts, aborted or inconclusive tests, with their outcome), and
+// the run itself when it didn't complete without a failed test to show for it
+func failedTests(run *trxRun) []string {
+	var failed []string
+	for _, r := range run.Results.TestResults {
+		switch r.Outcome {
+		case "Passed", "NotExecuted":
+		case "Failed":
+			failed = append(failed, r.TestName)
+		default:
+			failed = append(failed, fmt.Sprintf("%s (%s)", r.TestName, cmp.Or(r.Outcome, "no outcome")))
+		}
+	}
+	if outcome := run.Summary.Outcome; outcome != "Completed" && (outcome != "Failed" || len(failed) == 0) {
+		failed = append(failed, fmt.Sprintf("test run %s", cmp.Or(outcome, "without an outcome")))
+	}
+	return failed
+}
+
+// mergeTrx combines shard TRX files into a single run with summed counters
+func mergeTrx(runs []*trxRun) string {
+	var results, definitions, entries strings.Builder
+	var counters trxCounters
+	outcome := "Completed"
+	id := sha256.New()
+
+	for _, run := range runs {
+		results.WriteString(run.Results.Inner)
+		definitions.WriteString(run.Definitions.Inner)
+		entries.WriteString(run.Entries.Inner)
+		id.Write([]byte(run.Entries.Inner))
+
+		c := run.Summary.Counters
+		counters.Total += c.Total
+		counters.Executed += c.Executed
+		counters.Passed += c.Passed
+		counters.Failed += c.Failed
+		counters.Error += c.Error
+		counters.Timeout += c.Timeout
+		counters.Aborted += c.Aborted
+		counters.Inconclusive += c.Inconclusive
+		counters.NotExecuted += c.NotExecuted
+		if run.Summary.Outcome != "Completed" {
+			outcome = "Failed"
+		}
+	}
+
+	// Test lists use fixed IDs, so every shard declares the same ones
+	testLists := ""
+	if len(runs) > 0 {
+		testLists = runs[0].TestLists.Inner
+	}
+
+	sum := fmt.Sprintf("%x", id.Sum(nil))
+	runID := fmt.Sprintf("%s-%s-%s-%s-%s", sum[0:8], sum[8:12], sum[12:16], sum[16:20], sum[20:32])
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	fmt.Fprintf(&sb, `<TestRun id="%s" name="SearchApi.IntegrationTests (%d shards)" xmlns="http://microsoft.com/schemas/VisualStudio/TeamTest/2010">`+"\n", runID, len(runs))
+	fmt.Fprintf(&sb, "  <Results>%s</Results>\n", results.String())
+	fmt.Fprintf(&sb, "  <TestDefinitions>%s</TestDefinitions>\n", definitions.String())
+	fmt.Fprintf(&sb, "  <TestEntries>%s</TestEntries>\n", entries.String())
+	fmt.Fprintf(&sb, "  <TestLists>%s</TestLists>\n", testLists)
+	fmt.Fprintf(&sb, "  <ResultSummary outcome=%q>\n", outcome)
+	fmt.Fprintf(&sb, `    <Counters total="%d" executed="%d" passed="%d" failed="%d" error="%d" timeout="%d" aborted="%d" inconclusive="%d" notExecuted="%d" />`+"\n",
+		counters.Total, counters.Executed, counters.Passed, counters.Failed, counters.Error,
+		counters.Timeout, counters.Aborted, counters.Inconclusive, counters.NotExecuted)
+	sb.WriteString("  </ResultSummary>\n</TestRun>\n")
+	return sb.String()
+}
+
+// loadTimings reads per-class durations from a previous TRX file, if one is given
+func loadTimings(ctx context.Context, timings *dagger.File) (map[string]time.Duration, error) {
+	if timings == nil {
+		return nil, nil
+	}
+	content, err := timings.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timings: %w", err)
+	}
+	run, err := parseTrx(content)
+	if err != nil {
+		return nil, err
+	}
+	return classTimings(run), nil
+}
+
+// isolatedTestRun runs the tests matching filter (all when empty) against an API and
+// Solr of their own, distinguished by instance; Dagger stops both services as soon
+// as the test exec finishes, so nothing outlives the run
+func isolatedTestRun(ctx context.Context, build *dagger.Container, container *dagger.Container, solrVersion string, snapshot *dagger.Directory, instance string, filter string) (*trxRun, error) {
+	solr := solrService(solrVersion, snapshot, instance)
+	trxName := instance + ".trx"
+
+	args := []string{"dotnet", "test", integrationTestProject, "-c", buildConfig, "--no-build"}
+	if filter != "" {
+		args = append(args, "--filter", filter)
+	}
+	args = append(args, "--logger", "trx;LogFileName="+trxName, "--results-directory", "/results")
+
+	content, err := build.
+		WithServiceBinding("solr", solr).
+		WithServiceBinding("api", apiWithSolr(container, solr)).
+		WithEnvVariable("API_URL", "http://api:8080").
+		WithEnvVariable("SOLR_URL", "http://solr:8983/solr/"+solrCore).
+		WithExec(args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		File("/results/" + trxName).
+		Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s produced no results: %w", instance, err)
+	}
+
+	run, err := parseTrx(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", instance, err)
+	}
+	return run, nil
+}
+
+// RunIntegrationTestsSharded splits the integration suite by test class across
+// parallel containers, each against its own API and Solr instance, and merges the
+// shard results into a single TRX file
+// With isolation "class" every test class gets a fresh API and Solr, so destructive
+// indexing tests can't affect other classes; shardCount then limits concurrency
+func (m *SearchApi) RunIntegrationTestsSharded(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// API container image to run for each shard
+	container *dagger.Container,
+	// Number of parallel shards
+	// +default=4
+	shardCount int,
+	// TRX file from a previous run, used to balance shards by class duration
+	// +optional
+	timings *dagger.File,
+	// Seeded Solr data directory from SnapshotSolr, restored for every shard
+	// +optional
+	solrSnapshot *dagger.Directory,
+	// Return an error when tests fail (disable to always get the merged TRX)
+	// +default=true
+	failOnFailure bool,
+	// Scope of a Solr instance: "shard" (shared by the classes in a shard) or "class"
+	// +default="shard"
+	isolation string,
+) (*dagger.File, error) {
+	if shardCount < 1 {
+		return nil, fmt.Errorf("shard count must be at least 1, got %d", shardCount)
+	}
+	if isolation != "shard" && isolation != "class" {
+		return nil, fmt.Errorf("unknown isolation %q: expected \"shard\" or \"class\"", isolation)
+	}
+
+	build := buildBase(source)
+	classes, err := listTestClasses(ctx, build)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := loadTimings(ctx, timings)
+	if err != nil {
+		return nil, err
+	}
+
+	var shards [][]string
+	if isolation == "class" {
+		for _, class := range classes {
+			shards = append(shards, []string{class})
+		}
+	} else {
+		shards = assignShards(classes, shardCount, previous)
+	}
+	runs := make([]*trxRun, len(shards))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(shardCount)
+	for i, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		g.Go(func() error {
+			run, err := isolatedTestRun(gctx, build, container, "", solrSnapshot, fmt.Sprintf("%s-%d", isolation, i), shardFilter(shard))
+			if err != nil {
+				return err
+			}
+			runs[i] = run
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	completed := slices.DeleteFunc(runs, func(r *trxRun) bool { return r == nil })
+	merged := mergeTrx(completed)
+
+	if failOnFailure {
+		var failed []string
+		for _, run := range completed {
+			failed = append(failed, failedTests(run)...)
+		}
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("integration tests failed (%d across %d shards):\n  %s",
+				len(failed), len(completed), strings.Join(failed, "\n  "))
+		}
+	}
+
+	return dag.Directory().
+		WithNewFile("integration-tests.trx", merged).
+		File("integration-tests.trx"), nil
+}
+
+// SolrVersionMatrix runs the integration suite against each Solr version, every one
+// restored from an index seeded with the same fixtures, to check compatibility
+// before a Solr upgrade; seeded indexes are cached per version and fixture hash
+func (m *SearchApi) SolrVersionMatrix(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// API container image to test
+	container *dagger.Container,
+	// Directory with fixture documents (see SnapshotSolr)
+	fixtures *dagger.Directory,
+	// Solr versions (image tags) to test against
+	// +default=["8.11", "9.4"]
+	versions []string,
+) (string, error) {
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no Solr versions given")
+	}
+
+	build := buildBase(source)
+	runs := make([]*trxRun, len(versions))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, version := range versions {
+		g.Go(func() error {
+			snapshot, err := m.SnapshotSolr(gctx, fixtures, solrCore, version)
+			if err != nil {
+				return fmt.Errorf("Solr %s: %w", version, err)
+			}
+			runs[i], err = isolatedTestRun(gctx, build, container, version, snapshot, "solr-"+version, "")
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+
+	report := "🧪 Solr Version Matrix\n\n"
+	report += "| Solr | Passed | Failed | Total |\n|---|---|---|---|\n"
+	var failures []string
+	var incompatible []string
+	for i, run := range runs {
+		failed := failedTests(run)
+		report += fmt.Sprintf("| %s | %d | %d | %d |\n", versions[i], run.Summary.Counters.Passed, len(failed), run.Summary.Counters.Total)
+		for _, name := range failed {
+			failures = append(failures, fmt.Sprintf("  ❌ [Solr %s] %s\n", versions[i], name))
+		}
+		if len(failed) > 0 {
+			incompatible = append(incompatible, versions[i])
+		}
+	}
+	if len(failures) > 0 {
+		report += "\nFailed tests:\n" + strings.Join(failures, "")
+	}
+
+	if len(incompatible) > 0 {
+		return report, fmt.Errorf("integration tests failed against Solr %s", strings.Join(incompatible, ", "))
+	}
+	report += "\n✅ API is compatible with every tested Solr version\n"
+	return report, nil
+}
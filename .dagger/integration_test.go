@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// trxFixture is a shard's TRX file with the given results and summary outcome
+func trxFixture(t *testing.T, summary string, results ...[2]string) *trxRun {
+	t.Helper()
+	content := `<TestRun xmlns="http://microsoft.com/schemas/VisualStudio/TeamTest/2010"><Results>`
+	passed, failed := 0, 0
+	for _, r := range results {
+		content += `<UnitTestResult testName="` + r[0] + `" duration="00:00:01.5000000" outcome="` + r[1] + `" />`
+		switch r[1] {
+		case "Passed":
+			passed++
+		case "Failed":
+			failed++
+		}
+	}
+	content += `</Results><TestDefinitions /><TestEntries /><TestLists><TestList id="8c84fa94" /></TestLists>`
+	content += `<ResultSummary outcome="` + summary + `"><Counters total="` + strconv.Itoa(len(results)) + `" executed="` + strconv.Itoa(len(results)) +
+		`" passed="` + strconv.Itoa(passed) + `" failed="` + strconv.Itoa(failed) + `" /></ResultSummary></TestRun>`
+	run, err := parseTrx(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return run
+}
+
+func TestFailedTests(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary string
+		results [][2]string
+		want    []string
+	}{
+		{"all passed", "Completed", [][2]string{{"A.One", "Passed"}, {"A.Two", "NotExecuted"}}, nil},
+		{"failed", "Failed", [][2]string{{"A.One", "Passed"}, {"A.Two", "Failed"}}, []string{"A.Two"}},
+		{"error and timeout", "Failed", [][2]string{{"A.One", "Error"}, {"A.Two", "Timeout"}, {"A.Three", "Inconclusive"}},
+			[]string{"A.One (Error)", "A.Two (Timeout)", "A.Three (Inconclusive)"}},
+		{"missing outcome", "Completed", [][2]string{{"A.One", ""}}, []string{"A.One (no outcome)"}},
+		{"failed run without failed tests", "Failed", [][2]string{{"A.One", "Passed"}}, []string{"test run Failed"}},
+		{"aborted run", "Aborted", [][2]string{{"A.One", "Failed"}}, []string{"A.One", "test run Aborted"}},
+		{"no results", "", nil, []string{"test run without an outcome"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failedTests(trxFixture(t, tt.summary, tt.results...)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failedTests() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTrx(t *testing.T) {
+	shards := []*trxRun{
+		trxFixture(t, "Completed", [2]string{"A.One", "Passed"}, [2]string{"A.Two", "Passed"}),
+		trxFixture(t, "Failed", [2]string{"B.One", "Failed"}),
+	}
+	merged, err := parseTrx(mergeTrx(shards))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Summary.Outcome != "Failed" {
+		t.Errorf("outcome = %s, want Failed", merged.Summary.Outcome)
+	}
+	if c := merged.Summary.Counters; c.Total != 3 || c.Passed != 2 || c.Failed != 1 {
+		t.Errorf("counters = %+v, want 3 total, 2 passed, 1 failed", c)
+	}
+	if len(merged.Results.TestResults) != 3 {
+		t.Errorf("got %d results, want 3", len(merged.Results.TestResults))
+	}
+	if got := failedTests(merged); !reflect.DeepEqual(got, []string{"B.One"}) {
+		t.Errorf("failedTests(merged) = %q", got)
+	}
+
+	completed, err := parseTrx(mergeTrx(shards[:1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed.Summary.Outcome != "Completed" {
+		t.Errorf("outcome of passing shards = %s, want Completed", completed.Summary.Outcome)
+	}
+}
+
+func TestAssignShards(t *testing.T) {
+	classes := []string{"A", "B", "C", "D", "E"}
+	tests := []struct {
+		name    string
+		shards  int
+		timings map[string]time.Duration
+		want    [][]string
+	}{
+		{"round robin", 2, nil, [][]string{{"A", "C", "E"}, {"B", "D"}}},
+		{"more shards than classes", 7, nil, [][]string{{"A"}, {"B"}, {"C"}, {"D"}, {"E"}, nil, nil}},
+		{"by timing", 2, map[string]time.Duration{"A": 10 * time.Second, "B": 1 * time.Second, "C": 6 * time.Second, "D": 3 * time.Second},
+			// E has no timing and takes the average (5s)
+			[][]string{{"A", "D"}, {"C", "E", "B"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := assignShards(classes, tt.shards, tt.timings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assignShards() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestClass(t *testing.T) {
+	tests := map[string]string{
+		"SearchApi.IntegrationTests.SearchTests.ReturnsHits":              "SearchApi.IntegrationTests.SearchTests",
+		"SearchApi.IntegrationTests.SearchTests.Pages(size: 10, page: 2)": "SearchApi.IntegrationTests.SearchTests",
+		"Standalone": "Standalone",
+	}
+	for name, want := range tests {
+		if got := testClass(name); got != want {
+			t.Errorf("testClass(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got, want := shardFilter([]string{"A.FooTests", "A.BarTests"}), "FullyQualifiedName~A.FooTests.|FullyQualifiedName~A.BarTests."; got != want {
+		t.Errorf("shardFilter() = %q, want %q", got, want)
+	}
+	if got, want := parseTrxDuration("01:02:03.5"), time.Hour+2*time.Minute+3500*time.Millisecond; got != want {
+		t.Errorf("parseTrxDuration() = %v, want %v", got, want)
+	}
+}
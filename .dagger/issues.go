@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Label applied to every ticket managed by SyncIssues
+const findingLabel = "security-finding"
+
+// trackedIssue is an open ticket created for a finding
+type trackedIssue struct {
+	// Issue number (GitHub) or key (Jira)
+	id          string
+	fingerprint string
+	// Severity and scanners of the finding, as recorded in the ticket's description
+	severity string
+	sources  []string
+	// Already marked as no longer reported (Jira without a close transition)
+	resolved bool
+}
+
+// closable reports whether a ticket whose finding isn't in the current reports may
+// be closed: every scanner that reported the finding must have a report now, and
+// the finding's severity must still get tickets. A missing report or a narrowed
+// severity list says nothing about whether the finding is fixed
+func (t trackedIssue) closable(scanned map[string]bool, severities []string) bool {
+	if t.resolved || len(t.sources) == 0 || !containsSeverity(severities, t.severity) {
+		return false
+	}
+	for _, source := range t.sources {
+		if !scanned[source] {
+			return false
+		}
+	}
+	return true
+}
+
+// issueTracker abstracts the ticket operations SyncIssues needs
+type issueTracker interface {
+	// openIssues returns open finding tickets keyed by fingerprint
+	openIssues(ctx context.Context) (map[string]trackedIssue, error)
+	create(ctx context.Context, f Finding, body string) error
+	update(ctx context.Context, issue trackedIssue, body string) error
+	close(ctx context.Context, issue trackedIssue) error
+	// reopen clears a no-longer-reported mark when the finding is reported again
+	reopen(ctx context.Context, issue trackedIssue) error
+}
+
+// SyncIssues opens, updates and closes tickets for security findings
+// Each finding at a configured severity gets exactly one ticket, tracked by its
+// fingerprint; tickets whose finding is no longer reported are closed, as long as
+// the scanners that reported it have a report in the directory
+func (m *SearchApi) SyncIssues(
+	ctx context.Context,
+	// Directory of scan reports (e.g., output of ExportPipelineReports)
+	reports *dagger.Directory,
+	// Issue tracker: github or jira
+	// +default="github"
+	tracker string,
+	// GitHub token, or Jira API token
+	token *dagger.Secret,
+	// GitHub repository (owner/repo) or Jira project key
+	project string,
+	// Severities that get a ticket
+	// +default=["HIGH", "CRITICAL"]
+	severities []string,
+	// Link to the report artifacts, included in every ticket
+	// +optional
+	reportUrl string,
+	// API base URL (GitHub Enterprise, or Jira site such as "https://myorg.atlassian.net")
+	// +optional
+	apiUrl string,
+	// Jira account email (Jira authenticates with email + API token)
+	// +optional
+	jiraUser string,
+	// Jira issue type for new tickets
+	// +default="Bug"
+	jiraIssueType string,
+	// Jira transition ID that resolves a ticket (if unset, tickets are commented on
+	// and labeled finding-not-reported once instead)
+	// +optional
+	jiraCloseTransition string,
+) (string, error) {
+	all, err := collectFindings(ctx, reports)
+	if err != nil {
+		return "", err
+	}
+	scanned, err := scannedTools(ctx, reports)
+	if err != nil {
+		return "", err
+	}
+	findings := filterBySeverity(all, severities)
+
+	var it issueTracker
+	switch tracker {
+	case "github":
+		if apiUrl == "" {
+			apiUrl = "https://api.github.com"
+		}
+		it = &githubIssues{apiUrl: strings.TrimSuffix(apiUrl, "/"), repo: project, token: token}
+	case "jira":
+		if apiUrl == "" || jiraUser == "" {
+			return "", fmt.Errorf("jira requires apiUrl and jiraUser")
+		}
+		password, err := token.Plaintext(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Jira token: %w", err)
+		}
+		basic := base64.StdEncoding.EncodeToString([]byte(jiraUser + ":" + password))
+		it = &jiraIssues{
+			apiUrl:          strings.TrimSuffix(apiUrl, "/"),
+			project:         project,
+			issueType:       jiraIssueType,
+			closeTransition: jiraCloseTransition,
+			auth:            dag.SetSecret("jira-basic-auth", basic),
+		}
+	default:
+		return "", fmt.Errorf("unknown tracker %q (expected github or jira)", tracker)
+	}
+
+	open, err := it.openIssues(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list open issues: %w", err)
+	}
+
+	opened, updated, closed := 0, 0, 0
+	// A finding still reported below the tracked severities keeps its ticket open
+	seen := map[string]bool{}
+	for _, f := range all {
+		seen[f.Fingerprint] = true
+	}
+	for _, f := range findings {
+		body := issueBody(f, reportUrl)
+		if issue, ok := open[f.Fingerprint]; ok {
+			if err := it.update(ctx, issue, body); err != nil {
+				return "", fmt.Errorf("failed to update issue %s: %w", issue.id, err)
+			}
+			if issue.resolved {
+				if err := it.reopen(ctx, issue); err != nil {
+					return "", fmt.Errorf("failed to reopen issue %s: %w", issue.id, err)
+				}
+			}
+			updated++
+			continue
+		}
+		if err := it.create(ctx, f, body); err != nil {
+			return "", fmt.Errorf("failed to create issue for %s: %w", f.RuleID, err)
+		}
+		opened++
+	}
+
+	for fp, issue := range open {
+		if seen[fp] || !issue.closable(scanned, severities) {
+			continue
+		}
+		if err := it.close(ctx, issue); err != nil {
+			return "", fmt.Errorf("failed to close issue %s: %w", issue.id, err)
+		}
+		closed++
+	}
+
+	return fmt.Sprintf("Issue sync (%s): %d opened, %d updated, %d closed\n", tracker, opened, updated, closed), nil
+}
+
+// issueTitle builds the ticket title for a finding
+func issueTitle(f Finding) string {
+	subject := f.Location
+	if f.Package != "" {
+		subject = f.Package
+	}
+	return fmt.Sprintf("[%s] %s in %s", f.Severity, f.RuleID, subject)
+}
+
+// issueBody renders the ticket description for a finding
+// The fingerprint marker lets later runs find the ticket again
+func issueBody(f Finding, reportUrl string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n\n", f.Title)
+	fmt.Fprintf(&b, "| Field | Value |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Severity | %s |\n", f.Severity)
+	fmt.Fprintf(&b, "| Scanners | %s |\n", strings.Join(f.Sources, ", "))
+	fmt.Fprintf(&b, "| Rule | %s |\n", f.RuleID)
+	if f.CWE != "" {
+		fmt.Fprintf(&b, "| CWE | %s |\n", f.CWE)
+	}
+	if f.Package != "" {
+		fmt.Fprintf(&b, "| Package | %s %s |\n", f.Package, f.Version)
+	}
+	if f.FixedVersion != "" {
+		fmt.Fprintf(&b, "| Fixed in | %s |\n", f.FixedVersion)
+	}
+	if f.Location != "" {
+		location := f.Location
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.Location, f.Line)
+		}
+		fmt.Fprintf(&b, "| Location | %s |\n", location)
+	}
+	if f.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", f.Description)
+	}
+	if f.URL != "" {
+		fmt.Fprintf(&b, "\nReference: %s\n", f.URL)
+	}
+	if reportUrl != "" {
+		fmt.Fprintf(&b, "\nPipeline reports: %s\n", reportUrl)
+	}
+	fmt.Fprintf(&b, "\n<!-- finding-fingerprint: %s -->\n", f.Fingerprint)
+	return b.String()
+}
+
+var fingerprintMarker = regexp.MustCompile(`<!-- finding-fingerprint: ([0-9a-f]+) -->`)
+
+// Rows of issueBody's table that closing a ticket depends on
+var (
+	severityRow = regexp.MustCompile(`(?m)^\| Severity \| (\w+) \|$`)
+	scannersRow = regexp.MustCompile(`(?m)^\| Scanners \| (.*) \|$`)
+)
+
+// parseIssueBody reads a ticket's finding severity and scanners back from the
+// description issueBody wrote
+func parseIssueBody(body string) (severity string, sources []string) {
+	if match := severityRow.FindStringSubmatch(body); match != nil {
+		severity = match[1]
+	}
+	if match := scannersRow.FindStringSubmatch(body); match != nil {
+		for _, source := range strings.Split(match[1], ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return severity, sources
+}
+
+// githubIssues manages finding tickets in GitHub Issues
+type githubIssues struct {
+	apiUrl string
+	repo   string
+	token  *dagger.Secret
+}
+
+func (g *githubIssues) request(method, path string, payload any) (httpRequest, error) {
+	req := httpRequest{
+		method: method,
+		url:    fmt.Sprintf("%s/repos/%s%s", g.apiUrl, g.repo, path),
+		headers: []string{
+			"Accept: application/vnd.github+json",
+			"X-GitHub-Api-Version: 2022-11-28",
+		},
+		token:      g.token,
+		authPrefix: "Authorization: Bearer",
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return req, err
+		}
+		req.body = string(body)
+		req.headers = append(req.headers, "Content-Type: application/json")
+	}
+	return req, nil
+}
+
+func (g *githubIssues) openIssues(ctx context.Context) (map[string]trackedIssue, error) {
+	open := map[string]trackedIssue{}
+	for page := 1; ; page++ {
+		req, _ := g.request("GET", fmt.Sprintf("/issues?state=open&labels=%s&per_page=100&page=%d", findingLabel, page), nil)
+		response, err := req.do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var issues []struct {
+			Number int    `json:"number"`
+			Body   string `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(response), &issues); err != nil {
+			return nil, fmt.Errorf("unexpected GitHub response: %w", err)
+		}
+		for _, issue := range issues {
+			if match := fingerprintMarker.FindStringSubmatch(issue.Body); match != nil {
+				severity, sources := parseIssueBody(issue.Body)
+				open[match[1]] = trackedIssue{id: fmt.Sprint(issue.Number), fingerprint: match[1], severity: severity, sources: sources}
+			}
+		}
+		if len(issues) < 100 {
+			return open, nil
+		}
+	}
+}
+
+func (g *githubIssues) create(ctx context.Context, f Finding, body string) error {
+	req, err := g.request("POST", "/issues", map[string]any{
+		"title":  issueTitle(f),
+		"body":   body,
+		"labels": []string{findingLabel, "severity:" + strings.ToLower(f.Severity)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (g *githubIssues) update(ctx context.Context, issue trackedIssue, body string) error {
+	req, err := g.request("PATCH", "/issues/"+issue.id, map[string]any{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (g *githubIssues) close(ctx context.Context, issue trackedIssue) error {
+	comment, err := g.request("POST", "/issues/"+issue.id+"/comments", map[string]any{
+		"body": "No longer reported by the pipeline - closing.",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := comment.do(ctx); err != nil {
+		return err
+	}
+
+	req, err := g.request("PATCH", "/issues/"+issue.id, map[string]any{
+		"state":        "closed",
+		"state_reason": "completed",
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+// reopen does nothing: closed GitHub issues aren't listed as open, so a finding
+// reported again gets a new issue
+func (g *githubIssues) reopen(ctx context.Context, issue trackedIssue) error {
+	return nil
+}
+
+// jiraNotReportedLabel marks an open Jira ticket whose finding is no longer reported
+const jiraNotReportedLabel = "finding-not-reported"
+
+// jiraIssues manages finding tickets in Jira
+// Jira has no HTML comments, so the fingerprint is stored as a label
+// Without a close transition a ticket stays open; it is labeled jiraNotReportedLabel
+// so it is only commented on once
+type jiraIssues struct {
+	apiUrl          string
+	project         string
+	issueType       string
+	closeTransition string
+	// Pre-encoded basic auth credentials
+	auth *dagger.Secret
+}
+
+func (j *jiraIssues) request(method, path string, payload any) (httpRequest, error) {
+	req := httpRequest{
+		method:     method,
+		url:        j.apiUrl + "/rest/api/2" + path,
+		headers:    []string{"Accept: application/json"},
+		token:      j.auth,
+		authPrefix: "Authorization: Basic",
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return req, err
+		}
+		req.body = string(body)
+		req.headers = append(req.headers, "Content-Type: application/json")
+	}
+	return req, nil
+}
+
+func (j *jiraIssues) openIssues(ctx context.Context) (map[string]trackedIssue, error) {
+	jql := fmt.Sprintf(`project = "%s" AND labels = "%s" AND statusCategory != Done`, j.project, findingLabel)
+	open := map[string]trackedIssue{}
+	for start := 0; ; start += 100 {
+		req, _ := j.request("GET", fmt.Sprintf("/search?jql=%s&fields=labels,description&maxResults=100&startAt=%d", url.QueryEscape(jql), start), nil)
+		response, err := req.do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Total  int `json:"total"`
+			Issues []struct {
+				Key    string `json:"key"`
+				Fields struct {
+					Labels      []string `json:"labels"`
+					Description string   `json:"description"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		if err := json.Unmarshal([]byte(response), &result); err != nil {
+			return nil, fmt.Errorf("unexpected Jira response: %w", err)
+		}
+		for _, issue := range result.Issues {
+			severity, sources := parseIssueBody(issue.Fields.Description)
+			resolved := slices.Contains(issue.Fields.Labels, jiraNotReportedLabel)
+			for _, label := range issue.Fields.Labels {
+				if fp, ok := strings.CutPrefix(label, "fp-"); ok {
+					open[fp] = trackedIssue{id: issue.Key, fingerprint: fp, severity: severity, sources: sources, resolved: resolved}
+				}
+			}
+		}
+		if start+len(result.Issues) >= result.Total || len(result.Issues) == 0 {
+			return open, nil
+		}
+	}
+}
+
+// jiraPriority maps a finding severity onto Jira's default priority scheme
+func jiraPriority(severity string) string {
+	switch severity {
+	case "CRITICAL":
+		return "Highest"
+	case "HIGH":
+		return "High"
+	case "MEDIUM":
+		return "Medium"
+	default:
+		return "Low"
+	}
+}
+
+func (j *jiraIssues) create(ctx context.Context, f Finding, body string) error {
+	req, err := j.request("POST", "/issue", map[string]any{
+		"fields": map[string]any{
+			"project":     map[string]string{"key": j.project},
+			"summary":     issueTitle(f),
+			"description": body,
+			"issuetype":   map[string]string{"name": j.issueType},
+			"priority":    map[string]string{"name": jiraPriority(f.Severity)},
+			"labels":      []string{findingLabel, "fp-" + f.Fingerprint, "severity-" + strings.ToLower(f.Severity)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (j *jiraIssues) update(ctx context.Context, issue trackedIssue, body string) error {
+	req, err := j.request("PUT", "/issue/"+issue.id, map[string]any{
+		"fields": map[string]any{"description": body},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (j *jiraIssues) close(ctx context.Context, issue trackedIssue) error {
+	comment, err := j.request("POST", "/issue/"+issue.id+"/comment", map[string]any{
+		"body": "No longer reported by the pipeline.",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := comment.do(ctx); err != nil {
+		return err
+	}
+	if j.closeTransition == "" {
+		return j.label(ctx, issue, "add")
+	}
+
+	req, err := j.request("POST", "/issue/"+issue.id+"/transitions", map[string]any{
+		"transition": map[string]string{"id": j.closeTransition},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+// reopen removes the no-longer-reported label from a ticket whose finding is
+// reported again
+func (j *jiraIssues) reopen(ctx context.Context, issue trackedIssue) error {
+	return j.label(ctx, issue, "remove")
+}
+
+// label adds or removes jiraNotReportedLabel
+func (j *jiraIssues) label(ctx context.Context, issue trackedIssue, operation string) error {
+	req, err := j.request("PUT", "/issue/"+issue.id, map[string]any{
+		"update": map[string]any{
+			"labels": []map[string]string{{operation: jiraNotReportedLabel}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseIssueBody(t *testing.T) {
+	body := issueBody(Finding{
+		Fingerprint: "abc123",
+		RuleID:      "CVE-2024-1234",
+		Severity:    "HIGH",
+		Title:       "Prototype pollution",
+		Sources:     []string{"grype", "trivy"},
+	}, "")
+	severity, sources := parseIssueBody(body)
+	if severity != "HIGH" || !slices.Equal(sources, []string{"grype", "trivy"}) {
+		t.Errorf("parseIssueBody = %q, %v, want HIGH, [grype trivy]", severity, sources)
+	}
+
+	severity, sources = parseIssueBody("Created by hand")
+	if severity != "" || sources != nil {
+		t.Errorf("parseIssueBody of a foreign body = %q, %v, want nothing", severity, sources)
+	}
+}
+
+func TestTrackedIssueClosable(t *testing.T) {
+	tracked := []string{"HIGH", "CRITICAL"}
+	tests := []struct {
+		name    string
+		issue   trackedIssue
+		scanned map[string]bool
+		want    bool
+	}{
+		{"report present", trackedIssue{severity: "HIGH", sources: []string{"trivy"}}, map[string]bool{"trivy": true}, true},
+		{"report missing", trackedIssue{severity: "HIGH", sources: []string{"trivy"}}, map[string]bool{"semgrep": true}, false},
+		{"one of two reports missing", trackedIssue{severity: "CRITICAL", sources: []string{"grype", "trivy"}}, map[string]bool{"trivy": true}, false},
+		{"severity no longer tracked", trackedIssue{severity: "MEDIUM", sources: []string{"trivy"}}, map[string]bool{"trivy": true}, false},
+		{"unknown scanners", trackedIssue{severity: "HIGH"}, map[string]bool{"trivy": true}, false},
+		{"already marked", trackedIssue{severity: "HIGH", sources: []string{"trivy"}, resolved: true}, map[string]bool{"trivy": true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.issue.closable(tt.scanned, tracked); got != tt.want {
+			t.Errorf("%s: closable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReportedTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"01-secrets.sarif", `{"version": "2.1.0", "runs": [{"tool": {"driver": {"name": "Semgrep"}}, "results": []}]}`, []string{"semgrep"}},
+		{"07-dependencies.json", `{"ArtifactName": "/src", "Results": []}`, []string{"trivy"}},
+		{"14-api-security.jsonl", "", []string{"nuclei"}},
+		{"notes.json", `{"hello": "world"}`, nil},
+	}
+	for _, tt := range tests {
+		if got := reportedTools(tt.name, tt.content); !slices.Equal(got, tt.want) {
+			t.Errorf("reportedTools(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// License statuses, from best to worst
+const (
+	licenseAllowed = "allowed"
+	licenseUnknown = "unknown"
+	licenseDenied  = "denied"
+)
+
+// licenseWaiver accepts a denied or unknown license of one package
+type licenseWaiver struct {
+	Package string
+	// License the waiver is for; empty waives whatever the package is licensed under
+	License       string
+	Justification string
+	Approver      string
+}
+
+// licensePolicy is the parsed license-policy.yaml
+type licensePolicy struct {
+	// SPDX IDs that may be used; empty allows every license that isn't denied
+	Allowed []string
+	// SPDX IDs that must not be used
+	Denied []string
+	// What to do with packages without a license or with a license neither allowed
+	// nor denied: block, warn or allow
+	Unknown string
+	Waivers []licenseWaiver
+}
+
+// loadLicensePolicy reads and validates a license policy (YAML or JSON)
+func loadLicensePolicy(ctx context.Context, file *dagger.File) (*licensePolicy, error) {
+	policy := &licensePolicy{}
+	if err := decodeYAML(ctx, file, policy); err != nil {
+		return nil, fmt.Errorf("failed to load license policy: %w", err)
+	}
+	policy.Unknown = strings.ToLower(policy.Unknown)
+	if policy.Unknown == "" {
+		policy.Unknown = "block"
+	}
+	if !slices.Contains([]string{"block", "warn", "allow"}, policy.Unknown) {
+		return nil, fmt.Errorf("license policy: invalid unknown %q (expected block, warn or allow)", policy.Unknown)
+	}
+	for _, id := range policy.Allowed {
+		if slices.ContainsFunc(policy.Denied, func(d string) bool { return strings.EqualFold(d, id) }) {
+			return nil, fmt.Errorf("license policy: %s is both allowed and denied", id)
+		}
+	}
+	for i, w := range policy.Waivers {
+		if w.Package == "" || w.Justification == "" || w.Approver == "" {
+			return nil, fmt.Errorf("license waiver %d: package, justification and approver are required", i+1)
+		}
+	}
+	return policy, nil
+}
+
+// licenseStatus classifies one SPDX license ID
+func (p *licensePolicy) licenseStatus(id string) string {
+	// An exception (GPL-2.0-only WITH Classpath-exception-2.0) is judged by its license
+	id, _, _ = strings.Cut(id, " WITH ")
+	id = strings.TrimSpace(id)
+	equal := func(listed string) bool { return strings.EqualFold(listed, id) }
+	switch {
+	case id == "" || strings.EqualFold(id, "NOASSERTION") || strings.EqualFold(id, "NONE"):
+		return licenseUnknown
+	case slices.ContainsFunc(p.Denied, equal):
+		return licenseDenied
+	case slices.ContainsFunc(p.Allowed, equal):
+		return licenseAllowed
+	case len(p.Allowed) == 0 && !strings.HasPrefix(id, "LicenseRef-"):
+		return licenseAllowed
+	}
+	return licenseUnknown
+}
+
+// licenseStatuses orders the statuses from best to worst
+var licenseStatuses = []string{licenseAllowed, licenseUnknown, licenseDenied}
+
+// expressionStatus classifies an SPDX license expression: a package under "A OR B"
+// may be used under the better of the two, one under "A AND B" is bound by both
+// AND binds tighter than OR and parentheses group, so "(MIT OR Apache-2.0) AND
+// GPL-3.0" is bound by GPL-3.0 whichever of the first two is picked. An expression
+// that doesn't parse is unknown
+func (p *licensePolicy) expressionStatus(expression string) string {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	if len(tokens) == 0 {
+		return licenseUnknown
+	}
+	parser := &spdxParser{policy: p, tokens: tokens}
+	rank, ok := parser.or()
+	if !ok || parser.pos != len(tokens) {
+		return licenseUnknown
+	}
+	return licenseStatuses[rank]
+}
+
+// spdxParser evaluates an SPDX license expression to the rank of its status in
+// licenseStatuses; operators are matched case-insensitively
+type spdxParser struct {
+	policy *licensePolicy
+	tokens []string
+	pos    int
+}
+
+// next consumes the next token if it is the given operator
+func (s *spdxParser) next(operator string) bool {
+	if s.pos < len(s.tokens) && strings.EqualFold(s.tokens[s.pos], operator) {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// or evaluates alternatives: the best of them
+func (s *spdxParser) or() (int, bool) {
+	best, ok := s.and()
+	for ok && s.next("OR") {
+		var rank int
+		rank, ok = s.and()
+		best = min(best, rank)
+	}
+	return best, ok
+}
+
+// and evaluates conjunctions: the worst of them
+func (s *spdxParser) and() (int, bool) {
+	worst, ok := s.license()
+	for ok && s.next("AND") {
+		var rank int
+		rank, ok = s.license()
+		worst = max(worst, rank)
+	}
+	return worst, ok
+}
+
+// license evaluates a parenthesized expression or one license, with an optional
+// exception (GPL-2.0-only WITH Classpath-exception-2.0)
+func (s *spdxParser) license() (int, bool) {
+	if s.next("(") {
+		rank, ok := s.or()
+		return rank, ok && s.next(")")
+	}
+	if s.pos >= len(s.tokens) {
+		return 0, false
+	}
+	id := s.tokens[s.pos]
+	if id == ")" || strings.EqualFold(id, "AND") || strings.EqualFold(id, "OR") || strings.EqualFold(id, "WITH") {
+		return 0, false
+	}
+	s.pos++
+	if s.next("WITH") {
+		if s.pos >= len(s.tokens) || s.tokens[s.pos] == "(" || s.tokens[s.pos] == ")" {
+			return 0, false
+		}
+		s.pos++
+	}
+	return slices.Index(licenseStatuses, s.policy.licenseStatus(id)), true
+}
+
+// waiver returns the waiver covering a package's license, if any
+func (p *licensePolicy) waiver(pkg, license string) (licenseWaiver, bool) {
+	for _, w := range p.Waivers {
+		if strings.EqualFold(w.Package, pkg) && (w.License == "" || strings.EqualFold(w.License, license)) {
+			return w, true
+		}
+	}
+	return licenseWaiver{}, false
+}
+
+// LicensePackage is the license evaluation of one package in the SBOM
+type LicensePackage struct {
+	Package string
+	Version string
+	// SPDX license expression ("" when the SBOM has none)
+	License string
+	// allowed, denied or unknown
+	Status string
+	// Whether a waiver accepts the license, and why
+	Waived        bool
+	Justification string
+}
+
+// LicenseReport is the evaluation of an SBOM against a license policy
+type LicenseReport struct {
+	Allowed int
+	Denied  int
+	Unknown int
+	Waived  int
+	// Denied and, when the policy blocks them, unknown licenses that aren't waived
+	Blocking int
+	Packages []*LicensePackage
+}
+
+// text renders the report for pipeline reports, listing the packages that need attention
+func (r *LicenseReport) text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📜 %d packages: %d allowed, %d denied, %d unknown, %d waived\n",
+		len(r.Packages), r.Allowed, r.Denied, r.Unknown, r.Waived)
+	for _, p := range r.Packages {
+		if p.Status == licenseAllowed {
+			continue
+		}
+		license := cmp.Or(p.License, "no license")
+		if p.Waived {
+			fmt.Fprintf(&sb, "   • %s %s: %s (%s, waived: %s)\n", p.Package, p.Version, license, p.Status, p.Justification)
+		} else {
+			fmt.Fprintf(&sb, "   ✗ %s %s: %s (%s)\n", p.Package, p.Version, license, p.Status)
+		}
+	}
+	return sb.String()
+}
+
+// evaluateLicenses checks every package in an SPDX or CycloneDX JSON SBOM against
+// the policy
+func evaluateLicenses(sbom string, policy *licensePolicy) (*LicenseReport, error) {
+	entries, err := parseNoticeEntries(sbom)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LicenseReport{}
+	for _, e := range entries {
+		p := &LicensePackage{Package: e.name, Version: e.version, License: e.license, Status: policy.expressionStatus(e.license)}
+		switch p.Status {
+		case licenseAllowed:
+			report.Allowed++
+		case licenseDenied:
+			report.Denied++
+		case licenseUnknown:
+			report.Unknown++
+		}
+		if p.Status != licenseAllowed {
+			if w, ok := policy.waiver(e.name, e.license); ok {
+				p.Waived, p.Justification = true, w.Justification
+				report.Waived++
+			} else if p.Status == licenseDenied || policy.Unknown == "block" {
+				report.Blocking++
+			}
+		}
+		report.Packages = append(report.Packages, p)
+	}
+	return report, nil
+}
+
+// CheckLicensePolicy evaluates the licenses in an SBOM against a policy of allowed
+// and denied SPDX IDs, returning a per-package license report. Denied licenses, and
+// unknown ones unless the policy says otherwise, fail the check when no waiver in the
+// policy accepts them
+func (m *SearchApi) CheckLicensePolicy(
+	ctx context.Context,
+	// SBOM (SPDX JSON or CycloneDX JSON)
+	sbom *dagger.File,
+	// License policy (YAML or JSON)
+	// +defaultPath="/license-policy.yaml"
+	policy *dagger.File,
+) (*LicenseReport, error) {
+	parsed, err := loadLicensePolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+	content, err := sbom.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SBOM: %w", err)
+	}
+	report, err := evaluateLicenses(content, parsed)
+	if err != nil {
+		return nil, err
+	}
+	if report.Blocking > 0 {
+		return report, fmt.Errorf("❌ BLOCKED - %d package(s) with denied or unknown licenses:\n%s", report.Blocking, report.text())
+	}
+	return report, nil
+}
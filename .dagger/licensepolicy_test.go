@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestExpressionStatus(t *testing.T) {
+	policy := &licensePolicy{
+		Allowed: []string{"MIT", "Apache-2.0", "BSD-3-Clause", "GPL-2.0-only"},
+		Denied:  []string{"GPL-3.0", "AGPL-3.0"},
+	}
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"MIT", licenseAllowed},
+		{"GPL-3.0", licenseDenied},
+		{"LicenseRef-Custom", licenseUnknown},
+		{"", licenseUnknown},
+		{"NOASSERTION", licenseUnknown},
+		{"MIT OR GPL-3.0", licenseAllowed},
+		{"MIT AND GPL-3.0", licenseDenied},
+		{"MIT AND LicenseRef-Custom", licenseUnknown},
+		{"(MIT OR Apache-2.0) AND GPL-3.0", licenseDenied},
+		{"GPL-3.0 AND (MIT OR Apache-2.0)", licenseDenied},
+		{"MIT OR Apache-2.0 AND GPL-3.0", licenseAllowed},
+		{"(MIT OR GPL-3.0) AND (Apache-2.0 OR AGPL-3.0)", licenseAllowed},
+		{"((MIT AND GPL-3.0) OR (BSD-3-Clause AND AGPL-3.0))", licenseDenied},
+		{"((MIT AND GPL-3.0) OR (BSD-3-Clause AND Apache-2.0))", licenseAllowed},
+		{"(MIT or Apache-2.0) and GPL-3.0", licenseDenied},
+		{"gpl-3.0", licenseDenied},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", licenseAllowed},
+		{"(GPL-2.0-only WITH Classpath-exception-2.0) AND GPL-3.0", licenseDenied},
+		{"(MIT OR Apache-2.0", licenseUnknown},
+		{"MIT OR", licenseUnknown},
+		{"MIT Apache-2.0", licenseUnknown},
+		{"AND MIT", licenseUnknown},
+	}
+	for _, tt := range tests {
+		if got := policy.expressionStatus(tt.expression); got != tt.want {
+			t.Errorf("expressionStatus(%q) = %s, want %s", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionStatusEmptyAllowList(t *testing.T) {
+	policy := &licensePolicy{Denied: []string{"GPL-3.0"}}
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"MIT", licenseAllowed},
+		{"LicenseRef-Custom", licenseUnknown},
+		{"(MIT OR LicenseRef-Custom) AND GPL-3.0", licenseDenied},
+	}
+	for _, tt := range tests {
+		if got := policy.expressionStatus(tt.expression); got != tt.want {
+			t.Errorf("expressionStatus(%q) = %s, want %s", tt.expression, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,15 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"dagger/search-api/internal/dagger"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type SearchApi struct{}
@@ -28,24 +34,58 @@ const (
 	buildConfig     = "Release"
 	aspnetURL       = "http://+:8080"
 	containerPort   = 8080
+
+	// Tool images
+	curlImage      = "curlimages/curl:latest"
+	yqImage        = "mikefarah/yq:latest"
+	gitImage       = "alpine/git:latest"
+	orasImage      = "ghcr.io/oras-project/oras:v1.2.0"
+	mitmproxyImage = "mitmproxy/mitmproxy:10.3.1"
+	registryImage  = "registry:2"
+
+	// Images the conftest, oasdiff and skopeo modules run
+	conftestImage = "openpolicyagent/conftest:latest"
+	oasdiffImage  = "tufin/oasdiff:latest"
+	skopeoImage   = "quay.io/skopeo/stable:latest"
+
+	// Service images
+	defaultSolrVersion = "9.4"
+	zookeeperImage     = "zookeeper:3.9"
 )
 
-// buildAndTest executes dotnet restore, build, and test commands
-// This helper consolidates the common build-test pattern used across multiple functions
-func (m *SearchApi) buildAndTest(source *dagger.Directory, sdkImage string) *dagger.Container {
+// buildBase restores and builds the solution once; unit and integration tests,
+// coverage, formatting and the analyzer builds derive from it, and Dagger runs the
+// identical restore and build only once per pipeline
+func buildBase(source *dagger.Directory) *dagger.Container {
+	return sdkBuild(source, dotnetSDK)
+}
+
+// sdkBuild executes dotnet restore and build of the solution in an SDK image
+func sdkBuild(source *dagger.Directory, sdkImage string) *dagger.Container {
 	return dag.Container().
 		From(sdkImage).
 		WithDirectory("/src", source).
 		WithWorkdir("/src").
 		WithExec([]string{"dotnet", "restore", solutionFile}).
-		WithExec([]string{"dotnet", "build", solutionFile, "-c", buildConfig, "--no-restore"}).
+		WithExec([]string{"dotnet", "build", solutionFile, "-c", buildConfig, "--no-restore"})
+}
+
+// buildAndTest executes dotnet restore, build, and test commands
+// This helper consolidates the common build-test pattern used across multiple functions
+func (m *SearchApi) buildAndTest(source *dagger.Directory, sdkImage string) *dagger.Container {
+	return sdkBuild(source, sdkImage).
 		WithExec([]string{"dotnet", "test", testProject, "-c", buildConfig, "--no-build", "--verbosity", "normal"})
 }
 
 // publishApp executes dotnet publish command
-func (m *SearchApi) publishApp(buildContainer *dagger.Container, publishFlags ...string) *dagger.Directory {
+// A version is stamped into the assemblies (/p:Version); "" keeps the project's
+func (m *SearchApi) publishApp(buildContainer *dagger.Container, build buildMetadata, publishFlags ...string) *dagger.Directory {
 	args := []string{"dotnet", "publish", mainProject, "-c", buildConfig, "-o", "/app/publish", "--no-restore"}
+	args = append(args, build.publishFlags()...)
 	args = append(args, publishFlags...)
+	if build.sourceDateEpoch > 0 {
+		buildContainer = buildContainer.WithEnvVariable("SOURCE_DATE_EPOCH", fmt.Sprint(build.sourceDateEpoch))
+	}
 	return buildContainer.WithExec(args).Directory("/app/publish")
 }
 
@@ -73,14 +113,24 @@ func (m *SearchApi) BuildContainer(
 	// +optional
 	// +defaultPath="."
 	source *dagger.Directory,
+	// Version stamped into the assemblies (e.g., from ComputeVersion)
+	// +optional
+	version string,
+	// Git commit SHA, recorded as org.opencontainers.image.revision
+	// +optional
+	revision string,
+	// Build time in Unix seconds (e.g., the commit time), recorded as
+	// org.opencontainers.image.created and exported to the build as SOURCE_DATE_EPOCH
+	// +optional
+	sourceDateEpoch int,
 ) *dagger.Container {
+	build := buildMetadata{version: version, revision: revision, sourceDateEpoch: sourceDateEpoch}
 	// Build stage - use SDK to build and publish
 	buildContainer := m.buildAndTest(source, dotnetSDK)
-	publishDir := m.publishApp(buildContainer)
+	publishDir := m.publishApp(buildContainer, build)
 
 	// Runtime stage - use minimal ASP.NET runtime
-	return dag.Container().
-		From(aspnetRuntime).
+	return build.stamp(dag.Container().From(aspnetRuntime)).
 		WithExec([]string{"groupadd", "-r", "searchapi"}).
 		WithExec([]string{"useradd", "-r", "-g", "searchapi", "searchapi"}).
 		WithWorkdir("/app").
@@ -100,11 +150,22 @@ func (m *SearchApi) BuildContainerOptimized(
 	// +optional
 	// +defaultPath="."
 	source *dagger.Directory,
+	// Version stamped into the assemblies (e.g., from ComputeVersion)
+	// +optional
+	version string,
+	// Git commit SHA, recorded as org.opencontainers.image.revision
+	// +optional
+	revision string,
+	// Build time in Unix seconds (e.g., the commit time), recorded as
+	// org.opencontainers.image.created and exported to the build as SOURCE_DATE_EPOCH
+	// +optional
+	sourceDateEpoch int,
 ) *dagger.Container {
+	build := buildMetadata{version: version, revision: revision, sourceDateEpoch: sourceDateEpoch}
 	// Build stage - use Alpine SDK for smaller size
 	buildContainer := m.buildAndTest(source, dotnetSDKAlpine)
 	// Publish with trimming and ReadyToRun for optimal size and startup
-	publishDir := m.publishApp(buildContainer,
+	publishDir := m.publishApp(buildContainer, build,
 		"/p:PublishTrimmed=true",                 // Enable IL trimming
 		"/p:TrimMode=link",                        // Aggressive trimming
 		"/p:PublishReadyToRun=true",               // AOT compilation for startup
@@ -115,8 +176,7 @@ func (m *SearchApi) BuildContainerOptimized(
 	)
 
 	// Runtime stage - use Alpine ASP.NET runtime (smallest official image)
-	return dag.Container().
-		From(aspnetAlpine).
+	return build.stamp(dag.Container().From(aspnetAlpine)).
 		// Alpine addgroup/adduser syntax
 		WithExec([]string{"addgroup", "-S", "searchapi"}).
 		WithExec([]string{"adduser", "-S", "-G", "searchapi", "searchapi"}).
@@ -132,11 +192,23 @@ func (m *SearchApi) BuildContainerOptimized(
 }
 
 // ContainerSizeAnalysis analyzes container image size and composition
-// Uses dive to provide detailed layer-by-layer breakdown
+// Uses dive to provide detailed layer-by-layer breakdown; with a budget it fails
+// when the compressed image size or layer count exceeds it
 func (m *SearchApi) ContainerSizeAnalysis(
 	ctx context.Context,
 	container *dagger.Container,
+	// Maximum compressed image size in MB (layers + config, as pushed); 0 disables
+	// +optional
+	maxSizeMb float64,
+	// Maximum number of layers; 0 disables
+	// +optional
+	maxLayers int,
 ) (string, error) {
+	size, err := measureImage(ctx, container)
+	if err != nil {
+		return "", err
+	}
+
 	// Use the dive module to analyze the container
 	analysis, err := dag.Dive().Analyze(ctx, container, dagger.DiveAnalyzeOpts{
 		CiMode:     true,
@@ -144,15 +216,13 @@ func (m *SearchApi) ContainerSizeAnalysis(
 	})
 
 	if err != nil {
-		// Non-fatal - return partial analysis
-		return fmt.Sprintf("Container size analysis completed with warnings\n%s", analysis), nil
+		// Non-fatal - keep the partial analysis
+		analysis = fmt.Sprintf("Container size analysis completed with warnings\n%s", analysis)
 	}
 
-	// Get size information using the dive module
-	sizeInfo, err := dag.Dive().GetSize(ctx, container)
-
-	if err != nil {
-		sizeInfo = "unknown"
+	sizeInfo := fmt.Sprintf("%s compressed in %d layers (tarball %s)", megabytes(size.total()), len(size.layers), megabytes(size.tarball))
+	for i, layer := range size.layers {
+		sizeInfo += fmt.Sprintf("\n  Layer %d: %s", i+1, megabytes(layer))
 	}
 
 	result := fmt.Sprintf(`
@@ -170,6 +240,10 @@ Optimization Recommendations:
 - Use ReadyToRun compilation for faster startup
 `, sizeInfo, analysis)
 
+	if violations := sizeBudget(size, maxSizeMb, maxLayers); len(violations) > 0 {
+		return result, fmt.Errorf("image size budget exceeded: %s", strings.Join(violations, "; "))
+	}
+
 	return result, nil
 }
 
@@ -180,19 +254,29 @@ func (m *SearchApi) BuildContainerDistroless(
 	// +optional
 	// +defaultPath="."
 	source *dagger.Directory,
+	// Version stamped into the assemblies (e.g., from ComputeVersion)
+	// +optional
+	version string,
+	// Git commit SHA, recorded as org.opencontainers.image.revision
+	// +optional
+	revision string,
+	// Build time in Unix seconds (e.g., the commit time), recorded as
+	// org.opencontainers.image.created and exported to the build as SOURCE_DATE_EPOCH
+	// +optional
+	sourceDateEpoch int,
 ) *dagger.Container {
+	build := buildMetadata{version: version, revision: revision, sourceDateEpoch: sourceDateEpoch}
 	// Build stage - use standard SDK (not Alpine, as distroless runtime is glibc-based)
 	buildContainer := m.buildAndTest(source, dotnetSDK)
 	// Publish with optimized settings for distroless deployment
-	publishDir := m.publishApp(buildContainer,
+	publishDir := m.publishApp(buildContainer, build,
 		"/p:DebugType=none",              // Remove debug symbols for smaller size
 		"/p:DebugSymbols=false",          // Remove debug symbols
 		"/p:InvariantGlobalization=true", // Remove globalization data (smaller size)
 	)
 
 	// Runtime stage - use distroless chiseled Ubuntu (NO shell, NO package manager)
-	return dag.Container().
-		From(aspnetDistroless).
+	return build.stamp(dag.Container().From(aspnetDistroless)).
 		WithWorkdir("/app").
 		WithDirectory("/app", publishDir).
 		// Distroless images run as non-root by default (APP_UID=1654)
@@ -212,19 +296,29 @@ func (m *SearchApi) BuildContainerDistrolessExtra(
 	// +optional
 	// +defaultPath="."
 	source *dagger.Directory,
+	// Version stamped into the assemblies (e.g., from ComputeVersion)
+	// +optional
+	version string,
+	// Git commit SHA, recorded as org.opencontainers.image.revision
+	// +optional
+	revision string,
+	// Build time in Unix seconds (e.g., the commit time), recorded as
+	// org.opencontainers.image.created and exported to the build as SOURCE_DATE_EPOCH
+	// +optional
+	sourceDateEpoch int,
 ) *dagger.Container {
+	build := buildMetadata{version: version, revision: revision, sourceDateEpoch: sourceDateEpoch}
 	// Build stage - use standard SDK (not Alpine, as distroless runtime is glibc-based)
 	buildContainer := m.buildAndTest(source, dotnetSDK)
 	// Publish with optimized settings for distroless deployment
-	publishDir := m.publishApp(buildContainer,
+	publishDir := m.publishApp(buildContainer, build,
 		"/p:DebugType=none",              // Remove debug symbols for smaller size
 		"/p:DebugSymbols=false",          // Remove debug symbols
 		"/p:InvariantGlobalization=true", // Remove globalization data (use -extra if needed)
 	)
 
 	// Runtime stage - use distroless chiseled Ubuntu -extra variant (includes ICU, tzdata)
-	return dag.Container().
-		From(aspnetDistrolessExtra).
+	return build.stamp(dag.Container().From(aspnetDistrolessExtra)).
 		WithWorkdir("/app").
 		WithDirectory("/app", publishDir).
 		// Distroless images run as non-root by default (APP_UID=1654)
@@ -235,156 +329,171 @@ func (m *SearchApi) BuildContainerDistrolessExtra(
 		WithEntrypoint([]string{"dotnet", "SearchApi.dll"})
 }
 
-// CompareContainerSizes builds both standard and optimized containers and compares sizes
+// CompareContainerSizes builds all four container variants concurrently and compares
+// their compressed and uncompressed size, layer count, dive efficiency and CVE count
+// Given the JSON of a previous comparison, it fails when a variant grew by more than
+// maxGrowthPercent or gained layers, so image size regressions don't slip in
 func (m *SearchApi) CompareContainerSizes(
 	ctx context.Context,
 	// +optional
 	// +defaultPath="."
 	source *dagger.Directory,
-) (string, error) {
-	report := "Container Size Comparison\n"
-	report += "=========================\n\n"
-
-	// Build standard container
-	report += "1. Building standard container (Debian base)...\n"
-	standardContainer := m.BuildContainer(ctx, source)
-	standardTarball := standardContainer.AsTarball()
-
-	standardSize, err := dag.Container().
-		From("alpine:latest").
-		WithMountedFile("/image.tar", standardTarball).
-		WithExec([]string{"sh", "-c", "ls -lh /image.tar | awk '{print \"Size: \" $5}' && du -h /image.tar | awk '{print \"Disk: \" $1}'"}).
-		Stdout(ctx)
-
-	if err != nil {
-		standardSize = "Error getting size"
+	// Previous comparison (its json output) to check for regressions against
+	// +optional
+	baseline *dagger.File,
+	// Compressed size growth per variant allowed over the baseline, in percent
+	// +default=10
+	maxGrowthPercent float64,
+) (*ContainerSizeComparison, error) {
+	variants := []struct {
+		name        string
+		description string
+		build       func(context.Context, *dagger.Directory, string, string, int) *dagger.Container
+	}{
+		{"standard", "Debian base", m.BuildContainer},
+		{"optimized", "Alpine + trimming", m.BuildContainerOptimized},
+		{"distroless", "chiseled Ubuntu", m.BuildContainerDistroless},
+		{"distroless-extra", "chiseled Ubuntu with ICU/tzdata", m.BuildContainerDistrolessExtra},
 	}
-	report += fmt.Sprintf("   Standard Build (Debian base):\n   %s\n\n", standardSize)
-
-	// Build optimized container
-	report += "2. Building optimized container (Alpine + trimming)...\n"
-	optimizedContainer := m.BuildContainerOptimized(ctx, source)
-	optimizedTarball := optimizedContainer.AsTarball()
 
-	optimizedSize, err := dag.Container().
-		From("alpine:latest").
-		WithMountedFile("/image.tar", optimizedTarball).
-		WithExec([]string{"sh", "-c", "ls -lh /image.tar | awk '{print \"Size: \" $5}' && du -h /image.tar | awk '{print \"Disk: \" $1}'"}).
-		Stdout(ctx)
-
-	if err != nil {
-		optimizedSize = "Error getting size"
+	comparison := &ContainerSizeComparison{
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Variants:    make([]*SizeComparison, len(variants)),
 	}
-	report += fmt.Sprintf("   Optimized Build (Alpine + Trimming):\n   %s\n\n", optimizedSize)
-
-	// Build distroless container
-	report += "3. Building distroless container (chiseled Ubuntu)...\n"
-	distrolessContainer := m.BuildContainerDistroless(ctx, source)
-	distrolessTarball := distrolessContainer.AsTarball()
-
-	distrolessSize, err := dag.Container().
-		From("alpine:latest").
-		WithMountedFile("/image.tar", distrolessTarball).
-		WithExec([]string{"sh", "-c", "ls -lh /image.tar | awk '{print \"Size: \" $5}' && du -h /image.tar | awk '{print \"Disk: \" $1}'"}).
-		Stdout(ctx)
-
-	if err != nil {
-		distrolessSize = "Error getting size"
+	g, gctx := errgroup.WithContext(ctx)
+	for i, variant := range variants {
+		g.Go(func() error {
+			result, err := compareVariant(gctx, variant.name, variant.description, variant.build(gctx, source, "", "", 0))
+			if err != nil {
+				return fmt.Errorf("%s: %w", variant.name, err)
+			}
+			comparison.Variants[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
-	report += fmt.Sprintf("   Distroless Build (Chiseled Ubuntu):\n   %s\n\n", distrolessSize)
-
-	// Build distroless-extra container
-	report += "4. Building distroless-extra container (with ICU/tzdata)...\n"
-	distrolessExtraContainer := m.BuildContainerDistrolessExtra(ctx, source)
-	distrolessExtraTarball := distrolessExtraContainer.AsTarball()
-
-	distrolessExtraSize, err := dag.Container().
-		From("alpine:latest").
-		WithMountedFile("/image.tar", distrolessExtraTarball).
-		WithExec([]string{"sh", "-c", "ls -lh /image.tar | awk '{print \"Size: \" $5}' && du -h /image.tar | awk '{print \"Disk: \" $1}'"}).
-		Stdout(ctx)
 
-	if err != nil {
-		distrolessExtraSize = "Error getting size"
-	}
-	report += fmt.Sprintf("   Distroless-Extra Build:\n   %s\n\n", distrolessExtraSize)
-
-	report += "\n🔒 Security & Optimization Summary:\n"
-	report += "===================================\n\n"
-
-	report += "Standard (Debian):\n"
-	report += "  ✅ Full-featured Linux environment\n"
-	report += "  ✅ Easy debugging with shell access\n"
-	report += "  ⚠️  Largest size, most packages\n"
-	report += "  ⚠️  Larger attack surface\n\n"
-
-	report += "Optimized (Alpine + Trimming):\n"
-	report += "  ✅ 30-40% smaller than Debian\n"
-	report += "  ✅ IL trimming removes unused code\n"
-	report += "  ✅ ReadyToRun for faster startup\n"
-	report += "  ⚠️  Still includes shell and package manager\n\n"
-
-	report += "Distroless (Chiseled Ubuntu):\n"
-	report += "  ✅ 40-60% smaller than Debian\n"
-	report += "  ✅ NO shell (prevents shell-based attacks)\n"
-	report += "  ✅ NO package manager (minimal tools)\n"
-	report += "  ✅ Runs as non-root by default (UID 1654)\n"
-	report += "  ✅ Smallest attack surface\n"
-	report += "  ⚠️  Harder to debug (no shell access)\n"
-	report += "  ⚠️  Minimal globalization (use -extra if needed)\n\n"
-
-	report += "Distroless-Extra (With ICU/tzdata):\n"
-	report += "  ✅ Same security as distroless\n"
-	report += "  ✅ Includes globalization support\n"
-	report += "  ✅ Better locale/timezone handling\n"
-	report += "  ⚠️  Slightly larger than base distroless\n\n"
-
-	report += "📊 Expected Size Reduction:\n"
-	report += "  • Alpine:           30-40% smaller\n"
-	report += "  • Distroless:       40-60% smaller\n"
-	report += "  • Distroless-Extra: 35-50% smaller\n\n"
-
-	report += "🎯 Recommendation:\n"
-	report += "  • Development: Use Standard (Debian) for easy debugging\n"
-	report += "  • Staging: Use Optimized (Alpine) for size + debuggability\n"
-	report += "  • Production: Use Distroless for maximum security\n"
-
-	return report, nil
+	if baseline != nil {
+		var previous ContainerSizeComparison
+		if err := decodeYAML(ctx, baseline, &previous); err != nil {
+			return nil, fmt.Errorf("invalid baseline size comparison: %w", err)
+		}
+		comparison.Regressions = sizeRegressions(previous.Variants, comparison.Variants, maxGrowthPercent)
+		if len(comparison.Regressions) > 0 {
+			return comparison, fmt.Errorf("container size regression:\n   • %s", strings.Join(comparison.Regressions, "\n   • "))
+		}
+	}
+	return comparison, nil
 }
 
 // SetupLocalRegistry starts a local Docker registry for testing
-func (m *SearchApi) SetupLocalRegistry() *dagger.Service {
-	return dag.Container().
-		From("registry:2").
-		WithExposedPort(5000).
-		AsService()
+// With tls and credentials it behaves like a production registry, so pushes exercise
+// certificate verification and authentication; see TrustLocalRegistry for consumers
+func (m *SearchApi) SetupLocalRegistry(
+	// Serve HTTPS with a certificate signed by the generated CA (see LocalRegistryCa)
+	// +default=false
+	tls bool,
+	// Require htpasswd authentication with this username (needs tls)
+	// +optional
+	username string,
+	// Password for the htpasswd user
+	// +optional
+	password *dagger.Secret,
+) (*dagger.Service, error) {
+	// Images persist across pipelines in a cache volume; see GarbageCollectLocalRegistry
+	registry := dag.Container().
+		From(registryImage).
+		WithMountedCache(localRegistryStorage, dag.CacheVolume(localRegistryVolume)).
+		WithEnvVariable("REGISTRY_STORAGE_DELETE_ENABLED", "true").
+		WithExposedPort(5000)
+
+	if tls {
+		registry = registry.
+			WithDirectory("/certs", localRegistryCerts()).
+			WithEnvVariable("REGISTRY_HTTP_TLS_CERTIFICATE", "/certs/registry.crt").
+			WithEnvVariable("REGISTRY_HTTP_TLS_KEY", "/certs/registry.key")
+	}
+
+	if username != "" || password != nil {
+		if username == "" || password == nil {
+			return nil, fmt.Errorf("registry authentication needs both a username and a password")
+		}
+		// Basic auth over plain HTTP would send credentials in the clear
+		if !tls {
+			return nil, fmt.Errorf("registry authentication requires tls")
+		}
+		registry = registry.
+			WithFile("/auth/htpasswd", localRegistryHtpasswd(username, password)).
+			WithEnvVariable("REGISTRY_AUTH", "htpasswd").
+			WithEnvVariable("REGISTRY_AUTH_HTPASSWD_REALM", "Local Registry").
+			WithEnvVariable("REGISTRY_AUTH_HTPASSWD_PATH", "/auth/htpasswd")
+	}
+
+	return registry.AsService(), nil
 }
 
-// SetupSolr starts a Solr service for testing with proper configuration
-func (m *SearchApi) SetupSolr(ctx context.Context) (*dagger.Service, error) {
-	// Create Solr service using the default entrypoint
-	// The Solr image's default CMD will start Solr in foreground mode
-	// We'll use the standard Solr service without precreating cores
-	// The API should handle core creation if needed
-	solrContainer := dag.Container().
-		From("solr:9.4").
-		WithExposedPort(8983)
-
-	return solrContainer.AsService(), nil
+// SetupSolr starts a Solr service for testing with the core precreated, and returns
+// once the core is queryable
+func (m *SearchApi) SetupSolr(
+	ctx context.Context,
+	// Seeded data directory from SnapshotSolr to restore before starting
+	// +optional
+	snapshot *dagger.Directory,
+	// Solr version (image tag), e.g. "8.11" or "9.4"; must match the snapshot's version
+	// +default="9.4"
+	solrVersion string,
+	// Configset to create the core from (a directory with conf/solrconfig.xml and the
+	// schema); Solr's _default configset when not given
+	// +optional
+	configset *dagger.Directory,
+	// Core to create; the API uses "metadata"
+	// +default="metadata"
+	core string,
+) (*dagger.Service, error) {
+	solr := withPrecreatedCore(solrContainer(solrVersion, snapshot, ""), core, configset).AsService()
+	if err := waitForSolrCore(ctx, solr, core); err != nil {
+		return nil, err
+	}
+	return solr, nil
 }
 
 // PushToLocalRegistry pushes the container to local registry using skopeo
-func (m *SearchApi) PushToLocalRegistry(ctx context.Context, container *dagger.Container, tag string) (string, error) {
-	registry := m.SetupLocalRegistry()
+func (m *SearchApi) PushToLocalRegistry(
+	ctx context.Context,
+	container *dagger.Container,
+	tag string,
+	// Push over HTTPS, verifying the registry certificate against the generated CA
+	// +default=false
+	tls bool,
+	// Authenticate with this htpasswd user (needs tls)
+	// +optional
+	username string,
+	// Password for the htpasswd user
+	// +optional
+	password *dagger.Secret,
+) (string, error) {
+	registry, err := m.SetupLocalRegistry(tls, username, password)
+	if err != nil {
+		return "", err
+	}
 
 	imageRef := fmt.Sprintf("registry:5000/search-api:%s", tag)
 
-	// Use the skopeo module to push to the registry
-	_, err := dag.Skopeo().PushToRegistry(ctx, container, "registry:5000", "search-api", dagger.SkopeoPushToRegistryOpts{
+	opts := dagger.SkopeoPushToRegistryOpts{
 		Tag:             tag,
 		RegistryService: registry,
-		DisableTLS:      true,
-	})
+		DisableTLS:      !tls,
+		Username:        username,
+		Password:        password,
+	}
+	if tls {
+		opts.CaCertificate = m.LocalRegistryCa()
+	}
+
+	// Use the skopeo module to push to the registry
+	_, err = dag.Skopeo().PushToRegistry(ctx, container, "registry:5000", "search-api", opts)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to push to local registry: %w", err)
@@ -395,21 +504,80 @@ func (m *SearchApi) PushToLocalRegistry(ctx context.Context, container *dagger.C
 
 // RunApiWithServices starts the Search API container with Solr service bound
 // Returns the API service with Solr already bound to it
-func (m *SearchApi) RunApiWithServices(ctx context.Context, container *dagger.Container) (*dagger.Service, error) {
+func (m *SearchApi) RunApiWithServices(
+	ctx context.Context,
+	container *dagger.Container,
+	// Seeded Solr data directory from SnapshotSolr
+	// +optional
+	solrSnapshot *dagger.Directory,
+	// ASP.NET Core environment (e.g., "Development", "Staging")
+	// +optional
+	aspnetcoreEnvironment string,
+	// Additional environment variables as KEY=VALUE (e.g., "Logging__LogLevel__Default=Debug")
+	// +optional
+	env []string,
+	// Settings file mounted as appsettings.Override.json
+	// +optional
+	appsettingsOverride *dagger.File,
+	// Secret settings (JSON, e.g. connection strings) mounted as appsettings.Secrets.json
+	// +optional
+	secretSettings *dagger.Secret,
+	// Names of environment variables for secretValues (e.g., "ApiKeys__Admin")
+	// +optional
+	secretNames []string,
+	// Secret values for secretNames, in the same order
+	// +optional
+	secretValues []*dagger.Secret,
+	// Run against a SolrCloud cluster with this many nodes instead of a single Solr
+	// +optional
+	solrCloudNodes int,
+	// Solr version (image tag), e.g. "8.11" or "9.4"
+	// +default="9.4"
+	solrVersion string,
+) (*dagger.Service, error) {
+	config := apiConfig{
+		environment:    aspnetcoreEnvironment,
+		env:            env,
+		appsettings:    appsettingsOverride,
+		secretSettings: secretSettings,
+		secretNames:    secretNames,
+		secrets:        secretValues,
+	}
+	container, err := config.apply(container)
+	if err != nil {
+		return nil, err
+	}
+
 	// Start Solr service
-	solrService, err := m.SetupSolr(ctx)
+	var solr *dagger.Service
+	if solrCloudNodes > 0 {
+		if solrSnapshot != nil {
+			return nil, fmt.Errorf("Solr snapshots can't be restored into SolrCloud")
+		}
+		solr, err = m.SetupSolrCloud(ctx, solrCloudNodes, 1, min(2, solrCloudNodes), false, solrCore)
+	} else {
+		solr, err = m.SetupSolr(ctx, solrSnapshot, solrVersion, nil, solrCore)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup Solr: %w", err)
 	}
 
-	// Start the API with Solr bound to it
-	apiService := container.
-		WithServiceBinding("solr", solrService).
-		WithEnvVariable("Solr__Url", "http://solr:8983/solr/metadata").
+	return apiWithSolr(container, solr), nil
+}
+
+// apiWithSolr starts the API with the given Solr service bound to it
+func apiWithSolr(container *dagger.Container, solr *dagger.Service) *dagger.Service {
+	return container.
+		WithServiceBinding("solr", solr).
+		WithEnvVariable("Solr__Url", "http://solr:8983/solr/"+solrCore).
 		WithExposedPort(8080).
 		AsService()
+}
 
-	return apiService, nil
+// restoredApiService starts the API against its own Solr restored from the snapshot
+// so a test run can't observe index changes made by an earlier one
+func restoredApiService(container *dagger.Container, solrVersion string, snapshot *dagger.Directory, run string) *dagger.Service {
+	return apiWithSolr(container, solrService(solrVersion, snapshot, run))
 }
 
 // Old K3s-based deployment functions removed - now using direct service bindings
@@ -417,15 +585,52 @@ func (m *SearchApi) RunApiWithServices(ctx context.Context, container *dagger.Co
 // RunIntegrationTests runs integration tests against deployed services
 // RunIntegrationTests runs integration tests against the API service (with Solr already bound)
 // No internet access - only uses service bindings
-func (m *SearchApi) RunIntegrationTests(ctx context.Context, source *dagger.Directory, apiService *dagger.Service) (string, error) {
+// With shardCount > 1 only the test classes assigned to shardIndex run, so CI can fan out
+// the suite across jobs (see RunIntegrationTestsSharded to fan out within one call)
+func (m *SearchApi) RunIntegrationTests(
+	ctx context.Context,
+	source *dagger.Directory,
+	apiService *dagger.Service,
+	// Zero-based index of the shard to run
+	// +optional
+	shardIndex int,
+	// Total number of shards
+	// +default=1
+	shardCount int,
+	// TRX file from a previous run, used to balance shards by class duration
+	// +optional
+	timings *dagger.File,
+) (string, error) {
+	args := []string{"dotnet", "test", integrationTestProject, "-c", buildConfig, "--no-build", "--verbosity", "normal"}
+
+	if shardCount > 1 {
+		if shardIndex < 0 || shardIndex >= shardCount {
+			return "", fmt.Errorf("shard index %d out of range for %d shards", shardIndex, shardCount)
+		}
+		classes, err := listTestClasses(ctx, buildBase(source))
+		if err != nil {
+			return "", err
+		}
+		previous, err := loadTimings(ctx, timings)
+		if err != nil {
+			return "", err
+		}
+		shard := assignShards(classes, shardCount, previous)[shardIndex]
+		if len(shard) == 0 {
+			return fmt.Sprintf("Shard %d/%d has no test classes\n", shardIndex+1, shardCount), nil
+		}
+		args = append(args, "--filter", shardFilter(shard))
+	}
+
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return "", err
+	}
+
 	// Run integration tests with API service bound (Solr is already bound to API)
-	testContainer := dag.Container().
-		From("mcr.microsoft.com/dotnet/sdk:8.0").
+	testContainer := buildBase(source).
 		WithServiceBinding("api", apiService).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
 		WithEnvVariable("API_URL", "http://api:8080").
-		WithExec([]string{"dotnet", "test", "SearchApi.IntegrationTests/SearchApi.IntegrationTests.csproj", "-c", "Release", "--verbosity", "normal"})
+		WithExec(args)
 
 	output, err := testContainer.Stdout(ctx)
 	if err != nil {
@@ -436,7 +641,12 @@ func (m *SearchApi) RunIntegrationTests(ctx context.Context, source *dagger.Dire
 }
 
 // MutationTest runs mutation testing to verify test quality
-// Uses Stryker.NET to mutate code and ensure tests catch the mutations
+// Uses Stryker.NET to mutate code and ensure tests catch the mutations; returns the
+// score per file, the surviving mutants and Stryker's HTML and JSON reports, and
+// fails with a diff of the surviving mutants when the score is below minimumScore
+// On PRs, pass the base ref as since to mutate only the files changed since then;
+// with withBaseline the results for unchanged files come from the baseline stored
+// for that ref, so the score still covers the whole project
 func (m *SearchApi) MutationTest(
 	ctx context.Context,
 	// +optional
@@ -445,45 +655,73 @@ func (m *SearchApi) MutationTest(
 	// Minimum mutation score threshold (0-100)
 	// +default="80"
 	minimumScore int,
-) (string, error) {
-	// Run Stryker.NET mutation testing
-	output, err := dag.Container().
-		From("mcr.microsoft.com/dotnet/sdk:8.0").
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{"dotnet", "restore", "SearchApi.sln"}).
-		// Install Stryker.NET
-		WithExec([]string{"dotnet", "tool", "install", "-g", "dotnet-stryker"}).
-		WithEnvVariable("PATH", "/root/.dotnet/tools:$PATH", dagger.ContainerWithEnvVariableOpts{Expand: true}).
-		// Run mutation testing on the main project
-		WithExec([]string{
-			"sh", "-c",
-			fmt.Sprintf("cd SearchApi && dotnet stryker --threshold-high %d --threshold-low %d --break-at %d", minimumScore, minimumScore-10, minimumScore-10),
-		}).
-		Stdout(ctx)
+	// Git ref to diff against (e.g., "origin/main"); source must include .git history
+	// +optional
+	since string,
+	// Merge results with the baseline saved for the since ref instead of reporting changed files only
+	// +default=false
+	withBaseline bool,
+	// Name to save this run's baseline under (e.g., the branch name; defaults to "main")
+	// +optional
+	baselineVersion string,
+) (*MutationResult, error) {
+	stryker, args, err := strykerRun(source, minimumScore, since, withBaseline, baselineVersion)
+	if err != nil {
+		return nil, err
+	}
 
+	// Run mutation testing on the main project
+	reports, content, err := strykerReports(ctx, stryker, args)
 	if err != nil {
-		return "", fmt.Errorf("MUTATION TESTING FAILED - test quality below threshold: %w", err)
+		return nil, err
 	}
+	report, err := parseStrykerReport(content)
+	if err != nil {
+		return nil, err
+	}
+	result := mutationResult(report, minimumScore)
+	result.Reports = reports
 
-	return output, nil
+	if result.Score < float64(minimumScore) {
+		return result, fmt.Errorf("MUTATION TESTING FAILED - test quality below threshold:\n%s", result.Summary())
+	}
+	return result, nil
 }
 
 // AttestSbom attaches SBOM as an attestation to the container image
-// Uses Cosign to create a verifiable attestation
+// Uses Cosign to create a verifiable attestation; the SBOM is validated first and
+// its format (SPDX or CycloneDX JSON) detected unless a predicate type is given
 func (m *SearchApi) AttestSbom(
 	ctx context.Context,
-	sbom string,
+	// SBOM document (SPDX JSON or CycloneDX JSON)
+	sbom *dagger.File,
 	// Private key for signing (use cosign generate-key-pair to create)
 	privateKey *dagger.Secret,
 	// Password for the private key
 	password *dagger.Secret,
-	// Image reference to attest (e.g., "harbor.example.com/myproject/search-api:v1.0.0")
+	// Image reference pinned by digest (e.g., "harbor.example.com/myproject/search-api@sha256:...";
+	// PushToRegistry returns it as Ref)
 	imageRef string,
+	// Cosign predicate type: spdxjson or cyclonedx (detected from the document when empty)
+	// +optional
+	predicateType string,
 ) (string, error) {
+	// Like signing, an attestation made by tag could end up on another image
+	if _, _, digest := splitImageRef(imageRef); digest == "" {
+		return "", fmt.Errorf("image %s must be pinned by digest to be attested", imageRef)
+	}
+	content, err := sbom.Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SBOM: %w", err)
+	}
+	predicateType, err = sbomPredicateType(content, predicateType)
+	if err != nil {
+		return "", err
+	}
+
 	// Use the cosign module to attest SBOM
 	output, err := dag.Cosign().Attest(ctx, sbom, privateKey, password, imageRef, dagger.CosignAttestOpts{
-		PredicateType: "spdxjson",
+		PredicateType: predicateType,
 	})
 
 	if err != nil {
@@ -494,30 +732,50 @@ func (m *SearchApi) AttestSbom(
 }
 
 // CisBenchmark runs CIS Docker Benchmark security checks
-// Validates Docker/container best practices using Trivy's config scanning
+// Validates Docker/container best practices using Trivy's config scanning and scores
+// the result as the percentage of hardening checks passed
 func (m *SearchApi) CisBenchmark(
 	ctx context.Context,
 	container *dagger.Container,
-) (string, error) {
+	// Minimum hardening score (0-100); 0 only reports
+	// +default=0
+	minimumScore float64,
+	// Trivy cache with a pre-downloaded DB, for runners without internet access
+	// (see DownloadOfflineAssets)
+	// +optional
+	offlineDb *dagger.Directory,
+) (*CisComplianceSummary, error) {
 	// Run security best practice checks using Trivy module
 	// Note: docker-cis compliance was removed in newer Trivy versions
-	// Using config and secret scanning for Docker best practices instead
+	// Using config and secret scanning of the image and its config instead
 	output, err := dag.Trivy().ScanContainer(ctx, container, dagger.TrivyScanContainerOpts{
-		Scanners: []string{"config", "secret"},
-		Severity: []string{"HIGH", "CRITICAL"},
-		Format:   "json",
-		ExitCode: 0, // Don't fail, just report
+		Scanners:            []string{"config", "secret"},
+		ImageConfigScanners: []string{"misconfig", "secret"},
+		Severity:            []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"},
+		Format:              "json",
+		ExitCode:            0, // Don't fail, the score is gated below
+		OfflineDb:           offlineDb,
 	})
+	if err != nil {
+		return nil, fmt.Errorf("CIS Benchmark scan failed: %w", err)
+	}
 
+	summary, err := parseCisReport(output)
 	if err != nil {
-		return output, fmt.Errorf("CIS Benchmark check completed with findings: %w", err)
+		return nil, err
+	}
+	if summary.Score < minimumScore {
+		return summary, fmt.Errorf("CIS hardening score %.1f%% is below %.1f%%:\n%s", summary.Score, minimumScore, summary.text())
 	}
 
-	return output, nil
+	return summary, nil
 }
 
 // PushToRegistry pushes the final image to any container registry
 // Works with Harbor, GHCR, Docker Hub, GitLab Registry, etc.
+// Transient failures are retried with backoff; with immutableTag, an existing tag
+// pointing at a different digest fails the push instead of being overwritten.
+// Additional tags are added to the pushed digest rather than published again
 func (m *SearchApi) PushToRegistry(
 	ctx context.Context,
 	container *dagger.Container,
@@ -527,28 +785,136 @@ func (m *SearchApi) PushToRegistry(
 	// Image reference (e.g., "myproject/search-api" or "ghcr.io/myorg/search-api")
 	imageRef string,
 	tag string,
-) (string, error) {
+	// Release notes to attach to the pushed image as an OCI referrer artifact
+	// +optional
+	releaseNotes *dagger.File,
+	// Attempts for pushes failing on network errors (exponential backoff)
+	// +default=3
+	retries int,
+	// Fail instead of overwriting when the tag already points at a different digest
+	// +default=false
+	immutableTag bool,
+	// More tags for the same digest (e.g., short SHA, "latest", a channel); these may move
+	// +optional
+	additionalTags []string,
+	// OCI manifest annotations (KEY=VALUE, e.g., "org.opencontainers.image.revision=abc123")
+	// +optional
+	annotations []string,
+	// Image config labels (KEY=VALUE)
+	// +optional
+	labels []string,
+) (*PushedImage, error) {
+	return m.pushToRegistry(ctx, retryPolicy(retries), container, registryUrl, username, password, imageRef, tag, releaseNotes, immutableTag, additionalTags, annotations, labels)
+}
+
+// pushToRegistry is PushToRegistry, retrying network errors as the config says and
+// recording the failed attempts on the pushed image
+func (m *SearchApi) pushToRegistry(
+	ctx context.Context,
+	config *pipelineConfig,
+	container *dagger.Container,
+	registryUrl string,
+	username *dagger.Secret,
+	password *dagger.Secret,
+	imageRef string,
+	tag string,
+	releaseNotes *dagger.File,
+	immutableTag bool,
+	additionalTags []string,
+	annotations []string,
+	labels []string,
+) (*PushedImage, error) {
 	// Build full image reference
 	fullImageRef := fmt.Sprintf("%s:%s", imageRef, tag)
 
 	// Get username as plaintext (WithRegistryAuth expects string username, not Secret)
 	usernameStr, err := username.Plaintext(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to read username: %w", err)
+		return nil, fmt.Errorf("failed to read username: %w", err)
 	}
 
-	address, err := container.
-		WithRegistryAuth(registryUrl, usernameStr, password).
-		Publish(ctx, fullImageRef)
+	// Applied before the immutability check, since both change the digest
+	for _, kv := range labels {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q: expected KEY=VALUE", kv)
+		}
+		container = container.WithLabel(key, value)
+	}
+	for _, kv := range annotations {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid annotation %q: expected KEY=VALUE", kv)
+		}
+		container = container.WithAnnotation(key, value)
+	}
+
+	if immutableTag {
+		existing, err := remoteTagDigest(ctx, fullImageRef, usernameStr, password)
+		if err != nil {
+			return nil, err
+		}
+		if existing != "" {
+			digest, err := localImageDigest(ctx, container)
+			if err != nil {
+				return nil, err
+			}
+			if existing != digest {
+				return nil, fmt.Errorf("tag %s already points at %s; refusing to overwrite it with %s", fullImageRef, existing, digest)
+			}
+		}
+	}
+
+	var address string
+	retries, err := config.retry(ctx, "Registry push", func() (err error) {
+		address, err = container.
+			WithRegistryAuth(registryUrl, usernameStr, password).
+			Publish(ctx, fullImageRef)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push to registry: %w", err)
+	}
 
+	repository, digest, err := splitImageAddress(address)
 	if err != nil {
-		return "", fmt.Errorf("failed to push to registry: %w", err)
+		return nil, err
 	}
 
-	return address, nil
+	// Further tags point at the pushed digest, so the image is published only once
+	if len(additionalTags) > 0 {
+		tagRetries, err := config.retry(ctx, "Tagging", func() error {
+			_, err := dag.Skopeo().Tag(ctx, repository, digest, additionalTags, dagger.SkopeoTagOpts{
+				Username: usernameStr,
+				Password: password,
+			})
+			return err
+		})
+		retries += tagRetries
+		if err != nil {
+			return nil, fmt.Errorf("failed to add tags %s: %w", strings.Join(additionalTags, ", "), err)
+		}
+	}
+
+	if releaseNotes != nil {
+		if err := attachReleaseNotes(ctx, address, registryUrl, usernameStr, password, releaseNotes); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PushedImage{
+		Address:    address,
+		Repository: repository,
+		Tags:       append([]string{tag}, additionalTags...),
+		Digest:     digest,
+		Ref:        repository + "@" + digest,
+		retries:    retries,
+	}, nil
 }
 
 // FullPipeline runs the complete security-first CI/CD pipeline
+// The result is a PipelineReport with each step's status, duration, findings and raw
+// report; Json, Markdown and Summary render it for CI
 func (m *SearchApi) FullPipeline(
 	ctx context.Context,
 	// +optional
@@ -566,346 +932,1141 @@ func (m *SearchApi) FullPipeline(
 	// Image reference (e.g., "myproject/search-api", "ghcr.io/myorg/search-api")
 	// +optional
 	imageRef string,
-	// Image tag
-	// +default="latest"
+	// Image tag (defaults to the version computed from git history, or "latest"
+	// without history)
+	// +optional
 	tag string,
-) (string, error) {
-	report := "🚀 Starting Security-First CI/CD Pipeline\n\n"
-
-	// SECURITY GATE 1: Secret Scanning (FAIL FAST)
-	report += "🔐 Step 1: Scanning for hardcoded secrets...\n"
-	_, err := dag.Trufflehog().Scan(ctx, dagger.TrufflehogScanOpts{
-		Source:         source,
-		Format:         "json",
-		Concurrency:    10,
-		FailOnVerified: true,
-	})
+	// Risk register with expiring waivers for dependency, container and C# analyzer findings
+	// +optional
+	riskRegister *dagger.File,
+	// Expiring waivers by CVE and package (vuln-waivers.yaml) for dependency and container
+	// findings, reported as accepted risk; an expired waiver blocks
+	// +optional
+	vulnWaivers *dagger.File,
+	// License policy (license-policy.yaml) with allowed and denied SPDX IDs, evaluated
+	// against the SBOM instead of gating the license scan on severity
+	// +optional
+	licensePolicy *dagger.File,
+	// Security baseline (.security-baseline.yaml) with expiring suppressions passed to
+	// Trivy, Semgrep, Checkov and ZAP
+	// +optional
+	securityBaseline *dagger.File,
+	// Fixture documents to seed Solr with; each test run starts from a fresh restore of the seeded index
+	// +optional
+	solrFixtures *dagger.Directory,
+	// Scanner databases, rules and templates for runners without internet access
+	// (see DownloadOfflineAssets)
+	// +optional
+	offlineAssets *dagger.Directory,
+	// Record DAST traffic as a HAR file in the failure diagnostics
+	// +optional
+	captureDastHar bool,
+	// Minimum CIS container hardening score (0-100); 0 only reports
+	// +optional
+	minimumCisScore float64,
+	// Maximum compressed image size in MB; 0 only reports
+	// +optional
+	maxImageSizeMb float64,
+	// Maximum image layer count; 0 only reports
+	// +optional
+	maxImageLayers int,
+	// Maximum number of independent steps (1-11) run at once; 0 runs them all at once
+	// +optional
+	maxParallel int,
+	// Attempts of the network-dependent steps (secret scan, SAST, vulnerability scans,
+	// registry push) that fail on a network error, with exponential backoff
+	// +default=3
+	retryAttempts int,
+	// Step modes as STEP=MODE, overriding the defaults (e.g., "licenses=warn" on feature
+	// branches); modes are block, warn or skip
+	// +optional
+	gatePolicy []string,
+	// Return the report with a blocked or failed status instead of an error, so CI can
+	// gate on its JSON
+	// +optional
+	reportFailures bool,
+	// Slack or Teams incoming webhook to post the result to, passed or not
+	// +optional
+	notifyWebhook *dagger.Secret,
+	// Webhook platform: slack or teams
+	// +default="slack"
+	notifyPlatform string,
+	// Slack channel to post to, when the webhook allows overriding it
+	// +optional
+	notifyChannel string,
+	// Link to the pipeline's reports in the notification (e.g., the CI run's artifacts)
+	// +optional
+	reportsUrl string,
+	// OTLP/HTTP endpoint to export a span per step to (e.g., "http://otel-collector:4318")
+	// +optional
+	otlpEndpoint string,
+	// OIDC identity token (e.g., GitHub Actions' with the sigstore audience) to sign the
+	// pushed image keyless, with Fulcio and Rekor (see SignImageKeyless)
+	// +optional
+	signingOidcToken *dagger.Secret,
+	// Dependency-Track URL to upload a CycloneDX SBOM to (see UploadSbomToDependencyTrack)
+	// +optional
+	dependencyTrackUrl string,
+	// Dependency-Track API key
+	// +optional
+	dependencyTrackApiKey *dagger.Secret,
+	// Further registries to push and sign the same image in, including the registry
+	// (e.g., ["ghcr.io/myorg/search-api"])
+	// +optional
+	mirrorImageRefs []string,
+	// Username for each mirror registry
+	// +optional
+	mirrorUsernames []*dagger.Secret,
+	// Password or token for each mirror registry
+	// +optional
+	mirrorPasswords []*dagger.Secret,
+) (*PipelineReport, error) {
+	policy, err := parseGatePolicy(gatePolicy)
 	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - SECRET SCAN FAILED - secrets detected in code: %w", err)
-	}
-	report += "✅ No secrets detected\n\n"
-
-	// SECURITY GATE 2: SAST - Static Application Security Testing (FAIL FAST)
-	report += "🛡️  Step 2: Running SAST (Semgrep)...\n"
-	_, err = dag.Semgrep().Scan(ctx, dagger.SemgrepScanOpts{
-		Source:   source,
-		Configs:  []string{"p/csharp", "p/security-audit", "p/owasp-top-ten", "p/sql-injection", "p/xss"},
-		Severity: []string{"ERROR", "WARNING"},
-		Format:   "sarif",
-		Exclude:  []string{"*.Tests", "obj/", "bin/"},
-	})
+		return nil, err
+	}
+	mirrors, err := registryDestinations(mirrorImageRefs, mirrorUsernames, mirrorPasswords)
 	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - SAST FAILED - security vulnerabilities detected: %w", err)
+		return nil, err
+	}
+	config := defaultPipelineConfig()
+	config.mirrors = mirrors
+	config.Steps = policy
+	config.Registry.Url = registryUrl
+	config.Registry.ImageRef = imageRef
+	config.Registry.Tag = tag
+	config.Thresholds.CisScore = minimumCisScore
+	config.Thresholds.MaxImageSizeMb = maxImageSizeMb
+	config.Thresholds.MaxImageLayers = maxImageLayers
+	config.CaptureDastHar = captureDastHar
+	config.MaxParallel = maxParallel
+	config.Retry.Attempts = retryAttempts
+	config.ReportFailures = reportFailures
+	config.Notify.Platform = notifyPlatform
+	config.Notify.Channel = notifyChannel
+	config.Notify.ReportsUrl = reportsUrl
+	config.OtlpEndpoint = otlpEndpoint
+	config.DependencyTrack.Url = dependencyTrackUrl
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	inputs := pipelineInputs{
+		riskRegister:     riskRegister,
+		vulnWaivers:      vulnWaivers,
+		licensePolicy:    licensePolicy,
+		securityBaseline: securityBaseline,
+		solrFixtures:     solrFixtures,
+		offlineAssets:    offlineAssets,
 	}
-	report += "✅ SAST passed - no security vulnerabilities in code\n\n"
+	return m.runPipeline(ctx, source, config, registryUsername, registryPassword, notifyWebhook, signingOidcToken, dependencyTrackApiKey, inputs)
+}
 
-	// Step 3: C# Security Analysis
-	report += "🔒 Step 3: Running C# Security Analysis (.NET Analyzers)...\n"
-	_, err = dag.Dotnet().BuildWithAnalyzers(ctx, "SearchApi.sln", dagger.DotnetBuildWithAnalyzersOpts{
-		Source:        source,
-		Configuration: "Release",
-	})
+// FullPipelineFromConfig runs FullPipeline with its gates tuned by a config file
+// (YAML or JSON; see pipeline.yaml): which steps run, which block or only warn,
+// thresholds and severity levels. The config is validated before anything runs
+func (m *SearchApi) FullPipelineFromConfig(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Pipeline config (e.g., pipeline.yaml)
+	configFile *dagger.File,
+	// Registry username, for the registry in the config
+	// +optional
+	registryUsername *dagger.Secret,
+	// Registry password or token
+	// +optional
+	registryPassword *dagger.Secret,
+	// Slack or Teams incoming webhook, for the notification in the config
+	// +optional
+	notifyWebhook *dagger.Secret,
+	// OIDC identity token to sign the pushed image keyless (see SignImageKeyless)
+	// +optional
+	signingOidcToken *dagger.Secret,
+	// API key for the Dependency-Track instance in the config
+	// +optional
+	dependencyTrackApiKey *dagger.Secret,
+	// Read the credentials the config's vault.secrets name from HashiCorp Vault, with
+	// the VAULT_ADDR and VAULT_TOKEN of the Dagger CLI's environment; arguments passed
+	// explicitly take precedence
+	// +optional
+	fromVault bool,
+	// Branch selecting the config's branch step modes (defaults to the checked out branch)
+	// +optional
+	branch string,
+) (*PipelineReport, error) {
+	config, err := loadPipelineConfig(ctx, configFile)
 	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - C# SECURITY ANALYSIS FAILED - security issues detected: %w", err)
+		return nil, err
 	}
-	report += "✅ C# security analysis passed\n\n"
+	if branch == "" && len(config.Branches) > 0 {
+		// CI checkouts are often detached; pass the branch explicitly there
+		if checkout, err := gitSource(ctx, source); err == nil {
+			branch = strings.TrimPrefix(checkout.ref, "refs/heads/")
+		}
+	}
+	config.forBranch(branch)
 
-	// Step 4: Build and Unit Test
-	report += "📦 Step 4: Building and running unit tests...\n"
-	_, err = m.Build(ctx, source)
-	if err != nil {
-		return report, fmt.Errorf("build failed: %w", err)
+	var credentials map[string]*dagger.Secret
+	if fromVault {
+		credentials, err = config.vaultCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials from Vault: %w", err)
+		}
+		registryUsername = cmp.Or(registryUsername, credentials["registryUsername"])
+		registryPassword = cmp.Or(registryPassword, credentials["registryPassword"])
+		notifyWebhook = cmp.Or(notifyWebhook, credentials["notifyWebhook"])
+		dependencyTrackApiKey = cmp.Or(dependencyTrackApiKey, credentials["dependencyTrackApiKey"])
+	}
+	for i, mirror := range config.Registry.Mirrors {
+		config.mirrors = append(config.mirrors, registryDestination{
+			url:      cmp.Or(mirror.Url, registryHost(mirror.ImageRef)),
+			imageRef: mirror.ImageRef,
+			username: credentials[fmt.Sprintf("registry.mirrors[%d].username", i)],
+			password: credentials[fmt.Sprintf("registry.mirrors[%d].password", i)],
+		})
 	}
-	report += "✅ Build and unit tests passed\n\n"
 
-	// Step 5: Code Coverage
-	report += "📊 Step 5: Checking code coverage...\n"
-	_, err = dag.Dotnet().GetCoverage(ctx, "SearchApi.Tests/SearchApi.Tests.csproj", dagger.DotnetGetCoverageOpts{
-		Source:        source,
-		Configuration: "Release",
-	})
+	return m.runPipeline(ctx, source, config, registryUsername, registryPassword, notifyWebhook, signingOidcToken, dependencyTrackApiKey, config.inputs(source))
+}
+
+// RunStages runs only the selected pipeline stages, e.g. secrets, sast and build
+// before pushing, instead of the whole pipeline
+// What the stages need runs too: the container build before the container scan,
+// the services before DAST. Nothing is pushed to a registry
+func (m *SearchApi) RunStages(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Stages to run (e.g., "secrets,sast,build" or "secret-scan,sast-scan,build");
+	// an unknown stage lists the valid ones
+	stages []string,
+	// Pipeline config for modes and thresholds (e.g., pipeline.yaml)
+	// +optional
+	configFile *dagger.File,
+) (*PipelineReport, error) {
+	selected, err := resolveStages(stages)
 	if err != nil {
-		report += fmt.Sprintf("⚠️  Code coverage warning: %v\n\n", err)
-	} else {
-		report += "✅ Code coverage meets threshold (80%)\n\n"
+		return nil, err
+	}
+	config := defaultPipelineConfig()
+	if configFile != nil {
+		config, err = loadPipelineConfig(ctx, configFile)
+		if err != nil {
+			return nil, err
+		}
 	}
+	config.stages = selected
 
-	// Step 6: Code Quality - Static Analysis
-	report += "🔍 Step 6: Running code quality checks...\n"
-	_, err = dag.Dotnet().Format(ctx, dagger.DotnetFormatOpts{
-		Source:          source,
-		Project:         "SearchApi.sln",
-		VerifyNoChanges: true,
-		Verbosity:       "diagnostic",
-	})
-	if err != nil {
-		report += fmt.Sprintf("⚠️  Code formatting warnings: %v\n\n", err)
+	return m.runPipeline(ctx, source, config, nil, nil, nil, nil, nil, config.inputs(source))
+}
+
+// runPipeline runs the pipeline steps as the config sets them up
+func (m *SearchApi) runPipeline(
+	ctx context.Context,
+	source *dagger.Directory,
+	config *pipelineConfig,
+	registryUsername *dagger.Secret,
+	registryPassword *dagger.Secret,
+	notifyWebhook *dagger.Secret,
+	signingOidcToken *dagger.Secret,
+	dependencyTrackApiKey *dagger.Secret,
+	inputs pipelineInputs,
+) (*PipelineReport, error) {
+	registryUrl, imageRef, tag := config.Registry.Url, config.Registry.ImageRef, config.Registry.Tag
+	thresholds, severities := config.Thresholds, config.Severities
+	run := newPipelineRun(config)
+	if notifyWebhook != nil {
+		// A failed notification is reported but doesn't change the pipeline's result
+		run.onFinish = append(run.onFinish, func(report *PipelineReport) {
+			notice := config.Notify
+			if err := notify(ctx, report.view(), notifyWebhook, notice.Platform, notice.Channel, notice.ReportsUrl); err != nil {
+				report.Text += fmt.Sprintf("⚠️  Notification failed: %v\n", err)
+			} else {
+				report.Text += fmt.Sprintf("📣 Result posted to %s\n", notice.Platform)
+			}
+		})
+	}
+	if config.OtlpEndpoint != "" {
+		// Like notifications, a failed export doesn't change the pipeline's result
+		run.onFinish = append(run.onFinish, func(report *PipelineReport) {
+			if err := exportSpans(ctx, config.OtlpEndpoint, report); err != nil {
+				report.Text += fmt.Sprintf("⚠️  Trace export failed: %v\n", err)
+			} else {
+				report.Text += fmt.Sprintf("🔭 Step spans exported to %s\n", config.OtlpEndpoint)
+			}
+		})
+	}
+	run.log("🚀 Starting Security-First CI/CD Pipeline\n\n")
+
+	// The version tags the image and is stamped into the assemblies
+	if version, err := computeVersion(ctx, source, ""); err != nil {
+		run.log(fmt.Sprintf("⚠️  Version not computed: %v\n\n", err))
+	} else if version.Bump == "none" {
+		run.report.Version = version.Version
+		run.log(fmt.Sprintf("🏷️  Version %s (tagged release)\n\n", version.Version))
 	} else {
-		report += "✅ Static analysis passed: Code formatting is correct\n\n"
+		run.report.Version = version.Version
+		run.log(fmt.Sprintf("🏷️  Version %s (%s since %s)\n\n", version.Version, version.Bump, cmp.Or(version.PreviousTag, "the first commit")))
 	}
-
-	// SECURITY GATE 3: Dependency Vulnerability Scan (ENFORCED)
-	report += "🔒 Step 7: Scanning dependencies for vulnerabilities...\n"
-	_, err = dag.Trivy().ScanVulnerabilities(ctx, dagger.TrivyScanVulnerabilitiesOpts{
-		Source:         source,
-		Severity:       []string{"HIGH", "CRITICAL"},
-		FailOnFindings: true,
-	})
-	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - DEPENDENCY SCAN FAILED - vulnerable packages found: %w", err)
+	if tag == "" {
+		tag = cmp.Or(run.report.Version, "latest")
 	}
-	report += "✅ No vulnerable dependencies found\n\n"
 
-	// SECURITY GATE 4: License Compliance Scan (ENFORCED)
-	report += "📜 Step 8: Scanning for license compliance issues...\n"
-	_, err = dag.Trivy().ScanLicenses(ctx, dagger.TrivyScanLicensesOpts{
-		Source:   source,
-		Severity: []string{"HIGH", "CRITICAL"},
-	})
-	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - LICENSE SCAN FAILED - problematic licenses detected: %w", err)
+	// Accepted risks don't block the dependency, container and C# analyzer gates until their waiver expires
+	var register *acceptanceRegister
+	if inputs.riskRegister != nil {
+		loaded, err := loadRiskRegister(ctx, inputs.riskRegister, time.Now())
+		if err != nil {
+			return run.stop(err)
+		}
+		register = loaded
 	}
-	report += "✅ No problematic licenses detected\n\n"
-
-	// SECURITY GATE 5: IaC Security Scan
-	report += "☸️  Step 9: Scanning Kubernetes manifests (IaC)...\n"
-	_, err = dag.Checkov().ScanKubernetes(ctx, dagger.CheckovScanKubernetesOpts{
-		Source: source,
-		K8SDir: "k8s",
-	})
-	if err != nil {
-		report += "⚠️  IaC scan completed with findings\n\n"
-	} else {
-		report += "✅ IaC security scan completed\n\n"
+	// Waived CVEs are reported as accepted risk; an expired waiver blocks until renewed
+	var waivers *vulnWaivers
+	if inputs.vulnWaivers != nil {
+		loaded, err := loadVulnWaivers(ctx, inputs.vulnWaivers, time.Now())
+		if err != nil {
+			return run.stop(err)
+		}
+		if err := loaded.checkExpired(); err != nil {
+			return run.stop(blocked(fmt.Errorf("❌ BLOCKED - %w", err)))
+		}
+		waivers = loaded
+	}
+	var licenses *licensePolicy
+	if inputs.licensePolicy != nil {
+		loaded, err := loadLicensePolicy(ctx, inputs.licensePolicy)
+		if err != nil {
+			return run.stop(err)
+		}
+		licenses = loaded
+	}
+	// Suppressed findings are left out by the scanners themselves; an expired suppression blocks
+	var baseline *securityBaseline
+	if inputs.securityBaseline != nil {
+		loaded, err := loadSecurityBaseline(ctx, inputs.securityBaseline, time.Now())
+		if err != nil {
+			return run.stop(err)
+		}
+		if err := loaded.checkExpired(); err != nil {
+			return run.stop(blocked(fmt.Errorf("❌ BLOCKED - %w", err)))
+		}
+		baseline = loaded
+	}
+	// Scanners use the pre-seeded databases and rules instead of downloading them
+	var offline *offlineAssets
+	if inputs.offlineAssets != nil {
+		loaded, err := loadOfflineAssets(ctx, inputs.offlineAssets)
+		if err != nil {
+			return run.stop(err)
+		}
+		offline = loaded
+		run.log("📦 Offline mode: scanners use the pre-seeded databases, rules and templates\n\n")
 	}
 
-	// SECURITY GATE 6: Policy as Code (OPA/Conftest)
-	report += "📐 Step 10: Validating policies (OPA/Conftest)...\n"
-	_, err = dag.Conftest().TestKubernetes(ctx, dagger.ConftestTestKubernetesOpts{
-		Source: source,
-		K8SDir: "k8s",
-	})
+	// Steps 1-11 only read the source, so they run concurrently; a blocking gate
+	// stops the others and the report still lists the steps in order
+	var sbom string
+	steps := []pipelineStep{
+		// SECURITY GATE 1: Secret Scanning (FAIL FAST)
+		{stepSpecFor("secrets"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			var output string
+			retries, err := config.retry(ctx, "Secret scan", func() (err error) {
+				output, err = dag.Trufflehog().Scan(ctx, dagger.TrufflehogScanOpts{
+					Source:         config.scope(source),
+					Format:         "json",
+					Concurrency:    10,
+					FailOnVerified: true,
+				})
+				return err
+			})
+			if err != nil {
+				return retries, blocked(fmt.Errorf("❌ BLOCKED - SECRET SCAN FAILED - secrets detected in code: %w", err))
+			}
+			step.attach("01-secret-scan.json", output)
+			return retries + "✅ No secrets detected\n\n", nil
+		}},
+
+		// SECURITY GATE 2: SAST - Static Application Security Testing (FAIL FAST)
+		{stepSpecFor("sast"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			var output string
+			retries, err := config.retry(ctx, "SAST", func() (err error) {
+				output, err = dag.Semgrep().Scan(ctx, dagger.SemgrepScanOpts{
+					Source:       config.scope(source),
+					Configs:      sastRulesets,
+					Severity:     severities.Sast,
+					Format:       "sarif",
+					Exclude:      []string{"*.Tests", "obj/", "bin/"},
+					ExcludeRules: baseline.ids("semgrep"),
+					OfflineRules: offline.semgrepRules(),
+				})
+				return err
+			})
+			if err != nil {
+				return retries, blocked(fmt.Errorf("❌ BLOCKED - SAST FAILED - security vulnerabilities detected: %w", err))
+			}
+			step.attach("02-sast-scan.sarif", output)
+			return retries + "✅ SAST passed - no security vulnerabilities in code\n\n", nil
+		}},
+
+		// Step 3: C# Security Analysis
+		{stepSpecFor("csharp-analysis"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			_, err := dag.Dotnet().BuildWithAnalyzers(ctx, solutionFile, dagger.DotnetBuildWithAnalyzersOpts{
+				Configuration: buildConfig,
+				Base:          buildBase(source),
+			})
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - C# SECURITY ANALYSIS FAILED - security issues detected: %w", err))
+			}
+			// SecurityCodeScan findings are warnings, which block like the analyzers above
+			csharpSarif, err := csharpSecuritySarif(ctx, source, "")
+			if err == nil {
+				step.attach("03-csharp-security.sarif", csharpSarif)
+				_, _, err = gateScanOutput(csharpSarif, []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}, register, nil)
+			}
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - C# SECURITY ANALYSIS FAILED - security issues detected: %w", err))
+			}
+			return "✅ C# security analysis passed\n\n", nil
+		}},
+
+		// Step 4: Build and Unit Test
+		{stepSpecFor("build"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			if _, err := m.Build(ctx, source); err != nil {
+				return "", fmt.Errorf("build failed: %w", err)
+			}
+			return "✅ Build and unit tests passed\n\n", nil
+		}},
+
+		// Step 5: Code Coverage
+		{stepSpecFor("coverage"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			coverage, err := m.CodeCoverage(ctx, source, thresholds.Coverage, "", 90, thresholds.BranchCoverage)
+			if coverage != nil {
+				// Only this step sets them, so the concurrent writes are safe
+				run.report.CoveragePercent = coverage.LineRate
+				run.report.BranchCoveragePercent = coverage.BranchRate
+				run.report.MethodCoveragePercent = coverage.MethodRate
+			}
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - CODE COVERAGE BELOW THRESHOLD: %w", err))
+			}
+			return fmt.Sprintf("✅ Code coverage meets threshold (%.0f%%): %.1f%% lines, %.1f%% branches, %.1f%% methods\n\n",
+				thresholds.Coverage, coverage.LineRate, coverage.BranchRate, coverage.MethodRate), nil
+		}},
+
+		// Step 6: Code Quality - Static Analysis
+		{stepSpecFor("formatting"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			if _, err := m.StaticAnalysis(ctx, source, config.changedFiles); err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - CODE FORMATTING FAILED: %w (see format-diff)", err))
+			}
+			return "✅ Static analysis passed: Code formatting is correct\n\n", nil
+		}},
+
+		// SECURITY GATE 3: Dependency Vulnerability Scan (ENFORCED)
+		{stepSpecFor("dependencies"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			waived, acceptedRisk, retries := "", "", ""
+			var err error
+			if register != nil || waivers != nil {
+				var output string
+				retries, err = config.retry(ctx, "Dependency scan", func() (err error) {
+					output, err = dag.Trivy().ScanFilesystem(ctx, dagger.TrivyScanFilesystemOpts{
+						Source:     source,
+						Scanners:   []string{"vuln"},
+						Severity:   severities.Dependencies,
+						Format:     "json",
+						IgnoreFile: baseline.trivyIgnore(),
+						OfflineDb:  offline.trivyDb(),
+					})
+					return err
+				})
+				if err == nil {
+					step.attach("07-dependency-scan.json", output)
+					waived, acceptedRisk, err = gateScanOutput(output, severities.Dependencies, register, waivers)
+				}
+			} else {
+				var output string
+				retries, err = config.retry(ctx, "Dependency scan", func() (err error) {
+					output, err = dag.Trivy().ScanVulnerabilities(ctx, dagger.TrivyScanVulnerabilitiesOpts{
+						Source:         source,
+						Severity:       severities.Dependencies,
+						FailOnFindings: true,
+						IgnoreFile:     baseline.trivyIgnore(),
+						OfflineDb:      offline.trivyDb(),
+					})
+					return err
+				})
+				if err == nil {
+					step.attach("07-dependency-scan.json", output)
+				}
+			}
+			if err != nil {
+				return retries, blocked(fmt.Errorf("❌ BLOCKED - DEPENDENCY SCAN FAILED - vulnerable packages found: %w", err))
+			}
+			if waived != "" {
+				return retries + fmt.Sprintf("✅ No unaccepted vulnerable dependencies found (%s)\n", waived) + acceptedRisk + "\n", nil
+			}
+			return retries + "✅ No vulnerable dependencies found\n\n", nil
+		}},
+
+		// SECURITY GATE 4: License Compliance Scan (ENFORCED)
+		{stepSpecFor("licenses"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			if licenses != nil {
+				// Same scan as the SBOM step, so Dagger runs it once
+				content, err := dag.Syft().Scan(ctx, dagger.SyftScanOpts{
+					Source: source,
+					Format: "spdx-json",
+				})
+				if err != nil {
+					return "", fmt.Errorf("SBOM generation failed: %w", err)
+				}
+				report, err := evaluateLicenses(content, licenses)
+				if err != nil {
+					return "", err
+				}
+				if output, err := json.MarshalIndent(report, "", "  "); err == nil {
+					step.attach("08-license-report.json", string(output))
+				}
+				if report.Blocking > 0 {
+					return report.text(), blocked(fmt.Errorf("❌ BLOCKED - LICENSE POLICY VIOLATED - %d package(s) with denied or unknown licenses", report.Blocking))
+				}
+				return report.text() + "✅ All licenses allowed by the license policy or waived\n\n", nil
+			}
+			output, err := dag.Trivy().ScanLicenses(ctx, dagger.TrivyScanLicensesOpts{
+				Source:     source,
+				Severity:   severities.Licenses,
+				IgnoreFile: baseline.trivyIgnore(),
+				OfflineDb:  offline.trivyDb(),
+			})
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - LICENSE SCAN FAILED - problematic licenses detected: %w", err))
+			}
+			step.attach("08-license-scan.json", output)
+			return "✅ No problematic licenses detected\n\n", nil
+		}},
+
+		// SECURITY GATE 5: IaC Security Scan
+		{stepSpecFor("iac"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			output, err := dag.Checkov().ScanKubernetes(ctx, dagger.CheckovScanKubernetesOpts{
+				Source:     source,
+				K8SDir:     "k8s",
+				Output:     "json",
+				SkipChecks: baseline.ids("checkov"),
+			})
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - IAC SCAN FAILED - misconfigurations found: %w", err))
+			}
+			step.attach("09-iac-scan.json", output)
+			return "✅ IaC security scan completed\n\n", nil
+		}},
+
+		// SECURITY GATE 6: Policy as Code (OPA/Conftest)
+		{stepSpecFor("policy"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			output, err := dag.Conftest().TestKubernetes(ctx, dagger.ConftestTestKubernetesOpts{
+				Source: source,
+				K8SDir: "k8s",
+			})
+			if err != nil {
+				return "", blocked(fmt.Errorf("❌ BLOCKED - POLICY CHECK FAILED - policy violations found: %w", err))
+			}
+			step.attach("10-policy-check.txt", output)
+			return "✅ All policy checks passed\n\n", nil
+		}},
+
+		// Step 11: Generate SBOM
+		{stepSpecFor("sbom"), func(ctx context.Context, step *PipelineStepResult) (string, error) {
+			var err error
+			sbom, err = dag.Syft().Scan(ctx, dagger.SyftScanOpts{
+				Source: source,
+				Format: "spdx-json",
+			})
+			if err != nil {
+				return "", fmt.Errorf("SBOM generation failed: %w", err)
+			}
+			step.attach("11-sbom.spdx.json", sbom)
+			return fmt.Sprintf("✅ SBOM generated (%d bytes)\n\n", len(sbom)), nil
+		}},
+	}
+	results, err := runPipelineSteps(ctx, config, steps)
+	run.add(results)
 	if err != nil {
-		report += "⚠️  Policy check completed with violations\n\n"
-	} else {
-		report += "✅ All policy checks passed\n\n"
+		return run.stop(err)
 	}
 
-	// Step 11: Generate SBOM
-	report += "📋 Step 11: Generating SBOM...\n"
-	sbom, err := dag.Syft().Scan(ctx, dagger.SyftScanOpts{
-		Source: source,
-		Format: "spdx-json",
-	})
-	if err != nil {
-		report += fmt.Sprintf("⚠️  SBOM generation warning: %v\n\n", err)
-	} else {
-		report += fmt.Sprintf("✅ SBOM generated (%d bytes)\n\n", len(sbom))
+	// Step 11a: Dependency-Track keeps tracking the SBOM for new vulnerabilities
+	run.beginStep("dependency-track")
+	switch {
+	case config.DependencyTrack.Url == "" || dependencyTrackApiKey == nil:
+		run.skip("⏭️  Step " + stepSpecFor("dependency-track").number + ": Skipping Dependency-Track upload (not configured)\n\n")
+	case run.enabled("dependency-track"):
+		dtrack := config.DependencyTrack
+		cyclonedx, err := dag.Syft().Scan(ctx, dagger.SyftScanOpts{Source: source, Format: "cyclonedx-json"})
+		var result *DependencyTrackResult
+		if err == nil {
+			result, err = uploadToDependencyTrack(ctx, dependencyTrack{url: dtrack.Url, apiKey: dependencyTrackApiKey}, cyclonedx, dtrack.Project, tag, time.Duration(dtrack.WaitSeconds)*time.Second)
+		}
+		switch {
+		case err != nil:
+			if err := run.gate("dependency-track", fmt.Errorf("Dependency-Track upload failed: %w", err)); err != nil {
+				return run.stop(err)
+			}
+		case result.PolicyViolationsFail > 0:
+			run.log(result.text())
+			if err := run.gate("dependency-track", blocked(fmt.Errorf("❌ BLOCKED - %d Dependency-Track policy violation(s)", result.PolicyViolationsFail))); err != nil {
+				return run.stop(err)
+			}
+		default:
+			run.log(result.text() + "\n")
+		}
 	}
 
 	// Step 12: Build Container (using secure distroless image)
-	report += "🐳 Step 12: Building container image (distroless for security)...\n"
-	container := m.BuildContainerDistrolessExtra(ctx, source)
-	report += "✅ Container image built with distroless base (minimal attack surface)\n\n"
+	run.beginStep("container-build")
+	var container *dagger.Container
+	if config.runs("container-build") {
+		// Without the git history the image is labeled with the version only
+		build, err := commitMetadata(ctx, source, run.report.Version)
+		if err != nil {
+			run.log(fmt.Sprintf("⚠️  Image labeled without commit metadata: %v\n", err))
+		}
+		container = m.BuildContainerDistrolessExtra(ctx, source, build.version, build.revision, build.sourceDateEpoch)
+		run.log("✅ Container image built with distroless base (minimal attack surface)\n")
+		// Third-party notices are required in every released image
+		if sbom != "" {
+			notice, err := noticeFromSbom(sbom)
+			if err != nil {
+				run.warn(fmt.Sprintf("⚠️  Third-party notices skipped: %v\n\n", err))
+			} else {
+				container = m.EmbedNotice(container, notice)
+				run.log("✅ Third-party notices embedded at " + noticePath + "\n\n")
+			}
+		} else {
+			run.warn("⚠️  Third-party notices skipped: no SBOM\n\n")
+		}
+	} else {
+		run.skip(stageNotSelected)
+	}
 
 	// Step 12a: Container Size Analysis (optional)
-	report += "📏 Step 12a: Analyzing container size...\n"
-	_, err = m.ContainerSizeAnalysis(ctx, container)
-	if err != nil {
-		report += fmt.Sprintf("⚠️  Size analysis warning: %v\n\n", err)
-	} else {
-		// Extract just the size from the analysis
-		report += "✅ Container size analysis completed\n\n"
+	run.beginStep("container-size")
+	if run.enabled("container-size") {
+		_, err = m.ContainerSizeAnalysis(ctx, container, thresholds.MaxImageSizeMb, thresholds.MaxImageLayers)
+		// Measuring again is served from cache; the size goes into the job summary
+		if size, err := measureImage(ctx, container); err == nil {
+			run.report.ImageSizeMb = float64(size.total()) / (1024 * 1024)
+			run.report.ImageLayers = len(size.layers)
+		}
+		switch {
+		case err != nil && (thresholds.MaxImageSizeMb > 0 || thresholds.MaxImageLayers > 0):
+			if err := run.gate("container-size", blocked(fmt.Errorf("❌ BLOCKED - IMAGE SIZE BUDGET: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		case err != nil:
+			run.warn(fmt.Sprintf("⚠️  Size analysis warning: %v\n\n", err))
+		default:
+			run.log("✅ Container size analysis completed\n\n")
+		}
 	}
 
 	// SECURITY GATE 7: Container Vulnerability Scan (ENFORCED)
-	report += "🔎 Step 13: Scanning container for vulnerabilities...\n"
-	_, err = dag.Trivy().ScanContainer(ctx, container, dagger.TrivyScanContainerOpts{
-		Severity: []string{"HIGH", "CRITICAL"},
-	})
-	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - container scan FAILED - vulnerabilities found: %w", err)
+	run.beginStep("container-scan")
+	if run.enabled("container-scan") {
+		var containerScan string
+		retries, err := config.retry(ctx, "Container scan", func() (err error) {
+			containerScan, err = dag.Trivy().ScanContainer(ctx, container, dagger.TrivyScanContainerOpts{
+				Severity:   severities.Container,
+				IgnoreFile: baseline.trivyIgnore(),
+				OfflineDb:  offline.trivyDb(),
+			})
+			return err
+		})
+		run.log(retries)
+		if err == nil {
+			run.attach("13-container-scan.json", containerScan)
+		}
+		waived, acceptedRisk := "", ""
+		if err == nil && (register != nil || waivers != nil) {
+			waived, acceptedRisk, err = gateScanOutput(containerScan, severities.Container, register, waivers)
+		}
+		levels := strings.Join(severities.Container, "/")
+		switch {
+		case err != nil:
+			if err := run.gate("container-scan", blocked(fmt.Errorf("❌ BLOCKED - container scan FAILED - vulnerabilities found: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		case waived != "":
+			run.log(fmt.Sprintf("✅ Container has no unaccepted %s vulnerabilities (%s)\n", levels, waived) + acceptedRisk + "\n")
+		default:
+			run.log(fmt.Sprintf("✅ Container has no %s vulnerabilities\n\n", levels))
+		}
 	}
-	report += "✅ Container has no HIGH/CRITICAL vulnerabilities\n\n"
 
 	// Step 14: CIS Benchmark Compliance
-	report += "📋 Step 14: Running CIS Docker Benchmark...\n"
-	_, err = m.CisBenchmark(ctx, container)
-	if err != nil {
-		report += fmt.Sprintf("⚠️  CIS Benchmark completed with findings\n\n")
-	} else {
-		report += "✅ CIS Benchmark passed\n\n"
+	run.beginStep("cis")
+	if run.enabled("cis") {
+		cis, err := m.CisBenchmark(ctx, container, thresholds.CisScore, offline.trivyDb())
+		if cis != nil {
+			run.attach("14-cis-benchmark.json", cis.Report)
+		}
+		switch {
+		case cis == nil && err != nil:
+			run.warn(fmt.Sprintf("⚠️  CIS Benchmark could not run: %v\n\n", err))
+		case err != nil:
+			run.log(cis.text())
+			if err := run.gate("cis", blocked(fmt.Errorf("❌ BLOCKED - CIS BENCHMARK FAILED: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		case cis.Failed > 0 || cis.Secrets > 0:
+			run.warn("⚠️  CIS Benchmark completed with findings\n" + cis.text() + "\n")
+		default:
+			run.log("✅ CIS Benchmark passed\n" + cis.text() + "\n")
+		}
+	}
+	run.beginStep("config-hardening")
+	if run.enabled("config-hardening") {
+		hardening, err := m.ConfigHardening(ctx, container, "FATAL", nil)
+		if hardening != nil {
+			run.attach("14a-config-hardening.json", hardening.Report)
+		}
+		switch {
+		case hardening == nil && err != nil:
+			run.warn(fmt.Sprintf("⚠️  Image config hardening could not run: %v\n\n", err))
+		case err != nil:
+			run.log(hardening.text())
+			if err := run.gate("config-hardening", blocked(fmt.Errorf("❌ BLOCKED - IMAGE CONFIG HARDENING FAILED: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		default:
+			run.log("✅ Image config hardening passed (Dockle)\n" + hardening.text() + "\n")
+		}
 	}
 
 	// Step 15: Push to Local Registry
-	report += "📤 Step 15: Pushing to local registry...\n"
-	localImage, err := m.PushToLocalRegistry(ctx, container, tag)
-	if err != nil {
-		return report, fmt.Errorf("failed to push to local registry: %w", err)
+	run.beginStep("local-registry")
+	// Same TLS and auth paths as the production registry, with throwaway credentials
+	if config.runs("local-registry") {
+		localImage, err := m.PushToLocalRegistry(ctx, container, tag, true, "pipeline", dag.SetSecret("local-registry-password", fmt.Sprintf("pipeline-%d", time.Now().UnixNano())))
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to push to local registry: %w", err))
+		}
+		run.log(fmt.Sprintf("✅ Pushed to local registry: %s\n\n", localImage))
+	} else {
+		run.skip(stageNotSelected)
 	}
-	report += fmt.Sprintf("✅ Pushed to local registry: %s\n\n", localImage)
 
 	// Step 16: Start API and Solr Services
-	report += "🚀 Step 16: Starting API with Solr service...\n"
-	apiService, err := m.RunApiWithServices(ctx, container)
-	if err != nil {
-		return report, fmt.Errorf("failed to start services: %w", err)
+	run.beginStep("services")
+	var solrSnapshot *dagger.Directory
+	if inputs.solrFixtures != nil && (config.runs("services") || config.runs("performance")) {
+		solrSnapshot, err = m.SnapshotSolr(ctx, inputs.solrFixtures, solrCore, defaultSolrVersion)
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to seed Solr: %w", err))
+		}
+	}
+	// Integration tests and DAST log to volumes kept until the next run, so failures can be diagnosed
+	diagnostics := newFailureDiagnostics()
+	var apiService, dastService *dagger.Service
+	if config.runs("services") {
+		if err := diagnostics.clear(ctx); err != nil {
+			return run.stop(err)
+		}
+		apiService, err = diagnostics.apiService(ctx, container, solrSnapshot, "integration")
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to start services: %w", err))
+		}
+		// DAST and performance runs get their own restored index instead of the one integration tests modified
+		dastService, err = diagnostics.apiService(ctx, container, solrSnapshot, "dast")
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to start services: %w", err))
+		}
+		// Every later step targets these instances; none of them should race the startup
+		for _, service := range []*dagger.Service{apiService, dastService} {
+			if err := waitForHealthy(ctx, service, "/health", apiStartupTimeout); err != nil {
+				diagnostics.attach(m, run)
+				return run.stop(fmt.Errorf("failed to start services: %w", err))
+			}
+		}
+		if solrSnapshot != nil {
+			run.log("✅ API and Solr services started (index restored from seeded snapshot)\n\n")
+		} else {
+			run.log("✅ API and Solr services started\n\n")
+		}
+	} else {
+		run.skip(stageNotSelected)
+	}
+
+	// Step 16a: Smoke test, so a broken service stops the pipeline before the slow steps
+	run.beginStep("smoke-test")
+	if run.enabled("smoke-test") {
+		smoke, err := smokeTest(ctx, dastService, nil)
+		if err != nil {
+			diagnostics.attach(m, run)
+			if err := run.gate("smoke-test", fmt.Errorf("smoke test failed: %w", err)); err != nil {
+				return run.stop(err)
+			}
+		} else {
+			run.log("✅ Smoke test passed\n" + smoke.text() + "\n")
+		}
 	}
-	report += "✅ API and Solr services started\n\n"
 
 	// Step 17: Run Integration Tests
-	report += "🧪 Step 17: Running integration tests...\n"
-	_, err = m.RunIntegrationTests(ctx, source, apiService)
-	if err != nil {
-		return report, fmt.Errorf("integration tests failed: %w", err)
+	run.beginStep("integration-tests")
+	if run.enabled("integration-tests") {
+		if _, err := m.RunIntegrationTests(ctx, source, apiService, 0, 1, nil); err != nil {
+			diagnostics.attach(m, run)
+			if err := run.gate("integration-tests", fmt.Errorf("integration tests failed: %w", err)); err != nil {
+				return run.stop(err)
+			}
+		} else {
+			run.log("✅ Integration tests passed\n\n")
+		}
+	}
+
+	// The HAR is only written when the recording proxy stops
+	if config.CaptureDastHar && dastService != nil {
+		proxy, err := diagnostics.recordingProxy(dastService).Start(ctx)
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to start DAST recording proxy: %w", err))
+		}
+		defer func() { _, _ = proxy.Stop(ctx) }()
+		dastService = proxy
 	}
-	report += "✅ Integration tests passed\n\n"
 
 	// SECURITY GATE 8: DAST - Dynamic Application Security Testing
-	report += "🎯 Step 18: Running DAST (OWASP ZAP)...\n"
-	_, err = dag.Zap().BaselineScan(ctx, apiService, dagger.ZapBaselineScanOpts{
-		TargetURL: "http://api:8080",
-	})
-	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - DAST scan failed: %w", err)
+	run.beginStep("dast")
+	if run.enabled("dast") {
+		var output string
+		var err error
+		if config.deep {
+			// Actively attacks every page the spider finds instead of only observing
+			output, err = dag.Zap().FullScan(ctx, dastService, dagger.ZapFullScanOpts{
+				TargetURL:     "http://api:8080",
+				MaxDuration:   deepScanSpiderMinutes,
+				IgnoreAlerts:  baseline.ids("zap"),
+				OfflineAddons: offline.zapAddons(),
+			})
+		} else {
+			output, err = dag.Zap().BaselineScan(ctx, dastService, dagger.ZapBaselineScanOpts{
+				TargetURL:     "http://api:8080",
+				IgnoreAlerts:  baseline.ids("zap"),
+				OfflineAddons: offline.zapAddons(),
+			})
+		}
+		if err != nil {
+			diagnostics.attach(m, run)
+			if err := run.gate("dast", blocked(fmt.Errorf("❌ BLOCKED - DAST scan failed: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		} else {
+			run.attach("18-dast-scan.json", output)
+			run.log("✅ DAST passed - no vulnerabilities in running application\n\n")
+		}
 	}
-	report += "✅ DAST passed - no vulnerabilities in running application\n\n"
 
 	// SECURITY GATE 9: API Security Testing (OWASP API Top 10)
-	report += "🔓 Step 19: Running API security tests (Nuclei)...\n"
-	_, err = dag.Nuclei().ScanAPI(ctx, apiService, dagger.NucleiScanAPIOpts{
-		TargetURL: "http://api:8080",
-	})
-	if err != nil {
-		return report, fmt.Errorf("❌ BLOCKED - API SECURITY TEST FAILED - API vulnerabilities detected: %w", err)
+	run.beginStep("api-security")
+	if run.enabled("api-security") {
+		var output string
+		var err error
+		if config.deep {
+			output, err = dag.Nuclei().Scan(ctx, dastService, dagger.NucleiScanOpts{
+				TargetURL:        "http://api:8080",
+				Severity:         []string{"low", "medium", "high", "critical"},
+				AllTemplates:     true,
+				OfflineTemplates: offline.nucleiTemplates(),
+			})
+		} else {
+			output, err = dag.Nuclei().ScanAPI(ctx, dastService, dagger.NucleiScanAPIOpts{
+				TargetURL:        "http://api:8080",
+				OfflineTemplates: offline.nucleiTemplates(),
+			})
+		}
+		if err != nil {
+			diagnostics.attach(m, run)
+			if err := run.gate("api-security", blocked(fmt.Errorf("❌ BLOCKED - API SECURITY TEST FAILED - API vulnerabilities detected: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		} else {
+			run.attach("19-api-security.jsonl", output)
+			run.log("✅ API security tests passed - no API vulnerabilities\n\n")
+		}
 	}
-	report += "✅ API security tests passed - no API vulnerabilities\n\n"
 
 	// Step 20: Performance Testing
-	report += "🚀 Step 20: Running performance tests (k6)...\n"
-	_, err = dag.K6().LoadTest(ctx, apiService, dagger.K6LoadTestOpts{
-		TargetURL: "http://api:8080",
-		Endpoint:  "/health",
-		Vus:       10,
-		Duration:  "30s",
-	})
-	if err != nil {
-		report += fmt.Sprintf("⚠️  Performance test warning: %v\n\n", err)
-	} else {
-		report += "✅ Performance tests passed - meets SLAs\n\n"
+	run.beginStep("performance")
+	// Synthetic search mix (term, phrase, facet, paging) rather than just /health, against
+	// a monitored API with its own Solr so the report includes CPU/memory/GC counters
+	if run.enabled("performance") {
+		rate, duration := 10, "30s"
+		if config.deep {
+			rate, duration = deepScanRate, deepScanDuration
+		}
+		perfReport, err := m.PerformanceTest(ctx, nil, nil, rate, duration, 500, 0.05, container, solrSnapshot)
+		if err != nil {
+			if err := run.gate("performance", blocked(fmt.Errorf("❌ BLOCKED - PERFORMANCE TESTS FAILED: %w", err))); err != nil {
+				run.log(perfReport + "\n")
+				return run.stop(err)
+			}
+		} else {
+			run.log("✅ Performance tests passed - meets SLAs\n")
+		}
+		run.log(perfReport + "\n")
 	}
 
 	// Step 21: Mutation Testing (optional, can be slow)
-	report += "🧬 Step 21: Running mutation tests (Stryker.NET)...\n"
-	_, err = m.MutationTest(ctx, source, 80)
-	if err != nil {
-		report += fmt.Sprintf("⚠️  Mutation testing warning: %v\n\n", err)
-	} else {
-		report += "✅ Mutation testing passed - test quality is high\n\n"
+	run.beginStep("mutation")
+	if run.enabled("mutation") {
+		if result, err := m.MutationTest(ctx, source, thresholds.Mutation, "", false, ""); err != nil {
+			if err := run.gate("mutation", blocked(fmt.Errorf("❌ BLOCKED - MUTATION SCORE BELOW THRESHOLD: %w", err))); err != nil {
+				return run.stop(err)
+			}
+		} else if result.Killed+result.Survived+result.Timeout+result.NoCoverage == 0 {
+			run.log("✅ Mutation testing passed - no mutants to test, the score isn't enforced\n\n")
+		} else {
+			run.log(fmt.Sprintf("✅ Mutation testing passed - score %.1f%%\n\n", result.Score))
+		}
 	}
 
 	// Step 22: Push to Container Registry (if credentials provided)
 	if registryUrl != "" && registryUsername != nil && registryPassword != nil && imageRef != "" {
-		report += "🏗️  Step 22: Pushing to container registry...\n"
-		pushedImage, err := m.PushToRegistry(ctx, container, registryUrl, registryUsername, registryPassword, imageRef, tag)
+		run.beginStep("api-compatibility")
+		// Breaking API changes must be announced before they are released; the gate is
+		// recorded up front so it's reported whether or not the check finds a problem
+		run.gate("api-compatibility", nil)
+		usernameStr, err := registryUsername.Plaintext(ctx)
 		if err != nil {
-			return report, fmt.Errorf("failed to push to registry: %w", err)
+			return run.stop(fmt.Errorf("failed to read registry username: %w", err))
+		}
+		apiSpec := openApiSpec(container, solrService("", nil, "api-compat"))
+		lastTag, _, _, err := commitLog(ctx, source, "")
+		var baselineSpec *dagger.File
+		if err == nil && lastTag != "" {
+			baselineSpec, err = releasedOpenApiSpec(ctx, imageRef+":"+lastTag, registryUrl, usernameStr, registryPassword)
+		}
+		switch {
+		case config.mode("api-compatibility") == "skip":
+			run.skipGate("api-compatibility", "⏭️  API compatibility check skipped by pipeline config\n")
+		case err != nil:
+			run.warn(fmt.Sprintf("⚠️  API compatibility check skipped: %v\n", err))
+		case baselineSpec == nil:
+			run.skipGate("api-compatibility", "⏭️  API compatibility check skipped (no OpenAPI document from a previous release)\n")
+		default:
+			compat, err := apiCompatibility(ctx, source, baselineSpec, apiSpec, imageRef+":"+lastTag, "")
+			if err != nil {
+				if compat == nil {
+					return run.stop(fmt.Errorf("API compatibility check failed: %w", err))
+				}
+				if err := run.gate("api-compatibility", blocked(fmt.Errorf("❌ BLOCKED - UNANNOUNCED BREAKING API CHANGES: %w", err))); err != nil {
+					return run.stop(err)
+				}
+			} else {
+				run.log("✅ API compatible with the last release\n" + compat.text())
+			}
+		}
+		// Release notes need the git history; without it the image is pushed on its own
+		releaseNotes, err := m.GenerateReleaseNotes(ctx, source, tag, "", "", nil, "https://api.github.com", nil, nil, nil, nil)
+		if err != nil {
+			run.warn(fmt.Sprintf("⚠️  Release notes skipped: %v\n", err))
+			releaseNotes = nil
+		}
+		primary := registryDestination{url: registryUrl, imageRef: imageRef, username: registryUsername, password: registryPassword}
+		pushedImage, err := m.pushAndSign(ctx, config, container, primary, tag, nil, releaseNotes, signingOidcToken)
+		if err != nil {
+			return run.stop(fmt.Errorf("failed to push to registry: %w", err))
+		}
+		run.log(pushedImage.retries + fmt.Sprintf("✅ Pushed to registry: %s\n", pushedImage.Address))
+		// Tags move; everything attached to the release refers to the digest
+		run.report.Image = pushedImage.Ref
+		if pushedImage.Signature != "" {
+			run.log(fmt.Sprintf("✅ Signed keyless: %s\n", pushedImage.Signature))
+		}
+		for _, mirror := range config.mirrors {
+			if mirror.username == nil || mirror.password == nil {
+				run.warn(fmt.Sprintf("⚠️  Mirror %s skipped (credentials not provided)\n", mirror.imageRef))
+				continue
+			}
+			mirrored, err := m.pushAndSign(ctx, config, container, mirror, tag, nil, releaseNotes, signingOidcToken)
+			if err != nil {
+				return run.stop(fmt.Errorf("failed to push to mirror registry: %w", err))
+			}
+			if mirrored.Digest != pushedImage.Digest {
+				return run.stop(fmt.Errorf("mirror %s has digest %s, but %s has %s", mirrored.Repository, mirrored.Digest, pushedImage.Repository, pushedImage.Digest))
+			}
+			run.report.Mirrors = append(run.report.Mirrors, mirrored.Ref)
+			run.log(mirrored.retries + fmt.Sprintf("✅ Mirrored to %s\n", mirrored.Address))
+		}
+		if releaseNotes != nil {
+			run.log("✅ Release notes attached to image\n")
 		}
-		report += fmt.Sprintf("✅ Pushed to registry: %s\n\n", pushedImage)
+		// The next release compares its API against this document
+		if err := attachArtifact(ctx, pushedImage.Ref, registryUrl, usernameStr, registryPassword, apiSpec, "openapi.json", openApiArtifactType, "application/json"); err != nil {
+			return run.stop(fmt.Errorf("failed to attach OpenAPI document: %w", err))
+		}
+		run.log("✅ OpenAPI document attached to image\n")
+		run.log("\n")
 	} else {
-		report += "⏭️  Step 22: Skipping registry push (credentials not provided)\n\n"
-	}
-
-	report += "🎉 Security-First Pipeline Completed Successfully!\n"
-	report += "🔒 All 9 security gates passed - safe to deploy\n"
-	report += "🌐 100% air-gapped - no internet access during testing\n"
-	report += "📊 Pipeline Stats: 22 steps | 9 enforced gates | integration + DAST + API security tests\n"
-	report += "📏 Container optimization options:\n"
-	report += "   • BuildContainerOptimized() - Alpine + trimming (30-40% smaller)\n"
-	report += "   • BuildContainerDistroless() - No shell, max security (40-60% smaller)\n"
-	report += "   • CompareContainerSizes() - Compare all 4 build variants\n"
-	return report, nil
+		spec := stepSpecFor("api-compatibility")
+		run.begin(spec.name(), "")
+		run.gate("api-compatibility", nil)
+		run.skip("⏭️  Step " + spec.number + ": Skipping registry push (credentials not provided)\n\n")
+	}
+	run.end()
+
+	if register != nil {
+		run.log(register.summary() + "\n")
+	}
+	if baseline != nil {
+		run.log(baseline.summary() + "\n")
+	}
+
+	if config.stages != nil {
+		run.log("🎉 Selected stages completed successfully\n")
+		return run.finish(), nil
+	}
+	run.log("🎉 Security-First Pipeline Completed Successfully!\n")
+	gates := qualityGates(run.report.Steps, config)
+	run.log(gateSummary(gates))
+	if offline != nil {
+		run.log("🌐 Offline mode - scanner databases, rules and templates came from the offline assets\n")
+	}
+	run.log(fmt.Sprintf("📊 Pipeline Stats: %d steps | %d gates\n", len(run.report.Steps), len(gates)))
+	run.log("📏 Container optimization options:\n")
+	run.log("   • BuildContainerOptimized() - Alpine + trimming (30-40% smaller)\n")
+	run.log("   • BuildContainerDistroless() - No shell, max security (40-60% smaller)\n")
+	run.log("   • CompareContainerSizes() - Compare all 4 build variants\n")
+	return run.finish(), nil
 }
 
-// ExportPipelineReports runs the pipeline and exports all scan reports to a directory
+// ExportPipelineReports runs the pipeline's scans concurrently and exports their reports
+// to a directory, with index.json and index.html recording each report's status (failed
+// scans included), tool version and timing, and manifest.json describing every artifact
+// Besides the static scans, it starts the API with Solr to export the DAST, API
+// security, performance and integration test (TRX) reports
 func (m *SearchApi) ExportPipelineReports(
 	ctx context.Context,
 	source *dagger.Directory,
+	// Fixture documents to seed Solr with for the runtime reports
+	// +optional
+	solrFixtures *dagger.Directory,
+	// Export only the static scans, without starting the API
+	// +optional
+	staticOnly bool,
 ) *dagger.Directory {
-	// Create output directory
-	outputDir := dag.Directory()
-
-	// Run each scan and export the JSON reports
-
-	// 1. Secret Scan
-	secretReport, err := dag.Trufflehog().Scan(ctx, dagger.TrufflehogScanOpts{
-		Source:         source,
-		Format:         "json",
-		Concurrency:    10,
-		FailOnVerified: true,
-	})
-	outputDir = addScanReport(outputDir, "01-secret-scan.json", secretReport, err)
-
-	// 2. SAST Scan
-	sastReport, err := dag.Semgrep().Scan(ctx, dagger.SemgrepScanOpts{
-		Source:   source,
-		Configs:  []string{"p/csharp", "p/security-audit", "p/owasp-top-ten", "p/sql-injection", "p/xss"},
-		Severity: []string{"ERROR", "WARNING"},
-		Format:   "sarif",
-		Exclude:  []string{"*.Tests", "obj/", "bin/"},
-	})
-	outputDir = addScanReport(outputDir, "02-sast-scan.json", sastReport, err)
-
-	// 3. Dependency Scan
-	depReport, err := dag.Trivy().ScanVulnerabilities(ctx, dagger.TrivyScanVulnerabilitiesOpts{
-		Source:         source,
-		Severity:       []string{"HIGH", "CRITICAL"},
-		FailOnFindings: true,
-	})
-	outputDir = addScanReport(outputDir, "03-dependency-scan.json", depReport, err)
-
-	// 4. License Scan
-	licenseReport, err := dag.Trivy().ScanLicenses(ctx, dagger.TrivyScanLicensesOpts{
-		Source:   source,
-		Severity: []string{"HIGH", "CRITICAL"},
-	})
-	outputDir = addScanReport(outputDir, "04-license-scan.json", licenseReport, err)
-
-	// 5. IaC Scan
-	iacReport, err := dag.Checkov().ScanKubernetes(ctx, dagger.CheckovScanKubernetesOpts{
-		Source: source,
-		K8SDir: "k8s",
-	})
-	outputDir = addScanReport(outputDir, "05-iac-scan.json", iacReport, err)
-
-	// 6. C# Security Analysis
-	csharpReport, err := dag.Dotnet().BuildWithAnalyzers(ctx, solutionFile, dagger.DotnetBuildWithAnalyzersOpts{
-		Source:        source,
-		Configuration: buildConfig,
-	})
-	outputDir = addScanReport(outputDir, "06-csharp-security.txt", csharpReport, err)
-
-	// 7. Generate SBOM
-	sbomReport, err := dag.Syft().Scan(ctx, dagger.SyftScanOpts{
-		Source: source,
-		Format: "spdx-json",
-	})
-	outputDir = addScanReport(outputDir, "07-sbom.json", sbomReport, err)
-
-	// 8. Build container for scanning
-	container := m.BuildContainer(ctx, source)
-
-	// Container Scan
-	containerReport, err := dag.Trivy().ScanContainer(ctx, container, dagger.TrivyScanContainerOpts{
-		Severity: []string{"HIGH", "CRITICAL"},
-	})
-	outputDir = addScanReport(outputDir, "08-container-scan.json", containerReport, err)
-
-	// CIS Benchmark
-	cisReport, err := m.CisBenchmark(ctx, container)
-	outputDir = addScanReport(outputDir, "09-cis-benchmark.json", cisReport, err)
+	// Built once and shared by the container scans and the API services
+	container := m.BuildContainer(ctx, source, "", "", 0)
+
+	// Independent scans run concurrently; every one is listed in the index, including failures
+	tasks := []reportTask{
+		{name: "01-secret-scan.json", tool: "trufflehog", description: "Secrets found in the source and git history (TruffleHog)", content: func(ctx context.Context) (string, error) {
+			return dag.Trufflehog().Scan(ctx, dagger.TrufflehogScanOpts{
+				Source:         source,
+				Format:         "json",
+				Concurrency:    10,
+				FailOnVerified: true,
+			})
+		}},
+		{name: "02-sast-scan.json", tool: "semgrep", description: "SAST findings in the source (Semgrep)", content: func(ctx context.Context) (string, error) {
+			return dag.Semgrep().Scan(ctx, dagger.SemgrepScanOpts{
+				Source:   source,
+				Configs:  sastRulesets,
+				Severity: []string{"ERROR", "WARNING"},
+				Format:   "sarif",
+				Exclude:  []string{"*.Tests", "obj/", "bin/"},
+			})
+		}},
+		// Scanned without a failing exit code: findings would otherwise drop the report
+		{name: "03-dependency-scan.json", tool: "trivy", description: "Vulnerable NuGet dependencies (Trivy)", content: func(ctx context.Context) (string, error) {
+			return dag.Trivy().ScanFilesystem(ctx, dagger.TrivyScanFilesystemOpts{
+				Source:   source,
+				Scanners: []string{"vuln"},
+				Severity: []string{"HIGH", "CRITICAL"},
+			})
+		}},
+		{name: "04-license-scan.json", tool: "trivy", description: "Dependency licenses (Trivy)", content: func(ctx context.Context) (string, error) {
+			return dag.Trivy().ScanLicenses(ctx, dagger.TrivyScanLicensesOpts{
+				Source:   source,
+				Severity: []string{"HIGH", "CRITICAL"},
+			})
+		}},
+		{name: "05-iac-scan.json", tool: "checkov", description: "Kubernetes manifest misconfigurations (Checkov)", content: func(ctx context.Context) (string, error) {
+			return dag.Checkov().ScanKubernetes(ctx, dagger.CheckovScanKubernetesOpts{
+				Source: source,
+				K8SDir: "k8s",
+				Output: "json",
+			})
+		}},
+		{name: "06-csharp-security.txt", tool: "dotnet", description: "Build output with the .NET analyzers enabled", content: func(ctx context.Context) (string, error) {
+			return dag.Dotnet().BuildWithAnalyzers(ctx, solutionFile, dagger.DotnetBuildWithAnalyzersOpts{
+				Configuration: buildConfig,
+				Base:          buildBase(source),
+			})
+		}},
+		{name: "06-csharp-security.sarif", tool: "dotnet", description: "Security analyzer findings (SecurityCodeScan)", content: func(ctx context.Context) (string, error) {
+			return csharpSecuritySarif(ctx, source, "")
+		}},
+		{name: "07-sbom.json", tool: "syft", description: "Software bill of materials of the source (Syft)", format: "spdx-json", content: func(ctx context.Context) (string, error) {
+			return dag.Syft().Scan(ctx, dagger.SyftScanOpts{
+				Source: source,
+				Format: "spdx-json",
+			})
+		}},
+		{name: "08-container-scan.json", tool: "trivy", description: "Image vulnerabilities (Trivy)", content: func(ctx context.Context) (string, error) {
+			return dag.Trivy().ScanContainer(ctx, container, dagger.TrivyScanContainerOpts{
+				Severity: []string{"HIGH", "CRITICAL"},
+			})
+		}},
+		{name: "09-cis-benchmark.json", tool: "trivy", description: "Image hardening checks and secrets (Trivy)", content: func(ctx context.Context) (string, error) {
+			cis, err := m.CisBenchmark(ctx, container, 0, nil)
+			if err != nil {
+				return "", err
+			}
+			return cis.Report, nil
+		}},
+		// Note: SBOM Attestation requires signing keys, skipping in report export
+		// Mutation Testing: Stryker HTML/JSON reports, per-project scores and their trend
+		{name: "10-mutation", tool: "stryker", description: "Mutation testing reports, scores and trend (Stryker.NET)", directory: func(ctx context.Context) (*dagger.Directory, error) {
+			return mutationReports(ctx, source)
+		}},
+		// Formatting: the patch dotnet format would apply (empty when formatted)
+		{name: "11-format.patch", tool: "dotnet", description: "Formatting changes dotnet format would make", content: func(ctx context.Context) (string, error) {
+			return m.FormatDiff(source).Contents(ctx)
+		}},
+		// Image config hardening: Dockle CIS checks, independent of Trivy
+		{name: "12-config-hardening.json", tool: "dockle", description: "Image config hardening checks (Dockle)", content: func(ctx context.Context) (string, error) {
+			hardening, err := m.ConfigHardening(ctx, container, "FATAL", nil)
+			if hardening == nil {
+				return "", err
+			}
+			return hardening.Report, nil
+		}},
+	}
+	if !staticOnly {
+		tasks = append(tasks, m.runtimeReportTasks(ctx, source, container, solrFixtures)...)
+	}
+	outputDir, entries := runReportTasks(ctx, dag.Directory(), tasks)
 
-	// Note: SBOM Attestation requires signing keys, skipping in report export
+	// Deduplicated findings across all scanners, so counts aren't inflated by overlapping tools
+	findingsStarted := time.Now().UTC()
+	findingsEntry := reportEntry{File: "findings.json", Tool: "search-api", Status: "ok", StartedAt: findingsStarted.Format(time.RFC3339),
+		kind: "summary", format: "findings", description: "Findings of all scanners, deduplicated across tools"}
+	findings, err := collectFindings(ctx, outputDir)
+	if err == nil {
+		var content []byte
+		content, err = json.MarshalIndent(findings, "", "  ")
+		outputDir = addScanReport(outputDir, "findings.json", string(content), err)
+		findingsEntry.describe(string(content))
+	}
+	if err != nil {
+		findingsEntry.Status = "failed"
+		findingsEntry.Error = err.Error()
+	}
+	findingsEntry.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	findingsEntry.DurationSeconds = time.Since(findingsStarted).Round(time.Millisecond).Seconds()
 
-	return outputDir
+	indexed, err := withReportIndex(outputDir, append(entries, findingsEntry))
+	if err != nil {
+		return outputDir
+	}
+	return indexed
 }
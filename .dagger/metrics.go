@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// metricsPrefix namespaces the pipeline's Prometheus metrics
+const metricsPrefix = "search_api_pipeline_"
+
+// metricsWriter renders metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	sb strings.Builder
+}
+
+// metric writes a metric's HELP and TYPE lines followed by one sample per labels
+func (w *metricsWriter) metric(name, help string, samples ...metricSample) {
+	fmt.Fprintf(&w.sb, "# HELP %s%s %s\n# TYPE %s%s gauge\n", metricsPrefix, name, help, metricsPrefix, name)
+	for _, s := range samples {
+		fmt.Fprintf(&w.sb, "%s%s%s %g\n", metricsPrefix, name, s.labels, s.value)
+	}
+}
+
+// metricSample is one value of a metric with its rendered labels
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+// sample is a metric value labelled with name/value pairs
+func sample(value float64, labels ...string) metricSample {
+	if len(labels) == 0 {
+		return metricSample{value: value}
+	}
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		// Label values escape backslashes, quotes and newlines
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], escaped))
+	}
+	return metricSample{labels: "{" + strings.Join(pairs, ",") + "}", value: value}
+}
+
+// metrics renders the report as Prometheus metrics
+func (r *PipelineReport) metrics(findings []Finding) string {
+	w := &metricsWriter{}
+	passed := 0.0
+	if r.Status == "passed" {
+		passed = 1
+	}
+	w.metric("success", "Whether the last pipeline run passed (1) or was blocked or failed (0)", sample(passed))
+	w.metric("last_run_timestamp_seconds", "When the last pipeline run finished", sample(float64(time.Now().Unix())))
+	w.metric("duration_seconds", "Duration of the last pipeline run", sample(r.DurationSeconds))
+
+	var durations, statuses, stepFindings []metricSample
+	for _, s := range r.Steps {
+		durations = append(durations, sample(s.DurationSeconds, "step", s.Name))
+		statuses = append(statuses, sample(1, "step", s.Name, "status", s.Status))
+		stepFindings = append(stepFindings, sample(float64(s.Findings), "step", s.Name))
+	}
+	w.metric("step_duration_seconds", "Duration of each pipeline step", durations...)
+	w.metric("step_status", "Status of each pipeline step (passed, warning, blocked, failed, skipped or stopped)", statuses...)
+	w.metric("step_findings", "Deduplicated findings in each step's raw report", stepFindings...)
+
+	counts := severityCounts(findings)
+	var severities []metricSample
+	for _, severity := range dashboardSeverities {
+		severities = append(severities, sample(float64(counts[severity]), "severity", strings.ToLower(severity)))
+	}
+	w.metric("findings", "Deduplicated findings across the raw reports by severity", severities...)
+
+	if r.CoveragePercent > 0 {
+		w.metric("coverage_percent", "Total line coverage", sample(r.CoveragePercent))
+		w.metric("branch_coverage_percent", "Total branch coverage", sample(r.BranchCoveragePercent))
+		w.metric("method_coverage_percent", "Total method coverage", sample(r.MethodCoveragePercent))
+	}
+	if r.ImageSizeMb > 0 {
+		w.metric("image_size_bytes", "Compressed size of the image", sample(r.ImageSizeMb*1024*1024))
+		w.metric("image_layers", "Layers of the image", sample(float64(r.ImageLayers)))
+	}
+	return w.sb.String()
+}
+
+// PushMetrics publishes the pipeline's step durations and statuses, findings by
+// severity, coverage and image size to a Prometheus Pushgateway, for dashboards
+// tracking pipeline health over time
+// Each push replaces the job's previous metrics, so the gateway always holds the
+// latest run of every job
+func (r *PipelineReport) PushMetrics(
+	ctx context.Context,
+	// Pushgateway base URL (e.g., "http://pushgateway:9091")
+	pushgatewayUrl string,
+	// Job the metrics are grouped under (e.g., one per branch)
+	// +default="search-api-pipeline"
+	job string,
+	// Pushgateway basic auth as "user:password", when it requires it
+	// +optional
+	credentials *dagger.Secret,
+) (string, error) {
+	var findings []Finding
+	if r.Reports != nil {
+		var err error
+		if findings, err = collectFindings(ctx, r.Reports); err != nil {
+			return "", err
+		}
+	}
+	metrics := r.metrics(findings)
+
+	request := httpRequest{
+		method:  "PUT",
+		url:     strings.TrimSuffix(pushgatewayUrl, "/") + "/metrics/job/" + url.PathEscape(job),
+		headers: []string{"Content-Type: text/plain; version=0.0.4"},
+		body:    metrics,
+	}
+	if credentials != nil {
+		plaintext, err := credentials.Plaintext(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Pushgateway credentials: %w", err)
+		}
+		basic := base64.StdEncoding.EncodeToString([]byte(plaintext))
+		request.token, request.authPrefix = dag.SetSecret("pushgateway-basic-auth", basic), "Authorization: Basic"
+	}
+	if _, err := request.do(ctx); err != nil {
+		return "", fmt.Errorf("failed to push metrics to %s: %w", pushgatewayUrl, err)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// appUser is the non-root user the .NET 8 images ship ($APP_UID), so multi-arch
+// runtime images need no user setup that would have to run under emulation
+const appUser = "1654"
+
+// platformRuntime is the production image for one platform
+// The app is framework-dependent IL, so it is built and tested once on the host and
+// only the runtime base differs per platform; nothing executes on the target platform
+func platformRuntime(platform string, publishDir *dagger.Directory, build buildMetadata) *dagger.Container {
+	return build.stamp(dag.Container(dagger.ContainerOpts{Platform: dagger.Platform(platform)}).From(aspnetRuntime)).
+		WithWorkdir("/app").
+		WithDirectory("/app", publishDir, dagger.ContainerWithDirectoryOpts{Owner: appUser + ":" + appUser}).
+		WithUser(appUser).
+		WithEnvVariable("ASPNETCORE_URLS", aspnetURL).
+		WithEnvVariable("DOTNET_RUNNING_IN_CONTAINER", "true").
+		WithExposedPort(containerPort).
+		WithEntrypoint([]string{"dotnet", "SearchApi.dll"})
+}
+
+// multiArchVariants builds the production image for each platform
+func (m *SearchApi) multiArchVariants(source *dagger.Directory, platforms []string) ([]*dagger.Container, error) {
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("at least one platform is required")
+	}
+	seen := map[string]bool{}
+	for _, platform := range platforms {
+		if os, _, ok := strings.Cut(platform, "/"); !ok || os != "linux" {
+			return nil, fmt.Errorf("invalid platform %q: expected linux/<arch> (e.g., linux/arm64)", platform)
+		}
+		if seen[platform] {
+			return nil, fmt.Errorf("platform %s is listed twice", platform)
+		}
+		seen[platform] = true
+	}
+
+	build := buildMetadata{}
+	publishDir := m.publishApp(m.buildAndTest(source, dotnetSDK), build)
+	variants := make([]*dagger.Container, len(platforms))
+	for i, platform := range platforms {
+		variants[i] = platformRuntime(platform, publishDir, build)
+	}
+	return variants, nil
+}
+
+// BuildContainerMultiArch builds the production image for several platforms, e.g. to
+// run the Search API on ARM nodes
+func (m *SearchApi) BuildContainerMultiArch(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Platforms to build (os/arch)
+	// +default=["linux/amd64", "linux/arm64"]
+	platforms []string,
+) ([]*dagger.Container, error) {
+	return m.multiArchVariants(source, platforms)
+}
+
+// PublishMultiArch builds the production image for several platforms and pushes them
+// under one tag as a manifest list, so each node pulls the image for its architecture
+func (m *SearchApi) PublishMultiArch(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	registryUrl string,
+	username *dagger.Secret,
+	password *dagger.Secret,
+	// Image reference (e.g., "myproject/search-api" or "ghcr.io/myorg/search-api")
+	imageRef string,
+	// +default="latest"
+	tag string,
+	// Platforms to build (os/arch)
+	// +default=["linux/amd64", "linux/arm64"]
+	platforms []string,
+	// Attempts for pushes failing on network errors (exponential backoff)
+	// +default=3
+	retries int,
+) (*PushedImage, error) {
+	variants, err := m.multiArchVariants(source, platforms)
+	if err != nil {
+		return nil, err
+	}
+	usernameStr, err := username.Plaintext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read username: %w", err)
+	}
+
+	fullImageRef := fmt.Sprintf("%s:%s", imageRef, tag)
+	var address string
+	_, err = retryPolicy(retries).retry(ctx, "Registry push", func() (err error) {
+		address, err = dag.Container().
+			WithRegistryAuth(registryUrl, usernameStr, password).
+			Publish(ctx, fullImageRef, dagger.ContainerPublishOpts{PlatformVariants: variants})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push manifest list: %w", err)
+	}
+
+	repository, digest, err := splitImageAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &PushedImage{
+		Address:    address,
+		Repository: repository,
+		Tags:       []string{tag},
+		Digest:     digest,
+		Ref:        repository + "@" + digest,
+	}, nil
+}
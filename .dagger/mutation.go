@@ -0,0 +1,481 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// strykerRun prepares Stryker.NET for the main project and returns the container
+// (working directory set) and the command to run in it
+// The thresholds only color the HTML report; the minimum score is enforced on the
+// parsed JSON report, so Stryker never breaks the run itself
+func strykerRun(source *dagger.Directory, minimumScore int, since string, withBaseline bool, baselineVersion string) (*dagger.Container, []string, error) {
+	args := []string{
+		"dotnet", "stryker",
+		"--threshold-high", fmt.Sprint(minimumScore),
+		"--threshold-low", fmt.Sprint(max(minimumScore-10, 0)),
+		"--break-at", "0",
+		"--reporter", "html", "--reporter", "json", "--reporter", "progress",
+		"--output", "/stryker",
+	}
+
+	stryker := dag.Container().
+		From("mcr.microsoft.com/dotnet/sdk:8.0").
+		WithDirectory("/src", source).
+		WithWorkdir("/src").
+		WithExec([]string{"dotnet", "restore", "SearchApi.sln"}).
+		// Install Stryker.NET
+		WithExec([]string{"dotnet", "tool", "install", "-g", "dotnet-stryker"}).
+		WithEnvVariable("PATH", "/root/.dotnet/tools:$PATH", dagger.ContainerWithEnvVariableOpts{Expand: true})
+
+	switch {
+	case withBaseline:
+		if since == "" {
+			return nil, nil, fmt.Errorf("withBaseline needs the since ref whose baseline to compare against")
+		}
+		if baselineVersion == "" {
+			baselineVersion = "main"
+		}
+		// Baselines live in a cache volume so the next run can compare against this one
+		stryker = stryker.WithMountedCache("/src/SearchApi/StrykerOutput/baselines", dag.CacheVolume("search-api-stryker-baselines"))
+		args = append(args, "--with-baseline:"+since, "--version", baselineVersion)
+	case since != "":
+		args = append(args, "--since:"+since)
+	}
+	if since != "" {
+		// The checkout is owned by another user inside the container
+		stryker = stryker.WithExec([]string{"git", "config", "--global", "--add", "safe.directory", "*"})
+	}
+
+	return stryker.WithWorkdir("/src/SearchApi"), args, nil
+}
+
+// strykerReports runs Stryker and returns its HTML and JSON reports along with the
+// JSON report's content
+func strykerReports(ctx context.Context, stryker *dagger.Container, args []string) (*dagger.Directory, string, error) {
+	reports := stryker.
+		WithExec(args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		Directory("/stryker/reports")
+	content, err := reports.File("mutation-report.json").Contents(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("Stryker produced no JSON report: %w", err)
+	}
+	return reports, content, nil
+}
+
+// strykerMutant is one mutant in the mutation-testing-elements JSON report
+type strykerMutant struct {
+	MutatorName string
+	Replacement string
+	Status      string
+	Location    struct {
+		Start strykerPosition
+		End   strykerPosition
+	}
+}
+
+// strykerPosition is a 1-based line and column in a mutated file
+type strykerPosition struct {
+	Line   int
+	Column int
+}
+
+// strykerReport is the subset of the mutation-testing-elements JSON report used for scoring
+type strykerReport struct {
+	ProjectRoot string
+	Files       map[string]struct {
+		Source  string
+		Mutants []strykerMutant
+	}
+}
+
+func parseStrykerReport(content string) (*strykerReport, error) {
+	var report strykerReport
+	if err := json.Unmarshal([]byte(content), &report); err != nil {
+		return nil, fmt.Errorf("invalid Stryker report: %w", err)
+	}
+	return &report, nil
+}
+
+// mutationScore is the mutation score of one project, or of all of them ("total")
+type mutationScore struct {
+	Project    string  `json:"project"`
+	Killed     int     `json:"killed"`
+	Survived   int     `json:"survived"`
+	NoCoverage int     `json:"noCoverage"`
+	Timeout    int     `json:"timeout"`
+	Score      float64 `json:"score"`
+}
+
+func (s *mutationScore) add(status string) {
+	switch status {
+	case "Killed":
+		s.Killed++
+	case "Survived":
+		s.Survived++
+	case "NoCoverage":
+		s.NoCoverage++
+	case "Timeout":
+		s.Timeout++
+	}
+}
+
+func (s *mutationScore) score() {
+	s.Score = mutationScorePercent(s.Killed, s.Survived, s.NoCoverage, s.Timeout)
+}
+
+// mutationScorePercent follows Stryker's definition: detected / (detected + undetected),
+// where timeouts count as detected and compile errors or ignored mutants are left out.
+// With no valid mutants nothing went undetected, so like percent() it's 100
+func mutationScorePercent(killed, survived, noCoverage, timeout int) float64 {
+	detected := killed + timeout
+	if valid := detected + survived + noCoverage; valid > 0 {
+		return float64(detected) * 100 / float64(valid)
+	}
+	return 100
+}
+
+// file renders a file's tally as the MutationFile API type
+func (s *mutationScore) file() *MutationFile {
+	return &MutationFile{
+		File:       s.Project,
+		Killed:     s.Killed,
+		Survived:   s.Survived,
+		Timeout:    s.Timeout,
+		NoCoverage: s.NoCoverage,
+		Score:      s.Score,
+	}
+}
+
+// mutationProject is the project a mutated file belongs to: the top-level directory
+// of the source tree, which is mounted at /src
+func mutationProject(projectRoot string, file string) string {
+	if !path.IsAbs(file) {
+		file = path.Join(projectRoot, file)
+	}
+	rel, ok := strings.CutPrefix(file, "/src/")
+	if !ok {
+		return path.Base(projectRoot)
+	}
+	project, _, _ := strings.Cut(rel, "/")
+	return project
+}
+
+// mutationScores returns a score per project, sorted by name, followed by the total
+func mutationScores(report *strykerReport) []mutationScore {
+	byProject := map[string]*mutationScore{}
+	total := mutationScore{Project: "total"}
+	for file, result := range report.Files {
+		project := mutationProject(report.ProjectRoot, file)
+		if byProject[project] == nil {
+			byProject[project] = &mutationScore{Project: project}
+		}
+		for _, mutant := range result.Mutants {
+			byProject[project].add(mutant.Status)
+			total.add(mutant.Status)
+		}
+	}
+
+	var scores []mutationScore
+	for _, s := range byProject {
+		s.score()
+		scores = append(scores, *s)
+	}
+	slices.SortFunc(scores, func(a, b mutationScore) int { return strings.Compare(a.Project, b.Project) })
+	total.score()
+	return append(scores, total)
+}
+
+// mutationFilePath is a mutated file's path relative to the source tree
+func mutationFilePath(projectRoot string, file string) string {
+	if !path.IsAbs(file) {
+		file = path.Join(projectRoot, file)
+	}
+	return strings.TrimPrefix(file, "/src/")
+}
+
+// mutantDiff returns the mutated lines of a file before and after the mutation
+func mutantDiff(source string, mutant strykerMutant) (string, string) {
+	lines := strings.Split(source, "\n")
+	start, end := mutant.Location.Start, mutant.Location.End
+	if start.Line < 1 || end.Line < start.Line || end.Line > len(lines) {
+		return "", mutant.Replacement
+	}
+	first, last := lines[start.Line-1], lines[end.Line-1]
+	prefix := first[:min(max(start.Column-1, 0), len(first))]
+	suffix := last[min(max(end.Column-1, 0), len(last)):]
+	original := strings.Join(lines[start.Line-1:end.Line], "\n")
+	return original, prefix + mutant.Replacement + suffix
+}
+
+// MutationFile is the mutation result of one source file
+type MutationFile struct {
+	File       string
+	Killed     int
+	Survived   int
+	Timeout    int
+	NoCoverage int
+	Score      float64
+}
+
+// SurvivingMutant is a mutation no test caught
+type SurvivingMutant struct {
+	File    string
+	Line    int
+	Mutator string
+	// The mutated lines before and after the mutation
+	Original string
+	Mutated  string
+}
+
+// MutationResult is a Stryker.NET run
+type MutationResult struct {
+	// Mutation score (0-100) over all files
+	Score        float64
+	MinimumScore int
+	Killed       int
+	Survived     int
+	Timeout      int
+	NoCoverage   int
+	// Per file, sorted by path
+	Files     []*MutationFile
+	Survivors []*SurvivingMutant
+	// Stryker's HTML and JSON reports
+	Reports *dagger.Directory
+}
+
+// mutationResult tallies a Stryker report per file and collects the surviving mutants
+func mutationResult(report *strykerReport, minimumScore int) *MutationResult {
+	result := &MutationResult{MinimumScore: minimumScore}
+	total := mutationScore{Project: "total"}
+	for name, file := range report.Files {
+		tally := mutationScore{Project: mutationFilePath(report.ProjectRoot, name)}
+		for _, mutant := range file.Mutants {
+			tally.add(mutant.Status)
+			total.add(mutant.Status)
+			if mutant.Status == "Survived" {
+				original, mutated := mutantDiff(file.Source, mutant)
+				result.Survivors = append(result.Survivors, &SurvivingMutant{
+					File:     tally.Project,
+					Line:     mutant.Location.Start.Line,
+					Mutator:  mutant.MutatorName,
+					Original: original,
+					Mutated:  mutated,
+				})
+			}
+		}
+		tally.score()
+		result.Files = append(result.Files, tally.file())
+	}
+	total.score()
+	result.Score = total.Score
+	result.Killed, result.Survived, result.Timeout, result.NoCoverage = total.Killed, total.Survived, total.Timeout, total.NoCoverage
+	slices.SortFunc(result.Files, func(a, b *MutationFile) int { return strings.Compare(a.File, b.File) })
+	slices.SortFunc(result.Survivors, func(a, b *SurvivingMutant) int {
+		return cmp.Or(strings.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+	return result
+}
+
+// Summary renders the score, the files with surviving mutants and a diff of every
+// surviving mutant, the tests to write next
+func (r *MutationResult) Summary() string {
+	var sb strings.Builder
+	if r.Killed+r.Survived+r.Timeout+r.NoCoverage == 0 {
+		fmt.Fprintf(&sb, "🧬 No mutants to test: the score counts as 100%% and the minimum (%d%%) isn't enforced\n", r.MinimumScore)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "🧬 Mutation score %.1f%% (minimum %d%%): %d killed, %d survived, %d timeout, %d no coverage\n",
+		r.Score, r.MinimumScore, r.Killed, r.Survived, r.Timeout, r.NoCoverage)
+
+	var weak []*MutationFile
+	for _, f := range r.Files {
+		if f.Survived+f.NoCoverage > 0 {
+			weak = append(weak, f)
+		}
+	}
+	if len(weak) > 0 {
+		sb.WriteString("\n| File | Killed | Survived | Timeout | No coverage | Score |\n|---|---|---|---|---|---|\n")
+		for _, f := range weak {
+			fmt.Fprintf(&sb, "| %s | %d | %d | %d | %d | %.1f%% |\n", f.File, f.Killed, f.Survived, f.Timeout, f.NoCoverage, f.Score)
+		}
+	}
+
+	if len(r.Survivors) > 0 {
+		sb.WriteString("\nSurviving mutants:\n")
+		for _, s := range r.Survivors {
+			fmt.Fprintf(&sb, "\n%s:%d (%s)\n", s.File, s.Line, s.Mutator)
+			for _, line := range strings.Split(s.Original, "\n") {
+				fmt.Fprintf(&sb, "- %s\n", strings.TrimSpace(line))
+			}
+			for _, line := range strings.Split(s.Mutated, "\n") {
+				fmt.Fprintf(&sb, "+ %s\n", strings.TrimSpace(line))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Trend store: one JSON line per run, kept in a cache volume shared by all pipelines
+// on the engine
+const (
+	trendVolume        = "search-api-trends"
+	mutationTrendsFile = "mutation.jsonl"
+)
+
+// mutationTrendEntry is one run in the mutation trend store
+type mutationTrendEntry struct {
+	Time   time.Time       `json:"time"`
+	Scores []mutationScore `json:"scores"`
+}
+
+// trendStore returns a container with the trend store mounted at /trends
+// Its contents change between runs, so execs on it are never cached
+func trendStore() *dagger.Container {
+	return dag.Container().
+		From("alpine:latest").
+		WithMountedCache("/trends", dag.CacheVolume(trendVolume)).
+		WithEnvVariable("CACHEBUSTER", time.Now().String())
+}
+
+// recordMutationTrend appends a run's scores to the trend store
+func recordMutationTrend(ctx context.Context, entry mutationTrendEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = trendStore().
+		WithEnvVariable("ENTRY", string(line)).
+		WithExec([]string{"sh", "-c", `echo "$ENTRY" >> /trends/` + mutationTrendsFile}).
+		Sync(ctx)
+	return err
+}
+
+// loadMutationTrend reads every run recorded in the trend store, oldest first
+func loadMutationTrend(ctx context.Context) ([]mutationTrendEntry, error) {
+	content, err := trendStore().
+		WithExec([]string{"sh", "-c", "cat /trends/" + mutationTrendsFile + " 2>/dev/null || true"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mutation trend: %w", err)
+	}
+
+	var entries []mutationTrendEntry
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry mutationTrendEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("invalid mutation trend entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// mutationTrendReport renders a score table with one column per run (latest last)
+// and the change of each project's score over the shown runs
+func mutationTrendReport(entries []mutationTrendEntry) string {
+	if len(entries) == 0 {
+		return "No mutation runs recorded yet\n"
+	}
+
+	var projects []string
+	for _, entry := range entries {
+		for _, s := range entry.Scores {
+			if !slices.Contains(projects, s.Project) {
+				projects = append(projects, s.Project)
+			}
+		}
+	}
+
+	report := "🧬 Mutation Score Trend\n\n| Project |"
+	separator := "|---|"
+	for _, entry := range entries {
+		report += " " + entry.Time.Format("2006-01-02 15:04") + " |"
+		separator += "---|"
+	}
+	report += " Change |\n" + separator + "---|\n"
+
+	for _, project := range projects {
+		report += "| " + project + " |"
+		first, last := -1.0, -1.0
+		for _, entry := range entries {
+			i := slices.IndexFunc(entry.Scores, func(s mutationScore) bool { return s.Project == project })
+			if i < 0 {
+				report += " - |"
+				continue
+			}
+			score := entry.Scores[i].Score
+			report += fmt.Sprintf(" %.1f |", score)
+			if first < 0 {
+				first = score
+			}
+			last = score
+		}
+		change := last - first
+		marker := ""
+		if change < 0 {
+			marker = " 📉"
+		}
+		report += fmt.Sprintf(" %+.1f%s |\n", change, marker)
+	}
+	return report
+}
+
+// mutationReports runs Stryker with the HTML and JSON reporters, regardless of the
+// score threshold, records the per-project scores in the trend store and returns
+// the reports with a summary and the trend so far
+func mutationReports(ctx context.Context, source *dagger.Directory) (*dagger.Directory, error) {
+	stryker, args, err := strykerRun(source, 80, "", false, "")
+	if err != nil {
+		return nil, err
+	}
+	reports, content, err := strykerReports(ctx, stryker, args)
+	if err != nil {
+		return nil, err
+	}
+	report, err := parseStrykerReport(content)
+	if err != nil {
+		return nil, err
+	}
+	scores := mutationScores(report)
+	if err := recordMutationTrend(ctx, mutationTrendEntry{Time: time.Now().UTC(), Scores: scores}); err != nil {
+		return nil, fmt.Errorf("failed to record mutation trend: %w", err)
+	}
+	entries, err := loadMutationTrend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := json.MarshalIndent(scores, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return reports.
+		WithNewFile("mutation-summary.json", string(summary)).
+		WithNewFile("mutation-trend.md", mutationTrendReport(entries[max(len(entries)-10, 0):])), nil
+}
+
+// MutationTrend shows per-project mutation scores of the most recent runs recorded by
+// ExportPipelineReports, flagging projects whose test quality is declining
+func (m *SearchApi) MutationTrend(
+	ctx context.Context,
+	// Number of most recent runs to show
+	// +default=10
+	runs int,
+) (string, error) {
+	entries, err := loadMutationTrend(ctx)
+	if err != nil {
+		return "", err
+	}
+	return mutationTrendReport(entries[max(len(entries)-runs, 0):]), nil
+}
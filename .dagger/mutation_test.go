@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestMutationScorePercent(t *testing.T) {
+	tests := []struct {
+		killed, survived, noCoverage, timeout int
+		want                                  float64
+	}{
+		{0, 0, 0, 0, 100},
+		{10, 0, 0, 0, 100},
+		{0, 5, 5, 0, 0},
+		{6, 2, 0, 2, 80},
+		{3, 1, 0, 0, 75},
+		{1, 1, 2, 0, 25},
+	}
+	for _, tt := range tests {
+		if got := mutationScorePercent(tt.killed, tt.survived, tt.noCoverage, tt.timeout); got != tt.want {
+			t.Errorf("mutationScorePercent(%d, %d, %d, %d) = %v, want %v",
+				tt.killed, tt.survived, tt.noCoverage, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestMutationResult(t *testing.T) {
+	report, err := parseStrykerReport(`{
+		"projectRoot": "/src/SearchApi",
+		"files": {
+			"Services/Query.cs": {
+				"source": "if (a > b)\n  return a;",
+				"mutants": [
+					{"mutatorName": "Equality", "replacement": "a >= b", "status": "Survived",
+					 "location": {"start": {"line": 1, "column": 5}, "end": {"line": 1, "column": 10}}},
+					{"mutatorName": "Block", "replacement": "{}", "status": "Killed"},
+					{"mutatorName": "String", "replacement": "\"\"", "status": "CompileError"}
+				]
+			},
+			"/src/SearchApi/Models/Hit.cs": {
+				"mutants": [
+					{"mutatorName": "Boolean", "replacement": "false", "status": "Timeout"},
+					{"mutatorName": "Linq", "replacement": "First()", "status": "NoCoverage"}
+				]
+			},
+			"Empty.cs": {}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := mutationResult(report, 60)
+
+	if result.Killed != 1 || result.Survived != 1 || result.Timeout != 1 || result.NoCoverage != 1 || result.Score != 50 {
+		t.Errorf("totals = %d killed, %d survived, %d timeout, %d no coverage, score %v; want 1, 1, 1, 1, 50",
+			result.Killed, result.Survived, result.Timeout, result.NoCoverage, result.Score)
+	}
+	want := []MutationFile{
+		{File: "SearchApi/Empty.cs", Score: 100},
+		{File: "SearchApi/Models/Hit.cs", Timeout: 1, NoCoverage: 1, Score: 50},
+		{File: "SearchApi/Services/Query.cs", Killed: 1, Survived: 1, Score: 50},
+	}
+	if len(result.Files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(result.Files), len(want))
+	}
+	for i, f := range result.Files {
+		if *f != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, *f, want[i])
+		}
+	}
+	if len(result.Survivors) != 1 {
+		t.Fatalf("got %d survivors, want 1", len(result.Survivors))
+	}
+	if s := result.Survivors[0]; s.File != "SearchApi/Services/Query.cs" || s.Line != 1 || s.Original != "if (a > b)" || s.Mutated != "if (a >= b)" {
+		t.Errorf("survivor = %+v", *s)
+	}
+}
+
+func TestMutationResultWithoutMutants(t *testing.T) {
+	result := mutationResult(&strykerReport{ProjectRoot: "/src/SearchApi"}, 60)
+	if result.Score != 100 {
+		t.Errorf("score without mutants = %v, want 100", result.Score)
+	}
+	if got, want := result.Summary(), "🧬 No mutants to test: the score counts as 100% and the minimum (60%) isn't enforced\n"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Where the notice file is placed in the application image
+const noticePath = "/app/THIRD-PARTY-NOTICES.txt"
+
+// noticeEntry is the attribution for one third-party component
+type noticeEntry struct {
+	name      string
+	version   string
+	license   string
+	copyright string
+}
+
+// spdxValue drops SPDX placeholders that carry no information
+func spdxValue(value string) string {
+	if value == "NOASSERTION" || value == "NONE" {
+		return ""
+	}
+	return value
+}
+
+// parseNoticeEntries reads component attributions from an SPDX JSON or CycloneDX JSON SBOM
+func parseNoticeEntries(content string) ([]noticeEntry, error) {
+	var sbom struct {
+		Packages []struct {
+			Name             string `json:"name"`
+			VersionInfo      string `json:"versionInfo"`
+			LicenseConcluded string `json:"licenseConcluded"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+			CopyrightText    string `json:"copyrightText"`
+		} `json:"packages"`
+		Components []struct {
+			Name     string `json:"name"`
+			Version  string `json:"version"`
+			Licenses []struct {
+				License struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"license"`
+				Expression string `json:"expression"`
+			} `json:"licenses"`
+			Copyright string `json:"copyright"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(content), &sbom); err != nil {
+		return nil, fmt.Errorf("invalid SBOM: %w", err)
+	}
+
+	var entries []noticeEntry
+	for _, p := range sbom.Packages {
+		license := spdxValue(p.LicenseConcluded)
+		if license == "" {
+			license = spdxValue(p.LicenseDeclared)
+		}
+		entries = append(entries, noticeEntry{
+			name:      p.Name,
+			version:   p.VersionInfo,
+			license:   license,
+			copyright: spdxValue(p.CopyrightText),
+		})
+	}
+	for _, c := range sbom.Components {
+		var licenses []string
+		for _, l := range c.Licenses {
+			switch {
+			case l.Expression != "":
+				licenses = append(licenses, l.Expression)
+			case l.License.ID != "":
+				licenses = append(licenses, l.License.ID)
+			case l.License.Name != "":
+				licenses = append(licenses, l.License.Name)
+			}
+		}
+		entries = append(entries, noticeEntry{
+			name:      c.Name,
+			version:   c.Version,
+			license:   strings.Join(licenses, " OR "),
+			copyright: c.Copyright,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !strings.EqualFold(entries[i].name, entries[j].name) {
+			return strings.ToLower(entries[i].name) < strings.ToLower(entries[j].name)
+		}
+		return entries[i].version < entries[j].version
+	})
+	return entries, nil
+}
+
+// renderNotice formats the attributions as a plain-text notice file
+func renderNotice(entries []noticeEntry) string {
+	byLicense := map[string]int{}
+	for _, e := range entries {
+		license := e.license
+		if license == "" {
+			license = "Unknown"
+		}
+		byLicense[license]++
+	}
+	licenses := make([]string, 0, len(byLicense))
+	for license := range byLicense {
+		licenses = append(licenses, license)
+	}
+	sort.Strings(licenses)
+
+	var sb strings.Builder
+	sb.WriteString("THIRD-PARTY SOFTWARE NOTICES AND INFORMATION\n\n")
+	fmt.Fprintf(&sb, "Search API includes the following %d third-party components.\n\n", len(entries))
+	sb.WriteString("License summary:\n")
+	for _, license := range licenses {
+		fmt.Fprintf(&sb, "  %-40s %d\n", license, byLicense[license])
+	}
+
+	separator := strings.Repeat("-", 80)
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "\n%s\n%s %s\n", separator, e.name, e.version)
+		license := e.license
+		if license == "" {
+			license = "Unknown (review required)"
+		}
+		fmt.Fprintf(&sb, "License: %s\n", license)
+		if e.copyright != "" {
+			fmt.Fprintf(&sb, "Copyright: %s\n", e.copyright)
+		}
+	}
+	return sb.String()
+}
+
+// noticeFromSbom turns SBOM contents into a notice file
+func noticeFromSbom(sbom string) (*dagger.File, error) {
+	entries, err := parseNoticeEntries(sbom)
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().
+		WithNewFile("THIRD-PARTY-NOTICES.txt", renderNotice(entries)).
+		File("THIRD-PARTY-NOTICES.txt"), nil
+}
+
+// GenerateNotice produces a third-party notices file (package, version, license,
+// copyright) from an SBOM, generating an SPDX SBOM of the source when none is given
+func (m *SearchApi) GenerateNotice(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Existing SBOM (SPDX or CycloneDX JSON)
+	// +optional
+	sbom *dagger.File,
+) (*dagger.File, error) {
+	var content string
+	var err error
+	if sbom != nil {
+		content, err = sbom.Contents(ctx)
+	} else {
+		content, err = dag.Syft().Scan(ctx, dagger.SyftScanOpts{
+			Source: source,
+			Format: "spdx-json",
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SBOM: %w", err)
+	}
+
+	return noticeFromSbom(content)
+}
+
+// EmbedNotice adds a third-party notices file to the application image at /app/THIRD-PARTY-NOTICES.txt
+func (m *SearchApi) EmbedNotice(
+	container *dagger.Container,
+	// Notice file from GenerateNotice
+	notice *dagger.File,
+) *dagger.Container {
+	return container.WithFile(noticePath, notice, dagger.ContainerWithFileOpts{
+		Permissions: 0o444,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// statusIcons marks step and pipeline statuses in notifications
+var statusIcons = map[string]string{
+	"passed":  "✅",
+	"warning": "⚠️",
+	"blocked": "❌",
+	"failed":  "💥",
+	"skipped": "⏭️",
+	"stopped": "⏹️",
+}
+
+// notification is what a pipeline result message says, independent of the platform
+type notification struct {
+	title   string
+	steps   []string
+	details []string
+	link    string
+}
+
+// newNotification summarizes a report: pass/fail per gate, the pushed image and a
+// link to the reports
+func newNotification(report reportView, reportsUrl string) notification {
+	n := notification{
+		title: fmt.Sprintf("%s Search API pipeline %s", statusIcons[report.Status], report.Status),
+		link:  reportsUrl,
+	}
+	for _, s := range report.Steps {
+		line := fmt.Sprintf("%s %s", statusIcons[s.Status], s.Name)
+		if s.Findings > 0 {
+			line += fmt.Sprintf(" (%d findings)", s.Findings)
+		}
+		n.steps = append(n.steps, line)
+	}
+	n.details = append(n.details, fmt.Sprintf("Duration: %.0fs", report.DurationSeconds))
+	if report.Image != "" {
+		n.details = append(n.details, "Image: "+report.Image)
+	}
+	if report.Error != "" {
+		// The error can carry a whole tool report; the first line says what stopped the run
+		firstLine, _, _ := strings.Cut(report.Error, "\n")
+		n.details = append(n.details, "Error: "+firstLine)
+	}
+	return n
+}
+
+// slack renders the notification as a Slack Block Kit message
+func (n notification) slack(channel string) map[string]any {
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": n.title}},
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": strings.Join(n.steps, "\n")}},
+	}
+	var details []map[string]any
+	for _, d := range n.details {
+		details = append(details, map[string]any{"type": "mrkdwn", "text": d})
+	}
+	blocks = append(blocks, map[string]any{"type": "context", "elements": details})
+	if n.link != "" {
+		blocks = append(blocks, map[string]any{"type": "actions", "elements": []map[string]any{{
+			"type": "button",
+			"text": map[string]any{"type": "plain_text", "text": "View reports"},
+			"url":  n.link,
+		}}})
+	}
+
+	message := map[string]any{"text": n.title, "blocks": blocks}
+	if channel != "" {
+		message["channel"] = channel
+	}
+	return message
+}
+
+// teams renders the notification as a Teams Adaptive Card message
+func (n notification) teams() map[string]any {
+	body := []map[string]any{
+		{"type": "TextBlock", "text": n.title, "weight": "Bolder", "size": "Medium", "wrap": true},
+	}
+	for _, line := range n.steps {
+		body = append(body, map[string]any{"type": "TextBlock", "text": line, "spacing": "None", "wrap": true})
+	}
+	for _, d := range n.details {
+		body = append(body, map[string]any{"type": "TextBlock", "text": d, "isSubtle": true, "wrap": true})
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if n.link != "" {
+		card["actions"] = []map[string]any{{"type": "Action.OpenUrl", "title": "View reports", "url": n.link}}
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
+
+// notify posts a pipeline result to a Slack or Teams incoming webhook
+func notify(ctx context.Context, report reportView, webhookUrl *dagger.Secret, platform, channel, reportsUrl string) error {
+	n := newNotification(report, reportsUrl)
+	var message map[string]any
+	switch platform {
+	case "slack":
+		message = n.slack(channel)
+	case "teams":
+		message = n.teams()
+	default:
+		return fmt.Errorf("unknown platform %q: expected slack or teams", platform)
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	_, err = httpRequest{
+		method:    "POST",
+		secretUrl: webhookUrl,
+		headers:   []string{"Content-Type: application/json"},
+		body:      string(payload),
+	}.do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	return nil
+}
+
+// Notify posts a pipeline result to Slack (Block Kit) or Microsoft Teams (Adaptive
+// Card): pass/fail per gate, the pushed image digest and a link to the reports
+// FullPipeline sends it itself when given a webhook
+func (m *SearchApi) Notify(
+	ctx context.Context,
+	// Pipeline report JSON (output of FullPipeline's json)
+	report string,
+	// Incoming webhook URL, kept secret since it authorizes posting
+	webhookUrl *dagger.Secret,
+	// Channel to post to (Slack webhooks that allow overriding it); Teams posts to
+	// the webhook's channel
+	// +optional
+	channel string,
+	// slack or teams
+	// +default="slack"
+	platform string,
+	// Link to the pipeline's reports (e.g., the CI run's artifacts)
+	// +optional
+	reportsUrl string,
+) (string, error) {
+	var view reportView
+	if err := json.Unmarshal([]byte(report), &view); err != nil {
+		return "", fmt.Errorf("invalid pipeline report: %w", err)
+	}
+	if err := notify(ctx, view, webhookUrl, platform, channel, reportsUrl); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Posted pipeline %s to %s\n", view.Status, platform), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Images that download the scanners' databases, rules and templates
+const (
+	trivyImage  = "aquasec/trivy:latest"
+	nucleiImage = "projectdiscovery/nuclei:latest"
+	zapImage    = "ghcr.io/zaproxy/zaproxy:stable"
+)
+
+// sastRulesets are the Semgrep registry rulesets the SAST step scans with
+var sastRulesets = []string{"p/csharp", "p/security-audit", "p/owasp-top-ten", "p/sql-injection", "p/xss"}
+
+// offlineAssets are pre-seeded scanner databases, rules and templates, so the
+// scanners don't download anything on runners without internet access:
+//
+//	trivy/    Trivy cache with the vulnerability DB (db/trivy.db, db/metadata.json)
+//	semgrep/  Semgrep rule files (the SAST rulesets, exported from the registry)
+//	nuclei/   nuclei-templates
+//	zap/      ZAP add-on (.zap) files; optional, the image bundles its add-ons
+//	threat-intel/  EPSS scores and CISA KEV catalog for SecurityGate; optional
+type offlineAssets struct {
+	dir *dagger.Directory
+	zap bool
+}
+
+// loadOfflineAssets checks an offline assets directory has what every scanner
+// needs, so a missing database fails the run up front instead of a scan trying to
+// download it
+func loadOfflineAssets(ctx context.Context, dir *dagger.Directory) (*offlineAssets, error) {
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline assets: %w", err)
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		present[strings.TrimSuffix(entry, "/")] = true
+	}
+
+	var missing []string
+	if !present["trivy"] || !hasEntries(ctx, dir.Directory("trivy/db"), "trivy.db", "metadata.json") {
+		missing = append(missing, "trivy/db/trivy.db and metadata.json")
+	}
+	for _, tool := range []string{"semgrep", "nuclei"} {
+		if !present[tool] || !hasEntries(ctx, dir.Directory(tool)) {
+			missing = append(missing, tool+"/")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("offline assets are missing %s (see download-offline-assets)", strings.Join(missing, ", "))
+	}
+	return &offlineAssets{dir: dir, zap: present["zap"]}, nil
+}
+
+// hasEntries reports whether a directory exists and has the given entries, or any
+// entry when none are given
+func hasEntries(ctx context.Context, dir *dagger.Directory, names ...string) bool {
+	entries, err := dir.Entries(ctx)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	for _, name := range names {
+		found := false
+		for _, entry := range entries {
+			found = found || strings.TrimSuffix(entry, "/") == name
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// trivyDb returns the Trivy cache, or nil to download the database
+func (a *offlineAssets) trivyDb() *dagger.Directory {
+	if a == nil {
+		return nil
+	}
+	return a.dir.Directory("trivy")
+}
+
+// semgrepRules returns the Semgrep rules, or nil to use the registry rulesets
+func (a *offlineAssets) semgrepRules() *dagger.Directory {
+	if a == nil {
+		return nil
+	}
+	return a.dir.Directory("semgrep")
+}
+
+// nucleiTemplates returns the nuclei templates, or nil to download them
+func (a *offlineAssets) nucleiTemplates() *dagger.Directory {
+	if a == nil {
+		return nil
+	}
+	return a.dir.Directory("nuclei")
+}
+
+// zapAddons returns the ZAP add-ons, or nil to use the image's own
+func (a *offlineAssets) zapAddons() *dagger.Directory {
+	if a == nil || !a.zap {
+		return nil
+	}
+	return a.dir.Directory("zap")
+}
+
+// DownloadOfflineAssets downloads the Trivy vulnerability DB, the Semgrep SAST
+// rulesets, the nuclei templates, the latest ZAP add-ons and the EPSS/KEV threat
+// intel into one directory
+// Run it where there is internet access and pass the exported directory as
+// offlineAssets to pipelines on runners that have none; refresh it regularly, as
+// the scanners only know about vulnerabilities published before the download
+func (m *SearchApi) DownloadOfflineAssets() *dagger.Directory {
+	// Databases change daily, so the downloads are never served from cache
+	now := time.Now().String()
+
+	trivy := dag.Container().
+		From(trivyImage).
+		WithEnvVariable("CACHEBUSTER", now).
+		WithExec([]string{"trivy", "image", "--download-db-only", "--cache-dir", "/out"}).
+		Directory("/out")
+
+	// The curl image runs as an unprivileged user, so the rules go to /tmp
+	script := "set -e\nmkdir -p /tmp/rules\n"
+	for _, ruleset := range sastRulesets {
+		script += fmt.Sprintf("curl -sSfL https://semgrep.dev/c/%s -o /tmp/rules/%s.yaml\n", ruleset, strings.ReplaceAll(ruleset, "/", "-"))
+	}
+	semgrep := dag.Container().
+		From(curlImage).
+		WithEnvVariable("CACHEBUSTER", now).
+		WithExec([]string{"sh", "-c", script}).
+		Directory("/tmp/rules")
+
+	nuclei := dag.Container().
+		From(nucleiImage).
+		WithEnvVariable("CACHEBUSTER", now).
+		WithExec([]string{"nuclei", "-update-templates", "-update-template-dir", "/out"}).
+		Directory("/out")
+
+	zap := dag.Container().
+		From(zapImage).
+		WithEnvVariable("CACHEBUSTER", now).
+		WithExec([]string{"zap.sh", "-cmd", "-dir", "/tmp/zap", "-addonupdate"}).
+		Directory("/tmp/zap/plugin")
+
+	return dag.Directory().
+		WithDirectory("trivy", trivy, dagger.DirectoryWithDirectoryOpts{Include: []string{"db/**"}}).
+		WithDirectory("semgrep", semgrep).
+		WithDirectory("nuclei", nuclei).
+		WithDirectory("zap", zap).
+		WithDirectory("threat-intel", downloadThreatIntel())
+}
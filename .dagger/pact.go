@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"time"
+)
+
+// pactImage bundles the Pact provider verifier and broker client
+const pactImage = "pactfoundation/pact-cli:latest"
+
+// pactVerifyScript verifies the contracts of the consumers' main branches and of their
+// deployed or released versions; pending contracts (not yet verified by this
+// provider) are reported but don't fail the verification
+const pactVerifyScript = `set -e
+set -- --provider-base-url=http://api:8080 \
+  --pact-broker-base-url="$PACT_BROKER_BASE_URL" \
+  --provider="$PACT_PROVIDER" \
+  --consumer-version-selector='{"mainBranch":true}' \
+  --consumer-version-selector='{"deployedOrReleased":true}' \
+  --enable-pending
+if [ -n "$PACT_PROVIDER_VERSION" ]; then
+  set -- "$@" --publish-verification-results --provider-app-version="$PACT_PROVIDER_VERSION"
+fi
+pact-provider-verifier "$@"
+`
+
+// PactVerification is the outcome of VerifyPacts
+type PactVerification struct {
+	Provider string
+	// Provider version the results were published for ("" when not published)
+	ProviderVersion string
+	Passed          bool
+	// Verifier output, with the interactions of every contract
+	Output string
+}
+
+// VerifyPacts verifies the consumer contracts in a Pact broker against the running
+// API and, given the provider version, publishes the results to the broker so
+// consumers can check can-i-deploy. Fails when a contract is broken
+func (m *SearchApi) VerifyPacts(
+	ctx context.Context,
+	// Running API, listening on port 8080 (e.g., from RunApiWithServices)
+	apiService *dagger.Service,
+	// Pact broker URL (e.g., "https://myorg.pactflow.io")
+	brokerUrl string,
+	// Pact broker API token
+	brokerToken *dagger.Secret,
+	// Provider name the consumers' contracts refer to
+	// +default="search-api"
+	provider string,
+	// Provider version to publish the results for (e.g., from ComputeVersion or the git
+	// SHA); results are not published when omitted
+	// +optional
+	providerVersion string,
+) (*PactVerification, error) {
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return nil, err
+	}
+	verifier := dag.Container().
+		From(pactImage).
+		WithServiceBinding("api", apiService).
+		WithEnvVariable("PACT_BROKER_BASE_URL", brokerUrl).
+		WithSecretVariable("PACT_BROKER_TOKEN", brokerToken).
+		WithEnvVariable("PACT_PROVIDER", provider).
+		WithEnvVariable("PACT_PROVIDER_VERSION", providerVersion).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", pactVerifyScript}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+
+	exitCode, err := verifier.ExitCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pact verifier failed to run: %w", err)
+	}
+	stdout, err := verifier.Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := verifier.Stderr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PactVerification{
+		Provider:        provider,
+		ProviderVersion: providerVersion,
+		Passed:          exitCode == 0,
+		Output:          stdout + stderr,
+	}
+	if !result.Passed {
+		return result, fmt.Errorf("❌ BLOCKED - %s breaks consumer contracts:\n%s", provider, result.Output)
+	}
+	return result, nil
+}
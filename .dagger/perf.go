@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// workloadRequest is a request in the k6 data-driven workload; requests with the
+// same name are reported together
+type workloadRequest struct {
+	Name   string          `json:"name"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+var staticSegment = regexp.MustCompile(`^[a-z]+$`)
+
+// endpointName groups a request by route, collapsing IDs and other dynamic segments
+// (GET /api/search/doc-42 → GET_api_search_id)
+func endpointName(method string, path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := []string{strings.ToUpper(method)}
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if !staticSegment.MatchString(segment) {
+			segment = "id"
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "_")
+}
+
+// syntheticTerms is the vocabulary synthetic queries draw from
+var syntheticTerms = []string{"report", "policy", "dataset", "archive", "contract", "invoice", "research", "metadata"}
+
+// syntheticWorkload builds a search mix of 40% term, 20% phrase, 20% filtered (facet)
+// and 20% deep paging queries, plus document lookups
+func syntheticWorkload() []workloadRequest {
+	search := func(name string, body map[string]any) workloadRequest {
+		payload, _ := json.Marshal(body)
+		return workloadRequest{Name: name, Method: "POST", Path: "/api/search/search", Body: payload}
+	}
+
+	var requests []workloadRequest
+	for i, term := range syntheticTerms {
+		next := syntheticTerms[(i+1)%len(syntheticTerms)]
+		requests = append(requests,
+			search("search_term", map[string]any{"query": "title:" + term}),
+			search("search_term", map[string]any{"query": term}),
+			search("search_phrase", map[string]any{"query": fmt.Sprintf(`title:"%s %s"`, term, next)}),
+			search("search_facet", map[string]any{"query": "*:*", "filters": map[string]string{"category": term}}),
+			search("search_paging", map[string]any{"query": "*:*", "start": (i + 1) * 100, "rows": 20}),
+			workloadRequest{Name: "GET_api_search_id", Method: "GET", Path: fmt.Sprintf("/api/search/%s-%d", term, i)},
+		)
+	}
+	return requests
+}
+
+// queryLogWorkload converts a recorded query log (the JSONL corpus format used by
+// BlueGreenVerify) into a workload named by endpoint
+func queryLogWorkload(content string) ([]workloadRequest, error) {
+	corpus, err := parseQueryCorpus(content)
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]workloadRequest, len(corpus))
+	for i, req := range corpus {
+		requests[i] = workloadRequest{Name: endpointName(req.Method, req.Path), Method: req.Method, Path: req.Path, Body: req.Body}
+	}
+	return requests, nil
+}
+
+// endpointLatency is the summary of one endpoint_<name> trend
+type endpointLatency struct {
+	Med float64 `json:"med"`
+	P95 float64 `json:"p(95)"`
+	P99 float64 `json:"p(99)"`
+	Max float64 `json:"max"`
+}
+
+// PerformanceTest drives a realistic search workload at the API and reports latency
+// percentiles per endpoint. Requests come from a recorded query log (JSONL, one
+// request or SearchRequest body per line) or, without one, from a synthetic mix of
+// term, phrase, facet and paging queries.
+// Given the API container instead of a running service, it also records CPU, memory,
+// GC and thread pool counters during the run and adds them to the report.
+func (m *SearchApi) PerformanceTest(
+	ctx context.Context,
+	// Running API (e.g., from RunApiWithServices); not monitored
+	// +optional
+	apiService *dagger.Service,
+	// Recorded query log to replay
+	// +optional
+	queryLog *dagger.File,
+	// Requests per second
+	// +default=20
+	rate int,
+	// Test duration (e.g., "30s", "2m")
+	// +default="1m"
+	duration string,
+	// Maximum p95 latency per endpoint in milliseconds
+	// +default=500
+	p95ThresholdMs float64,
+	// Maximum fraction of failed requests
+	// +default=0.01
+	maxErrorRate float64,
+	// API container to start with resource monitoring (takes precedence over apiService)
+	// +optional
+	container *dagger.Container,
+	// Seeded Solr data directory from SnapshotSolr for the monitored API
+	// +optional
+	solrSnapshot *dagger.Directory,
+) (string, error) {
+	var monitor *resourceMonitor
+	if container != nil {
+		monitor = newResourceMonitor()
+		monitored, err := monitor.apiService(ctx, container, solrService("", solrSnapshot, "perf"))
+		if err != nil {
+			return "", err
+		}
+		// Started explicitly so it can be stopped, which makes dotnet-counters flush
+		apiService, err = monitored.Start(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to start monitored API: %w", err)
+		}
+		// Stopped again below before reading the counters; this stops the API and
+		// Solr when the test fails first
+		defer func() { _, _ = apiService.Stop(ctx) }()
+	}
+	if apiService == nil {
+		return "", fmt.Errorf("either apiService or container is required")
+	}
+	// k6 counts requests to an API that is still starting as failures
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return "", err
+	}
+
+	workload := syntheticWorkload()
+	source := "synthetic term/phrase/facet/paging mix"
+	if queryLog != nil {
+		content, err := queryLog.Contents(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read query log: %w", err)
+		}
+		workload, err = queryLogWorkload(content)
+		if err != nil {
+			return "", err
+		}
+		if len(workload) == 0 {
+			return "", fmt.Errorf("query log is empty")
+		}
+		source = fmt.Sprintf("%d recorded requests", len(workload))
+	}
+
+	content, err := json.Marshal(workload)
+	if err != nil {
+		return "", err
+	}
+	requests := dag.Directory().WithNewFile("requests.json", string(content)).File("requests.json")
+	output, err := dag.K6().DataDriven(ctx, apiService, requests, dagger.K6DataDrivenOpts{
+		Rate:     rate,
+		Duration: duration,
+		Vus:      max(rate, 1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("k6 run failed: %w", err)
+	}
+
+	var summary struct {
+		Metrics map[string]json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(output), &summary); err != nil {
+		return "", fmt.Errorf("invalid k6 summary: %w", err)
+	}
+	var totals k6Summary
+	if err := json.Unmarshal([]byte(output), &totals); err != nil {
+		return "", fmt.Errorf("invalid k6 summary: %w", err)
+	}
+
+	report := "🚀 Performance Test\n\n"
+	report += fmt.Sprintf("Workload: %s at %d req/s for %s\n", source, rate, duration)
+	report += fmt.Sprintf("Requests: %d, failed: %.2f%%\n\n", totals.Metrics.Requests.Count, totals.Metrics.Failed.Value*100)
+	report += "| Endpoint | p50 (ms) | p95 (ms) | p99 (ms) | max (ms) |\n|---|---|---|---|---|\n"
+
+	var violations []string
+	for _, metric := range slices.Sorted(maps.Keys(summary.Metrics)) {
+		name, ok := strings.CutPrefix(metric, "endpoint_")
+		if !ok {
+			continue
+		}
+		var latency endpointLatency
+		if err := json.Unmarshal(summary.Metrics[metric], &latency); err != nil {
+			return "", fmt.Errorf("invalid k6 metric %s: %w", metric, err)
+		}
+		report += fmt.Sprintf("| %s | %.0f | %.0f | %.0f | %.0f |\n", name, latency.Med, latency.P95, latency.P99, latency.Max)
+		if latency.P95 > p95ThresholdMs {
+			violations = append(violations, fmt.Sprintf("%s p95 %.0fms exceeds %.0fms", name, latency.P95, p95ThresholdMs))
+		}
+	}
+	if totals.Metrics.Failed.Value > maxErrorRate {
+		violations = append(violations, fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", totals.Metrics.Failed.Value*100, maxErrorRate*100))
+	}
+
+	if monitor != nil {
+		if _, err := apiService.Stop(ctx); err != nil {
+			return report, fmt.Errorf("failed to stop monitored API: %w", err)
+		}
+		content, err := monitor.counters(ctx)
+		if err != nil {
+			return report, fmt.Errorf("failed to read resource counters: %w", err)
+		}
+		series, err := parseCounters(content)
+		if err != nil {
+			return report, err
+		}
+		// Roughly 20 rows regardless of the test duration
+		bucket := 5 * time.Second
+		if d, err := time.ParseDuration(duration); err == nil {
+			bucket = max((d / 20).Round(time.Second), time.Second)
+		}
+		report += "\n" + resourceReport(series, bucket)
+	}
+
+	if len(violations) > 0 {
+		report += "\n❌ Performance thresholds not met:\n   • " + strings.Join(violations, "\n   • ") + "\n"
+		return report, fmt.Errorf("performance thresholds not met: %s", strings.Join(violations, "; "))
+	}
+	report += "\n✅ All endpoints within thresholds\n"
+	return report, nil
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// PipelineStepResult is the outcome of one FullPipeline step
+type PipelineStepResult struct {
+	// Step name (e.g., "Step 1: Secret scan")
+	Name string
+	// passed, warning, blocked, failed, skipped or stopped (cancelled after another step blocked)
+	Status          string
+	DurationSeconds float64
+	// Deduplicated findings in the step's raw report (0 when it has none or isn't a scan)
+	Findings int
+	// Path of the step's raw tool output within PipelineReport.Reports ("" when none)
+	RawReport string
+	// The step's lines of the human-readable report
+	Output string
+
+	rawContent string
+	started    time.Time
+	// Config ID of the gate the step applies ("" for steps that always run)
+	gate string
+	// Outcome of the gate when it differs from the step's, such as a check skipped
+	// within a step that still ran ("" when the gate has the step's status)
+	gateStatus string
+}
+
+// QualityGateResult is the outcome of one tunable gate of the pipeline
+type QualityGateResult struct {
+	// Gate ID as in pipeline.yaml (e.g., "dependencies")
+	Name string
+	// Step that applied the gate
+	Step string
+	// Whether the gate blocks (block mode) rather than only warns or is skipped
+	Required bool
+	// Whether the gate found no problem; skipped gates count as passed
+	Passed bool
+	// Step status (see PipelineStepResult), or skipped when only the gate's check was
+	Status   string
+	Findings int
+	// Where the gate's raw report is: its path within PipelineReport.Reports, under
+	// the reports URL when one is configured ("" when the gate has none)
+	DetailsUri string
+}
+
+// PipelineReport is the machine-readable result of FullPipeline
+type PipelineReport struct {
+	// passed, blocked (a security gate blocked) or failed (a step couldn't run)
+	Status string
+	// Error of the step that blocked or failed
+	Error           string
+	StartedAt       string
+	DurationSeconds float64
+	// Semantic version of the build (see ComputeVersion)
+	Version string
+	// Pushed image pinned by digest (repository@sha256:..., "" when not pushed)
+	Image string
+	// The same image in the mirror registries, pinned by digest
+	Mirrors []string
+	// Compressed size of the image in MB and its layer count (0 when not measured)
+	ImageSizeMb float64
+	ImageLayers int
+	// Total line, branch and method coverage in percent (0 when not measured)
+	CoveragePercent       float64
+	BranchCoveragePercent float64
+	MethodCoveragePercent float64
+	Steps                 []*PipelineStepResult
+	// Result of every gate that ran or was skipped, in step order
+	Gates []*QualityGateResult
+	// Raw tool outputs referenced by the steps
+	Reports *dagger.Directory
+	// Full human-readable report
+	Text string
+}
+
+// blockedError marks a security gate that blocked, as opposed to a step that failed
+type blockedError struct{ error }
+
+func (e blockedError) Unwrap() error { return e.error }
+
+// blocked marks err as a blocking security gate result
+func blocked(err error) error {
+	return blockedError{err}
+}
+
+// stepStatus is the status of a step that returned err
+func stepStatus(err error) string {
+	var gate blockedError
+	if errors.As(err, &gate) {
+		return "blocked"
+	}
+	return "failed"
+}
+
+// attach records the step's raw tool output and counts its findings
+func (s *PipelineStepResult) attach(name, content string) {
+	s.RawReport = name
+	s.rawContent = content
+	if findings, err := parseFindings(content); err == nil {
+		s.Findings = len(dedupeFindings(findings))
+	}
+}
+
+// stageNotSelected is logged for the steps outside the stages RunStages selected
+const stageNotSelected = "⏭️  Not needed by the selected stages\n\n"
+
+// warning renders a problem found by a step in warn mode
+func warning(err error) string {
+	return fmt.Sprintf("⚠️  %s\n\n", strings.TrimPrefix(err.Error(), "❌ BLOCKED - "))
+}
+
+// pipelineRun builds the PipelineReport while FullPipeline runs, one step at a time
+type pipelineRun struct {
+	config *pipelineConfig
+	// Called with the completed report, whether the pipeline passed or stopped
+	onFinish []func(report *PipelineReport)
+	report   *PipelineReport
+	current  *PipelineStepResult
+	started  time.Time
+	// Further directories for the report's Reports, by their path within it
+	directories map[string]*dagger.Directory
+}
+
+func newPipelineRun(config *pipelineConfig) *pipelineRun {
+	started := time.Now().UTC()
+	return &pipelineRun{
+		config:  config,
+		report:  &PipelineReport{Status: "passed", StartedAt: started.Format(time.RFC3339)},
+		started: started,
+	}
+}
+
+// log adds lines to the report and to the current step
+func (r *pipelineRun) log(text string) {
+	r.report.Text += text
+	if r.current != nil {
+		r.current.Output += text
+	}
+}
+
+// warn logs a warning, which doesn't stop the pipeline
+func (r *pipelineRun) warn(text string) {
+	if r.current != nil {
+		r.current.Status = "warning"
+	}
+	r.log(text)
+}
+
+// skip logs a step that didn't run
+func (r *pipelineRun) skip(text string) {
+	if r.current != nil {
+		r.current.Status = "skipped"
+	}
+	r.log(text)
+}
+
+// enabled reports whether the config runs a step; a skipped step is recorded as such
+func (r *pipelineRun) enabled(step string) bool {
+	if r.current != nil {
+		r.current.gate = step
+	}
+	if r.config.mode(step) != "skip" {
+		return true
+	}
+	r.skip(r.config.skipReason(step))
+	return false
+}
+
+// gate applies the config mode of a step to a problem it found: in block mode the
+// problem is returned to stop the pipeline, in warn mode it is only reported
+func (r *pipelineRun) gate(step string, err error) error {
+	if r.current != nil {
+		r.current.gate = step
+	}
+	if err == nil || r.config.mode(step) == "block" {
+		return err
+	}
+	r.warn(warning(err))
+	return nil
+}
+
+// skipGate logs a gate whose check didn't run within a step that otherwise did
+func (r *pipelineRun) skipGate(step, text string) {
+	if r.current != nil {
+		r.current.gate = step
+		r.current.gateStatus = "skipped"
+	}
+	r.log(text)
+}
+
+// beginStep begins a step of the pipeline table by its config step ID or stage
+func (r *pipelineRun) beginStep(key string) {
+	spec := stepSpecFor(key)
+	r.begin(spec.name(), spec.header())
+}
+
+// begin ends the current step and starts the next one with its header line
+func (r *pipelineRun) begin(name, header string) {
+	r.end()
+	r.current = &PipelineStepResult{Name: name, started: time.Now()}
+	r.log(header)
+}
+
+// end records the duration of the current step; steps without problems passed
+func (r *pipelineRun) end() {
+	if r.current == nil {
+		return
+	}
+	r.current.DurationSeconds = time.Since(r.current.started).Round(time.Millisecond).Seconds()
+	if r.current.Status == "" {
+		r.current.Status = "passed"
+	}
+	r.report.Steps = append(r.report.Steps, r.current)
+	r.current = nil
+}
+
+// attach records the current step's raw tool output
+func (r *pipelineRun) attach(name, content string) {
+	if r.current != nil {
+		r.current.attach(name, content)
+	}
+}
+
+// attachDirectory adds a directory of supporting files, such as failure
+// diagnostics, to the report's Reports under path
+func (r *pipelineRun) attachDirectory(path string, dir *dagger.Directory) {
+	if r.directories == nil {
+		r.directories = map[string]*dagger.Directory{}
+	}
+	r.directories[path] = dir
+}
+
+// add appends steps that already ran, such as the concurrent ones
+func (r *pipelineRun) add(steps []*PipelineStepResult) {
+	r.end()
+	for _, step := range steps {
+		r.report.Text += step.Output
+		r.report.Steps = append(r.report.Steps, step)
+	}
+}
+
+// finish completes the report
+func (r *pipelineRun) finish() *PipelineReport {
+	r.end()
+	r.report.DurationSeconds = time.Since(r.started).Round(time.Second).Seconds()
+	reports := dag.Directory()
+	for _, step := range r.report.Steps {
+		if step.RawReport != "" {
+			reports = reports.WithNewFile(step.RawReport, step.rawContent)
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(r.directories)) {
+		reports = reports.WithDirectory(path, r.directories[path])
+	}
+	r.report.Reports = reports
+	r.report.Gates = qualityGates(r.report.Steps, r.config)
+	for _, onFinish := range r.onFinish {
+		onFinish(r.report)
+	}
+	return r.report
+}
+
+// stop ends the pipeline at the current step; the report is returned instead of the
+// error when failures are reported rather than raised
+func (r *pipelineRun) stop(err error) (*PipelineReport, error) {
+	status := stepStatus(err)
+	if r.current != nil {
+		r.current.Status = status
+	}
+	r.report.Status = status
+	r.report.Error = err.Error()
+	report := r.finish()
+	if r.config.ReportFailures {
+		return report, nil
+	}
+	return nil, err
+}
+
+// stepSpec is one FullPipeline step: runPipeline names and announces its steps by
+// it and Plan lists them, so both follow the same table
+type stepSpec struct {
+	number string
+	title  string
+	// Header line announcing the step: icon, then what it does
+	icon   string
+	action string
+	// Config step ID; the container build, local registry push and services have
+	// none and run whenever their stage does
+	id    string
+	stage string
+	// Images the step pulls
+	images []string
+	// Thresholds and severities the step enforces
+	detail func(c *pipelineConfig) string
+}
+
+// pipelineStepSpecs lists FullPipeline's steps in the order they run
+var pipelineStepSpecs = []stepSpec{
+	{number: "1", title: "Secret scan", icon: "🔐 ", action: "Scanning for hardcoded secrets", id: "secrets", images: []string{reportTools["trufflehog"].image}},
+	{number: "2", title: "SAST", icon: "🛡️  ", action: "Running SAST (Semgrep)", id: "sast", images: []string{reportTools["semgrep"].image}, detail: func(c *pipelineConfig) string {
+		return "severities " + strings.Join(c.Severities.Sast, ", ")
+	}},
+	{number: "3", title: "C# security analysis", icon: "🔒 ", action: "Running C# Security Analysis (.NET Analyzers)", id: "csharp-analysis", images: []string{dotnetSDK}},
+	{number: "4", title: "Build and unit tests", icon: "📦 ", action: "Building and running unit tests", id: "build", images: []string{dotnetSDK}},
+	{number: "5", title: "Code coverage", icon: "📊 ", action: "Checking code coverage", id: "coverage", images: []string{dotnetSDK}, detail: func(c *pipelineConfig) string {
+		detail := fmt.Sprintf("lines ≥ %v%%", c.Thresholds.Coverage)
+		if c.Thresholds.BranchCoverage > 0 {
+			detail += fmt.Sprintf(", branches ≥ %v%%", c.Thresholds.BranchCoverage)
+		}
+		return detail
+	}},
+	{number: "6", title: "Code formatting", icon: "🔍 ", action: "Running code quality checks", id: "formatting", images: []string{dotnetSDK}},
+	{number: "7", title: "Dependency scan", icon: "🔒 ", action: "Scanning dependencies for vulnerabilities", id: "dependencies", images: []string{trivyImage}, detail: func(c *pipelineConfig) string {
+		detail := "severities " + strings.Join(c.Severities.Dependencies, ", ")
+		if c.VulnWaivers != "" {
+			detail += ", waivers " + c.VulnWaivers
+		}
+		return detail
+	}},
+	{number: "8", title: "License scan", icon: "📜 ", action: "Scanning for license compliance issues", id: "licenses", images: []string{trivyImage}, detail: func(c *pipelineConfig) string {
+		if c.LicensePolicy != "" {
+			return "policy " + c.LicensePolicy
+		}
+		return "severities " + strings.Join(c.Severities.Licenses, ", ")
+	}},
+	{number: "9", title: "IaC scan", icon: "☸️  ", action: "Scanning Kubernetes manifests (IaC)", id: "iac", images: []string{reportTools["checkov"].image}},
+	{number: "10", title: "Policy check", icon: "📐 ", action: "Validating policies (OPA/Conftest)", id: "policy", images: []string{conftestImage}},
+	{number: "11", title: "SBOM", icon: "📋 ", action: "Generating SBOM", id: "sbom", images: []string{reportTools["syft"].image}},
+	{number: "11a", title: "Dependency-Track", icon: "📤 ", action: "Uploading SBOM to Dependency-Track", id: "dependency-track", detail: func(c *pipelineConfig) string {
+		if c.DependencyTrack.Url == "" {
+			return "not configured"
+		}
+		detail := fmt.Sprintf("%s (project %s)", c.DependencyTrack.Url, c.DependencyTrack.Project)
+		if c.DependencyTrack.WaitSeconds > 0 {
+			detail += fmt.Sprintf(", waits %ds for policy violations", c.DependencyTrack.WaitSeconds)
+		}
+		return detail
+	}},
+	{number: "12", title: "Container build", icon: "🐳 ", action: "Building container image (distroless for security)", stage: "container-build", images: []string{dotnetSDK, aspnetDistrolessExtra}},
+	{number: "12a", title: "Container size", icon: "📏 ", action: "Analyzing container size", id: "container-size", images: []string{diveImage}, detail: func(c *pipelineConfig) string {
+		var budgets []string
+		if c.Thresholds.MaxImageSizeMb > 0 {
+			budgets = append(budgets, fmt.Sprintf("≤ %v MB", c.Thresholds.MaxImageSizeMb))
+		}
+		if c.Thresholds.MaxImageLayers > 0 {
+			budgets = append(budgets, fmt.Sprintf("≤ %d layers", c.Thresholds.MaxImageLayers))
+		}
+		return cmp.Or(strings.Join(budgets, ", "), "no budget (report only)")
+	}},
+	{number: "13", title: "Container scan", icon: "🔎 ", action: "Scanning container for vulnerabilities", id: "container-scan", images: []string{trivyImage}, detail: func(c *pipelineConfig) string {
+		return "severities " + strings.Join(c.Severities.Container, ", ")
+	}},
+	{number: "14", title: "CIS benchmark", icon: "📋 ", action: "Running CIS Docker Benchmark", id: "cis", images: []string{trivyImage}, detail: func(c *pipelineConfig) string {
+		if c.Thresholds.CisScore > 0 {
+			return fmt.Sprintf("score ≥ %v%%", c.Thresholds.CisScore)
+		}
+		return ""
+	}},
+	{number: "14a", title: "Image config hardening", icon: "🧱 ", action: "Checking image config hardening (Dockle)", id: "config-hardening", images: []string{reportTools["dockle"].image}},
+	{number: "15", title: "Local registry push", icon: "📤 ", action: "Pushing to local registry", stage: "local-registry", images: []string{registryImage, skopeoImage}},
+	{number: "16", title: "Services", icon: "🚀 ", action: "Starting API with Solr service", stage: "services", images: []string{solrImage(defaultSolrVersion)}},
+	{number: "16a", title: "Smoke test", icon: "💨 ", action: "Smoke testing the API (health, readiness, search)", id: "smoke-test", images: []string{curlImage}},
+	{number: "17", title: "Integration tests", icon: "🧪 ", action: "Running integration tests", id: "integration-tests", images: []string{dotnetSDK}},
+	{number: "18", title: "DAST", icon: "🎯 ", action: "Running DAST (OWASP ZAP)", id: "dast", images: []string{zapImage}, detail: func(c *pipelineConfig) string {
+		if c.CaptureDastHar {
+			return "captures a HAR"
+		}
+		return ""
+	}},
+	{number: "19", title: "API security tests", icon: "🔓 ", action: "Running API security tests (Nuclei)", id: "api-security", images: []string{nucleiImage}},
+	{number: "20", title: "Performance tests", icon: "🚀 ", action: "Running performance tests (k6)", id: "performance", images: []string{reportTools["k6"].image}},
+	{number: "21", title: "Mutation tests", icon: "🧬 ", action: "Running mutation tests (Stryker.NET)", id: "mutation", images: []string{dotnetSDK}, detail: func(c *pipelineConfig) string {
+		return fmt.Sprintf("score ≥ %d%%", c.Thresholds.Mutation)
+	}},
+	{number: "22", title: "Registry push", icon: "🏗️  ", action: "Pushing to container registry", id: "api-compatibility", images: []string{orasImage, oasdiffImage, cosignImage}, detail: func(c *pipelineConfig) string {
+		if c.stages != nil {
+			return "RunStages doesn't push"
+		}
+		return "only with registry credentials"
+	}},
+}
+
+// name is the step's name in the report (e.g., "Step 1: Secret scan")
+func (s stepSpec) name() string {
+	return "Step " + s.number + ": " + s.title
+}
+
+// header is the report line announcing the step
+func (s stepSpec) header() string {
+	return s.icon + "Step " + s.number + ": " + s.action + "...\n"
+}
+
+// stepSpecFor returns the spec of a step by its config step ID, or by its stage for
+// the steps without one
+func stepSpecFor(key string) stepSpec {
+	for _, spec := range pipelineStepSpecs {
+		if spec.id == key || (spec.id == "" && spec.stage == key) {
+			return spec
+		}
+	}
+	return stepSpec{number: "?", title: key, action: key}
+}
+
+// pipelineStep is one FullPipeline step that only depends on the source
+// run returns the step's report lines and may set its raw output; an error is a
+// problem the step found, wrapped with blocked() when it's a gate that blocked
+type pipelineStep struct {
+	stepSpec
+	run func(ctx context.Context, step *PipelineStepResult) (string, error)
+}
+
+// runPipelineSteps runs independent steps concurrently, at most config.MaxParallel at
+// once (0 = no limit), applying each step's mode. The first step to block cancels the
+// rest; results keep step order regardless of which step finished first
+func runPipelineSteps(ctx context.Context, config *pipelineConfig, steps []pipelineStep) ([]*PipelineStepResult, error) {
+	results := make([]*PipelineStepResult, len(steps))
+	var first atomic.Int32
+	first.Store(-1)
+
+	g, gctx := errgroup.WithContext(ctx)
+	if config.MaxParallel > 0 {
+		g.SetLimit(config.MaxParallel)
+	}
+	for i, step := range steps {
+		results[i] = &PipelineStepResult{Name: step.name(), Output: step.header(), gate: step.id}
+		if config.mode(step.id) == "skip" {
+			results[i].Status = "skipped"
+			results[i].Output += config.skipReason(step.id)
+			continue
+		}
+		g.Go(func() error {
+			result := results[i]
+			if err := gctx.Err(); err != nil {
+				result.Status = "stopped"
+				return err
+			}
+			result.started = time.Now()
+			output, err := step.run(gctx, result)
+			result.DurationSeconds = time.Since(result.started).Round(time.Millisecond).Seconds()
+			result.Output += output
+			if err != nil && config.mode(step.id) == "warn" {
+				result.Status = "warning"
+				result.Output += warning(err)
+				err = nil
+			}
+			switch {
+			case err != nil && first.CompareAndSwap(-1, int32(i)):
+				result.Status = stepStatus(err)
+			case err != nil:
+				result.Status = "stopped"
+			case result.Status == "":
+				result.Status = "passed"
+			}
+			return err
+		})
+	}
+	err := g.Wait()
+
+	for _, result := range results {
+		if result.Status == "stopped" {
+			result.Output += "⏹️  Stopped after another step blocked\n\n"
+		}
+	}
+	return results, err
+}
+
+// qualityGates lists the gates the steps applied, with the mode the config gives them
+func qualityGates(steps []*PipelineStepResult, config *pipelineConfig) []*QualityGateResult {
+	var gates []*QualityGateResult
+	for _, s := range steps {
+		if s.gate == "" {
+			continue
+		}
+		status := cmp.Or(s.gateStatus, s.Status)
+		gate := &QualityGateResult{
+			Name:     s.gate,
+			Step:     s.Name,
+			Required: config.mode(s.gate) == "block",
+			Passed:   status == "passed" || status == "skipped",
+			Status:   status,
+			Findings: s.Findings,
+		}
+		if s.RawReport != "" {
+			gate.DetailsUri = s.RawReport
+			if config.Notify.ReportsUrl != "" {
+				gate.DetailsUri = strings.TrimSuffix(config.Notify.ReportsUrl, "/") + "/" + s.RawReport
+			}
+		}
+		gates = append(gates, gate)
+	}
+	return gates
+}
+
+// gateSummary renders the outcome of a completed run's gates: whether every enforced
+// gate passed, and the gates that only warned or were skipped
+func gateSummary(gates []*QualityGateResult) string {
+	var enforced, passed int
+	var unchecked, warned, skipped []string
+	for _, g := range gates {
+		switch {
+		case g.Required && g.Status == "passed":
+			enforced++
+			passed++
+		case g.Required:
+			// A required gate whose step couldn't run only warns
+			enforced++
+			unchecked = append(unchecked, g.Name)
+		case g.Status == "warning":
+			warned = append(warned, g.Name)
+		case g.Status == "skipped":
+			skipped = append(skipped, g.Name)
+		}
+	}
+
+	var sb strings.Builder
+	switch {
+	case enforced == 0:
+		sb.WriteString("⚠️  No security gate is enforced (every gate is in warn or skip mode)\n")
+	case passed == enforced:
+		fmt.Fprintf(&sb, "🔒 All %d enforced security gate(s) passed - safe to deploy\n", enforced)
+	default:
+		fmt.Fprintf(&sb, "🔒 %d of %d enforced security gate(s) passed; not checked: %s\n", passed, enforced, strings.Join(unchecked, ", "))
+	}
+	if len(warned) > 0 {
+		fmt.Fprintf(&sb, "⚠️  %d gate(s) in warn mode reported problems: %s\n", len(warned), strings.Join(warned, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&sb, "⏭️  %d gate(s) skipped: %s\n", len(skipped), strings.Join(skipped, ", "))
+	}
+	return sb.String()
+}
+
+// Check fails when a required gate blocked or failed, or a step the gates depend on
+// failed, and succeeds otherwise: warnings, including a required gate that couldn't
+// run, don't fail it any more than they stop the pipeline. Run it after FullPipeline
+// with reportFailures for the CI job's exit code
+func (r *PipelineReport) Check() error {
+	var failed []string
+	for _, g := range r.Gates {
+		if g.Required && (g.Status == "blocked" || g.Status == "failed") {
+			failed = append(failed, fmt.Sprintf("%s (%s)", g.Name, g.Status))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d required gate(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	if r.Status == "failed" {
+		return fmt.Errorf("pipeline failed: %s", r.Error)
+	}
+	return nil
+}
+
+// stepView is the JSON form of a step
+type stepView struct {
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Findings        int     `json:"findings"`
+	RawReport       string  `json:"rawReport,omitempty"`
+}
+
+// reportView is the JSON form of a report, which Notify reads back
+type reportView struct {
+	Status          string     `json:"status"`
+	Error           string     `json:"error"`
+	StartedAt       string     `json:"startedAt"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Version         string     `json:"version,omitempty"`
+	Image           string     `json:"image,omitempty"`
+	Steps           []stepView `json:"steps"`
+}
+
+func (r *PipelineReport) view() reportView {
+	steps := make([]stepView, len(r.Steps))
+	for i, s := range r.Steps {
+		steps[i] = stepView{s.Name, s.Status, s.DurationSeconds, s.Findings, s.RawReport}
+	}
+	return reportView{r.Status, r.Error, r.StartedAt, r.DurationSeconds, r.Version, r.Image, steps}
+}
+
+// Json returns the report as JSON, without the human-readable text
+func (r *PipelineReport) Json() (string, error) {
+	content, err := json.MarshalIndent(r.view(), "", "  ")
+	return string(content), err
+}
+
+// Markdown returns the report as a markdown table, e.g. for a CI job summary
+func (r *PipelineReport) Markdown() string {
+	return r.view().markdown()
+}
+
+func (r reportView) markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Pipeline %s\n\n", r.Status)
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "```\n%s\n```\n\n", r.Error)
+	}
+	sb.WriteString("| Step | Status | Duration (s) | Findings | Report |\n")
+	sb.WriteString("|------|--------|--------------|----------|--------|\n")
+	for _, s := range r.Steps {
+		fmt.Fprintf(&sb, "| %s | %s | %.1f | %d | %s |\n", s.Name, s.Status, s.DurationSeconds, s.Findings, s.RawReport)
+	}
+	return sb.String()
+}
+
+// Summary returns a one-line result, naming the step that stopped the pipeline
+func (r *PipelineReport) Summary() string {
+	counts := map[string]int{}
+	stoppedAt := ""
+	for _, s := range r.Steps {
+		counts[s.Status]++
+		if (s.Status == "blocked" || s.Status == "failed") && stoppedAt == "" {
+			stoppedAt = s.Name
+		}
+	}
+	summary := fmt.Sprintf("Pipeline %s in %.0fs: %d passed, %d warnings, %d skipped", r.Status, r.DurationSeconds,
+		counts["passed"], counts["warning"], counts["skipped"])
+	if stoppedAt != "" {
+		summary += fmt.Sprintf("; %s at %s", r.Status, stoppedAt)
+	}
+	return summary
+}
+
+// JobSummary returns GitHub-flavored markdown for $GITHUB_STEP_SUMMARY: the status of
+// every gate, findings by severity across the raw reports and the image size, so
+// results are visible without downloading artifacts
+func (r *PipelineReport) JobSummary(ctx context.Context) (string, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s Pipeline %s\n\n", statusIcons[r.Status], r.Status)
+	fmt.Fprintf(&sb, "%s\n\n", r.Summary())
+	if r.Version != "" || r.Image != "" {
+		sb.WriteString("| Version | Image |\n|---------|-------|\n")
+		fmt.Fprintf(&sb, "| %s | `%s` |\n\n", r.Version, r.Image)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "<details><summary>Error</summary>\n\n```\n%s\n```\n</details>\n\n", r.Error)
+	}
+
+	sb.WriteString("### Gates\n\n")
+	sb.WriteString("| Step | Status | Findings | Duration (s) |\n")
+	sb.WriteString("|------|--------|----------|--------------|\n")
+	for _, s := range r.Steps {
+		fmt.Fprintf(&sb, "| %s | %s %s | %d | %.1f |\n", s.Name, statusIcons[s.Status], s.Status, s.Findings, s.DurationSeconds)
+	}
+
+	if r.Reports != nil {
+		findings, err := collectFindings(ctx, r.Reports)
+		if err != nil {
+			return "", err
+		}
+		counts := severityCounts(findings)
+		sb.WriteString("\n### Findings by severity\n\n")
+		sb.WriteString("| " + strings.Join(dashboardSeverities, " | ") + " | Total |\n")
+		sb.WriteString(strings.Repeat("|------", len(dashboardSeverities)+1) + "|\n")
+		for _, severity := range dashboardSeverities {
+			fmt.Fprintf(&sb, "| %d ", counts[severity])
+		}
+		fmt.Fprintf(&sb, "| %d |\n", len(findings))
+	}
+
+	if r.ImageSizeMb > 0 {
+		sb.WriteString("\n### Image size\n\n")
+		sb.WriteString("| Compressed | Layers |\n|------------|--------|\n")
+		fmt.Fprintf(&sb, "| %.1f MB | %d |\n", r.ImageSizeMb, r.ImageLayers)
+	}
+	return sb.String(), nil
+}
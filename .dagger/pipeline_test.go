@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestGateSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		gates []*QualityGateResult
+		want  string
+	}{
+		{
+			name: "all enforced passed",
+			gates: []*QualityGateResult{
+				{Name: "secrets", Required: true, Status: "passed"},
+				{Name: "sast", Required: true, Status: "passed"},
+			},
+			want: "🔒 All 2 enforced security gate(s) passed - safe to deploy\n",
+		},
+		{
+			name: "warnings and skips",
+			gates: []*QualityGateResult{
+				{Name: "secrets", Required: true, Status: "passed"},
+				{Name: "licenses", Status: "warning"},
+				{Name: "mutation", Status: "skipped"},
+				{Name: "dast", Status: "skipped"},
+				{Name: "formatting", Status: "passed"},
+			},
+			want: "🔒 All 1 enforced security gate(s) passed - safe to deploy\n" +
+				"⚠️  1 gate(s) in warn mode reported problems: licenses\n" +
+				"⏭️  2 gate(s) skipped: mutation, dast\n",
+		},
+		{
+			name: "required gate that couldn't run",
+			gates: []*QualityGateResult{
+				{Name: "secrets", Required: true, Status: "passed"},
+				{Name: "dependencies", Required: true, Status: "warning"},
+			},
+			want: "🔒 1 of 2 enforced security gate(s) passed; not checked: dependencies\n",
+		},
+		{
+			name:  "nothing enforced",
+			gates: []*QualityGateResult{{Name: "sast", Status: "passed"}},
+			want:  "⚠️  No security gate is enforced (every gate is in warn or skip mode)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gateSummary(tt.gates); got != tt.want {
+				t.Errorf("gateSummary() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQualityGates(t *testing.T) {
+	steps := []*PipelineStepResult{
+		{Name: "Step 1: Secret scan", Status: "passed", gate: "secrets"},
+		{Name: "Step 10: Formatting", Status: "passed"},
+		{Name: "Step 22: Registry push", Status: "passed", gate: "api-compatibility", gateStatus: "skipped"},
+		{Name: "Step 17: DAST", Status: "warning", gate: "dast"},
+	}
+	gates := qualityGates(steps, defaultPipelineConfig())
+	if len(gates) != 3 {
+		t.Fatalf("got %d gates, want 3", len(gates))
+	}
+	if g := gates[1]; g.Name != "api-compatibility" || g.Status != "skipped" || !g.Passed || !g.Required {
+		t.Errorf("api-compatibility gate = %+v, want required and skipped", g)
+	}
+	if g := gates[2]; g.Status != "warning" || g.Passed {
+		t.Errorf("dast gate = %+v, want a warning that didn't pass", g)
+	}
+}
+
+func TestPipelineStepSpecs(t *testing.T) {
+	keys := map[string]bool{}
+	for _, spec := range pipelineStepSpecs {
+		key := spec.id
+		if key == "" {
+			key = spec.stage
+		}
+		if key == "" || keys[key] {
+			t.Errorf("step %s: missing or duplicate key %q", spec.number, key)
+		}
+		keys[key] = true
+		if spec.title == "" || spec.icon == "" || spec.action == "" {
+			t.Errorf("step %s (%s): title, icon and action are required", spec.number, key)
+		}
+	}
+
+	// Every step runPipeline begins by key is in the table
+	source, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range regexp.MustCompile(`(?:stepSpecFor|beginStep)\("([^"]+)"\)`).FindAllSubmatch(source, -1) {
+		if key := string(match[1]); !keys[key] {
+			t.Errorf("main.go uses unknown step %q", key)
+		}
+	}
+
+	if got, want := stepSpecFor("sast").header(), "🛡️  Step 2: Running SAST (Semgrep)...\n"; got != want {
+		t.Errorf("sast header = %q, want %q", got, want)
+	}
+	if got, want := stepSpecFor("container-build").name(), "Step 12: Container build"; got != want {
+		t.Errorf("container-build name = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// pipelineStepModes lists the FullPipeline steps a config can tune, with their default
+// mode: block stops the pipeline on a problem, warn reports it, skip doesn't run the step
+// The container build, local registry push and services are needed by later steps and
+// always run
+var pipelineStepModes = map[string]string{
+	"secrets":           "block",
+	"sast":              "block",
+	"csharp-analysis":   "block",
+	"build":             "block",
+	"coverage":          "warn",
+	"formatting":        "warn",
+	"dependencies":      "block",
+	"licenses":          "block",
+	"iac":               "warn",
+	"policy":            "warn",
+	"sbom":              "warn",
+	"dependency-track":  "warn",
+	"container-size":    "block",
+	"container-scan":    "block",
+	"cis":               "block",
+	"config-hardening":  "block",
+	"smoke-test":        "block",
+	"integration-tests": "block",
+	"dast":              "block",
+	"api-security":      "block",
+	"performance":       "warn",
+	"mutation":          "warn",
+	"api-compatibility": "block",
+}
+
+// pipelineStageNeeds lists what each stage RunStages can select needs to run first:
+// the tunable steps plus the container build, local registry push and services they
+// share. API compatibility is checked on registry push, which RunStages doesn't do
+var pipelineStageNeeds = map[string][]string{
+	"secrets":           nil,
+	"sast":              nil,
+	"csharp-analysis":   nil,
+	"build":             nil,
+	"coverage":          nil,
+	"formatting":        nil,
+	"dependencies":      nil,
+	"licenses":          nil,
+	"iac":               nil,
+	"policy":            nil,
+	"sbom":              nil,
+	"dependency-track":  {"sbom"},
+	"container-build":   nil,
+	"container-size":    {"container-build"},
+	"container-scan":    {"container-build"},
+	"cis":               {"container-build"},
+	"config-hardening":  {"container-build"},
+	"local-registry":    {"container-build"},
+	"services":          {"container-build"},
+	"smoke-test":        {"services"},
+	"integration-tests": {"services"},
+	"dast":              {"services"},
+	"api-security":      {"services"},
+	"performance":       {"container-build"},
+	"mutation":          nil,
+}
+
+// pipelineStageAliases maps the CLI names of the standalone functions onto the
+// stages that run them, so a stage can be selected as it's called on its own
+var pipelineStageAliases = map[string]string{
+	"secret-scan":                     "secrets",
+	"sast-scan":                       "sast",
+	"c-sharp-security-analysis":       "csharp-analysis",
+	"code-coverage":                   "coverage",
+	"dependency-scan":                 "dependencies",
+	"license-scan":                    "licenses",
+	"iac-scan":                        "iac",
+	"policy-check":                    "policy",
+	"generate-sbom":                   "sbom",
+	"upload-sbom-to-dependency-track": "dependency-track",
+	"build-container":                 "container-build",
+	"container-size-analysis":         "container-size",
+	"scan-container":                  "container-scan",
+	"cis-benchmark":                   "cis",
+	"push-to-local-registry":          "local-registry",
+	"run-api-with-services":           "services",
+	"run-integration-tests":           "integration-tests",
+	"dast-scan":                       "dast",
+	"api-security-test":               "api-security",
+	"performance-test":                "performance",
+	"mutation-test":                   "mutation",
+}
+
+// resolveStages expands the selected stages with everything they need; stages
+// may also be given by their function's CLI name (e.g., secret-scan)
+func resolveStages(stages []string) (map[string]bool, error) {
+	stages = slices.Clone(stages)
+	var unknown []string
+	for i, stage := range stages {
+		if alias, ok := pipelineStageAliases[stage]; ok {
+			stages[i] = alias
+		} else if _, ok := pipelineStageNeeds[stage]; !ok {
+			unknown = append(unknown, fmt.Sprintf("%q", stage))
+		}
+	}
+	if len(unknown) > 0 {
+		valid := slices.Sorted(maps.Keys(pipelineStageNeeds))
+		return nil, fmt.Errorf("unknown stage(s) %s; valid stages: %s", strings.Join(unknown, ", "), strings.Join(valid, ", "))
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("at least one stage is required")
+	}
+
+	selected := map[string]bool{}
+	var add func(stage string)
+	add = func(stage string) {
+		if selected[stage] {
+			return
+		}
+		selected[stage] = true
+		for _, need := range pipelineStageNeeds[stage] {
+			add(need)
+		}
+	}
+	for _, stage := range stages {
+		add(stage)
+	}
+	return selected, nil
+}
+
+// Severity scales of the scanners a config can set levels for
+var (
+	trivySeverities   = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+	semgrepSeverities = []string{"INFO", "WARNING", "ERROR"}
+)
+
+// registryMirror is a further registry in pipeline.yaml; its credentials are read
+// from Vault as "<path>#<key>"
+type registryMirror struct {
+	// Defaults to the registry of imageRef
+	Url      string `json:"url"`
+	ImageRef string `json:"imageRef"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// pipelineConfig tunes FullPipeline's gates (pipeline.yaml)
+type pipelineConfig struct {
+	// Step ID to mode (block, warn or skip); unlisted steps keep their default
+	Steps map[string]string `json:"steps"`
+	// Step modes by branch pattern (e.g., "main" or "feature/*"), applied over Steps
+	// on matching branches
+	Branches   map[string]map[string]string `json:"branches"`
+	Thresholds struct {
+		Coverage       float64 `json:"coverage"`
+		BranchCoverage float64 `json:"branchCoverage"`
+		Mutation       int     `json:"mutation"`
+		CisScore       float64 `json:"cisScore"`
+		MaxImageSizeMb float64 `json:"maxImageSizeMb"`
+		MaxImageLayers int     `json:"maxImageLayers"`
+	} `json:"thresholds"`
+	Severities struct {
+		Sast         []string `json:"sast"`
+		Dependencies []string `json:"dependencies"`
+		Licenses     []string `json:"licenses"`
+		Container    []string `json:"container"`
+	} `json:"severities"`
+	MaxParallel    int  `json:"maxParallel"`
+	CaptureDastHar bool `json:"captureDastHar"`
+	ReportFailures bool `json:"reportFailures"`
+	// Paths relative to the source
+	RiskRegister     string `json:"riskRegister"`
+	VulnWaivers      string `json:"vulnWaivers"`
+	LicensePolicy    string `json:"licensePolicy"`
+	SecurityBaseline string `json:"securityBaseline"`
+	SolrFixtures     string `json:"solrFixtures"`
+	OfflineAssets    string `json:"offlineAssets"`
+	Registry         struct {
+		Url      string `json:"url"`
+		ImageRef string `json:"imageRef"`
+		// Defaults to the computed version
+		Tag string `json:"tag"`
+		// Further registries the same image is pushed to and signed in
+		Mirrors []registryMirror `json:"mirrors"`
+	} `json:"registry"`
+	// Result notification, sent when a webhook is given
+	Notify struct {
+		Platform   string `json:"platform"`
+		Channel    string `json:"channel"`
+		ReportsUrl string `json:"reportsUrl"`
+	} `json:"notify"`
+	// OTLP/HTTP endpoint receiving a span per step (e.g., "http://otel-collector:4318")
+	OtlpEndpoint string `json:"otlpEndpoint"`
+	// SBOM upload to Dependency-Track, when its API key is passed
+	DependencyTrack struct {
+		Url     string `json:"url"`
+		Project string `json:"project"`
+		// Seconds to wait for the analysis; with more than 0, FAIL-state policy
+		// violations are a problem of the dependency-track step
+		WaitSeconds int `json:"waitSeconds"`
+	} `json:"dependencyTrack"`
+	// Retries of the network-dependent steps (secret scan, SAST, vulnerability
+	// scans, registry push) when they fail on a network error
+	Retry struct {
+		Attempts       int     `json:"attempts"`
+		BackoffSeconds float64 `json:"backoffSeconds"`
+	} `json:"retry"`
+	// Credentials read from HashiCorp Vault when FullPipelineFromConfig runs with
+	// fromVault; each maps an argument to "<path>#<key>"
+	Vault struct {
+		Secrets struct {
+			RegistryUsername      string `json:"registryUsername"`
+			RegistryPassword      string `json:"registryPassword"`
+			NotifyWebhook         string `json:"notifyWebhook"`
+			DependencyTrackApiKey string `json:"dependencyTrackApiKey"`
+		} `json:"secrets"`
+	} `json:"vault"`
+
+	// Mirror registries with their credentials, from FullPipeline's arguments or Vault
+	mirrors []registryDestination
+	// Stages selected by RunStages, with what they need (nil runs everything)
+	stages map[string]bool
+	// Whether the runtime scans run their slow, thorough variants (DeepScan)
+	deep bool
+	// Files changed since a pull request's base (PrPipeline); the secret, SAST and
+	// formatting scans only look at these (nil scans everything)
+	changedFiles []string
+}
+
+// defaultPipelineConfig is FullPipeline's behavior without a config file
+func defaultPipelineConfig() *pipelineConfig {
+	config := &pipelineConfig{}
+	config.Thresholds.Coverage = 80
+	config.Thresholds.Mutation = 80
+	config.Severities.Sast = []string{"ERROR", "WARNING"}
+	config.Severities.Dependencies = []string{"HIGH", "CRITICAL"}
+	config.Severities.Licenses = []string{"HIGH", "CRITICAL"}
+	config.Severities.Container = []string{"HIGH", "CRITICAL"}
+	config.Notify.Platform = "slack"
+	config.DependencyTrack.Project = "search-api"
+	config.Retry.Attempts = 3
+	config.Retry.BackoffSeconds = 2
+	return config
+}
+
+// pipelineInputs are the files from the source tree a pipeline run reads besides
+// the code: waivers, policies and fixtures. Nil ones aren't used
+type pipelineInputs struct {
+	riskRegister     *dagger.File
+	vulnWaivers      *dagger.File
+	licensePolicy    *dagger.File
+	securityBaseline *dagger.File
+	solrFixtures     *dagger.Directory
+	offlineAssets    *dagger.Directory
+}
+
+// inputs resolves the files the config points at against the source tree
+func (c *pipelineConfig) inputs(source *dagger.Directory) pipelineInputs {
+	var inputs pipelineInputs
+	if c.RiskRegister != "" {
+		inputs.riskRegister = source.File(c.RiskRegister)
+	}
+	if c.VulnWaivers != "" {
+		inputs.vulnWaivers = source.File(c.VulnWaivers)
+	}
+	if c.LicensePolicy != "" {
+		inputs.licensePolicy = source.File(c.LicensePolicy)
+	}
+	if c.SecurityBaseline != "" {
+		inputs.securityBaseline = source.File(c.SecurityBaseline)
+	}
+	if c.SolrFixtures != "" {
+		inputs.solrFixtures = source.Directory(c.SolrFixtures)
+	}
+	if c.OfflineAssets != "" {
+		inputs.offlineAssets = source.Directory(c.OfflineAssets)
+	}
+	return inputs
+}
+
+// scope returns the part of the source the changed-files scans look at
+func (c *pipelineConfig) scope(source *dagger.Directory) *dagger.Directory {
+	if c.changedFiles == nil {
+		return source
+	}
+	if len(c.changedFiles) == 0 {
+		// An empty include list would select everything
+		return dag.Directory()
+	}
+	return dag.Directory().WithDirectory(".", source, dagger.DirectoryWithDirectoryOpts{Include: c.changedFiles})
+}
+
+// runs reports whether a stage is part of the run
+func (c *pipelineConfig) runs(stage string) bool {
+	return c.stages == nil || c.stages[stage]
+}
+
+// skipReason explains why a step is skipped
+func (c *pipelineConfig) skipReason(step string) string {
+	if !c.runs(step) {
+		return stageNotSelected
+	}
+	return "⏭️  Skipped by pipeline config\n\n"
+}
+
+// mode returns the configured mode of a step; steps outside the selected stages are skipped
+func (c *pipelineConfig) mode(step string) string {
+	if !c.runs(step) {
+		return "skip"
+	}
+	if mode, ok := c.Steps[step]; ok {
+		return mode
+	}
+	return pipelineStepModes[step]
+}
+
+// validate rejects unknown steps and modes, thresholds out of range and unknown
+// severities, so a typo can't silently turn a gate off
+func (c *pipelineConfig) validate() error {
+	problems := validateStepModes("", c.Steps)
+	for pattern, steps := range c.Branches {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("branches: invalid pattern %q", pattern))
+		}
+		problems = append(problems, validateStepModes(fmt.Sprintf("branches.%s: ", pattern), steps)...)
+	}
+
+	percentages := map[string]float64{
+		"coverage":       c.Thresholds.Coverage,
+		"branchCoverage": c.Thresholds.BranchCoverage,
+		"mutation":       float64(c.Thresholds.Mutation),
+		"cisScore":       c.Thresholds.CisScore,
+	}
+	for name, value := range percentages {
+		if value < 0 || value > 100 {
+			problems = append(problems, fmt.Sprintf("thresholds.%s: %v is not between 0 and 100", name, value))
+		}
+	}
+	if c.Thresholds.MaxImageSizeMb < 0 || c.Thresholds.MaxImageLayers < 0 {
+		problems = append(problems, "thresholds: image budgets can't be negative")
+	}
+	if c.MaxParallel < 0 {
+		problems = append(problems, "maxParallel can't be negative")
+	}
+	if c.DependencyTrack.Url != "" && !strings.HasPrefix(c.DependencyTrack.Url, "http://") && !strings.HasPrefix(c.DependencyTrack.Url, "https://") {
+		problems = append(problems, fmt.Sprintf("dependencyTrack.url: %q is not an http(s) URL", c.DependencyTrack.Url))
+	}
+	for field, ref := range c.vaultRefs() {
+		if !strings.HasPrefix(field, "registry.") {
+			field = "vault.secrets." + field
+		}
+		if _, err := vaultSecretUri(ref); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", field, err))
+		}
+	}
+	for i, mirror := range c.Registry.Mirrors {
+		if mirror.ImageRef == "" {
+			problems = append(problems, fmt.Sprintf("registry.mirrors[%d]: imageRef is required", i))
+		}
+	}
+	if c.Retry.Attempts < 1 || c.Retry.BackoffSeconds < 0 {
+		problems = append(problems, "retry: attempts must be at least 1 and backoffSeconds can't be negative")
+	}
+	if c.OtlpEndpoint != "" && !strings.HasPrefix(c.OtlpEndpoint, "http://") && !strings.HasPrefix(c.OtlpEndpoint, "https://") {
+		problems = append(problems, fmt.Sprintf("otlpEndpoint: %q is not an http(s) URL", c.OtlpEndpoint))
+	}
+	if c.Notify.Platform != "slack" && c.Notify.Platform != "teams" {
+		problems = append(problems, fmt.Sprintf("notify.platform: invalid platform %q (expected slack or teams)", c.Notify.Platform))
+	}
+
+	severities := []struct {
+		name   string
+		levels []string
+		scale  []string
+	}{
+		{"sast", c.Severities.Sast, semgrepSeverities},
+		{"dependencies", c.Severities.Dependencies, trivySeverities},
+		{"licenses", c.Severities.Licenses, trivySeverities},
+		{"container", c.Severities.Container, trivySeverities},
+	}
+	for _, s := range severities {
+		if len(s.levels) == 0 {
+			problems = append(problems, fmt.Sprintf("severities.%s: at least one level is required", s.name))
+		}
+		for _, level := range s.levels {
+			if !slices.Contains(s.scale, level) {
+				problems = append(problems, fmt.Sprintf("severities.%s: unknown level %q (expected %s)", s.name, level, strings.Join(s.scale, ", ")))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid pipeline config:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// validateStepModes rejects unknown steps and modes
+func validateStepModes(prefix string, steps map[string]string) []string {
+	var problems []string
+	for step, mode := range steps {
+		if _, ok := pipelineStepModes[step]; !ok {
+			problems = append(problems, fmt.Sprintf("%sunknown step %q", prefix, step))
+		} else if mode != "block" && mode != "warn" && mode != "skip" {
+			problems = append(problems, fmt.Sprintf("%sstep %q: invalid mode %q (expected block, warn or skip)", prefix, step, mode))
+		}
+	}
+	return problems
+}
+
+// parseGatePolicy reads step modes given as STEP=MODE (e.g., "licenses=warn")
+func parseGatePolicy(entries []string) (map[string]string, error) {
+	policy := map[string]string{}
+	for _, entry := range entries {
+		step, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid gate policy %q: expected STEP=MODE (e.g., licenses=warn)", entry)
+		}
+		policy[strings.TrimSpace(step)] = strings.TrimSpace(mode)
+	}
+	return policy, nil
+}
+
+// forBranch applies the step modes of the branch patterns matching branch over
+// Steps; an exact branch name wins over the patterns
+func (c *pipelineConfig) forBranch(branch string) {
+	if branch == "" || len(c.Branches) == 0 {
+		return
+	}
+	patterns := slices.Sorted(maps.Keys(c.Branches))
+	slices.SortStableFunc(patterns, func(a, b string) int {
+		return cmp.Compare(boolRank(a == branch), boolRank(b == branch))
+	})
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, branch); !matched {
+			continue
+		}
+		if c.Steps == nil {
+			c.Steps = map[string]string{}
+		}
+		maps.Copy(c.Steps, c.Branches[pattern])
+	}
+}
+
+// boolRank orders false before true
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// loadPipelineConfig reads a pipeline config (YAML or JSON) over the defaults and
+// validates it; unknown keys are rejected
+func loadPipelineConfig(ctx context.Context, file *dagger.File) (*pipelineConfig, error) {
+	var raw json.RawMessage
+	if err := decodeYAML(ctx, file, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load pipeline config: %w", err)
+	}
+
+	config := defaultPipelineConfig()
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		stages  []string
+		want    []string
+		wantErr string
+	}{
+		{"function name", []string{"secret-scan", "sast", "build"}, []string{"secrets", "sast", "build"}, ""},
+		{"needs", []string{"dast"}, []string{"dast", "services", "container-build"}, ""},
+		{"alias with needs", []string{"performance-test"}, []string{"performance", "container-build"}, ""},
+		{"unknown", []string{"secrets", "lint"}, nil, `unknown stage(s) "lint"`},
+		{"none", nil, nil, "at least one stage is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveStages(tt.stages)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]bool{}
+			for _, stage := range tt.want {
+				want[stage] = true
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("resolveStages(%q) = %v, want %v", tt.stages, got, want)
+			}
+		})
+	}
+}
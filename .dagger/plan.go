@@ -0,0 +1,144 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// planMode is the enforcement of a step as the config resolves it
+func (c *pipelineConfig) planMode(step stepSpec) string {
+	if step.id != "" {
+		return c.mode(step.id)
+	}
+	if c.runs(step.stage) {
+		return "always"
+	}
+	return "skip"
+}
+
+// planText renders the resolved pipeline: the steps with their mode, what they
+// enforce and the images they pull, then the files, registries and integrations
+// the config points at. Secrets only appear as their Vault references
+func (c *pipelineConfig) planText(branch string) string {
+	var sb strings.Builder
+	sb.WriteString("# Pipeline plan\n\n")
+	if branch != "" {
+		fmt.Fprintf(&sb, "Branch: %s\n", branch)
+	}
+	if c.stages != nil {
+		sb.WriteString("Stages: " + strings.Join(slices.Sorted(maps.Keys(c.stages)), ", ") + "\n")
+	}
+	sb.WriteString("\n| # | Step | ID | Mode | Enforces | Images |\n|---|---|---|---|---|---|\n")
+
+	var unpinned []string
+	for _, step := range pipelineStepSpecs {
+		detail := ""
+		if step.detail != nil {
+			detail = step.detail(c)
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s |\n",
+			step.number, step.title, cmp.Or(step.id, "-"), c.planMode(step), cmp.Or(detail, "-"), cmp.Or(strings.Join(step.images, "<br>"), "-"))
+		for _, image := range step.images {
+			if (strings.HasSuffix(image, ":latest") || strings.HasSuffix(image, ":stable")) && !slices.Contains(unpinned, image) {
+				unpinned = append(unpinned, image)
+			}
+		}
+	}
+
+	sb.WriteString("\n## Inputs\n\n")
+	files := [][2]string{
+		{"Risk register", c.RiskRegister},
+		{"Vulnerability waivers", c.VulnWaivers},
+		{"License policy", c.LicensePolicy},
+		{"Security baseline", c.SecurityBaseline},
+		{"Solr fixtures", c.SolrFixtures},
+		{"Offline assets", c.OfflineAssets},
+	}
+	for _, file := range files {
+		fmt.Fprintf(&sb, "- %s: %s\n", file[0], cmp.Or(file[1], "none"))
+	}
+	if c.MaxParallel > 0 {
+		fmt.Fprintf(&sb, "- Parallel steps: at most %d\n", c.MaxParallel)
+	}
+	fmt.Fprintf(&sb, "- Retries: %d attempt(s), %vs backoff\n", c.Retry.Attempts, c.Retry.BackoffSeconds)
+
+	sb.WriteString("\n## Release\n\n")
+	if c.Registry.ImageRef == "" {
+		sb.WriteString("- Registry: none configured (credentials and imageRef come from the arguments)\n")
+	} else {
+		fmt.Fprintf(&sb, "- Registry: %s (%s)\n", c.Registry.ImageRef, cmp.Or(c.Registry.Url, "registry of the image ref"))
+	}
+	fmt.Fprintf(&sb, "- Tag: %s\n", cmp.Or(c.Registry.Tag, "computed version"))
+	for i, mirror := range c.Registry.Mirrors {
+		credentials := "no credentials"
+		if mirror.Username != "" || mirror.Password != "" {
+			credentials = "credentials from Vault " + strings.Join([]string{mirror.Username, mirror.Password}, ", ")
+		}
+		fmt.Fprintf(&sb, "- Mirror %d: %s (%s)\n", i+1, mirror.ImageRef, credentials)
+	}
+
+	sb.WriteString("\n## Integrations\n\n")
+	fmt.Fprintf(&sb, "- Notifications: %s", c.Notify.Platform)
+	if c.Notify.Channel != "" {
+		fmt.Fprintf(&sb, " (%s)", c.Notify.Channel)
+	}
+	sb.WriteString(", when a webhook is given\n")
+	fmt.Fprintf(&sb, "- OpenTelemetry: %s\n", cmp.Or(c.OtlpEndpoint, "off"))
+	if refs := c.vaultRefs(); len(refs) > 0 {
+		sb.WriteString("- Vault (with --from-vault):\n")
+		for _, field := range slices.Sorted(maps.Keys(refs)) {
+			fmt.Fprintf(&sb, "  - %s ← %s\n", field, refs[field])
+		}
+	}
+
+	if len(unpinned) > 0 {
+		sb.WriteString("\n## Floating image tags\n\nThese resolve to whatever the registry serves at run time:\n\n")
+		for _, image := range unpinned {
+			fmt.Fprintf(&sb, "- %s\n", image)
+		}
+	}
+	return sb.String()
+}
+
+// Plan resolves a pipeline config the way FullPipelineFromConfig does and lists the
+// steps in order, with their mode, what they enforce and the images they'd pull,
+// without running anything, so a change to pipeline.yaml can be reviewed in its PR
+func (m *SearchApi) Plan(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Pipeline config (YAML or JSON)
+	// +defaultPath="/pipeline.yaml"
+	config *dagger.File,
+	// Branch selecting the config's branch step modes (defaults to the checked out branch)
+	// +optional
+	branch string,
+	// Stages to plan as RunStages would (e.g., "secrets,sast,build"); empty plans
+	// the full pipeline
+	// +optional
+	stages []string,
+) (string, error) {
+	resolved, err := loadPipelineConfig(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	if branch == "" && len(resolved.Branches) > 0 {
+		if checkout, err := gitSource(ctx, source); err == nil {
+			branch = strings.TrimPrefix(checkout.ref, "refs/heads/")
+		}
+	}
+	resolved.forBranch(branch)
+	if len(stages) > 0 {
+		resolved.stages, err = resolveStages(stages)
+		if err != nil {
+			return "", err
+		}
+	}
+	return resolved.planText(branch), nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pipelineCommentMarker identifies the pipeline's comment, so re-runs update it
+const pipelineCommentMarker = "<!-- search-api-pipeline-report -->"
+
+// pullRequestComments abstracts the comment operations CommentOnPullRequest needs
+type pullRequestComments interface {
+	// find returns the ID of the comment carrying the marker ("" when there is none)
+	find(ctx context.Context) (string, error)
+	create(ctx context.Context, body string) error
+	update(ctx context.Context, id, body string) error
+}
+
+// pipelineComment renders the PR comment: gate results and, when given, the
+// container size comparison
+func pipelineComment(report reportView, sizes []*SizeComparison, reportsUrl string) string {
+	var sb strings.Builder
+	sb.WriteString(pipelineCommentMarker + "\n")
+	sb.WriteString(report.markdown())
+	if report.Image != "" {
+		fmt.Fprintf(&sb, "\n**Image:** `%s`\n", report.Image)
+	}
+	if len(sizes) > 0 {
+		sb.WriteString("\n### Container size\n\n")
+		sb.WriteString("| Variant | Compressed | Uncompressed | Layers | Efficiency | CVEs (HIGH/CRITICAL) |\n")
+		sb.WriteString("|---------|------------|--------------|--------|------------|----------------------|\n")
+		for _, s := range sizes {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %d | %.1f%% | %d (%d) |\n", s.Variant,
+				megabytes(s.CompressedBytes), megabytes(s.UncompressedBytes), s.Layers, s.Efficiency*100, s.Cves, s.HighCriticalCves)
+		}
+	}
+	if reportsUrl != "" {
+		fmt.Fprintf(&sb, "\n[Full reports](%s)\n", reportsUrl)
+	}
+	return sb.String()
+}
+
+// githubComments manages the pipeline comment on a GitHub pull request
+type githubComments struct {
+	apiUrl string
+	repo   string
+	number int
+	token  *dagger.Secret
+}
+
+func (g *githubComments) request(method, path string, payload any) (httpRequest, error) {
+	req := httpRequest{
+		method: method,
+		url:    fmt.Sprintf("%s/repos/%s%s", g.apiUrl, g.repo, path),
+		headers: []string{
+			"Accept: application/vnd.github+json",
+			"X-GitHub-Api-Version: 2022-11-28",
+		},
+		token:      g.token,
+		authPrefix: "Authorization: Bearer",
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return req, err
+		}
+		req.body = string(body)
+		req.headers = append(req.headers, "Content-Type: application/json")
+	}
+	return req, nil
+}
+
+func (g *githubComments) find(ctx context.Context) (string, error) {
+	for page := 1; ; page++ {
+		req, _ := g.request("GET", fmt.Sprintf("/issues/%d/comments?per_page=100&page=%d", g.number, page), nil)
+		response, err := req.do(ctx)
+		if err != nil {
+			return "", err
+		}
+		var comments []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(response), &comments); err != nil {
+			return "", fmt.Errorf("unexpected GitHub response: %w", err)
+		}
+		for _, c := range comments {
+			if strings.Contains(c.Body, pipelineCommentMarker) {
+				return strconv.FormatInt(c.ID, 10), nil
+			}
+		}
+		if len(comments) < 100 {
+			return "", nil
+		}
+	}
+}
+
+func (g *githubComments) create(ctx context.Context, body string) error {
+	req, err := g.request("POST", fmt.Sprintf("/issues/%d/comments", g.number), map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (g *githubComments) update(ctx context.Context, id, body string) error {
+	req, err := g.request("PATCH", "/issues/comments/"+id, map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+// gitlabNotes manages the pipeline comment (note) on a GitLab merge request
+type gitlabNotes struct {
+	apiUrl  string
+	project string
+	iid     int
+	token   *dagger.Secret
+}
+
+func (g *gitlabNotes) request(method, path string, payload any) (httpRequest, error) {
+	req := httpRequest{
+		method:     method,
+		url:        fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes%s", g.apiUrl, url.PathEscape(g.project), g.iid, path),
+		headers:    []string{"Accept: application/json"},
+		token:      g.token,
+		authPrefix: "PRIVATE-TOKEN:",
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return req, err
+		}
+		req.body = string(body)
+		req.headers = append(req.headers, "Content-Type: application/json")
+	}
+	return req, nil
+}
+
+func (g *gitlabNotes) find(ctx context.Context) (string, error) {
+	for page := 1; ; page++ {
+		req, _ := g.request("GET", fmt.Sprintf("?per_page=100&page=%d", page), nil)
+		response, err := req.do(ctx)
+		if err != nil {
+			return "", err
+		}
+		var notes []struct {
+			ID   int64  `json:"id"`
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(response), &notes); err != nil {
+			return "", fmt.Errorf("unexpected GitLab response: %w", err)
+		}
+		for _, n := range notes {
+			if strings.Contains(n.Body, pipelineCommentMarker) {
+				return strconv.FormatInt(n.ID, 10), nil
+			}
+		}
+		if len(notes) < 100 {
+			return "", nil
+		}
+	}
+}
+
+func (g *gitlabNotes) create(ctx context.Context, body string) error {
+	req, err := g.request("POST", "", map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+func (g *gitlabNotes) update(ctx context.Context, id, body string) error {
+	req, err := g.request("PUT", "/"+id, map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = req.do(ctx)
+	return err
+}
+
+// CommentOnPullRequest posts the pipeline's gate results (and container size
+// comparison) as a comment on a GitHub pull request or GitLab merge request
+// Re-runs update the existing comment instead of adding another one
+func (m *SearchApi) CommentOnPullRequest(
+	ctx context.Context,
+	// GitHub token (pull requests write) or GitLab token (api scope)
+	token *dagger.Secret,
+	// GitHub repository (owner/repo) or GitLab project path (group/project)
+	repo string,
+	// Pull request number or merge request IID
+	pullRequest int,
+	// Pipeline report JSON (output of FullPipeline's json)
+	report string,
+	// Platform: github or gitlab
+	// +default="github"
+	platform string,
+	// Container size comparison JSON (output of compare-container-sizes json)
+	// +optional
+	sizes string,
+	// Link to the pipeline's reports (e.g., the CI run's artifacts)
+	// +optional
+	reportsUrl string,
+	// API base URL (GitHub Enterprise Server or self-managed GitLab, e.g. "https://gitlab.example.com/api/v4")
+	// +optional
+	apiUrl string,
+) (string, error) {
+	var view reportView
+	if err := json.Unmarshal([]byte(report), &view); err != nil {
+		return "", fmt.Errorf("invalid pipeline report: %w", err)
+	}
+	var comparison ContainerSizeComparison
+	if sizes != "" {
+		if err := json.Unmarshal([]byte(sizes), &comparison); err != nil {
+			return "", fmt.Errorf("invalid size comparison: %w", err)
+		}
+	}
+
+	var comments pullRequestComments
+	switch platform {
+	case "github":
+		if apiUrl == "" {
+			apiUrl = "https://api.github.com"
+		}
+		comments = &githubComments{apiUrl: strings.TrimSuffix(apiUrl, "/"), repo: repo, number: pullRequest, token: token}
+	case "gitlab":
+		if apiUrl == "" {
+			apiUrl = "https://gitlab.com/api/v4"
+		}
+		comments = &gitlabNotes{apiUrl: strings.TrimSuffix(apiUrl, "/"), project: repo, iid: pullRequest, token: token}
+	default:
+		return "", fmt.Errorf("unknown platform %q (expected github or gitlab)", platform)
+	}
+
+	body := pipelineComment(view, comparison.Variants, reportsUrl)
+	id, err := comments.find(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list comments: %w", err)
+	}
+	if id != "" {
+		if err := comments.update(ctx, id, body); err != nil {
+			return "", fmt.Errorf("failed to update comment %s: %w", id, err)
+		}
+		return fmt.Sprintf("Updated pipeline comment %s on %s#%d\n", id, repo, pullRequest), nil
+	}
+	if err := comments.create(ctx, body); err != nil {
+		return "", fmt.Errorf("failed to create comment: %w", err)
+	}
+	return fmt.Sprintf("Posted pipeline comment on %s#%d\n", repo, pullRequest), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cosignImage copies images together with their signatures and attestations
+const cosignImage = "gcr.io/projectsigstore/cosign:latest"
+
+// registryHost returns the registry of an image reference, as Docker config keys name
+// it; references without one are on Docker Hub
+func registryHost(ref string) string {
+	host, _, found := strings.Cut(ref, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "https://index.docker.io/v1/"
+	}
+	return host
+}
+
+// registryCredentials reads a username and pairs it with the password, or returns
+// nil when either is missing (anonymous access)
+func registryCredentials(ctx context.Context, ref string, username, password *dagger.Secret) (*registryLogin, error) {
+	if username == nil || password == nil {
+		return nil, nil
+	}
+	name, err := username.Plaintext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the username for %s: %w", registryHost(ref), err)
+	}
+	return &registryLogin{registryHost(ref), name, password}, nil
+}
+
+// PromoteImage copies an image that was pushed, scanned and signed in a staging
+// registry to the production registry by digest, together with its cosign
+// signatures, attestations and attached SBOMs, so production runs exactly the bytes
+// that were verified and their signatures still verify there
+func (m *SearchApi) PromoteImage(
+	ctx context.Context,
+	// Image in the staging registry, pinned by digest (e.g., "staging.example.com/search-api@sha256:...")
+	sourceRef string,
+	// Destination with tag (e.g., "ghcr.io/myorg/search-api:v1.4.2")
+	destRef string,
+	// Staging registry username
+	// +optional
+	sourceUsername *dagger.Secret,
+	// Staging registry password or token
+	// +optional
+	sourcePassword *dagger.Secret,
+	// Production registry username
+	// +optional
+	destUsername *dagger.Secret,
+	// Production registry password or token
+	// +optional
+	destPassword *dagger.Secret,
+) (*PushedImage, error) {
+	sourceRepository, digest, found := strings.Cut(sourceRef, "@")
+	if !found || !digestPattern.MatchString(digest) {
+		return nil, fmt.Errorf("source %q must be pinned by digest (repository@sha256:...)", sourceRef)
+	}
+	i := strings.LastIndex(destRef, ":")
+	if i <= strings.LastIndex(destRef, "/") || strings.Contains(destRef, "@") {
+		return nil, fmt.Errorf("destination %q must be repository:tag", destRef)
+	}
+	destRepository, tag := destRef[:i], destRef[i+1:]
+
+	sourceLogin, err := registryCredentials(ctx, sourceRepository, sourceUsername, sourcePassword)
+	if err != nil {
+		return nil, err
+	}
+	destLogin, err := registryCredentials(ctx, destRepository, destUsername, destPassword)
+	if err != nil {
+		return nil, err
+	}
+	var logins []registryLogin
+	for _, login := range []*registryLogin{sourceLogin, destLogin} {
+		if login != nil {
+			logins = append(logins, *login)
+		}
+	}
+
+	copier := dag.Container().
+		From(cosignImage).
+		WithEnvVariable("CACHEBUSTER", time.Now().String())
+	if len(logins) > 0 {
+		dockerConfig, err := registryAuthConfigs(ctx, logins...)
+		if err != nil {
+			return nil, err
+		}
+		copier = copier.
+			WithMountedSecret("/docker/config.json", dockerConfig).
+			WithEnvVariable("DOCKER_CONFIG", "/docker")
+	}
+	// cosign copy brings the .sig, .att and .sbom tags of the digest along
+	if _, err := copier.WithExec([]string{"cosign", "copy", "--force", sourceRef, destRef}).Sync(ctx); err != nil {
+		return nil, fmt.Errorf("failed to promote %s to %s: %w", sourceRef, destRef, err)
+	}
+
+	// A registry that rewrote the manifest would break the signatures
+	var destUser string
+	if destLogin != nil {
+		destUser = destLogin.username
+	}
+	promoted, err := remoteTagDigest(ctx, destRef, destUser, destPassword)
+	if err != nil {
+		return nil, err
+	}
+	if promoted != digest {
+		return nil, fmt.Errorf("%s has digest %s after promotion, expected %s", destRef, promoted, digest)
+	}
+
+	return &PushedImage{
+		Address:    destRef + "@" + digest,
+		Repository: destRepository,
+		Tags:       []string{tag},
+		Digest:     digest,
+		Ref:        destRepository + "@" + digest,
+	}, nil
+}
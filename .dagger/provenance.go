@@ -0,0 +1,287 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// provenancePredicateType is the cosign predicate type of SLSA v1 provenance
+const provenancePredicateType = "slsaprovenance1"
+
+// scpLikeRemote matches git remotes such as "git@github.com:myorg/search-api.git"
+var scpLikeRemote = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// slsaProvenance is a SLSA v1 provenance predicate, the format cosign attests as
+// "slsaprovenance1"
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string            `json:"buildType"`
+		ExternalParameters   map[string]string `json:"externalParameters"`
+		ResolvedDependencies []slsaDependency  `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId,omitempty"`
+			StartedOn    string `json:"startedOn"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// slsaDependency is an artifact the build consumed, identified by digest
+type slsaDependency struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// provenanceSource is the commit a build ran from
+type provenanceSource struct {
+	repo string
+	ref  string
+	sha  string
+}
+
+// uri is the source in SPDX download location form (git+https://host/repo@ref)
+func (s provenanceSource) uri() string {
+	uri := "git+" + s.repo
+	if s.ref != "" {
+		uri += "@" + s.ref
+	}
+	return uri
+}
+
+// normalizeRemote turns a git remote into an https URL without credentials, so a
+// token in the CI checkout URL never ends up in a published attestation
+func normalizeRemote(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if m := scpLikeRemote.FindStringSubmatch(remote); m != nil {
+		remote = "https://" + m[1] + "/" + m[2]
+	}
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		u.User = nil
+		if u.Scheme == "ssh" || u.Scheme == "git" {
+			u.Scheme = "https"
+			u.Host = u.Hostname()
+		}
+		remote = u.String()
+	}
+	return strings.TrimSuffix(remote, ".git")
+}
+
+// gitSource reads the remote, ref and commit of a checkout; in a detached checkout
+// the ref is the tag pointing at HEAD, if any
+func gitSource(ctx context.Context, repo *dagger.Directory) (provenanceSource, error) {
+	output, err := dag.Container().
+		From(gitImage).
+		WithDirectory("/repo", repo).
+		WithWorkdir("/repo").
+		WithExec([]string{"sh", "-c", `set -e
+sha=$(git rev-parse HEAD)
+remote=$(git config --get remote.origin.url || true)
+ref=$(git symbolic-ref -q HEAD || { tag=$(git describe --tags --exact-match 2>/dev/null) && echo "refs/tags/$tag"; } || true)
+printf '%s\n%s\n%s\n' "$sha" "$remote" "$ref"`}).
+		Stdout(ctx)
+	if err != nil {
+		return provenanceSource{}, fmt.Errorf("failed to read git source: %w", err)
+	}
+	lines := strings.Split(output, "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	return provenanceSource{
+		repo: normalizeRemote(lines[1]),
+		ref:  strings.TrimSpace(lines[2]),
+		sha:  strings.TrimSpace(lines[0]),
+	}, nil
+}
+
+// newProvenance builds the provenance of a build of source by the given function
+func newProvenance(function string, source provenanceSource, parameters map[string]string, invocationId string, startedOn, finishedOn time.Time) *slsaProvenance {
+	p := &slsaProvenance{}
+	p.BuildDefinition.BuildType = provenanceBuilder + "/" + function + "@v1"
+	p.BuildDefinition.ExternalParameters = map[string]string{
+		"repository": source.repo,
+		"ref":        source.ref,
+	}
+	for key, value := range parameters {
+		p.BuildDefinition.ExternalParameters[key] = value
+	}
+	p.BuildDefinition.ResolvedDependencies = []slsaDependency{{
+		URI:    source.uri(),
+		Digest: map[string]string{"gitCommit": source.sha},
+	}}
+	p.RunDetails.Builder.ID = provenanceBuilder
+	p.RunDetails.Metadata.InvocationID = invocationId
+	p.RunDetails.Metadata.StartedOn = startedOn.UTC().Format(time.RFC3339)
+	p.RunDetails.Metadata.FinishedOn = finishedOn.UTC().Format(time.RFC3339)
+	return p
+}
+
+// validateProvenance checks the fields SLSA verifiers require: the builder, the
+// build type and the source commit the image was built from
+func validateProvenance(content string) error {
+	var p slsaProvenance
+	if err := json.Unmarshal([]byte(content), &p); err != nil {
+		return fmt.Errorf("provenance is not valid JSON: %w", err)
+	}
+	var problems []string
+	if p.RunDetails.Builder.ID == "" {
+		problems = append(problems, "runDetails.builder.id")
+	}
+	if p.BuildDefinition.BuildType == "" {
+		problems = append(problems, "buildDefinition.buildType")
+	}
+	hasCommit := false
+	for _, d := range p.BuildDefinition.ResolvedDependencies {
+		hasCommit = hasCommit || d.Digest["gitCommit"] != ""
+	}
+	if !hasCommit {
+		problems = append(problems, "a resolved dependency with a gitCommit digest")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid SLSA v1 provenance: missing %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// GenerateProvenance produces a SLSA v1 provenance predicate for a build of the
+// repository: builder, source repository, ref and commit, build parameters and times
+// The source is read from the checkout unless given, e.g. by CI in a shallow clone
+func (m *SearchApi) GenerateProvenance(
+	ctx context.Context,
+	// Repository including .git
+	// +defaultPath="/"
+	repo *dagger.Directory,
+	// Source repository URL (defaults to the origin remote, without credentials)
+	// +optional
+	sourceRepo string,
+	// Source ref (e.g., "refs/heads/main"; defaults to the checked out branch or tag)
+	// +optional
+	ref string,
+	// Source commit SHA (defaults to HEAD)
+	// +optional
+	sha string,
+	// Build parameters as KEY=VALUE (e.g., "tag=v1.2.0")
+	// +optional
+	parameters []string,
+	// Build start time, RFC 3339 (defaults to the finish time)
+	// +optional
+	startedOn string,
+	// Build finish time, RFC 3339 (defaults to now)
+	// +optional
+	finishedOn string,
+	// ID of the CI run (e.g., its URL), so the provenance can be traced back to it
+	// +optional
+	invocationId string,
+) (*dagger.File, error) {
+	source := provenanceSource{repo: normalizeRemote(sourceRepo), ref: ref, sha: sha}
+	if sourceRepo == "" || ref == "" || sha == "" {
+		detected, err := gitSource(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+		source.repo = cmp.Or(source.repo, detected.repo)
+		source.ref = cmp.Or(source.ref, detected.ref)
+		source.sha = cmp.Or(source.sha, detected.sha)
+	}
+	if source.repo == "" {
+		return nil, fmt.Errorf("the repository has no origin remote: sourceRepo is required")
+	}
+
+	params := map[string]string{}
+	for _, p := range parameters {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid parameter %q: expected KEY=VALUE", p)
+		}
+		params[key] = value
+	}
+
+	finished := time.Now()
+	if finishedOn != "" {
+		t, err := time.Parse(time.RFC3339, finishedOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid finishedOn: %w", err)
+		}
+		finished = t
+	}
+	started := finished
+	if startedOn != "" {
+		t, err := time.Parse(time.RFC3339, startedOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startedOn: %w", err)
+		}
+		started = t
+	}
+	if started.After(finished) {
+		return nil, fmt.Errorf("startedOn %s is after finishedOn %s", startedOn, finishedOn)
+	}
+
+	content, err := json.MarshalIndent(newProvenance("GenerateProvenance", source, params, invocationId, started, finished), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().WithNewFile("provenance.json", string(content)).File("provenance.json"), nil
+}
+
+// AttestProvenance attaches a SLSA v1 provenance predicate to an image with Cosign
+// The image must be referenced by digest, so a tag moved in between can't end up
+// with another build's provenance
+func (m *SearchApi) AttestProvenance(
+	ctx context.Context,
+	// SLSA v1 provenance predicate (see GenerateProvenance)
+	provenance *dagger.File,
+	// Private key for signing (use cosign generate-key-pair to create)
+	privateKey *dagger.Secret,
+	// Password for the private key
+	keyPassword *dagger.Secret,
+	// Image reference pinned by digest (e.g., "ghcr.io/myorg/search-api@sha256:...")
+	imageRef string,
+	// Upload the attestation to the transparency log (Rekor)
+	// +default=false
+	tlogUpload bool,
+	// Registry holding the image, for private registries
+	// +optional
+	registryUrl string,
+	// +optional
+	username string,
+	// +optional
+	password *dagger.Secret,
+) (string, error) {
+	if _, digest, _ := strings.Cut(imageRef, "@"); !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("image %s must be referenced by digest (<repository>@sha256:...)", imageRef)
+	}
+	content, err := provenance.Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read provenance: %w", err)
+	}
+	if err := validateProvenance(content); err != nil {
+		return "", err
+	}
+
+	opts := dagger.CosignAttestOpts{
+		PredicateType: provenancePredicateType,
+		TlogUpload:    tlogUpload,
+	}
+	if password != nil {
+		opts.DockerConfig, err = registryAuthConfig(ctx, registryUrl, username, password)
+		if err != nil {
+			return "", err
+		}
+	}
+	output, err := dag.Cosign().Attest(ctx, provenance, privateKey, keyPassword, imageRef, opts)
+	if err != nil {
+		return "", fmt.Errorf("provenance attestation failed: %w", err)
+	}
+	return output, nil
+}
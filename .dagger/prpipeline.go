@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+// prPipelineStages are the quick stages PrPipeline runs; the container build and
+// everything that needs the running API are left to FullPipeline
+var prPipelineStages = []string{"secrets", "sast", "build", "formatting"}
+
+// changedFiles lists the files added or modified since the merge base with baseRef
+func changedFiles(ctx context.Context, source *dagger.Directory, baseRef string) ([]string, error) {
+	output, err := dag.Container().
+		From(gitImage).
+		WithDirectory("/src", source).
+		WithWorkdir("/src").
+		WithExec([]string{"git", "config", "--global", "--add", "safe.directory", "*"}).
+		WithExec([]string{"git", "diff", "--name-only", "--diff-filter=d", "--no-color", baseRef + "...HEAD"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s (source must include .git history): %w", baseRef, err)
+	}
+	files := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// PrPipeline is the fast pipeline for pull request feedback: secret scanning, SAST
+// and the formatting check only look at the files changed since the base branch,
+// next to the build and unit tests
+// The container build, container scans and DAST are skipped, so it finishes in
+// minutes; FullPipeline still runs everything before merging or releasing
+func (m *SearchApi) PrPipeline(
+	ctx context.Context,
+	// Repository including .git history, to diff against the base branch
+	// +defaultPath="/"
+	source *dagger.Directory,
+	// Base branch of the pull request
+	// +default="origin/main"
+	baseRef string,
+	// Pipeline config for modes and thresholds (e.g., pipeline.yaml)
+	// +optional
+	configFile *dagger.File,
+) (*PipelineReport, error) {
+	config := defaultPipelineConfig()
+	if configFile != nil {
+		var err error
+		if config, err = loadPipelineConfig(ctx, configFile); err != nil {
+			return nil, err
+		}
+	}
+	selected, err := resolveStages(prPipelineStages)
+	if err != nil {
+		return nil, err
+	}
+	config.stages = selected
+	if config.changedFiles, err = changedFiles(ctx, source, baseRef); err != nil {
+		return nil, err
+	}
+
+	report, err := m.runPipeline(ctx, source, config, nil, nil, nil, nil, nil, config.inputs(source))
+	if report != nil {
+		report.Text = fmt.Sprintf("🔀 %d file(s) changed since %s\n", len(config.changedFiles), baseRef) + report.Text
+	}
+	return report, err
+}
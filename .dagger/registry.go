@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// Local registry storage, shared by every pipeline on the same engine
+const (
+	localRegistryVolume  = "search-api-local-registry"
+	localRegistryStorage = "/var/lib/registry"
+)
+
+// RetagImage adds tags to an image already in the registry, addressed by digest,
+// without rebuilding or re-scanning it (hotfix rollbacks, release aliases like "stable")
+// Digests are preserved, so every new tag points at exactly the image that was scanned
+func (m *SearchApi) RetagImage(
+	ctx context.Context,
+	// Image repository without tag (e.g., "ghcr.io/myorg/search-api")
+	imageRef string,
+	// Digest of the image to tag (e.g., "sha256:...")
+	digest string,
+	// Tags to add (e.g., ["v1.4.2", "stable"])
+	tags []string,
+	// Registry username
+	// +optional
+	registryUsername *dagger.Secret,
+	// Registry password or token
+	// +optional
+	registryPassword *dagger.Secret,
+) (string, error) {
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("invalid digest %q: expected sha256:<64 hex chars>", digest)
+	}
+	if i := strings.LastIndex(imageRef, ":"); i > strings.LastIndex(imageRef, "/") {
+		return "", fmt.Errorf("image reference %q must not include a tag", imageRef)
+	}
+
+	opts := dagger.SkopeoTagOpts{}
+	if registryUsername != nil && registryPassword != nil {
+		username, err := registryUsername.Plaintext(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read username: %w", err)
+		}
+		opts.Username = username
+		opts.Password = registryPassword
+	}
+
+	report := "🏷️  Retagging image by digest (no rebuild)...\n"
+	output, err := dag.Skopeo().Tag(ctx, imageRef, digest, tags, opts)
+	if err != nil {
+		return report, fmt.Errorf("failed to retag %s@%s: %w", imageRef, digest, err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		report += "   • " + line + "\n"
+	}
+
+	report += fmt.Sprintf("✅ %s@%s tagged as %s\n", imageRef, digest, strings.Join(tags, ", "))
+	return report, nil
+}
+
+// PushedImage is an image published by PushToRegistry
+type PushedImage struct {
+	// Address returned by the registry (registry/repo:tag@sha256:...)
+	Address string
+	// Repository without tag (e.g., "ghcr.io/myorg/search-api")
+	Repository string
+	// Tags that were pushed, the primary tag first
+	Tags []string
+	// Manifest digest (sha256:...)
+	Digest string
+	// Reference pinned by digest (repository@digest)
+	Ref string
+	// Tag holding the keyless cosign signature ("" when not signed)
+	Signature string
+
+	// A report line per push attempt that failed on a network error
+	retries string
+}
+
+// registryDestination is a registry an image is published to
+type registryDestination struct {
+	url      string
+	imageRef string
+	username *dagger.Secret
+	password *dagger.Secret
+}
+
+// registryDestinations pairs image repositories with their credentials by position;
+// each repository's registry is taken from its reference
+func registryDestinations(imageRefs []string, usernames, passwords []*dagger.Secret) ([]registryDestination, error) {
+	if len(usernames) != len(imageRefs) || len(passwords) != len(imageRefs) {
+		return nil, fmt.Errorf("%d registries need as many usernames and passwords (got %d and %d)", len(imageRefs), len(usernames), len(passwords))
+	}
+	var destinations []registryDestination
+	for i, ref := range imageRefs {
+		if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") || strings.Contains(ref, "@") {
+			return nil, fmt.Errorf("image reference %q must not include a tag or digest", ref)
+		}
+		destinations = append(destinations, registryDestination{url: registryHost(ref), imageRef: ref, username: usernames[i], password: passwords[i]})
+	}
+	return destinations, nil
+}
+
+// pushAndSign pushes the image to one destination and, given an OIDC token, signs
+// the pushed digest keyless there, so the signature verifies in every registry
+func (m *SearchApi) pushAndSign(ctx context.Context, config *pipelineConfig, container *dagger.Container, destination registryDestination, tag string, additionalTags []string, releaseNotes *dagger.File, signingOidcToken *dagger.Secret) (*PushedImage, error) {
+	pushed, err := m.pushToRegistry(ctx, config, container, destination.url, destination.username, destination.password, destination.imageRef, tag, releaseNotes, false, additionalTags, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", destination.imageRef, err)
+	}
+	if signingOidcToken != nil {
+		signed, err := m.SignImageKeyless(ctx, pushed.Ref, signingOidcToken, destination.url, destination.username, destination.password, sigstoreFulcioUrl, sigstoreRekorUrl)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", destination.imageRef, err)
+		}
+		pushed.Signature = signed.Signature
+	}
+	return pushed, nil
+}
+
+// PushToRegistries publishes the image to several registries in one step (e.g.,
+// Harbor and a GHCR mirror) and, given an OIDC token, signs it keyless in each,
+// returning every pushed image with its digest. Registries, usernames and passwords
+// are matched by position. Every registry must end up with the same digest
+func (m *SearchApi) PushToRegistries(
+	ctx context.Context,
+	container *dagger.Container,
+	// Image repositories including the registry (e.g., ["harbor.example.com/myproject/search-api", "ghcr.io/myorg/search-api"])
+	imageRefs []string,
+	// Username for each registry
+	usernames []*dagger.Secret,
+	// Password or token for each registry
+	passwords []*dagger.Secret,
+	tag string,
+	// More tags for the same digest (e.g., short SHA, "latest")
+	// +optional
+	additionalTags []string,
+	// Attempts for registry pushes failing on network errors (exponential backoff)
+	// +default=3
+	retries int,
+	// OIDC identity token to sign every pushed image keyless (see SignImageKeyless)
+	// +optional
+	signingOidcToken *dagger.Secret,
+) ([]*PushedImage, error) {
+	destinations, err := registryDestinations(imageRefs, usernames, passwords)
+	if err != nil {
+		return nil, err
+	}
+	var pushed []*PushedImage
+	for _, destination := range destinations {
+		image, err := m.pushAndSign(ctx, retryPolicy(retries), container, destination, tag, additionalTags, nil, signingOidcToken)
+		if err != nil {
+			return pushed, err
+		}
+		if len(pushed) > 0 && image.Digest != pushed[0].Digest {
+			return pushed, fmt.Errorf("%s has digest %s, but %s has %s", image.Repository, image.Digest, pushed[0].Repository, pushed[0].Digest)
+		}
+		pushed = append(pushed, image)
+	}
+	return pushed, nil
+}
+
+// splitImageAddress splits a published address (registry/repo:tag@sha256:...) into
+// the repository and the digest
+func splitImageAddress(address string) (repository string, digest string, err error) {
+	repository, digest, ok := strings.Cut(address, "@")
+	if !ok || !digestPattern.MatchString(digest) {
+		return "", "", fmt.Errorf("published address %q has no sha256 digest", address)
+	}
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	return repository, digest, nil
+}
+
+// localImageDigest returns the manifest digest the container will have when published,
+// read from the OCI index of its tarball export
+func localImageDigest(ctx context.Context, container *dagger.Container) (string, error) {
+	index, err := dag.Container().
+		From("alpine:latest").
+		WithMountedFile("/image.tar", container.AsTarball()).
+		WithExec([]string{"tar", "-xOf", "/image.tar", "index.json"}).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image index: %w", err)
+	}
+	var oci struct {
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal([]byte(index), &oci); err != nil || len(oci.Manifests) == 0 {
+		return "", fmt.Errorf("invalid OCI image index")
+	}
+	return oci.Manifests[0].Digest, nil
+}
+
+// remoteTagDigest returns the digest a tag currently points at, or "" when the tag
+// doesn't exist
+func remoteTagDigest(ctx context.Context, ref string, username string, password *dagger.Secret) (string, error) {
+	output, err := dag.Skopeo().Inspect(ctx, "docker://"+ref, dagger.SkopeoInspectOpts{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		message := strings.ToLower(err.Error())
+		if strings.Contains(message, "manifest unknown") || strings.Contains(message, "not found") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to inspect %s: %w", ref, err)
+	}
+	var inspect struct {
+		Digest string `json:"Digest"`
+	}
+	if err := json.Unmarshal([]byte(output), &inspect); err != nil {
+		return "", fmt.Errorf("invalid skopeo inspect output for %s: %w", ref, err)
+	}
+	return inspect.Digest, nil
+}
+
+// localRegistryCertScript creates a CA and a registry certificate signed by it, valid
+// for the "registry" service alias and localhost
+const localRegistryCertScript = `set -e
+apk add --no-cache openssl >/dev/null
+mkdir -p /certs && cd /certs
+openssl req -x509 -newkey rsa:2048 -nodes -days 3650 -subj "/CN=Local Registry CA" -keyout ca.key -out ca.crt
+openssl req -newkey rsa:2048 -nodes -subj "/CN=registry" -keyout registry.key -out registry.csr
+echo "subjectAltName=DNS:registry,DNS:localhost,IP:127.0.0.1" > san.ext
+openssl x509 -req -in registry.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days 3650 -extfile san.ext -out registry.crt
+rm ca.key ca.srl registry.csr san.ext
+`
+
+// localRegistryCerts returns ca.crt, registry.crt and registry.key
+// The generating exec is cached, so the registry and its clients agree on the same CA
+func localRegistryCerts() *dagger.Directory {
+	return dag.Container().
+		From("alpine:latest").
+		WithExec([]string{"sh", "-c", localRegistryCertScript}).
+		Directory("/certs")
+}
+
+// localRegistryHtpasswd returns a bcrypt htpasswd file for a single user
+func localRegistryHtpasswd(username string, password *dagger.Secret) *dagger.File {
+	return dag.Container().
+		From("alpine:latest").
+		WithExec([]string{"apk", "add", "--no-cache", "apache2-utils"}).
+		WithEnvVariable("REGISTRY_USERNAME", username).
+		WithSecretVariable("REGISTRY_PASSWORD", password).
+		WithExec([]string{"sh", "-c", `htpasswd -Bbn "$REGISTRY_USERNAME" "$REGISTRY_PASSWORD" > /htpasswd`}).
+		File("/htpasswd")
+}
+
+// LocalRegistryCa returns the CA certificate that signs the local registry's TLS certificate
+func (m *SearchApi) LocalRegistryCa() *dagger.File {
+	return localRegistryCerts().File("ca.crt")
+}
+
+// TrustLocalRegistry installs the local registry CA into a container so registry
+// clients verify TLS instead of needing --tls-verify=false:
+// containers/image tools (skopeo, podman, buildah) and Docker read certs.d, and
+// Go-based tools (oras, crane, cosign) read SSL_CERT_DIR in addition to the system bundle
+func (m *SearchApi) TrustLocalRegistry(container *dagger.Container) *dagger.Container {
+	ca := m.LocalRegistryCa()
+	return container.
+		WithMountedFile("/etc/containers/certs.d/registry:5000/ca.crt", ca).
+		WithMountedFile("/etc/docker/certs.d/registry:5000/ca.crt", ca).
+		WithMountedFile("/etc/ssl/local-registry/ca.crt", ca).
+		WithEnvVariable("SSL_CERT_DIR", "/etc/ssl/local-registry")
+}
+
+// manifestAccept lists the manifest types a registry may hold, so HEAD requests
+// return the digest of the stored manifest rather than a converted one
+const manifestAccept = "application/vnd.oci.image.index.v1+json, " +
+	"application/vnd.oci.image.manifest.v1+json, " +
+	"application/vnd.docker.distribution.manifest.list.v2+json, " +
+	"application/vnd.docker.distribution.manifest.v2+json"
+
+// localRegistryClient returns a curl container bound to the plain HTTP local registry
+// Registry state changes between calls, so requests are never served from cache
+func (m *SearchApi) localRegistryClient() (*dagger.Container, error) {
+	registry, err := m.SetupLocalRegistry(false, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return dag.Container().
+		From(curlImage).
+		WithServiceBinding("registry", registry).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()), nil
+}
+
+// localRegistryTags returns the tags of every repository in the local registry
+func localRegistryTags(ctx context.Context, client *dagger.Container) (map[string][]string, error) {
+	catalog, err := client.
+		WithExec([]string{"curl", "-sSf", "http://registry:5000/v2/_catalog?n=10000"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	var repositories struct {
+		Repositories []string
+	}
+	if err := json.Unmarshal([]byte(catalog), &repositories); err != nil {
+		return nil, fmt.Errorf("invalid registry catalog: %w", err)
+	}
+
+	tags := make(map[string][]string, len(repositories.Repositories))
+	for _, repo := range repositories.Repositories {
+		list, err := client.
+			WithExec([]string{"curl", "-sSf", fmt.Sprintf("http://registry:5000/v2/%s/tags/list", repo)}).
+			Stdout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo, err)
+		}
+		var repoTags struct {
+			Tags []string
+		}
+		if err := json.Unmarshal([]byte(list), &repoTags); err != nil {
+			return nil, fmt.Errorf("invalid tag list for %s: %w", repo, err)
+		}
+		// Repositories whose manifests were all deleted are listed with null tags
+		tags[repo] = repoTags.Tags
+	}
+	return tags, nil
+}
+
+// ListLocalRegistry lists the repositories and tags stored in the local registry
+func (m *SearchApi) ListLocalRegistry(ctx context.Context) (string, error) {
+	client, err := m.localRegistryClient()
+	if err != nil {
+		return "", err
+	}
+	tags, err := localRegistryTags(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	repos := slices.Sorted(maps.Keys(tags))
+	report := fmt.Sprintf("📦 Local registry: %d repositories\n", len(repos))
+	for _, repo := range repos {
+		if len(tags[repo]) == 0 {
+			report += fmt.Sprintf("  %s (no tags)\n", repo)
+			continue
+		}
+		report += fmt.Sprintf("  %s: %s\n", repo, strings.Join(slices.Sorted(slices.Values(tags[repo])), ", "))
+	}
+	return report, nil
+}
+
+// deleteManifestScript resolves each tag to its manifest digest and deletes the manifest
+// Deleting by digest removes every tag that points at it; blobs stay on disk until
+// garbage collection
+const deleteManifestScript = `set -e
+for tag in $TAGS; do
+  digest=$(curl -sSfI -H "Accept: $MANIFEST_ACCEPT" "http://registry:5000/v2/$REPOSITORY/manifests/$tag" \
+    | tr -d '\r' | awk 'tolower($1) == "docker-content-digest:" { print $2 }')
+  if [ -z "$digest" ]; then
+    echo "$REPOSITORY:$tag not found" >&2
+    exit 1
+  fi
+  curl -sSf -X DELETE "http://registry:5000/v2/$REPOSITORY/manifests/$digest"
+  echo "$REPOSITORY:$tag ($digest)"
+done
+`
+
+// DeleteFromLocalRegistry deletes image manifests from the local registry
+// Run GarbageCollectLocalRegistry afterwards to reclaim the disk space
+func (m *SearchApi) DeleteFromLocalRegistry(
+	ctx context.Context,
+	// Repository name (e.g., "search-api")
+	repository string,
+	// Tags to delete; all tags of the repository when empty
+	// +optional
+	tags []string,
+) (string, error) {
+	client, err := m.localRegistryClient()
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		all, err := localRegistryTags(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		tags = all[repository]
+		if len(tags) == 0 {
+			return fmt.Sprintf("Nothing to delete: %s has no tags\n", repository), nil
+		}
+	}
+
+	output, err := client.
+		WithEnvVariable("REPOSITORY", repository).
+		WithEnvVariable("TAGS", strings.Join(tags, " ")).
+		WithEnvVariable("MANIFEST_ACCEPT", manifestAccept).
+		WithExec([]string{"sh", "-c", deleteManifestScript}).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete from %s: %w", repository, err)
+	}
+
+	report := "🗑️  Deleted manifests:\n"
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		report += "   • " + line + "\n"
+	}
+	return report, nil
+}
+
+// garbageCollectScript runs the registry's offline garbage collector against the
+// shared storage, reporting the space used before and after
+const garbageCollectScript = `set -e
+echo "before: $(du -sh "$REGISTRY_STORAGE" | cut -f1)"
+registry garbage-collect /etc/docker/registry/config.yml $GC_FLAGS > /tmp/gc.log
+echo "blobs deleted: $(grep -c 'blob eligible for deletion' /tmp/gc.log || true)"
+echo "after: $(du -sh "$REGISTRY_STORAGE" | cut -f1)"
+`
+
+// GarbageCollectLocalRegistry removes blobs no longer referenced by any manifest from
+// the local registry storage
+// Don't run it while a pipeline is pushing to the registry: blobs of an upload in
+// progress are unreferenced and would be deleted
+func (m *SearchApi) GarbageCollectLocalRegistry(
+	ctx context.Context,
+	// Also delete manifests that no tag points at (e.g., images overwritten by a re-push)
+	// +default=true
+	deleteUntagged bool,
+) (string, error) {
+	flags := ""
+	if deleteUntagged {
+		flags = "--delete-untagged"
+	}
+
+	output, err := dag.Container().
+		From(registryImage).
+		WithMountedCache(localRegistryStorage, dag.CacheVolume(localRegistryVolume)).
+		WithEnvVariable("REGISTRY_STORAGE", localRegistryStorage).
+		WithEnvVariable("GC_FLAGS", flags).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", garbageCollectScript}).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("registry garbage collection failed: %w", err)
+	}
+
+	report := "🧹 Local registry garbage collection\n"
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		report += "   • " + line + "\n"
+	}
+	return report, nil
+}
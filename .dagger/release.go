@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GithubRelease is a release published by Release
+type GithubRelease struct {
+	// Tag the release created (e.g., "v1.4.0")
+	Tag string
+	// Commit the tag points at
+	Commit string
+	// Release page
+	Url string
+	// Names of the attached assets
+	Assets []string
+}
+
+// releaseAsset is a file attached to a GitHub release
+type releaseAsset struct {
+	name        string
+	contentType string
+	file        *dagger.File
+}
+
+// githubRepoFromRemote returns owner/name of a github.com remote, or ""
+func githubRepoFromRemote(remote string) string {
+	repo, ok := strings.CutPrefix(remote, "https://github.com/")
+	if !ok || strings.Count(repo, "/") != 1 {
+		return ""
+	}
+	return repo
+}
+
+// archiveDirectory packs a directory as a gzipped tarball
+func archiveDirectory(dir *dagger.Directory, name string) *dagger.File {
+	return dag.Container().
+		From("alpine:latest").
+		WithDirectory("/in", dir).
+		WithExec([]string{"tar", "-czf", "/" + name, "-C", "/in", "."}).
+		File("/" + name)
+}
+
+// Release publishes a GitHub Release for HEAD: it creates the version tag on the
+// commit, with a changelog from the conventional commits since the last tag, and
+// attaches the SBOM, the scan reports and the image digest as assets
+// The tag is created by GitHub with the release, so nothing is pushed from the
+// checkout; an existing tag or release fails instead of being moved
+func (m *SearchApi) Release(
+	ctx context.Context,
+	// Repository including .git
+	// +defaultPath="/"
+	source *dagger.Directory,
+	// GitHub token allowed to create releases (contents: write)
+	token *dagger.Secret,
+	// Version to release (defaults to the computed version, see ComputeVersion)
+	// +optional
+	version string,
+	// GitHub repository (owner/name); defaults to the origin remote's
+	// +optional
+	githubRepo string,
+	// GitHub API URL (override for GitHub Enterprise)
+	// +default="https://api.github.com"
+	apiUrl string,
+	// SBOM to attach (generated from the source when not given)
+	// +optional
+	sbom *dagger.File,
+	// Scan reports to attach as reports.tar.gz (e.g., ExportPipelineReports output)
+	// +optional
+	reports *dagger.Directory,
+	// Image pushed for this release, with its digest (e.g., FullPipeline's image)
+	// +optional
+	image string,
+	// Create the release as a draft, to review before publishing
+	// +optional
+	draft bool,
+) (*GithubRelease, error) {
+	checkout, err := gitSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if githubRepo == "" {
+		if githubRepo = githubRepoFromRemote(checkout.repo); githubRepo == "" {
+			return nil, fmt.Errorf("origin remote %q is not a github.com repository; pass githubRepo", checkout.repo)
+		}
+	}
+	if version == "" {
+		computed, err := computeVersion(ctx, source, "")
+		if err != nil {
+			return nil, err
+		}
+		version = computed.Version
+	}
+	version = strings.TrimPrefix(version, "v")
+	tag := "v" + version
+	apiUrl = strings.TrimSuffix(apiUrl, "/")
+
+	notes, err := m.GenerateReleaseNotes(ctx, source, tag, "", githubRepo, token, apiUrl, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := notes.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release notes: %w", err)
+	}
+
+	var assets []releaseAsset
+	if sbom == nil {
+		content, err := dag.Syft().Scan(ctx, dagger.SyftScanOpts{
+			Source: source,
+			Format: "spdx-json",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("SBOM generation failed: %w", err)
+		}
+		sbom = dag.Directory().WithNewFile("sbom.spdx.json", content).File("sbom.spdx.json")
+	}
+	assets = append(assets, releaseAsset{"sbom.spdx.json", "application/json", sbom})
+	if reports != nil {
+		assets = append(assets, releaseAsset{"reports.tar.gz", "application/gzip", archiveDirectory(reports, "reports.tar.gz")})
+	}
+	if image != "" {
+		body += fmt.Sprintf("## 📦 Image\n\n`%s`\n", image)
+		digest := dag.Directory().WithNewFile("image-digest.txt", image+"\n").File("image-digest.txt")
+		assets = append(assets, releaseAsset{"image-digest.txt", "text/plain", digest})
+	}
+
+	gh := &githubIssues{apiUrl: apiUrl, repo: githubRepo, token: token}
+	req, err := gh.request("POST", "/releases", map[string]any{
+		"tag_name":         tag,
+		"target_commitish": checkout.sha,
+		"name":             tag,
+		"body":             body,
+		"draft":            draft,
+		"prerelease":       strings.Contains(version, "-"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := req.do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create release %s: %w", tag, err)
+	}
+	var created struct {
+		HtmlUrl   string `json:"html_url"`
+		UploadUrl string `json:"upload_url"`
+	}
+	if err := json.Unmarshal([]byte(response), &created); err != nil {
+		return nil, fmt.Errorf("invalid release response: %w", err)
+	}
+
+	release := &GithubRelease{Tag: tag, Commit: checkout.sha, Url: created.HtmlUrl}
+	// upload_url is a URI template: https://uploads.github.com/.../assets{?name,label}
+	uploadUrl, _, _ := strings.Cut(created.UploadUrl, "{")
+	for _, asset := range assets {
+		upload := httpRequest{
+			method: "POST",
+			url:    uploadUrl + "?name=" + url.QueryEscape(asset.name),
+			headers: []string{
+				"Accept: application/vnd.github+json",
+				"Content-Type: " + asset.contentType,
+			},
+			upload:     asset.file,
+			token:      token,
+			authPrefix: "Authorization: Bearer",
+		}
+		if _, err := upload.do(ctx); err != nil {
+			return release, fmt.Errorf("failed to attach %s to release %s: %w", asset.name, tag, err)
+		}
+		release.Assets = append(release.Assets, asset.name)
+	}
+	return release, nil
+}
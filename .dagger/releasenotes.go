@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commitLogScript prints the last tag, its date and the commits since then
+// Fields are separated by \x1f and commits by \x1e so subjects and bodies can contain anything
+const commitLogScript = `set -e
+git config --global --add safe.directory /repo
+since="$SINCE_TAG"
+[ -n "$since" ] || since=$(git describe --tags --abbrev=0 2>/dev/null || true)
+echo "$since"
+if [ -n "$since" ]; then
+  git log -1 --format=%cI "$since"
+  git log --no-merges --format='%h%x1f%s%x1f%b%x1e' "$since..HEAD"
+else
+  echo
+  git log --no-merges --format='%h%x1f%s%x1f%b%x1e'
+fi
+`
+
+// releaseCommit is a commit parsed as a conventional commit
+type releaseCommit struct {
+	hash     string
+	kind     string
+	scope    string
+	subject  string
+	breaking bool
+}
+
+var conventionalCommit = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// parseCommit splits a commit into its conventional commit parts
+// Subjects that don't follow the convention are kept as "other"
+func parseCommit(hash, subject, body string) releaseCommit {
+	c := releaseCommit{hash: hash, kind: "other", subject: subject}
+	if match := conventionalCommit.FindStringSubmatch(subject); match != nil {
+		c.kind = strings.ToLower(match[1])
+		c.scope = match[2]
+		c.breaking = match[3] == "!"
+		c.subject = match[4]
+	}
+	if strings.Contains(body, "BREAKING CHANGE") {
+		c.breaking = true
+	}
+	return c
+}
+
+// releaseSections orders commit kinds in the notes
+var releaseSections = []struct{ kind, title string }{
+	{"feat", "✨ Features"},
+	{"fix", "🐛 Bug Fixes"},
+	{"security", "🔒 Security"},
+	{"perf", "⚡ Performance"},
+	{"refactor", "♻️ Refactoring"},
+	{"docs", "📝 Documentation"},
+	{"other", "🧹 Other Changes"},
+}
+
+// commitLog reads the tag the release is based on, its date and the commits since
+func commitLog(ctx context.Context, repo *dagger.Directory, sinceTag string) (tag, tagDate string, commits []releaseCommit, err error) {
+	output, err := dag.Container().
+		From(gitImage).
+		WithDirectory("/repo", repo).
+		WithWorkdir("/repo").
+		WithEnvVariable("SINCE_TAG", sinceTag).
+		WithExec([]string{"sh", "-c", commitLogScript}).
+		Stdout(ctx)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+
+	header, log, _ := strings.Cut(output, "\n")
+	tag = strings.TrimSpace(header)
+	dateLine, log, _ := strings.Cut(log, "\n")
+	// Normalize to UTC so it compares with GitHub's timestamps
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(dateLine)); err == nil {
+		tagDate = t.UTC().Format(time.RFC3339)
+	}
+
+	for _, record := range strings.Split(log, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) < 2 {
+			continue
+		}
+		body := ""
+		if len(fields) > 2 {
+			body = fields[2]
+		}
+		commits = append(commits, parseCommit(fields[0], fields[1], body))
+	}
+	return tag, tagDate, commits, nil
+}
+
+// closedIssues lists GitHub issues (not pull requests) closed since the given time
+func closedIssues(ctx context.Context, gh *githubIssues, since string) ([]string, error) {
+	path := "/issues?state=closed&per_page=100"
+	if since != "" {
+		path += "&since=" + url.QueryEscape(since)
+	}
+	req, _ := gh.request("GET", path, nil)
+	response, err := req.do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []struct {
+		Number      int       `json:"number"`
+		Title       string    `json:"title"`
+		ClosedAt    string    `json:"closed_at"`
+		PullRequest *struct{} `json:"pull_request"`
+	}
+	if err := json.Unmarshal([]byte(response), &issues); err != nil {
+		return nil, fmt.Errorf("unexpected GitHub response: %w", err)
+	}
+
+	var closed []string
+	for _, issue := range issues {
+		// "since" filters on update time, so re-check the close time
+		if issue.PullRequest != nil || (since != "" && issue.ClosedAt < since) {
+			continue
+		}
+		closed = append(closed, fmt.Sprintf("#%d %s", issue.Number, issue.Title))
+	}
+	return closed, nil
+}
+
+// sbomPackages reads name → version from an SPDX JSON or CycloneDX JSON SBOM
+func sbomPackages(content string) (map[string]string, error) {
+	var sbom struct {
+		Packages []struct {
+			Name        string `json:"name"`
+			VersionInfo string `json:"versionInfo"`
+		} `json:"packages"`
+		Components []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(content), &sbom); err != nil {
+		return nil, fmt.Errorf("invalid SBOM: %w", err)
+	}
+
+	packages := map[string]string{}
+	for _, p := range sbom.Packages {
+		packages[p.Name] = p.VersionInfo
+	}
+	for _, c := range sbom.Components {
+		packages[c.Name] = c.Version
+	}
+	return packages, nil
+}
+
+// sbomDiff describes package changes between two SBOMs as markdown list items
+func sbomDiff(previous, current map[string]string) []string {
+	var changes []string
+	for name, version := range current {
+		old, existed := previous[name]
+		switch {
+		case !existed:
+			changes = append(changes, fmt.Sprintf("Added `%s` %s", name, version))
+		case old != version:
+			changes = append(changes, fmt.Sprintf("Updated `%s` %s → %s", name, old, version))
+		}
+	}
+	for name, version := range previous {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, fmt.Sprintf("Removed `%s` %s", name, version))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// vulnerabilityDiff returns dependency vulnerabilities introduced and fixed between two scans
+func vulnerabilityDiff(previous, current []Finding) (introduced, fixed []Finding) {
+	seen := func(findings []Finding) map[string]Finding {
+		byFingerprint := map[string]Finding{}
+		for _, f := range findings {
+			if f.Package != "" {
+				byFingerprint[f.Fingerprint] = f
+			}
+		}
+		return byFingerprint
+	}
+	before, after := seen(previous), seen(current)
+
+	for fp, f := range after {
+		if _, ok := before[fp]; !ok {
+			introduced = append(introduced, f)
+		}
+	}
+	for fp, f := range before {
+		if _, ok := after[fp]; !ok {
+			fixed = append(fixed, f)
+		}
+	}
+	byID := func(findings []Finding) {
+		sort.Slice(findings, func(i, j int) bool { return findings[i].RuleID < findings[j].RuleID })
+	}
+	byID(introduced)
+	byID(fixed)
+	return introduced, fixed
+}
+
+// readSbom loads packages from an SBOM file
+func readSbom(ctx context.Context, file *dagger.File) (map[string]string, error) {
+	content, err := file.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SBOM: %w", err)
+	}
+	return sbomPackages(content)
+}
+
+// GenerateReleaseNotes builds markdown release notes from the conventional commits
+// since the last tag, issues closed since then, dependency vulnerabilities introduced
+// or fixed between two report directories and package changes between two SBOMs
+func (m *SearchApi) GenerateReleaseNotes(
+	ctx context.Context,
+	// Repository including .git
+	// +defaultPath="/"
+	repo *dagger.Directory,
+	// Version being released, used as the title
+	// +default="Unreleased"
+	version string,
+	// Tag to compare against (defaults to the most recent tag)
+	// +optional
+	sinceTag string,
+	// GitHub repository (owner/name) to list closed issues from
+	// +optional
+	githubRepo string,
+	// GitHub token for private repositories
+	// +optional
+	token *dagger.Secret,
+	// GitHub API URL (override for GitHub Enterprise)
+	// +default="https://api.github.com"
+	apiUrl string,
+	// Scan reports of the previous release (e.g., ExportPipelineReports output)
+	// +optional
+	previousReports *dagger.Directory,
+	// Scan reports of this release
+	// +optional
+	reports *dagger.Directory,
+	// SBOM of the previous release (SPDX or CycloneDX JSON)
+	// +optional
+	previousSbom *dagger.File,
+	// SBOM of this release
+	// +optional
+	sbom *dagger.File,
+) (*dagger.File, error) {
+	tag, tagDate, commits, err := commitLog(ctx, repo, sinceTag)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Release %s\n\n", version)
+	if tag != "" {
+		fmt.Fprintf(&sb, "Changes since %s.\n\n", tag)
+	}
+
+	var breaking []releaseCommit
+	byKind := map[string][]releaseCommit{}
+	for _, c := range commits {
+		if c.breaking {
+			breaking = append(breaking, c)
+		}
+		kind := "other"
+		for _, section := range releaseSections {
+			if section.kind == c.kind {
+				kind = c.kind
+			}
+		}
+		byKind[kind] = append(byKind[kind], c)
+	}
+
+	line := func(c releaseCommit) string {
+		if c.scope != "" {
+			return fmt.Sprintf("- **%s:** %s (%s)\n", c.scope, c.subject, c.hash)
+		}
+		return fmt.Sprintf("- %s (%s)\n", c.subject, c.hash)
+	}
+	if len(breaking) > 0 {
+		sb.WriteString("## ⚠️ Breaking Changes\n\n")
+		for _, c := range breaking {
+			sb.WriteString(line(c))
+		}
+		sb.WriteString("\n")
+	}
+	for _, section := range releaseSections {
+		if len(byKind[section.kind]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "## %s\n\n", section.title)
+		for _, c := range byKind[section.kind] {
+			sb.WriteString(line(c))
+		}
+		sb.WriteString("\n")
+	}
+
+	if githubRepo != "" {
+		issues, err := closedIssues(ctx, &githubIssues{apiUrl: apiUrl, repo: githubRepo, token: token}, tagDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list closed issues: %w", err)
+		}
+		if len(issues) > 0 {
+			sb.WriteString("## ✅ Closed Issues\n\n")
+			for _, issue := range issues {
+				fmt.Fprintf(&sb, "- %s\n", issue)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if previousReports != nil && reports != nil {
+		before, err := collectFindings(ctx, previousReports)
+		if err != nil {
+			return nil, err
+		}
+		after, err := collectFindings(ctx, reports)
+		if err != nil {
+			return nil, err
+		}
+		introduced, fixed := vulnerabilityDiff(before, after)
+		sb.WriteString("## 🛡️ Vulnerabilities\n\n")
+		fmt.Fprintf(&sb, "%d fixed, %d new.\n\n", len(fixed), len(introduced))
+		for _, f := range fixed {
+			fmt.Fprintf(&sb, "- Fixed %s in `%s` %s\n", f.RuleID, f.Package, f.Version)
+		}
+		for _, f := range introduced {
+			fmt.Fprintf(&sb, "- **New** %s (%s) in `%s` %s\n", f.RuleID, f.Severity, f.Package, f.Version)
+		}
+		sb.WriteString("\n")
+	}
+
+	if previousSbom != nil && sbom != nil {
+		before, err := readSbom(ctx, previousSbom)
+		if err != nil {
+			return nil, err
+		}
+		after, err := readSbom(ctx, sbom)
+		if err != nil {
+			return nil, err
+		}
+		changes := sbomDiff(before, after)
+		sb.WriteString("## 📦 Dependency Changes\n\n")
+		if len(changes) == 0 {
+			sb.WriteString("No package changes.\n")
+		}
+		for _, c := range changes {
+			fmt.Fprintf(&sb, "- %s\n", c)
+		}
+		sb.WriteString("\n")
+	}
+
+	return dag.Directory().
+		WithNewFile("RELEASE_NOTES.md", sb.String()).
+		File("RELEASE_NOTES.md"), nil
+}
+
+// attachReleaseNotes attaches release notes to the image as an OCI artifact
+func attachReleaseNotes(ctx context.Context, address, registryUrl, username string, password *dagger.Secret, notes *dagger.File) error {
+	err := attachArtifact(ctx, address, registryUrl, username, password, notes, "RELEASE_NOTES.md", "application/vnd.search-api.release-notes", "text/markdown")
+	if err != nil {
+		return fmt.Errorf("failed to attach release notes: %w", err)
+	}
+	return nil
+}
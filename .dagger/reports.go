@@ -0,0 +1,322 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// reportTools are the images behind each report and how to ask them for their version
+// The modules pull floating tags, so the version actually used is recorded per export
+var reportTools = map[string]struct {
+	image   string
+	command []string
+}{
+	"trufflehog": {"trufflesecurity/trufflehog:latest", []string{"trufflehog", "--version"}},
+	"semgrep":    {"returntocorp/semgrep:latest", []string{"semgrep", "--version"}},
+	"trivy":      {"aquasec/trivy:latest", []string{"trivy", "--version"}},
+	"checkov":    {"bridgecrew/checkov:latest", []string{"checkov", "--version"}},
+	"syft":       {"anchore/syft:latest", []string{"syft", "--version"}},
+	"dockle":     {"goodwithtech/dockle:latest", []string{"dockle", "--version"}},
+	"dotnet":     {dotnetSDK, []string{"dotnet", "--version"}},
+	"zap":        {zapImage, []string{"zap.sh", "-cmd", "-version"}},
+	"nuclei":     {nucleiImage, []string{"nuclei", "-version"}},
+	"k6":         {"grafana/k6:latest", []string{"k6", "version"}},
+}
+
+// reportTask produces one artifact of ExportPipelineReports, either a file or a directory
+type reportTask struct {
+	name string
+	tool string
+	// What the artifact contains, for manifest.json
+	description string
+	// Whether it comes from the running API (DAST, tests) rather than the source or image
+	runtime bool
+	// Format when it can't be detected from the content (e.g., "spdx-json")
+	format    string
+	content   func(ctx context.Context) (string, error)
+	directory func(ctx context.Context) (*dagger.Directory, error)
+}
+
+// reportEntry is the index.json record of one artifact
+type reportEntry struct {
+	File            string  `json:"file"`
+	Tool            string  `json:"tool"`
+	ToolVersion     string  `json:"toolVersion,omitempty"`
+	Status          string  `json:"status"`
+	Error           string  `json:"error,omitempty"`
+	StartedAt       string  `json:"startedAt"`
+	FinishedAt      string  `json:"finishedAt"`
+	DurationSeconds float64 `json:"durationSeconds"`
+
+	// Recorded for manifest.json
+	kind        string
+	format      string
+	description string
+	size        int
+	digest      string
+}
+
+// describe records the size and digest of a file artifact
+func (e *reportEntry) describe(content string) {
+	e.size = len(content)
+	e.digest = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+// manifestArtifact is the manifest.json record of an exported artifact
+type manifestArtifact struct {
+	File        string `json:"file"`
+	Kind        string `json:"kind"`
+	Format      string `json:"format"`
+	Description string `json:"description"`
+	Tool        string `json:"tool"`
+	ToolVersion string `json:"toolVersion,omitempty"`
+	SizeBytes   int    `json:"sizeBytes,omitempty"`
+	Digest      string `json:"digest"`
+}
+
+// artifactFormat names a report's format: the scanner format when it is a scan
+// report, otherwise what its extension says
+func artifactFormat(name string, content string) string {
+	if format := reportFormat(content); format != "" {
+		return format
+	}
+	switch ext := strings.TrimPrefix(path.Ext(name), "."); ext {
+	case "txt":
+		return "text"
+	case "patch":
+		return "diff"
+	default:
+		return ext
+	}
+}
+
+// toolVersion returns the first line a tool prints for its version, or "" if unknown
+func toolVersion(ctx context.Context, tool string) string {
+	spec, ok := reportTools[tool]
+	if !ok {
+		return ""
+	}
+	exec := dag.Container().From(spec.image).WithExec(spec.command)
+	output, err := exec.Stdout(ctx)
+	if err == nil && strings.TrimSpace(output) == "" {
+		output, err = exec.Stderr(ctx)
+	}
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+// runReportTasks runs every task concurrently and adds the artifacts that succeeded
+// A failed task never stops the others; it is recorded in the returned entries
+func runReportTasks(ctx context.Context, outputDir *dagger.Directory, tasks []reportTask) (*dagger.Directory, []reportEntry) {
+	entries := make([]reportEntry, len(tasks))
+	files := make([]string, len(tasks))
+	directories := make([]*dagger.Directory, len(tasks))
+	versions := map[string]string{}
+	var mu sync.Mutex
+
+	var g errgroup.Group
+	tools := map[string]bool{}
+	for _, task := range tasks {
+		tools[task.tool] = true
+	}
+	for tool := range tools {
+		g.Go(func() error {
+			version := toolVersion(ctx, tool)
+			mu.Lock()
+			versions[tool] = version
+			mu.Unlock()
+			return nil
+		})
+	}
+	for i, task := range tasks {
+		g.Go(func() error {
+			started := time.Now().UTC()
+			var err error
+			if task.directory != nil {
+				directories[i], err = task.directory(ctx)
+			} else {
+				files[i], err = task.content(ctx)
+			}
+			finished := time.Now().UTC()
+
+			entries[i] = reportEntry{
+				File:            task.name,
+				Tool:            task.tool,
+				Status:          "ok",
+				StartedAt:       started.Format(time.RFC3339),
+				FinishedAt:      finished.Format(time.RFC3339),
+				DurationSeconds: finished.Sub(started).Round(time.Millisecond).Seconds(),
+				kind:            "static",
+				format:          task.format,
+				description:     task.description,
+			}
+			if task.runtime {
+				entries[i].kind = "runtime"
+			}
+			switch {
+			case err != nil:
+				entries[i].Status = "failed"
+				entries[i].Error = err.Error()
+			case task.directory != nil:
+				entries[i].format = cmp.Or(task.format, "directory")
+				entries[i].digest, _ = directories[i].Digest(ctx)
+			default:
+				entries[i].format = cmp.Or(task.format, artifactFormat(task.name, files[i]))
+				entries[i].describe(files[i])
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for i, task := range tasks {
+		entries[i].ToolVersion = versions[task.tool]
+		if entries[i].Status != "ok" {
+			continue
+		}
+		if task.directory != nil {
+			outputDir = outputDir.WithDirectory(task.name, directories[i])
+		} else {
+			outputDir = outputDir.WithNewFile(task.name, files[i])
+		}
+	}
+	return outputDir, entries
+}
+
+// withReportIndex adds index.json and index.html listing every artifact and its
+// status, and manifest.json describing the artifacts that were exported
+func withReportIndex(outputDir *dagger.Directory, entries []reportEntry) (*dagger.Directory, error) {
+	generatedAt := time.Now().UTC().Format(time.RFC3339)
+	content, err := json.MarshalIndent(map[string]any{
+		"generatedAt": generatedAt,
+		"reports":     entries,
+	}, "", "  ")
+	if err != nil {
+		return outputDir, err
+	}
+
+	artifacts := []manifestArtifact{}
+	for _, e := range entries {
+		if e.Status != "ok" {
+			continue
+		}
+		artifacts = append(artifacts, manifestArtifact{
+			File:        e.File,
+			Kind:        e.kind,
+			Format:      e.format,
+			Description: e.description,
+			Tool:        e.Tool,
+			ToolVersion: e.ToolVersion,
+			SizeBytes:   e.size,
+			Digest:      e.digest,
+		})
+	}
+	manifest, err := json.MarshalIndent(map[string]any{
+		"generatedAt": generatedAt,
+		"artifacts":   artifacts,
+	}, "", "  ")
+	if err != nil {
+		return outputDir, err
+	}
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>Pipeline reports</title>\n")
+	page.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}.failed{color:#b00}</style>\n")
+	fmt.Fprintf(&page, "</head><body>\n<h1>Pipeline reports</h1>\n<p>Generated %s</p>\n<table>\n", generatedAt)
+	page.WriteString("<tr><th>Report</th><th>Tool</th><th>Version</th><th>Status</th><th>Started</th><th>Duration (s)</th></tr>\n")
+	for _, e := range entries {
+		report := html.EscapeString(e.File)
+		status := e.Status
+		if e.Status == "ok" {
+			report = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(e.File), report)
+		} else {
+			status = fmt.Sprintf("<span class=\"failed\" title=\"%s\">%s</span>", html.EscapeString(e.Error), e.Status)
+		}
+		fmt.Fprintf(&page, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%.1f</td></tr>\n",
+			report, html.EscapeString(e.Tool), html.EscapeString(e.ToolVersion), status, e.StartedAt, e.DurationSeconds)
+	}
+	page.WriteString("</table>\n</body></html>\n")
+
+	return outputDir.
+		WithNewFile("index.json", string(content)).
+		WithNewFile("index.html", page.String()).
+		WithNewFile("manifest.json", string(manifest)), nil
+}
+
+// runtimeReportTasks produce the reports of the running API: DAST, API security,
+// performance and integration tests, each against its own API and Solr so one can't
+// affect another's index
+func (m *SearchApi) runtimeReportTasks(ctx context.Context, source *dagger.Directory, container *dagger.Container, solrFixtures *dagger.Directory) []reportTask {
+	// Seeded once, on first use, and restored into every instance
+	snapshot := sync.OnceValues(func() (*dagger.Directory, error) {
+		if solrFixtures == nil {
+			return nil, nil
+		}
+		return m.SnapshotSolr(ctx, solrFixtures, solrCore, defaultSolrVersion)
+	})
+	api := func(instance string) (*dagger.Service, error) {
+		seeded, err := snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed Solr: %w", err)
+		}
+		return apiWithSolr(container, solrService("", seeded, instance)), nil
+	}
+
+	return []reportTask{
+		{name: "13-dast-scan.json", tool: "zap", description: "Passive scan of the running API (ZAP baseline)", runtime: true, content: func(ctx context.Context) (string, error) {
+			service, err := api("reports-dast")
+			if err != nil {
+				return "", err
+			}
+			return dag.Zap().BaselineScan(ctx, service, dagger.ZapBaselineScanOpts{TargetURL: "http://api:8080"})
+		}},
+		{name: "14-api-security.jsonl", tool: "nuclei", description: "OWASP API Top 10 checks against the running API (Nuclei)", runtime: true, content: func(ctx context.Context) (string, error) {
+			service, err := api("reports-api-security")
+			if err != nil {
+				return "", err
+			}
+			return dag.Nuclei().ScanAPI(ctx, service, dagger.NucleiScanAPIOpts{TargetURL: "http://api:8080"})
+		}},
+		// Threshold violations are part of the report, so they don't drop it
+		{name: "15-performance.txt", tool: "k6", description: "Latency per endpoint and resource usage under the search workload (k6)", runtime: true, content: func(ctx context.Context) (string, error) {
+			seeded, err := snapshot()
+			if err != nil {
+				return "", fmt.Errorf("failed to seed Solr: %w", err)
+			}
+			report, err := m.PerformanceTest(ctx, nil, nil, 10, "30s", 500, 0.05, container, seeded)
+			if report != "" {
+				return report, nil
+			}
+			return "", err
+		}},
+		// Failing tests are part of the results, like scan findings
+		{name: "16-integration-tests.trx", tool: "dotnet", description: "Integration test results against the API and Solr", format: "trx", runtime: true, content: func(ctx context.Context) (string, error) {
+			seeded, err := snapshot()
+			if err != nil {
+				return "", fmt.Errorf("failed to seed Solr: %w", err)
+			}
+			run, err := isolatedTestRun(ctx, buildBase(source), container, "", seeded, "reports-integration", "")
+			if err != nil {
+				return "", err
+			}
+			return mergeTrx([]*trxRun{run}), nil
+		}},
+		{name: "17-openapi.json", tool: "search-api", description: "OpenAPI document served by the API, for contract tests and client generation", runtime: true, content: func(ctx context.Context) (string, error) {
+			return openApiSpec(container, solrService("", nil, "reports-openapi")).Contents(ctx)
+		}},
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resourceCounters are the System.Runtime counters included in the perf report,
+// by their dotnet-counters display name
+var resourceCounters = []struct {
+	name   string
+	column string
+}{
+	{"CPU Usage (%)", "CPU %"},
+	{"Working Set (MB)", "Working set MB"},
+	{"GC Heap Size (MB)", "GC heap MB"},
+	{"Gen 0 GC Count (Count / 1 sec)", "Gen0 GCs"},
+	{"Gen 2 GC Count (Count / 1 sec)", "Gen2 GCs"},
+	{"% Time in GC since last GC (%)", "Time in GC %"},
+	{"ThreadPool Queue Length", "Thread pool queue"},
+}
+
+// dotnetCountersTool installs dotnet-counters and keeps its framework-dependent build,
+// which runs on every .NET 8 runtime image (Debian, Alpine and chiseled alike)
+func dotnetCountersTool() *dagger.Directory {
+	return dag.Container().
+		From(dotnetSDK).
+		WithExec([]string{"dotnet", "tool", "install", "--tool-path", "/tools", "dotnet-counters"}).
+		WithExec([]string{"sh", "-c", `cp -R "$(ls -d /tools/.store/dotnet-counters/*/dotnet-counters/*/tools/*/any | tail -n 1)" /counters`}).
+		Directory("/counters")
+}
+
+// resourceMonitor records the API's runtime counters while it serves a load test
+// dotnet-counters launches the API as its child process, so no shell or extra
+// process manager is needed in the image; the CSV goes to a cache volume because
+// the service's own filesystem is discarded when it stops. Every run reuses the
+// same volume and clears it before the API starts
+type resourceMonitor struct {
+	volume *dagger.CacheVolume
+}
+
+func newResourceMonitor() *resourceMonitor {
+	return &resourceMonitor{volume: dag.CacheVolume("search-api-perf-counters")}
+}
+
+// apiService starts the API (its entrypoint and default args) under dotnet-counters
+func (r *resourceMonitor) apiService(ctx context.Context, container *dagger.Container, solr *dagger.Service) (*dagger.Service, error) {
+	user, err := container.User(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API container user: %w", err)
+	}
+	entrypoint, err := container.Entrypoint(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API entrypoint: %w", err)
+	}
+	defaultArgs, err := container.DefaultArgs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API default args: %w", err)
+	}
+
+	// Mounted with the API's owner, so a fresh volume is writable by the API
+	_, err = dag.Container().
+		From("alpine:latest").
+		WithMountedCache("/metrics", r.volume, dagger.ContainerWithMountedCacheOpts{
+			Owner: user,
+		}).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"rm", "-f", "/metrics/counters.csv"}).
+		Sync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear the previous run's counters: %w", err)
+	}
+
+	args := []string{
+		"dotnet", "/opt/dotnet-counters/dotnet-counters.dll", "collect",
+		"--counters", "System.Runtime",
+		"--refresh-interval", "1",
+		"--format", "csv",
+		"--output", "/metrics/counters.csv",
+		"--",
+	}
+	args = append(append(args, entrypoint...), defaultArgs...)
+
+	return container.
+		WithDirectory("/opt/dotnet-counters", dotnetCountersTool()).
+		WithMountedCache("/metrics", r.volume, dagger.ContainerWithMountedCacheOpts{
+			Owner: user,
+		}).
+		WithServiceBinding("solr", solr).
+		WithEnvVariable("Solr__Url", "http://solr:8983/solr/"+solrCore).
+		WithExposedPort(8080).
+		AsService(dagger.ContainerAsServiceOpts{Args: args}), nil
+}
+
+// counters reads the recorded CSV; call it after the service has stopped, since
+// dotnet-counters only flushes everything on exit
+func (r *resourceMonitor) counters(ctx context.Context) (string, error) {
+	return dag.Container().
+		From("alpine:latest").
+		WithMountedCache("/metrics", r.volume).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"cat", "/metrics/counters.csv"}).
+		Stdout(ctx)
+}
+
+// resourceSample is one counter reading
+type resourceSample struct {
+	at    time.Time
+	value float64
+}
+
+// parseCounters reads dotnet-counters CSV (Timestamp,Provider,Counter Name,Counter Type,Mean/Increment)
+// into a series per counter display name
+func parseCounters(content string) (map[string][]resourceSample, error) {
+	records, err := csv.NewReader(strings.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid counters CSV: %w", err)
+	}
+
+	series := make(map[string][]resourceSample)
+	for _, record := range records {
+		if len(record) < 5 || record[0] == "Timestamp" {
+			continue
+		}
+		at, err := time.Parse("01/02/2006 15:04:05", record[0])
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(record[4], 64)
+		if err != nil {
+			continue
+		}
+		series[record[2]] = append(series[record[2]], resourceSample{at: at, value: value})
+	}
+	return series, nil
+}
+
+// resourceReport renders the counters as a time series of bucketed averages, plus
+// the peak of each counter, so latency spikes can be lined up with GC or CPU load
+func resourceReport(series map[string][]resourceSample, bucket time.Duration) string {
+	var start time.Time
+	for _, samples := range series {
+		if len(samples) > 0 && (start.IsZero() || samples[0].at.Before(start)) {
+			start = samples[0].at
+		}
+	}
+	if start.IsZero() {
+		return "⚠️  No resource counters recorded\n"
+	}
+
+	// sums[bucket][counter] and counts[bucket][counter]
+	var sums, counts [][]float64
+	peaks := make([]float64, len(resourceCounters))
+	for c, counter := range resourceCounters {
+		for _, sample := range series[counter.name] {
+			b := int(sample.at.Sub(start) / bucket)
+			for len(sums) <= b {
+				sums = append(sums, make([]float64, len(resourceCounters)))
+				counts = append(counts, make([]float64, len(resourceCounters)))
+			}
+			sums[b][c] += sample.value
+			counts[b][c]++
+			peaks[c] = max(peaks[c], sample.value)
+		}
+	}
+
+	report := fmt.Sprintf("📈 API resource usage (%s averages)\n\n| t |", bucket)
+	separator := "|---|"
+	for _, counter := range resourceCounters {
+		report += " " + counter.column + " |"
+		separator += "---|"
+	}
+	report += "\n" + separator + "\n"
+	for b := range sums {
+		report += fmt.Sprintf("| +%s |", time.Duration(b)*bucket)
+		for c := range resourceCounters {
+			if counts[b][c] == 0 {
+				report += " - |"
+				continue
+			}
+			report += fmt.Sprintf(" %.1f |", sums[b][c]/counts[b][c])
+		}
+		report += "\n"
+	}
+	report += "| peak |"
+	for c := range resourceCounters {
+		report += fmt.Sprintf(" %.1f |", peaks[c])
+	}
+	return report + "\n"
+}
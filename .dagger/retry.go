@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// transientNetworkErrors mark failures caused by the network rather than by what a
+// step checks, so retrying them may succeed; a scanner exiting because it found
+// something matches none of them and is never retried
+var transientNetworkErrors = []string{
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporary failure in name resolution",
+	"no such host",
+	"unexpected eof",
+	"too many requests",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// transientNetworkError reports whether err looks like a network blip
+func transientNetworkError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return slices.ContainsFunc(transientNetworkErrors, func(s string) bool { return strings.Contains(message, s) })
+}
+
+// retryPolicy is the default retry config with the given attempts, for entry points
+// that take only an attempt count
+func retryPolicy(attempts int) *pipelineConfig {
+	config := defaultPipelineConfig()
+	config.Retry.Attempts = max(attempts, 1)
+	return config
+}
+
+// retry calls fn up to config.Retry.Attempts times while it fails with a network
+// error, backing off exponentially from config.Retry.BackoffSeconds. It returns a
+// report line per failed attempt, so a step that recovered shows it was flaky
+func (c *pipelineConfig) retry(ctx context.Context, what string, fn func() error) (string, error) {
+	attempts := max(c.Retry.Attempts, 1)
+	delay := time.Duration(c.Retry.BackoffSeconds * float64(time.Second))
+	log := ""
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == attempts || !transientNetworkError(err) {
+			return log, err
+		}
+		first, _, _ := strings.Cut(err.Error(), "\n")
+		log += fmt.Sprintf("🔁 %s attempt %d/%d failed (%s); retrying in %v\n", what, attempt, attempts, first, delay)
+		select {
+		case <-ctx.Done():
+			return log, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
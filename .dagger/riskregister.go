@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RiskAcceptance is a waiver for a single finding in the risk register
+type RiskAcceptance struct {
+	// Fingerprint of the accepted finding (see DeduplicateFindings)
+	Fingerprint string
+	// Person who approved the acceptance
+	Approver string
+	// Why the risk is acceptable
+	Justification string
+	// Last day the waiver applies (YYYY-MM-DD)
+	Expires string
+	// Whether the waiver has expired and no longer applies
+	Expired bool
+}
+
+// acceptanceRegister is the parsed risk register file
+type acceptanceRegister struct {
+	Acceptances []RiskAcceptance
+}
+
+// loadRiskRegister reads and validates a risk register (YAML or JSON)
+// Incomplete entries are rejected rather than ignored so a waiver can't silently lose its approver
+func loadRiskRegister(ctx context.Context, file *dagger.File, now time.Time) (*acceptanceRegister, error) {
+	register := &acceptanceRegister{}
+	if err := decodeYAML(ctx, file, register); err != nil {
+		return nil, fmt.Errorf("failed to load risk register: %w", err)
+	}
+
+	for i := range register.Acceptances {
+		a := &register.Acceptances[i]
+		expired, err := checkWaiver(fmt.Sprintf("risk register entry %d", i+1), a.Fingerprint, a.Expires, now,
+			waiverField{"fingerprint", a.Fingerprint},
+			waiverField{"approver", a.Approver},
+			waiverField{"justification", a.Justification})
+		if err != nil {
+			return nil, err
+		}
+		a.Expired = expired
+	}
+	return register, nil
+}
+
+// waiverField is a required field of a waiver entry, by its name in the file
+type waiverField struct {
+	name  string
+	value string
+}
+
+// checkWaiver validates what every waiver file (risk register, vulnerability waivers,
+// security baseline) requires of an entry: the given fields and an expiry date
+// (YYYY-MM-DD). An entry applies through the end of its expiry day; checkWaiver
+// returns whether that has passed
+func checkWaiver(entry, id, expires string, now time.Time, required ...waiverField) (bool, error) {
+	var names []string
+	complete := expires != ""
+	for _, field := range required {
+		names = append(names, field.name)
+		complete = complete && field.value != ""
+	}
+	if !complete {
+		return false, fmt.Errorf("%s: %s and expires are required", entry, strings.Join(names, ", "))
+	}
+	day, err := time.Parse(time.DateOnly, expires)
+	if err != nil {
+		return false, fmt.Errorf("%s (%s): invalid expiry date %q", entry, id, expires)
+	}
+	return !now.Before(day.AddDate(0, 0, 1)), nil
+}
+
+// lookup returns the acceptance for a fingerprint, if any
+func (r *acceptanceRegister) lookup(fingerprint string) (RiskAcceptance, bool) {
+	for _, a := range r.Acceptances {
+		if strings.EqualFold(a.Fingerprint, fingerprint) {
+			return a, true
+		}
+	}
+	return RiskAcceptance{}, false
+}
+
+// waive splits findings into those still subject to gating and those covered by an
+// active acceptance; findings whose waiver has expired stay subject to gating and
+// are also returned separately so the report can call them out
+func (r *acceptanceRegister) waive(findings []Finding) (remaining, waived, expired []Finding) {
+	if r == nil {
+		return findings, nil, nil
+	}
+
+	for _, f := range findings {
+		a, ok := r.lookup(f.Fingerprint)
+		switch {
+		case !ok:
+			remaining = append(remaining, f)
+		case a.Expired:
+			remaining = append(remaining, f)
+			expired = append(expired, f)
+		default:
+			waived = append(waived, f)
+		}
+	}
+	return remaining, waived, expired
+}
+
+// active returns the acceptances that still apply
+func (r *acceptanceRegister) active() []RiskAcceptance {
+	var active []RiskAcceptance
+	for _, a := range r.Acceptances {
+		if !a.Expired {
+			active = append(active, a)
+		}
+	}
+	return active
+}
+
+// summary renders the active acceptances for the pipeline report
+func (r *acceptanceRegister) summary() string {
+	active := r.active()
+	if len(active) == 0 {
+		return "📝 Risk register: no active acceptances\n"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📝 Risk register: %d active acceptance(s)\n", len(active))
+	for _, a := range active {
+		fmt.Fprintf(&sb, "   • %s (approved by %s, expires %s): %s\n", a.Fingerprint, a.Approver, a.Expires, a.Justification)
+	}
+	if expired := len(r.Acceptances) - len(active); expired > 0 {
+		fmt.Fprintf(&sb, "   ⚠️  %d expired acceptance(s) no longer apply\n", expired)
+	}
+	return sb.String()
+}
+
+// RiskRegister validates a risk register file and lists its acceptances with expiry status
+func (m *SearchApi) RiskRegister(
+	ctx context.Context,
+	// Risk register file (YAML or JSON)
+	// +defaultPath="/risk-register.yaml"
+	register *dagger.File,
+) ([]*RiskAcceptance, error) {
+	parsed, err := loadRiskRegister(ctx, register, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*RiskAcceptance, len(parsed.Acceptances))
+	for i := range parsed.Acceptances {
+		result[i] = &parsed.Acceptances[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckWaiver(t *testing.T) {
+	now := time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC)
+	complete := []waiverField{{"fingerprint", "abc123"}, {"approver", "security-team"}}
+	tests := []struct {
+		name        string
+		expires     string
+		required    []waiverField
+		wantExpired bool
+		wantErr     string
+	}{
+		{name: "future", expires: "2026-07-01", required: complete},
+		{name: "expiry day", expires: "2026-06-15", required: complete},
+		{name: "day after expiry", expires: "2026-06-14", required: complete, wantExpired: true},
+		{name: "long past", expires: "2025-01-01", required: complete, wantExpired: true},
+		{name: "missing field", expires: "2026-07-01", required: []waiverField{{"fingerprint", "abc123"}, {"approver", ""}},
+			wantErr: "risk register entry 1: fingerprint, approver and expires are required"},
+		{name: "missing expiry", required: complete,
+			wantErr: "risk register entry 1: fingerprint, approver and expires are required"},
+		{name: "invalid date", expires: "15/06/2026", required: complete,
+			wantErr: `risk register entry 1 (abc123): invalid expiry date "15/06/2026"`},
+		{name: "date and time", expires: "2026-06-15T00:00:00Z", required: complete,
+			wantErr: `risk register entry 1 (abc123): invalid expiry date "2026-06-15T00:00:00Z"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired, err := checkWaiver("risk register entry 1", "abc123", tt.expires, now, tt.required...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expired != tt.wantExpired {
+				t.Errorf("expired = %v, want %v", expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestAcceptanceRegisterWaive(t *testing.T) {
+	register := &acceptanceRegister{Acceptances: []RiskAcceptance{
+		{Fingerprint: "AAA", Expires: "2026-07-01"},
+		{Fingerprint: "bbb", Expires: "2026-01-01", Expired: true},
+	}}
+	findings := []Finding{{Fingerprint: "aaa"}, {Fingerprint: "bbb"}, {Fingerprint: "ccc"}}
+
+	remaining, waived, expired := register.waive(findings)
+	if want := []Finding{{Fingerprint: "bbb"}, {Fingerprint: "ccc"}}; !reflect.DeepEqual(remaining, want) {
+		t.Errorf("remaining = %v, want %v", remaining, want)
+	}
+	if want := []Finding{{Fingerprint: "aaa"}}; !reflect.DeepEqual(waived, want) {
+		t.Errorf("waived = %v, want %v", waived, want)
+	}
+	if want := []Finding{{Fingerprint: "bbb"}}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("expired = %v, want %v", expired, want)
+	}
+
+	var none *acceptanceRegister
+	if remaining, _, _ := none.waive(findings); !reflect.DeepEqual(remaining, findings) {
+		t.Errorf("nil register waived findings: %v", remaining)
+	}
+}
+
+func TestVulnWaiversAccept(t *testing.T) {
+	waivers := &vulnWaivers{Waivers: []VulnWaiver{
+		{Cve: "CVE-2024-1234", Package: "Newtonsoft.Json"},
+		{Cve: "CVE-2024-9999", Package: "System.Text.Json", Expired: true},
+	}}
+	findings := []Finding{
+		{RuleID: "cve-2024-1234", Package: "newtonsoft.json"},
+		{RuleID: "CVE-2024-1234", Package: "Serilog"},
+	}
+	remaining, accepted := waivers.accept(findings)
+	if !reflect.DeepEqual(accepted, findings[:1]) || !reflect.DeepEqual(remaining, findings[1:]) {
+		t.Errorf("accept = %v remaining, %v accepted", remaining, accepted)
+	}
+	if err := waivers.checkExpired(); err == nil {
+		t.Error("checkExpired passed with an expired waiver")
+	}
+}
+
+func TestSecurityBaselineIds(t *testing.T) {
+	baseline := &securityBaseline{Suppressions: []SecuritySuppression{
+		{Tool: "trivy", Id: "CVE-2024-1234"},
+		{Tool: "trivy", Id: "CVE-2024-1234"},
+		{Tool: "trivy", Id: "CVE-2023-0001", Expired: true},
+		{Tool: "semgrep", Id: "csharp.lang.security.xss"},
+	}}
+	if got, want := baseline.ids("trivy"), []string{"CVE-2024-1234"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids(trivy) = %v, want %v", got, want)
+	}
+	if err := baseline.checkExpired(); err == nil {
+		t.Error("checkExpired passed with an expired suppression")
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sarifLog is the subset of a SARIF 2.1.0 document the pipeline reads and writes
+type sarifLog struct {
+	Schema  string     `json:"$schema,omitempty"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+	// Distinguishes runs of the same tool, e.g. as the code scanning category
+	AutomationDetails *sarifAutomationDetails `json:"automationDetails,omitempty"`
+}
+
+type sarifAutomationDetails struct {
+	ID string `json:"id"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name,omitempty"`
+	ShortDescription *sarifMessage   `json:"shortDescription,omitempty"`
+	HelpURI          string          `json:"helpUri,omitempty"`
+	Properties       json.RawMessage `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level,omitempty"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          json.RawMessage   `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine,omitempty"`
+}
+
+// parseSarif decodes and sanity-checks a SARIF document
+func parseSarif(content string) (*sarifLog, error) {
+	var log sarifLog
+	if err := json.Unmarshal([]byte(content), &log); err != nil {
+		return nil, fmt.Errorf("invalid SARIF document: %w", err)
+	}
+	if !strings.HasPrefix(log.Version, "2.1") {
+		return nil, fmt.Errorf("unsupported SARIF version %q (expected 2.1.0)", log.Version)
+	}
+	return &log, nil
+}
+
+// sarifDrivers names the tools whose JSON reports are converted to SARIF runs
+var sarifDrivers = map[string]sarifDriver{
+	"trivy":            {Name: "Trivy", InformationURI: "https://github.com/aquasecurity/trivy"},
+	"grype":            {Name: "Grype", InformationURI: "https://github.com/anchore/grype"},
+	"dependency-check": {Name: "Dependency-Check", InformationURI: "https://owasp.org/www-project-dependency-check/"},
+	"semgrep":          {Name: "Semgrep", InformationURI: "https://semgrep.dev"},
+	"checkov":          {Name: "Checkov", InformationURI: "https://www.checkov.io"},
+	"zap":              {Name: "ZAP", InformationURI: "https://www.zaproxy.org"},
+	"nuclei":           {Name: "Nuclei", InformationURI: "https://github.com/projectdiscovery/nuclei"},
+}
+
+// securitySeverityScores are the security-severity values code scanning ranks alerts by,
+// within the CVSS band of each normalized severity
+var securitySeverityScores = map[string]string{
+	"CRITICAL": "9.5",
+	"HIGH":     "8.0",
+	"MEDIUM":   "5.5",
+	"LOW":      "2.0",
+}
+
+// sarifLevel maps a normalized severity onto a SARIF result level
+func sarifLevel(severity string) string {
+	switch severity {
+	case "CRITICAL", "HIGH":
+		return "error"
+	case "MEDIUM":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// findingsRun converts normalized findings of a tool into a SARIF run
+// Rules carry the highest severity of their findings and the CWE as a tag
+func findingsRun(tool string, findings []Finding) (sarifRun, error) {
+	driver, ok := sarifDrivers[tool]
+	if !ok {
+		driver = sarifDriver{Name: tool}
+	}
+	run := sarifRun{Results: []sarifResult{}}
+
+	rules := map[string]*Finding{}
+	var ruleIDs []string
+	for i := range findings {
+		f := &findings[i]
+		if rule, ok := rules[f.RuleID]; !ok {
+			rules[f.RuleID] = f
+			ruleIDs = append(ruleIDs, f.RuleID)
+		} else if severityRank[f.Severity] > severityRank[rule.Severity] {
+			rules[f.RuleID] = f
+		}
+
+		message := f.Title
+		if f.Package != "" {
+			message = fmt.Sprintf("%s: %s %s", f.Title, f.Package, f.Version)
+			if f.FixedVersion != "" {
+				message += fmt.Sprintf(" (fixed in %s)", f.FixedVersion)
+			}
+		}
+		result := sarifResult{
+			RuleID:              f.RuleID,
+			Level:               sarifLevel(f.Severity),
+			Message:             sarifMessage{Text: message},
+			PartialFingerprints: map[string]string{"searchApiFingerprint/v1": f.Fingerprint},
+		}
+		if f.Location != "" {
+			location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.Location},
+			}}
+			if f.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	sort.Strings(ruleIDs)
+	for _, id := range ruleIDs {
+		f := rules[id]
+		props := map[string]any{}
+		if score, ok := securitySeverityScores[f.Severity]; ok {
+			props["security-severity"] = score
+		}
+		tags := []string{"security"}
+		if f.CWE != "" {
+			tags = append(tags, f.CWE)
+		}
+		props["tags"] = tags
+		properties, err := json.Marshal(props)
+		if err != nil {
+			return run, err
+		}
+		rule := sarifRule{ID: id, Name: id, HelpURI: f.URL, Properties: properties}
+		if f.Title != "" {
+			rule.ShortDescription = &sarifMessage{Text: f.Title}
+		}
+		driver.Rules = append(driver.Rules, rule)
+	}
+	run.Tool.Driver = driver
+	return run, nil
+}
+
+// AggregateSarif merges the scan reports in a directory into one SARIF 2.1.0 document
+// with a run per tool, for code scanning backends that take a single upload
+// SARIF reports (Semgrep, C# analyzers) keep their runs; Trivy, Grype, Dependency-Check,
+// Semgrep, Checkov, ZAP and Nuclei JSON reports are converted. Each run is categorized
+// by its report name so results of one scan don't close another's alerts
+// Reports without findings (SBOMs, plain text) are left out
+func (m *SearchApi) AggregateSarif(
+	ctx context.Context,
+	// Directory of scan reports (e.g., the reports of FullPipeline or ExportPipelineReports)
+	reports *dagger.Directory,
+) (*dagger.File, error) {
+	entries, err := reports.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	sort.Strings(entries)
+
+	merged := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{},
+	}
+	for _, name := range entries {
+		switch path.Ext(name) {
+		case ".json", ".jsonl", ".sarif":
+		default:
+			continue
+		}
+		content, err := reports.File(name).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", name, err)
+		}
+
+		category := strings.TrimSuffix(name, path.Ext(name))
+		var runs []sarifRun
+		switch format := reportFormat(content); format {
+		case "":
+			continue
+		case "sarif":
+			log, err := parseSarif(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse report %s: %w", name, err)
+			}
+			runs = log.Runs
+		default:
+			findings, err := parseFindings(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse report %s: %w", name, err)
+			}
+			run, err := findingsRun(format, findings)
+			if err != nil {
+				return nil, err
+			}
+			runs = []sarifRun{run}
+		}
+
+		for i, run := range runs {
+			if run.AutomationDetails == nil {
+				id := category + "/"
+				if len(runs) > 1 {
+					id = fmt.Sprintf("%s-%d/", category, i+1)
+				}
+				run.AutomationDetails = &sarifAutomationDetails{ID: id}
+			}
+			merged.Runs = append(merged.Runs, run)
+		}
+	}
+
+	content, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().WithNewFile("merged.sarif", string(content)).File("merged.sarif"), nil
+}
+
+// codeScanning calls the GitHub code scanning and git APIs of a repository
+type codeScanning struct {
+	apiUrl string
+	repo   string
+	token  *dagger.Secret
+}
+
+func (c codeScanning) request(method, path, body string) httpRequest {
+	req := httpRequest{
+		method: method,
+		url:    fmt.Sprintf("%s/repos/%s%s", strings.TrimSuffix(c.apiUrl, "/"), c.repo, path),
+		headers: []string{
+			"Accept: application/vnd.github+json",
+			"X-GitHub-Api-Version: 2022-11-28",
+		},
+		body:       body,
+		token:      c.token,
+		authPrefix: "Authorization: Bearer",
+	}
+	if body != "" {
+		req.headers = append(req.headers, "Content-Type: application/json")
+	}
+	return req
+}
+
+// upload validates a SARIF document and posts it gzipped and base64 encoded, as the
+// code scanning API expects; it returns GitHub's response (upload ID and URL)
+func (c codeScanning) upload(ctx context.Context, content, ref, commitSha string) (string, error) {
+	if _, err := parseSarif(content); err != nil {
+		return "", err
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		return "", fmt.Errorf("failed to compress SARIF report: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress SARIF report: %w", err)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"commit_sha": commitSha,
+		"ref":        ref,
+		"sarif":      base64.StdEncoding.EncodeToString(compressed.Bytes()),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.request("POST", "/code-scanning/sarifs", string(payload)).do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("SARIF upload failed: %w", err)
+	}
+	return response, nil
+}
+
+// commitSha resolves a git ref (e.g., "refs/pull/42/merge") to the commit it points to
+func (c codeScanning) commitSha(ctx context.Context, ref string) (string, error) {
+	response, err := c.request("GET", "/git/ref/"+strings.TrimPrefix(ref, "refs/"), "").do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	var resolved struct {
+		Object struct {
+			Sha  string `json:"sha"`
+			Type string `json:"type"`
+		} `json:"object"`
+	}
+	if err := json.Unmarshal([]byte(response), &resolved); err != nil {
+		return "", fmt.Errorf("unexpected git ref response: %w", err)
+	}
+	if resolved.Object.Type == "tag" {
+		// Annotated tags point to a tag object, which points to the commit
+		response, err := c.request("GET", "/git/tags/"+resolved.Object.Sha, "").do(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+		}
+		if err := json.Unmarshal([]byte(response), &resolved); err != nil {
+			return "", fmt.Errorf("unexpected git tag response: %w", err)
+		}
+	}
+	if resolved.Object.Type != "commit" {
+		return "", fmt.Errorf("%s doesn't point to a commit", ref)
+	}
+	return resolved.Object.Sha, nil
+}
+
+// awaitProcessing polls an upload until GitHub has processed it, so results that
+// GitHub rejects fail the caller instead of silently not showing up
+func (c codeScanning) awaitProcessing(ctx context.Context, id string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		response, err := c.request("GET", "/code-scanning/sarifs/"+id, "").do(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to check SARIF upload %s: %w", id, err)
+		}
+		var status struct {
+			ProcessingStatus string   `json:"processing_status"`
+			AnalysesURL      string   `json:"analyses_url"`
+			Errors           []string `json:"errors"`
+		}
+		if err := json.Unmarshal([]byte(response), &status); err != nil {
+			return "", fmt.Errorf("unexpected SARIF upload status: %w", err)
+		}
+		switch status.ProcessingStatus {
+		case "complete":
+			return status.AnalysesURL, nil
+		case "failed":
+			return "", fmt.Errorf("GitHub rejected SARIF upload %s: %s", id, strings.Join(status.Errors, "; "))
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("SARIF upload %s still %s after %s", id, status.ProcessingStatus, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// UploadSarif uploads a SARIF report to GitHub Code Scanning
+// Findings then appear in the repository's Security tab, where GitHub tracks
+// alert lifecycle (new, fixed, dismissed) across commits
+// GitLab has no upload API; its security dashboard reads the report of
+// GitlabSastReport published as a job's reports:sast artifact
+func (m *SearchApi) UploadSarif(
+	ctx context.Context,
+	// SARIF 2.1.0 report to upload
+	sarif *dagger.File,
+	// Token with security_events write permission
+	token *dagger.Secret,
+	// Repository (format: owner/repo)
+	repo string,
+	// Git ref that was analyzed (e.g., "refs/heads/main", "refs/pull/42/merge")
+	ref string,
+	// Commit SHA that was analyzed
+	commitSha string,
+	// API base URL (override for GitHub Enterprise Server)
+	// +default="https://api.github.com"
+	apiUrl string,
+) (string, error) {
+	content, err := sarif.Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SARIF report: %w", err)
+	}
+	return codeScanning{apiUrl, repo, token}.upload(ctx, content, ref, commitSha)
+}
+
+// PublishToGithubCodeScanning uploads a (merged) SARIF document to GitHub Code Scanning
+// and waits until GitHub has processed it. For a pull request ref
+// ("refs/pull/42/merge") the results show up as annotations on the PR
+// The commit is resolved from the ref unless given
+func (m *SearchApi) PublishToGithubCodeScanning(
+	ctx context.Context,
+	// SARIF 2.1.0 document (e.g., from AggregateSarif)
+	sarif string,
+	// Repository (format: owner/repo)
+	repo string,
+	// Git ref that was analyzed (e.g., "refs/heads/main", "refs/pull/42/merge")
+	ref string,
+	// Token with security_events write permission
+	token *dagger.Secret,
+	// Commit SHA that was analyzed (defaults to the commit ref points to)
+	// +optional
+	commitSha string,
+	// API base URL (override for GitHub Enterprise Server)
+	// +default="https://api.github.com"
+	apiUrl string,
+	// How long to wait for GitHub to process the upload
+	// +default="2m"
+	timeout string,
+) (string, error) {
+	wait, err := time.ParseDuration(timeout)
+	if err != nil {
+		return "", fmt.Errorf("invalid timeout %q: %w", timeout, err)
+	}
+	github := codeScanning{apiUrl, repo, token}
+	if commitSha == "" {
+		if commitSha, err = github.commitSha(ctx, ref); err != nil {
+			return "", err
+		}
+	}
+
+	response, err := github.upload(ctx, sarif, ref, commitSha)
+	if err != nil {
+		return "", err
+	}
+	var upload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(response), &upload); err != nil || upload.ID == "" {
+		return "", fmt.Errorf("unexpected SARIF upload response: %s", response)
+	}
+	id := upload.ID
+	analyses, err := github.awaitProcessing(ctx, id, wait)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Published SARIF upload %s for %s (%s)\nAnalyses: %s\n", id, ref, commitSha[:min(len(commitSha), 12)], analyses), nil
+}
+
+// gitlabSeverities maps normalized severities onto the GitLab security report's
+// severity levels; anything else is reported as Unknown
+var gitlabSeverities = map[string]string{
+	"CRITICAL": "Critical",
+	"HIGH":     "High",
+	"MEDIUM":   "Medium",
+	"LOW":      "Low",
+	"INFO":     "Info",
+}
+
+// gitlabReportVersion is the GitLab security report schema the SAST report follows
+const gitlabReportVersion = "15.0.7"
+
+// gitlabIdentifier is a rule, CVE or CWE a GitLab vulnerability is reported under
+type gitlabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	URL   string `json:"url,omitempty"`
+}
+
+type gitlabVulnerability struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Severity    string             `json:"severity"`
+	Identifiers []gitlabIdentifier `json:"identifiers"`
+	Location    struct {
+		File      string `json:"file,omitempty"`
+		StartLine int    `json:"start_line,omitempty"`
+	} `json:"location"`
+}
+
+type gitlabTool struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Vendor  struct {
+		Name string `json:"name"`
+	} `json:"vendor"`
+}
+
+// gitlabSecurityReport is a GitLab SAST security report (gl-sast-report.json)
+type gitlabSecurityReport struct {
+	Version         string                `json:"version"`
+	Vulnerabilities []gitlabVulnerability `json:"vulnerabilities"`
+	Scan            struct {
+		Analyzer  gitlabTool `json:"analyzer"`
+		Scanner   gitlabTool `json:"scanner"`
+		Type      string     `json:"type"`
+		StartTime string     `json:"start_time"`
+		EndTime   string     `json:"end_time"`
+		Status    string     `json:"status"`
+	} `json:"scan"`
+}
+
+// gitlabSastReport converts normalized findings into a GitLab SAST report
+// A report holds a single scanner, so the scanning tool of each finding is kept in
+// its rule identifier's type (e.g., "semgrep_id"); the fingerprint is the
+// vulnerability ID, so GitLab tracks a finding across pipelines. Findings in a
+// package are left out: GitLab only takes those from a dependency_scanning report
+func gitlabSastReport(findings []Finding, scanned time.Time) gitlabSecurityReport {
+	report := gitlabSecurityReport{Version: gitlabReportVersion, Vulnerabilities: []gitlabVulnerability{}}
+	tool := gitlabTool{ID: "search-api-sarif", Name: "Search API security pipeline", Version: "1.0"}
+	tool.Vendor.Name = "search-api"
+	report.Scan.Analyzer, report.Scan.Scanner = tool, tool
+	report.Scan.Type = "sast"
+	report.Scan.StartTime = scanned.UTC().Format("2006-01-02T15:04:05")
+	report.Scan.EndTime = report.Scan.StartTime
+	report.Scan.Status = "success"
+
+	for _, f := range findings {
+		if f.Package != "" {
+			continue
+		}
+		v := gitlabVulnerability{
+			ID:          f.Fingerprint,
+			Name:        cmp.Or(f.Title, f.RuleID),
+			Description: f.Description,
+			Severity:    cmp.Or(gitlabSeverities[f.Severity], "Unknown"),
+		}
+		ruleType := strings.ReplaceAll(cmp.Or(f.Tool, "sarif"), " ", "_") + "_id"
+		if cvePattern.MatchString(f.RuleID) {
+			ruleType = "cve"
+		}
+		rule := cmp.Or(f.RuleID, f.Fingerprint)
+		v.Identifiers = append(v.Identifiers, gitlabIdentifier{Type: ruleType, Name: rule, Value: rule, URL: f.URL})
+		if f.CWE != "" {
+			id := strings.TrimPrefix(f.CWE, "CWE-")
+			v.Identifiers = append(v.Identifiers, gitlabIdentifier{
+				Type:  "cwe",
+				Name:  f.CWE,
+				Value: id,
+				URL:   "https://cwe.mitre.org/data/definitions/" + id + ".html",
+			})
+		}
+		v.Location.File = f.Location
+		v.Location.StartLine = f.Line
+		report.Vulnerabilities = append(report.Vulnerabilities, v)
+	}
+	return report
+}
+
+// GitlabSastReport converts a SARIF report (e.g., from AggregateSarif) into GitLab's
+// SAST security report format. Publish it as gl-sast-report.json under a job's
+// artifacts:reports:sast and the findings appear in the merge request security
+// widget and the project's vulnerability report, where GitLab tracks their state.
+// Vulnerable package findings (Trivy, Grype, ...) aren't SAST findings and are left out
+func (m *SearchApi) GitlabSastReport(
+	ctx context.Context,
+	// SARIF 2.1.0 report to convert
+	sarif *dagger.File,
+) (*dagger.File, error) {
+	content, err := sarif.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SARIF report: %w", err)
+	}
+	findings, err := parseSarifFindings(content)
+	if err != nil {
+		return nil, err
+	}
+	report, err := json.MarshalIndent(gitlabSastReport(findings, time.Now()), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().WithNewFile("gl-sast-report.json", string(report)).File("gl-sast-report.json"), nil
+}
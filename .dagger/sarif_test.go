@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGitlabSastReport(t *testing.T) {
+	findings, err := parseSarifFindings(`{
+		"version": "2.1.0",
+		"runs": [{
+			"tool": {"driver": {"name": "Semgrep", "rules": [{
+				"id": "csharp.lang.security.xss",
+				"shortDescription": {"text": "Unescaped output"},
+				"helpUri": "https://semgrep.dev/r/csharp.lang.security.xss",
+				"properties": {"security-severity": "8.0", "tags": ["security", "CWE-79"]}
+			}]}},
+			"results": [{
+				"ruleId": "csharp.lang.security.xss",
+				"level": "warning",
+				"message": {"text": "User input reaches the response"},
+				"locations": [{"physicalLocation": {"artifactLocation": {"uri": "SearchApi/Program.cs"}, "region": {"startLine": 42}}}]
+			}]
+		}, {
+			"tool": {"driver": {"name": "Trivy"}},
+			"results": [{"ruleId": "CVE-2024-1234", "level": "note", "message": {"text": "Outdated package"}}]
+		}]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Package findings belong in a dependency scanning report
+	findings = append(findings, Finding{Tool: "grype", RuleID: "CVE-2024-5678", Severity: "HIGH", Package: "Newtonsoft.Json", Version: "12.0.1"})
+	report := gitlabSastReport(findings, time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC))
+
+	if report.Version != gitlabReportVersion || report.Scan.Type != "sast" || report.Scan.StartTime != "2026-03-01T12:30:00" {
+		t.Errorf("scan = %+v (version %s)", report.Scan, report.Version)
+	}
+	if len(report.Vulnerabilities) != 2 {
+		t.Fatalf("got %d vulnerabilities, want 2", len(report.Vulnerabilities))
+	}
+
+	xss := report.Vulnerabilities[0]
+	if xss.ID != findings[0].Fingerprint || xss.Name != "Unescaped output" || xss.Severity != "High" ||
+		xss.Location.File != "SearchApi/Program.cs" || xss.Location.StartLine != 42 {
+		t.Errorf("semgrep vulnerability = %+v", xss)
+	}
+	wantIdentifiers := []gitlabIdentifier{
+		{Type: "semgrep_id", Name: "csharp.lang.security.xss", Value: "csharp.lang.security.xss", URL: "https://semgrep.dev/r/csharp.lang.security.xss"},
+		{Type: "cwe", Name: "CWE-79", Value: "79", URL: "https://cwe.mitre.org/data/definitions/79.html"},
+	}
+	if !reflect.DeepEqual(xss.Identifiers, wantIdentifiers) {
+		t.Errorf("identifiers = %+v, want %+v", xss.Identifiers, wantIdentifiers)
+	}
+
+	cve := report.Vulnerabilities[1]
+	if cve.Severity != "Low" || cve.Location.File != "" || len(cve.Identifiers) != 1 || cve.Identifiers[0].Type != "cve" {
+		t.Errorf("trivy vulnerability = %+v", cve)
+	}
+}
+
+func TestGitlabSastReportWithoutFindings(t *testing.T) {
+	report := gitlabSastReport(nil, time.Now())
+	if report.Vulnerabilities == nil || len(report.Vulnerabilities) != 0 {
+		t.Errorf("vulnerabilities = %#v, want an empty list", report.Vulnerabilities)
+	}
+}
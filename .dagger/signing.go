@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// provenanceBuilder identifies this pipeline as the builder in SLSA provenance
+const provenanceBuilder = "https://github.com/carpelan/search-api/.dagger"
+
+// SigningBundle records what SignAndAttestAll published, all bound to one digest
+type SigningBundle struct {
+	// Image reference pinned by digest (e.g., "ghcr.io/myorg/search-api@sha256:...")
+	Image string
+	// Image digest (sha256:...)
+	Digest string
+	// Tag holding the cosign signature (<repository>:sha256-<hex>.sig)
+	Signature string
+	// Tag holding the cosign attestations (<repository>:sha256-<hex>.att)
+	Attestations string
+	// Predicate types attested for the image
+	PredicateTypes []string
+}
+
+// sbomPredicateType validates an SBOM and returns its cosign predicate type
+// The document must be SPDX JSON or CycloneDX JSON with its mandatory fields; an
+// explicit predicate type must match the detected format
+func sbomPredicateType(content string, predicateType string) (string, error) {
+	var doc struct {
+		SpdxVersion string `json:"spdxVersion"`
+		SPDXID      string `json:"SPDXID"`
+		Name        string `json:"name"`
+		BomFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return "", fmt.Errorf("SBOM is not valid JSON: %w", err)
+	}
+
+	var detected string
+	switch {
+	case doc.SpdxVersion != "":
+		if !strings.HasPrefix(doc.SpdxVersion, "SPDX-2.") || doc.SPDXID == "" || doc.Name == "" {
+			return "", fmt.Errorf("invalid SPDX SBOM: spdxVersion (SPDX-2.x), SPDXID and name are required")
+		}
+		detected = "spdxjson"
+	case doc.BomFormat == "CycloneDX":
+		if doc.SpecVersion == "" {
+			return "", fmt.Errorf("invalid CycloneDX SBOM: specVersion is required")
+		}
+		detected = "cyclonedx"
+	default:
+		return "", fmt.Errorf("unrecognized SBOM format: expected SPDX JSON or CycloneDX JSON")
+	}
+
+	if predicateType != "" && predicateType != detected {
+		return "", fmt.Errorf("SBOM is %s but predicate type %s was requested", detected, predicateType)
+	}
+	return detected, nil
+}
+
+// registryAuthConfig builds a Docker config.json holding registry credentials, for
+// tools that read them from DOCKER_CONFIG rather than from flags
+func registryAuthConfig(ctx context.Context, registryUrl string, username string, password *dagger.Secret) (*dagger.Secret, error) {
+	return registryAuthConfigs(ctx, registryLogin{registryUrl, username, password})
+}
+
+// registryLogin is the credentials for one registry
+type registryLogin struct {
+	registryUrl string
+	username    string
+	password    *dagger.Secret
+}
+
+// registryAuthConfigs builds a Docker config.json holding the credentials of
+// several registries, e.g. for copying between them
+func registryAuthConfigs(ctx context.Context, logins ...registryLogin) (*dagger.Secret, error) {
+	auths := map[string]any{}
+	var hosts []string
+	for _, login := range logins {
+		plaintext, err := login.password.Plaintext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the password for %s: %w", login.registryUrl, err)
+		}
+		auths[login.registryUrl] = map[string]string{
+			"auth": base64.StdEncoding.EncodeToString([]byte(login.username + ":" + plaintext)),
+		}
+		hosts = append(hosts, login.registryUrl)
+	}
+	config, err := json.Marshal(map[string]any{"auths": auths})
+	if err != nil {
+		return nil, err
+	}
+	return dag.SetSecret("registry-auth-"+strings.Join(hosts, "-"), string(config)), nil
+}
+
+// Sigstore's public-good instances, used for keyless signing
+const (
+	sigstoreFulcioUrl = "https://fulcio.sigstore.dev"
+	sigstoreRekorUrl  = "https://rekor.sigstore.dev"
+)
+
+// signatureTag is the tag cosign stores an image's signature under
+func signatureTag(repository, digest string) string {
+	return repository + ":" + strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// SignImageKeyless signs a pushed image with the CI's OIDC identity (e.g., GitHub
+// Actions) instead of a long-lived key pair: Fulcio issues a short-lived certificate
+// for the identity and the signature is recorded in Rekor
+// Verify with cosign verify --certificate-identity (the workflow) and
+// --certificate-oidc-issuer; there is no public key to distribute
+func (m *SearchApi) SignImageKeyless(
+	ctx context.Context,
+	// Image reference pinned by digest (e.g., "ghcr.io/myorg/search-api@sha256:...")
+	imageRef string,
+	// OIDC identity token with the sigstore audience (on GitHub Actions, requested
+	// from ACTIONS_ID_TOKEN_REQUEST_URL with audience=sigstore)
+	oidcToken *dagger.Secret,
+	// Registry URL, for pushing the signature to a private registry
+	// +optional
+	registryUrl string,
+	// +optional
+	username *dagger.Secret,
+	// +optional
+	password *dagger.Secret,
+	// Fulcio certificate authority
+	// +default="https://fulcio.sigstore.dev"
+	fulcioUrl string,
+	// Rekor transparency log
+	// +default="https://rekor.sigstore.dev"
+	rekorUrl string,
+) (*SigningBundle, error) {
+	// A tag could move between signing and verification; a digest can't
+	repository, _, digest := splitImageRef(imageRef)
+	if digest == "" {
+		return nil, fmt.Errorf("image %s must be pinned by digest to be signed", imageRef)
+	}
+
+	var dockerConfig *dagger.Secret
+	if registryUrl != "" && username != nil && password != nil {
+		usernameStr, err := username.Plaintext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read username: %w", err)
+		}
+		if dockerConfig, err = registryAuthConfig(ctx, registryUrl, usernameStr, password); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := dag.Cosign().SignKeyless(ctx, imageRef, oidcToken, dagger.CosignSignKeylessOpts{
+		FulcioURL:    fulcioUrl,
+		RekorURL:     rekorUrl,
+		DockerConfig: dockerConfig,
+	}); err != nil {
+		return nil, fmt.Errorf("keyless signing failed: %w", err)
+	}
+	return &SigningBundle{
+		Image:     imageRef,
+		Digest:    digest,
+		Signature: signatureTag(repository, digest),
+	}, nil
+}
+
+// SignAndAttestAll publishes the image, then signs it and attests its SBOM and
+// build provenance, all by the digest that was pushed
+// Signing by digest rather than tag means a tag moved in between can't end up with
+// another image's signature or attestations
+func (m *SearchApi) SignAndAttestAll(
+	ctx context.Context,
+	container *dagger.Container,
+	registryUrl string,
+	username *dagger.Secret,
+	password *dagger.Secret,
+	// Image reference (e.g., "myproject/search-api" or "ghcr.io/myorg/search-api")
+	imageRef string,
+	tag string,
+	// Private key for signing (use cosign generate-key-pair to create)
+	privateKey *dagger.Secret,
+	// Password for the private key
+	keyPassword *dagger.Secret,
+	// Upload signature and attestations to the transparency log (Rekor)
+	// +default=false
+	tlogUpload bool,
+	// Repository including .git, the source recorded in the provenance
+	// +defaultPath="/"
+	repo *dagger.Directory,
+) (*SigningBundle, error) {
+	startedOn := time.Now().UTC()
+	source, err := gitSource(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	pushed, err := m.PushToRegistry(ctx, container, registryUrl, username, password, imageRef, tag, nil, 3, false, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	repository, digest, pinned := pushed.Repository, pushed.Digest, pushed.Ref
+
+	usernameStr, err := username.Plaintext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read username: %w", err)
+	}
+	dockerConfig, err := registryAuthConfig(ctx, registryUrl, usernameStr, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dag.Cosign().Sign(ctx, container, privateKey, keyPassword, pinned, dagger.CosignSignOpts{
+		TlogUpload:   tlogUpload,
+		DockerConfig: dockerConfig,
+	}); err != nil {
+		return nil, fmt.Errorf("image signing failed: %w", err)
+	}
+
+	sbom, err := dag.Syft().ScanContainer(ctx, container, dagger.SyftScanContainerOpts{
+		Format: "spdx-json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SBOM generation failed: %w", err)
+	}
+	if _, err := sbomPredicateType(sbom, "spdxjson"); err != nil {
+		return nil, err
+	}
+
+	provenance := newProvenance("SignAndAttestAll", source, map[string]string{
+		"registryUrl": registryUrl,
+		"imageRef":    imageRef,
+		"tag":         tag,
+	}, "", startedOn, time.Now())
+	predicate, err := json.Marshal(provenance)
+	if err != nil {
+		return nil, err
+	}
+
+	attestations := []struct {
+		predicateType string
+		content       string
+	}{
+		{"spdxjson", sbom},
+		{provenancePredicateType, string(predicate)},
+	}
+	bundle := &SigningBundle{
+		Image:        pinned,
+		Digest:       digest,
+		Signature:    signatureTag(repository, digest),
+		Attestations: repository + ":" + strings.Replace(digest, ":", "-", 1) + ".att",
+	}
+	for _, a := range attestations {
+		document := dag.Directory().WithNewFile("predicate.json", a.content).File("predicate.json")
+		if _, err := dag.Cosign().Attest(ctx, document, privateKey, keyPassword, pinned, dagger.CosignAttestOpts{
+			PredicateType: a.predicateType,
+			TlogUpload:    tlogUpload,
+			DockerConfig:  dockerConfig,
+		}); err != nil {
+			return nil, fmt.Errorf("%s attestation failed: %w", a.predicateType, err)
+		}
+		bundle.PredicateTypes = append(bundle.PredicateTypes, a.predicateType)
+	}
+
+	return bundle, nil
+}
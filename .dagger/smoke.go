@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSmokeEndpoints are the checks SmokeTest runs when none are given: liveness,
+// readiness (Solr reachable) and a canned search
+var defaultSmokeEndpoints = []string{
+	"GET /health",
+	"GET /ready",
+	`POST /api/search/search {"query":"*:*","rows":1}`,
+}
+
+// smokeShapes lists the JSON fields a successful response of an endpoint must have
+var smokeShapes = map[string][]string{
+	"/api/search/search": {"totalResults", "results", "queryTime", "start", "rows"},
+}
+
+// smokeScript waits for the API to come up, then sends every request in
+// /checks/manifest once, saving each response body and a "<index> <status> <seconds>" line
+const smokeScript = `set -e
+for i in $(seq 1 60); do
+  curl -sf http://api:8080/health >/dev/null && break
+  sleep 2
+done
+mkdir -p /out
+while read -r i method path; do
+  data=""
+  [ -s "/checks/$i.json" ] && data="--data-binary @/checks/$i.json"
+  result=$(curl -s -o "/out/$i.json" -w '%{http_code} %{time_total}' --max-time 10 \
+    -X "$method" -H 'Content-Type: application/json' $data "http://api:8080$path" || echo "000 0")
+  echo "$i $result" >> /out/results.tsv
+done < /checks/manifest
+`
+
+// SmokeCheck is the result of one SmokeTest request
+type SmokeCheck struct {
+	// Request (e.g., "GET /ready")
+	Endpoint string
+	// HTTP status (0 when the API didn't answer)
+	Status          int
+	DurationSeconds float64
+	Passed          bool
+	// Why the check failed
+	Problem string
+}
+
+// SmokeTestResult is the outcome of SmokeTest
+type SmokeTestResult struct {
+	Passed int
+	Failed int
+	Checks []*SmokeCheck
+}
+
+// text renders the result for pipeline reports
+func (r *SmokeTestResult) text() string {
+	text := fmt.Sprintf("%d passed, %d failed\n", r.Passed, r.Failed)
+	for _, c := range r.Checks {
+		mark := "✓"
+		if !c.Passed {
+			mark = "✗"
+		}
+		text += fmt.Sprintf("   %s %s → %d (%.2fs)", mark, c.Endpoint, c.Status, c.DurationSeconds)
+		if c.Problem != "" {
+			text += ": " + c.Problem
+		}
+		text += "\n"
+	}
+	return text
+}
+
+// smokeRequest is one request of a smoke test
+type smokeRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+// parseSmokeEndpoint parses "[METHOD] /path [JSON body]"; the method defaults to GET
+func parseSmokeEndpoint(endpoint string) (smokeRequest, error) {
+	fields := strings.SplitN(strings.TrimSpace(endpoint), " ", 3)
+	req := smokeRequest{method: "GET"}
+	if !strings.HasPrefix(fields[0], "/") {
+		req.method, fields = strings.ToUpper(fields[0]), fields[1:]
+	}
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return req, fmt.Errorf("invalid endpoint %q: expected \"[METHOD] /path [JSON body]\"", endpoint)
+	}
+	req.path = fields[0]
+	if len(fields) > 1 {
+		req.body = strings.Join(fields[1:], " ")
+		if !json.Valid([]byte(req.body)) {
+			return req, fmt.Errorf("invalid endpoint %q: body is not valid JSON", endpoint)
+		}
+	}
+	return req, nil
+}
+
+// checkSmokeResponse validates a response's status and, for known endpoints, the
+// fields of its JSON body
+func checkSmokeResponse(req smokeRequest, status int, body string) string {
+	if status == 0 {
+		return "no response"
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Sprintf("unexpected status %d", status)
+	}
+	fields, ok := smokeShapes[req.path]
+	if !ok {
+		return ""
+	}
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return "response is not a JSON object"
+	}
+	var missing []string
+	for _, field := range fields {
+		if _, ok := response[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return "response is missing " + strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+// smokeTest runs the endpoint checks against the API
+func smokeTest(ctx context.Context, apiService *dagger.Service, endpoints []string) (*SmokeTestResult, error) {
+	if len(endpoints) == 0 {
+		endpoints = defaultSmokeEndpoints
+	}
+	requests := make([]smokeRequest, len(endpoints))
+	checks := dag.Directory()
+	var manifest strings.Builder
+	for i, endpoint := range endpoints {
+		req, err := parseSmokeEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		requests[i] = req
+		fmt.Fprintf(&manifest, "%d %s %s\n", i, req.method, req.path)
+		checks = checks.WithNewFile(fmt.Sprintf("%d.json", i), req.body)
+	}
+	checks = checks.WithNewFile("manifest", manifest.String())
+
+	out := dag.Container().
+		From(curlImage).
+		WithServiceBinding("api", apiService).
+		WithDirectory("/checks", checks).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", smokeScript}).
+		Directory("/out")
+	tsv, err := out.File("results.tsv").Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read smoke test results: %w", err)
+	}
+
+	result := &SmokeTestResult{}
+	for _, req := range requests {
+		result.Checks = append(result.Checks, &SmokeCheck{Endpoint: req.method + " " + req.path, Problem: "no response"})
+	}
+	for _, line := range strings.Split(strings.TrimSpace(tsv), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		i, err := strconv.Atoi(fields[0])
+		if err != nil || i >= len(requests) {
+			continue
+		}
+		check := result.Checks[i]
+		check.Status, _ = strconv.Atoi(fields[1])
+		check.DurationSeconds, _ = strconv.ParseFloat(fields[2], 64)
+		body, _ := out.File(fmt.Sprintf("%d.json", i)).Contents(ctx)
+		check.Problem = checkSmokeResponse(requests[i], check.Status, body)
+	}
+	for _, check := range result.Checks {
+		check.Passed = check.Problem == ""
+		if check.Passed {
+			result.Passed++
+		} else {
+			result.Failed++
+		}
+	}
+	if result.Failed > 0 {
+		return result, fmt.Errorf("%d smoke check(s) failed:\n%s", result.Failed, result.text())
+	}
+	return result, nil
+}
+
+// SmokeTest hits the API's health, readiness and a canned search, validating status
+// codes and the JSON shape of known responses
+// Cheap enough to run right after deployment or when RunApiWithServices starts, so a
+// broken service fails fast instead of in the expensive DAST and performance steps
+func (m *SearchApi) SmokeTest(
+	ctx context.Context,
+	// Running API, listening on port 8080 (e.g., from RunApiWithServices)
+	apiService *dagger.Service,
+	// Requests as "[METHOD] /path [JSON body]" (defaults to GET /health, GET /ready and a search)
+	// +optional
+	endpoints []string,
+) (*SmokeTestResult, error) {
+	return smokeTest(ctx, apiService, endpoints)
+}
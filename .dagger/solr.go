@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Solr core used by the API (see Solr__Url in RunApiWithServices)
+const solrCore = "metadata"
+
+// solrImage returns the official Solr image for a version such as "8.11" or "9.4"
+func solrImage(version string) string {
+	if version == "" {
+		version = defaultSolrVersion
+	}
+	return "solr:" + version
+}
+
+// seedSolrScript starts Solr in the build container, creates the core, applies an
+// optional schema.json (Schema API payload) and indexes every fixture file, then
+// stops Solr cleanly so the data directory can be captured as a snapshot
+// When /cache already holds an index for the same fixtures it is restored instead
+const seedSolrScript = `set -e
+if [ -f "/cache/$SOLR_CORE/core.properties" ]; then
+  echo "Restoring cached $SOLR_CORE index"
+  cp -a /cache/. /var/solr/data/
+  exit 0
+fi
+
+solr start -p 8983 >/dev/null
+solr create_core -c "$SOLR_CORE" >/dev/null
+url="http://localhost:8983/solr/$SOLR_CORE"
+` + indexFixturesScript + `
+solr stop -p 8983 >/dev/null
+cp -a /var/solr/data/. /cache/
+`
+
+// indexFixturesScript applies /fixtures/schema.json, if any, to the core at $url and
+// indexes every other fixture file, then prints the resulting document count
+const indexFixturesScript = `
+if [ -f /fixtures/schema.json ]; then
+  curl -sS --fail-with-body -X POST -H 'Content-Type: application/json' --data-binary @/fixtures/schema.json "$url/schema"
+fi
+
+for f in /fixtures/*; do
+  case "$f" in
+    */schema.json) continue ;;
+    *.json|*.jsonl) type=application/json ;;
+    *.xml) type=text/xml ;;
+    *.csv) type=text/csv ;;
+    *) continue ;;
+  esac
+  echo "Indexing $f"
+  curl -sS --fail-with-body -X POST -H "Content-Type: $type" --data-binary @"$f" "$url/update"
+done
+
+curl -sS --fail-with-body "$url/update?commit=true"
+curl -sS "$url/select?q=*:*&rows=0"
+`
+
+// solrService starts Solr, restoring a snapshot when one is given
+// instance makes otherwise identical services distinct, so each consumer gets its
+// own Solr instead of sharing one whose index a previous run may have modified
+func solrService(version string, snapshot *dagger.Directory, instance string) *dagger.Service {
+	return solrContainer(version, snapshot, instance).AsService()
+}
+
+// solrContainer is the container behind solrService, for callers that customize it
+// The API's core is precreated, so nothing depends on the API creating it; a restored
+// snapshot that already has the core is left as it is
+func solrContainer(version string, snapshot *dagger.Directory, instance string) *dagger.Container {
+	solr := withPrecreatedCore(dag.Container().
+		From(solrImage(version)).
+		WithExposedPort(8983), solrCore, nil)
+
+	if snapshot != nil {
+		solr = solr.WithDirectory("/var/solr/data", snapshot, dagger.ContainerWithDirectoryOpts{
+			Owner: "solr",
+		})
+	}
+	if instance != "" {
+		solr = solr.WithEnvVariable("SOLR_INSTANCE", instance)
+	}
+
+	return solr
+}
+
+// solrConfigsetPath is where a custom configset is mounted for solr-precreate
+const solrConfigsetPath = "/opt/solr/server/solr/configsets/custom"
+
+// withPrecreatedCore makes the Solr image create a core at startup, from a configset
+// directory (with conf/solrconfig.xml and the schema) or Solr's _default configset
+func withPrecreatedCore(solr *dagger.Container, core string, configset *dagger.Directory) *dagger.Container {
+	args := []string{"solr-precreate", core}
+	if configset != nil {
+		solr = solr.WithDirectory(solrConfigsetPath, configset, dagger.ContainerWithDirectoryOpts{Owner: "solr"})
+		args = append(args, solrConfigsetPath)
+	}
+	return solr.WithDefaultArgs(args)
+}
+
+// solrReadyScript waits until the core answers queries
+const solrReadyScript = `for i in $(seq 1 90); do
+  curl -sf "http://solr:8983/solr/$SOLR_CORE/select?q=*:*&rows=0" >/dev/null && exit 0
+  sleep 2
+done
+echo "Solr core $SOLR_CORE did not become queryable" >&2
+exit 1
+`
+
+// waitForSolrCore starts Solr and waits until the core is queryable; the port being
+// open only means Solr is starting, not that the core has been loaded
+func waitForSolrCore(ctx context.Context, solr *dagger.Service, core string) error {
+	if _, err := solr.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start Solr: %w", err)
+	}
+	_, err := dag.Container().
+		From(curlImage).
+		WithServiceBinding("solr", solr).
+		WithEnvVariable("SOLR_CORE", core).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", solrReadyScript}).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("solr core %s is not ready: %w", core, err)
+	}
+	return nil
+}
+
+// SnapshotSolr seeds a Solr core from fixture files and returns its data directory
+// The index is kept in a cache volume keyed by Solr version, core and fixture hash,
+// so restoring it with SetupSolr or RunApiWithServices avoids re-indexing before
+// every test run, even after the engine's layer cache has been pruned.
+// Fixtures may be JSON, JSONL, XML or CSV update payloads; a schema.json file is
+// applied through the Schema API before indexing.
+func (m *SearchApi) SnapshotSolr(
+	ctx context.Context,
+	// Directory with fixture documents
+	fixtures *dagger.Directory,
+	// Core to create
+	// +default="metadata"
+	core string,
+	// Solr version (image tag), e.g. "8.11" or "9.4"
+	// +default="9.4"
+	solrVersion string,
+) (*dagger.Directory, error) {
+	digest, err := fixtures.Digest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash Solr fixtures: %w", err)
+	}
+	// Index formats differ between major versions, so the version is part of the key
+	key := fmt.Sprintf("solr-index-%s-%s-%s", solrVersion, core, strings.TrimPrefix(digest, "sha256:"))
+
+	return dag.Container().
+		From(solrImage(solrVersion)).
+		WithDirectory("/fixtures", fixtures).
+		WithMountedCache("/cache", dag.CacheVolume(key), dagger.ContainerWithMountedCacheOpts{
+			Owner: "solr",
+		}).
+		WithEnvVariable("SOLR_CORE", core).
+		WithExec([]string{"sh", "-c", seedSolrScript}).
+		Directory("/var/solr/data"), nil
+}
+
+// SeedSolr indexes fixture documents into a core of a running Solr service and
+// commits, so integration tests and DAST query a realistic index instead of an empty
+// one. The core must exist (SetupSolr precreates it); fixtures use the same formats
+// as SnapshotSolr. Returns the service, for binding it to the API
+func (m *SearchApi) SeedSolr(
+	ctx context.Context,
+	// Running Solr service (e.g., from SetupSolr)
+	solrService *dagger.Service,
+	// Directory with fixture documents
+	fixtures *dagger.Directory,
+	// Core to index into
+	// +default="metadata"
+	core string,
+) (*dagger.Service, error) {
+	if err := waitForSolrCore(ctx, solrService, core); err != nil {
+		return nil, err
+	}
+	_, err := dag.Container().
+		From(curlImage).
+		WithServiceBinding("solr", solrService).
+		WithDirectory("/fixtures", fixtures).
+		WithEnvVariable("SOLR_CORE", core).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", `set -e
+url="http://solr:8983/solr/$SOLR_CORE"` + indexFixturesScript}).
+		Sync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seed Solr core %s: %w", core, err)
+	}
+	return solrService, nil
+}
+
+// solrCloudInitScript waits until every node has joined the cluster, then creates
+// the collection (skipped when it already exists, e.g. on a reused cluster)
+const solrCloudInitScript = `set -e
+admin="http://solr1:8983/solr/admin/collections"
+for i in $(seq 1 120); do
+  live=$(curl -s "$admin?action=CLUSTERSTATUS" | grep -o '"[^"]*:8983_solr"' | sort -u | wc -l)
+  [ "$live" -ge "$SOLR_NODES" ] && break
+  sleep 2
+done
+if [ "$live" -lt "$SOLR_NODES" ]; then
+  echo "only $live of $SOLR_NODES Solr nodes joined the cluster" >&2
+  exit 1
+fi
+
+if curl -s "$admin?action=LIST" | grep -q "\"$SOLR_COLLECTION\""; then
+  echo "Collection $SOLR_COLLECTION already exists"
+else
+  curl -sS --fail-with-body "$admin?action=CREATE&name=$SOLR_COLLECTION&numShards=$SOLR_SHARDS&replicationFactor=$SOLR_REPLICATION&collection.configName=_default&waitForFinalState=true"
+fi
+curl -sS --fail-with-body "$admin?action=CLUSTERSTATUS&collection=$SOLR_COLLECTION"
+`
+
+// solrCloudNodes defines the nodes of a SolrCloud cluster, reachable as solr1..solrN
+// With an external ZooKeeper service every node joins it; otherwise solr1 runs
+// Solr's embedded ZooKeeper on port 9983 and the other nodes join that
+func solrCloudNodes(nodes int, zookeeper *dagger.Service) []*dagger.Service {
+	services := make([]*dagger.Service, nodes)
+	for i := range services {
+		host := fmt.Sprintf("solr%d", i+1)
+		node := dag.Container().
+			From(solrImage(defaultSolrVersion)).
+			WithEnvVariable("SOLR_HOST", host).
+			WithExposedPort(8983)
+
+		switch {
+		case zookeeper != nil:
+			node = node.
+				WithServiceBinding("zookeeper", zookeeper).
+				WithEnvVariable("ZK_HOST", "zookeeper:2181")
+		case i == 0:
+			node = node.
+				WithEnvVariable("SOLR_MODE", "solrcloud").
+				WithExposedPort(9983)
+		default:
+			node = node.
+				WithServiceBinding("solr1", services[0]).
+				WithEnvVariable("ZK_HOST", "solr1:9983")
+		}
+
+		services[i] = node.AsService().WithHostname(host)
+	}
+	return services
+}
+
+// SetupSolrCloud starts a multi-node SolrCloud cluster and creates the collection the
+// API uses, mirroring the production topology; the returned service is the first node,
+// which routes requests for the collection to whichever nodes host its replicas
+func (m *SearchApi) SetupSolrCloud(
+	ctx context.Context,
+	// Number of Solr nodes
+	// +default=3
+	nodes int,
+	// Number of shards in the collection
+	// +default=1
+	shards int,
+	// Replicas per shard (at most the number of nodes)
+	// +default=2
+	replicationFactor int,
+	// Run ZooKeeper as a separate service instead of Solr's embedded one
+	// +default=false
+	externalZookeeper bool,
+	// Collection to create
+	// +default="metadata"
+	collection string,
+) (*dagger.Service, error) {
+	cluster, err := startSolrCloud(ctx, nodes, shards, replicationFactor, externalZookeeper, collection)
+	if err != nil {
+		return nil, err
+	}
+	return cluster[0], nil
+}
+
+// SetupSolrCloudNodes starts the same cluster as SetupSolrCloud but returns every
+// node, so tests can query replicas directly or stop a node to cover failover
+func (m *SearchApi) SetupSolrCloudNodes(
+	ctx context.Context,
+	// Number of Solr nodes
+	// +default=3
+	nodes int,
+	// Number of shards in the collection
+	// +default=1
+	shards int,
+	// Replicas per shard (at most the number of nodes)
+	// +default=2
+	replicationFactor int,
+	// Run ZooKeeper as a separate service instead of Solr's embedded one
+	// +default=false
+	externalZookeeper bool,
+	// Collection to create
+	// +default="metadata"
+	collection string,
+) ([]*dagger.Service, error) {
+	return startSolrCloud(ctx, nodes, shards, replicationFactor, externalZookeeper, collection)
+}
+
+// startSolrCloud starts the nodes of a SolrCloud cluster, waits until all of them have
+// joined and creates the collection
+func startSolrCloud(ctx context.Context, nodes, shards, replicationFactor int, externalZookeeper bool, collection string) ([]*dagger.Service, error) {
+	if nodes < 1 {
+		return nil, fmt.Errorf("SolrCloud needs at least one node, got %d", nodes)
+	}
+	if replicationFactor > nodes {
+		return nil, fmt.Errorf("replication factor %d exceeds the %d available nodes", replicationFactor, nodes)
+	}
+
+	var zookeeper *dagger.Service
+	if externalZookeeper {
+		zookeeper = dag.Container().
+			From(zookeeperImage).
+			WithExposedPort(2181).
+			AsService().
+			WithHostname("zookeeper")
+	}
+
+	cluster := solrCloudNodes(nodes, zookeeper)
+	setup := dag.Container().
+		From(curlImage).
+		WithEnvVariable("SOLR_NODES", fmt.Sprint(nodes)).
+		WithEnvVariable("SOLR_SHARDS", fmt.Sprint(shards)).
+		WithEnvVariable("SOLR_REPLICATION", fmt.Sprint(replicationFactor)).
+		WithEnvVariable("SOLR_COLLECTION", collection).
+		WithEnvVariable("CACHEBUSTER", time.Now().String())
+	for i, node := range cluster {
+		setup = setup.WithServiceBinding(fmt.Sprintf("solr%d", i+1), node)
+	}
+
+	// Keep the nodes running after the init container exits so the collection survives
+	for i, node := range cluster {
+		if _, err := node.Start(ctx); err != nil {
+			return nil, fmt.Errorf("failed to start Solr node %d: %w", i+1, err)
+		}
+	}
+	if _, err := setup.WithExec([]string{"sh", "-c", solrCloudInitScript}).Sync(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create SolrCloud collection: %w", err)
+	}
+
+	return cluster, nil
+}
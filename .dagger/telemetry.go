@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stepAttributes describes a step's outcome as span attributes, with its findings
+// by severity when it has a raw report
+func stepAttributes(s *PipelineStepResult) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("pipeline.step.name", s.Name),
+		attribute.String("pipeline.step.status", s.Status),
+		attribute.Float64("pipeline.step.duration_seconds", s.DurationSeconds),
+		attribute.Int("pipeline.step.findings", s.Findings),
+	}
+	if s.RawReport == "" {
+		return attrs
+	}
+	attrs = append(attrs, attribute.String("pipeline.step.raw_report", s.RawReport))
+	if findings, err := parseFindings(s.rawContent); err == nil {
+		counts := severityCounts(dedupeFindings(findings))
+		for _, severity := range dashboardSeverities {
+			attrs = append(attrs, attribute.Int("pipeline.step.findings."+strings.ToLower(severity), counts[severity]))
+		}
+	}
+	return attrs
+}
+
+// exportSpans sends a finished run to an OTLP/HTTP endpoint as a trace: a pipeline
+// span with a child span per step, timed as the steps ran
+// The trace is a new root, linked to Dagger's own span, since the collector usually
+// doesn't receive Dagger's traces
+func exportSpans(ctx context.Context, endpoint string, report *PipelineReport) error {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "search-api-pipeline"),
+			attribute.String("service.version", report.Version),
+		)),
+	)
+	tracer := provider.Tracer("dagger/search-api")
+
+	started, err := time.Parse(time.RFC3339, report.StartedAt)
+	if err != nil {
+		started = time.Now().Add(-time.Duration(report.DurationSeconds * float64(time.Second)))
+	}
+	pipelineCtx, pipeline := tracer.Start(ctx, "FullPipeline",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithTimestamp(started),
+		trace.WithAttributes(
+			attribute.String("pipeline.status", report.Status),
+			attribute.String("pipeline.version", report.Version),
+			attribute.String("pipeline.image", report.Image),
+		))
+
+	// Steps that didn't run have no start time; they're placed where they'd have run
+	cursor := started
+	for _, s := range report.Steps {
+		stepStarted := s.started
+		if stepStarted.IsZero() {
+			stepStarted = cursor
+		}
+		ended := stepStarted.Add(time.Duration(s.DurationSeconds * float64(time.Second)))
+		_, span := tracer.Start(pipelineCtx, s.Name, trace.WithTimestamp(stepStarted), trace.WithAttributes(stepAttributes(s)...))
+		if s.Status == "blocked" || s.Status == "failed" {
+			span.SetStatus(codes.Error, s.Status)
+		}
+		span.End(trace.WithTimestamp(ended))
+		if ended.After(cursor) {
+			cursor = ended
+		}
+	}
+
+	if report.Status != "passed" {
+		pipeline.SetStatus(codes.Error, report.Error)
+	}
+	pipeline.End(trace.WithTimestamp(started.Add(time.Duration(report.DurationSeconds * float64(time.Second)))))
+	// Shutting down flushes the batched spans
+	return provider.Shutdown(ctx)
+}
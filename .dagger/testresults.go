@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// junitCase is a JUnit test case; skipped is non-nil for tests that didn't run
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitSuite is the JUnit test suite of one test class
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+// junitSuites is the root of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// trxToJunit converts a TRX run to JUnit XML with one suite per test class, the
+// format most CI systems render and track flaky tests with
+func trxToJunit(run *trxRun, name string) (string, error) {
+	report := junitSuites{Name: name}
+	suites := map[string]*junitSuite{}
+	var order []string
+	durations := map[string]float64{}
+
+	for _, r := range run.Results.TestResults {
+		class := testClass(r.TestName)
+		suite, ok := suites[class]
+		if !ok {
+			suite = &junitSuite{Name: class}
+			suites[class] = suite
+			order = append(order, class)
+		}
+		seconds := parseTrxDuration(r.Duration).Seconds()
+		durations[class] += seconds
+		c := junitCase{
+			Name:      strings.TrimPrefix(strings.TrimPrefix(r.TestName, class), "."),
+			ClassName: class,
+			Time:      fmt.Sprintf("%.3f", seconds),
+			SystemOut: r.Output.StdOut,
+		}
+		switch r.Outcome {
+		case "Passed":
+		case "NotExecuted", "Inconclusive":
+			c.Skipped = &struct{}{}
+			suite.Skipped++
+		default:
+			// Failed, Error, Timeout and Aborted are all failures to the CI
+			c.Failure = &junitProblem{Message: r.Output.ErrorInfo.Message, Text: r.Output.ErrorInfo.StackTrace}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	for _, class := range order {
+		suite := suites[class]
+		suite.Time = fmt.Sprintf("%.3f", durations[class])
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, *suite)
+	}
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to write JUnit XML: %w", err)
+	}
+	return xml.Header + string(content) + "\n", nil
+}
+
+// testResultFiles runs a test project with the TRX logger and returns the TRX file
+// and its JUnit conversion as <name>.trx and <name>.junit.xml
+// Failing tests are part of the results, so a failing run still returns them
+func testResultFiles(ctx context.Context, tests *dagger.Container, project, name string) (*dagger.Directory, error) {
+	trxName := name + ".trx"
+	content, err := tests.
+		WithExec([]string{
+			"dotnet", "test", project, "-c", buildConfig, "--no-build",
+			"--logger", "trx;LogFileName=" + trxName, "--results-directory", "/results",
+		}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		File("/results/" + trxName).
+		Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s produced no results: %w", name, err)
+	}
+	run, err := parseTrx(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	junit, err := trxToJunit(run, name)
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().
+		WithNewFile(trxName, content).
+		WithNewFile(name+".junit.xml", junit), nil
+}
+
+// TestResults runs the unit tests and, given a running API, the integration tests,
+// and returns their results as TRX and JUnit XML (unit-tests.trx,
+// unit-tests.junit.xml, integration-tests.trx, integration-tests.junit.xml) for CI
+// test report views and flaky test tracking
+// Failing tests don't fail the call; they are in the results
+func (m *SearchApi) TestResults(
+	ctx context.Context,
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Running API to run the integration tests against (e.g., from RunApiWithServices)
+	// +optional
+	apiService *dagger.Service,
+) (*dagger.Directory, error) {
+	build := buildBase(source)
+	results, err := testResultFiles(ctx, build, testProject, "unit-tests")
+	if err != nil {
+		return nil, err
+	}
+	if apiService == nil {
+		return results, nil
+	}
+
+	if err := waitForHealthy(ctx, apiService, "/health", apiStartupTimeout); err != nil {
+		return nil, err
+	}
+	integration, err := testResultFiles(ctx,
+		build.WithServiceBinding("api", apiService).WithEnvVariable("API_URL", "http://api:8080"),
+		integrationTestProject, "integration-tests")
+	if err != nil {
+		return nil, err
+	}
+	return results.WithDirectory(".", integration), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// vaultSecretUri converts a "<path>#<key>" reference (e.g., "secret/ci/registry#password")
+// to the URI of the Dagger CLI's Vault secret provider, whose path starts with the KV
+// version 2 mount and ends with the key after the last dot
+func vaultSecretUri(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" || strings.Contains(key, ".") || strings.ContainsAny(ref, " \t\n") {
+		return "", fmt.Errorf("invalid Vault secret %q (expected <path>#<key>, without a dot in the key)", ref)
+	}
+	return "vault://" + strings.Trim(path, "/") + "." + key, nil
+}
+
+// vaultSecrets returns the secrets the references name, resolved by the Dagger CLI's
+// Vault provider: the CLI reads a value when a step uses it, authenticating with the
+// VAULT_ADDR and VAULT_TOKEN in its own environment. The values never pass through
+// a container, so they aren't in any log, snapshot or cache entry
+func vaultSecrets(refs []string) (map[string]*dagger.Secret, error) {
+	secrets := map[string]*dagger.Secret{}
+	for _, ref := range refs {
+		uri, err := vaultSecretUri(ref)
+		if err != nil {
+			return nil, err
+		}
+		secrets[ref] = dag.Secret(uri)
+	}
+	return secrets, nil
+}
+
+// VaultSecrets are the secrets read by SecretsFromVault
+type VaultSecrets struct {
+	// Secret names ("<path>#<key>", e.g. "secret/ci/registry#password"), sorted
+	Names []string
+	// Values in the order of Names
+	Values []*dagger.Secret
+}
+
+// Get returns a secret by name ("<path>#<key>")
+func (s *VaultSecrets) Get(name string) (*dagger.Secret, error) {
+	i := slices.Index(s.Names, name)
+	if i < 0 {
+		return nil, fmt.Errorf("no Vault secret %s (have %s)", name, strings.Join(s.Names, ", "))
+	}
+	return s.Values[i], nil
+}
+
+// SecretsFromVault returns HashiCorp Vault KV secrets, named "<path>#<key>", so
+// registry credentials, Cosign keys and API tokens come from one place instead of
+// CI variables. The Dagger CLI resolves them with its Vault provider when they are
+// used: export VAULT_ADDR and VAULT_TOKEN (e.g., from a JWT login with the CI's OIDC
+// token) before calling. Only KV version 2 engines are supported
+func (m *SearchApi) SecretsFromVault(
+	// Secrets as "<path>#<key>", the path starting with the KV mount
+	// (e.g., "secret/ci/registry#password")
+	secrets []string,
+) (*VaultSecrets, error) {
+	resolved, err := vaultSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VaultSecrets{}
+	for name := range resolved {
+		result.Names = append(result.Names, name)
+	}
+	slices.Sort(result.Names)
+	for _, name := range result.Names {
+		result.Values = append(result.Values, resolved[name])
+	}
+	return result, nil
+}
+
+// vaultCredentials returns the pipeline credentials pipeline.yaml maps to Vault
+// secrets, keyed like FullPipelineFromConfig's arguments, and the mirror registries'
+// credentials, keyed by their config field
+func (c *pipelineConfig) vaultCredentials() (map[string]*dagger.Secret, error) {
+	refs := c.vaultRefs()
+	secrets, err := vaultSecrets(slices.Collect(maps.Values(refs)))
+	if err != nil {
+		return nil, err
+	}
+	credentials := map[string]*dagger.Secret{}
+	for name, ref := range refs {
+		credentials[name] = secrets[ref]
+	}
+	return credentials, nil
+}
+
+// vaultRefs maps the config's credential fields to the Vault secrets they name;
+// fields without a secret are left out
+func (c *pipelineConfig) vaultRefs() map[string]string {
+	refs := map[string]string{
+		"registryUsername":      c.Vault.Secrets.RegistryUsername,
+		"registryPassword":      c.Vault.Secrets.RegistryPassword,
+		"notifyWebhook":         c.Vault.Secrets.NotifyWebhook,
+		"dependencyTrackApiKey": c.Vault.Secrets.DependencyTrackApiKey,
+	}
+	for i, mirror := range c.Registry.Mirrors {
+		refs[fmt.Sprintf("registry.mirrors[%d].username", i)] = mirror.Username
+		refs[fmt.Sprintf("registry.mirrors[%d].password", i)] = mirror.Password
+	}
+	maps.DeleteFunc(refs, func(_, ref string) bool { return ref == "" })
+	return refs
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// releaseTag matches release tags such as "v1.4.0" or "1.5.0-rc.1"
+var releaseTag = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(-[0-9A-Za-z.-]+)?$`)
+
+// ComputedVersion is the semantic version of a build, derived from git history
+type ComputedVersion struct {
+	// SemVer without a "v" prefix (e.g., "1.4.0", "1.4.0-rc.1"); valid as an image tag
+	Version string
+	// Release tag the version is derived from ("" before the first release)
+	PreviousTag string
+	// major, minor or patch; release when completing a pre-release tag, none when HEAD
+	// is the tagged release
+	Bump string
+	// Commits since the previous tag
+	Commits int
+}
+
+// nextVersion applies the conventional commits since a release tag to its version:
+// a breaking change bumps major, a feature minor and anything else patch
+// A pre-release tag (v1.5.0-rc.1) is completed rather than bumped again
+func nextVersion(tag string, commits []releaseCommit) (*ComputedVersion, error) {
+	result := &ComputedVersion{PreviousTag: tag, Commits: len(commits)}
+	if tag == "" {
+		result.Version, result.Bump = "0.1.0", "minor"
+		return result, nil
+	}
+	match := releaseTag.FindStringSubmatch(tag)
+	if match == nil {
+		return nil, fmt.Errorf("last tag %q is not a semantic version (vMAJOR.MINOR.PATCH)", tag)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	patch, _ := strconv.Atoi(match[3])
+
+	switch {
+	case len(commits) == 0:
+		result.Version, result.Bump = fmt.Sprintf("%d.%d.%d%s", major, minor, patch, match[4]), "none"
+		return result, nil
+	case match[4] != "":
+		result.Bump = "release"
+	default:
+		result.Bump = "patch"
+		for _, c := range commits {
+			if c.breaking {
+				result.Bump = "major"
+				break
+			}
+			if c.kind == "feat" {
+				result.Bump = "minor"
+			}
+		}
+		switch result.Bump {
+		case "major":
+			major, minor, patch = major+1, 0, 0
+		case "minor":
+			minor, patch = minor+1, 0
+		default:
+			patch++
+		}
+	}
+	result.Version = fmt.Sprintf("%d.%d.%d", major, minor, patch)
+	return result, nil
+}
+
+// computeVersion derives the version of the repository's HEAD
+func computeVersion(ctx context.Context, repo *dagger.Directory, prerelease string) (*ComputedVersion, error) {
+	tag, _, commits, err := commitLog(ctx, repo, "")
+	if err != nil {
+		return nil, err
+	}
+	version, err := nextVersion(tag, commits)
+	if err != nil {
+		return nil, err
+	}
+	if prerelease != "" && version.Bump != "none" {
+		version.Version += "-" + prerelease
+	}
+	return version, nil
+}
+
+// ComputeVersion derives the next semantic version from the last release tag and the
+// conventional commits since: "feat!:" or BREAKING CHANGE bumps major, "feat:" minor,
+// anything else patch. HEAD on a release tag keeps that tag's version
+// FullPipeline tags images and stamps assemblies with it unless a tag is given
+func (m *SearchApi) ComputeVersion(
+	ctx context.Context,
+	// Repository including .git
+	// +defaultPath="/"
+	repo *dagger.Directory,
+	// Pre-release label for builds that aren't releases (e.g., "rc.1", "pr.42")
+	// +optional
+	prerelease string,
+) (*ComputedVersion, error) {
+	return computeVersion(ctx, repo, prerelease)
+}
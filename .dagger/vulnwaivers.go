@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VulnWaiver accepts the risk of one CVE in one package (vuln-waivers.yaml)
+type VulnWaiver struct {
+	// Vulnerability ID (e.g., "CVE-2024-1234" or a GHSA ID)
+	Cve string
+	// Affected package, as the scanner reports it
+	Package string
+	// Why the risk is acceptable
+	Justification string
+	// Last day the waiver applies (YYYY-MM-DD)
+	Expires string
+	// Person who approved the waiver
+	Approver string
+	// Whether the waiver has expired
+	Expired bool
+}
+
+// vulnWaivers is the parsed vuln-waivers.yaml
+type vulnWaivers struct {
+	Waivers []VulnWaiver
+}
+
+// loadVulnWaivers reads and validates a waiver file (YAML or JSON)
+// Like the risk register (see checkWaiver), incomplete entries are rejected rather than ignored
+func loadVulnWaivers(ctx context.Context, file *dagger.File, now time.Time) (*vulnWaivers, error) {
+	waivers := &vulnWaivers{}
+	if err := decodeYAML(ctx, file, waivers); err != nil {
+		return nil, fmt.Errorf("failed to load vulnerability waivers: %w", err)
+	}
+
+	for i := range waivers.Waivers {
+		w := &waivers.Waivers[i]
+		expired, err := checkWaiver(fmt.Sprintf("vulnerability waiver %d", i+1), w.Cve+" in "+w.Package, w.Expires, now,
+			waiverField{"cve", w.Cve},
+			waiverField{"package", w.Package},
+			waiverField{"justification", w.Justification},
+			waiverField{"approver", w.Approver})
+		if err != nil {
+			return nil, err
+		}
+		w.Expired = expired
+	}
+	return waivers, nil
+}
+
+// checkExpired fails when any waiver is past its expiry: unlike a lapsed risk
+// register acceptance, an expired waiver has to be renewed or removed
+func (w *vulnWaivers) checkExpired() error {
+	if w == nil {
+		return nil
+	}
+	var expired []string
+	for _, waiver := range w.Waivers {
+		if waiver.Expired {
+			expired = append(expired, fmt.Sprintf("%s in %s (expired %s, approved by %s)", waiver.Cve, waiver.Package, waiver.Expires, waiver.Approver))
+		}
+	}
+	if len(expired) > 0 {
+		return fmt.Errorf("%d vulnerability waiver(s) expired; renew or remove them:\n   • %s", len(expired), strings.Join(expired, "\n   • "))
+	}
+	return nil
+}
+
+// lookup returns the waiver for a finding's vulnerability and package, if any
+func (w *vulnWaivers) lookup(f Finding) (VulnWaiver, bool) {
+	for _, waiver := range w.Waivers {
+		if strings.EqualFold(waiver.Cve, f.RuleID) && strings.EqualFold(waiver.Package, f.Package) {
+			return waiver, true
+		}
+	}
+	return VulnWaiver{}, false
+}
+
+// accept splits findings into those still subject to gating and those covered by a
+// waiver, which are reported as accepted risk instead
+func (w *vulnWaivers) accept(findings []Finding) (remaining, accepted []Finding) {
+	if w == nil {
+		return findings, nil
+	}
+	for _, f := range findings {
+		if _, ok := w.lookup(f); ok {
+			accepted = append(accepted, f)
+		} else {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining, accepted
+}
+
+// acceptedRisk lists the waived findings with their justification for the report
+func (w *vulnWaivers) acceptedRisk(accepted []Finding) string {
+	if len(accepted) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📝 Accepted risk: %d finding(s) covered by vulnerability waivers\n", len(accepted))
+	for _, f := range accepted {
+		waiver, _ := w.lookup(f)
+		fmt.Fprintf(&sb, "   • [%s] %s in %s@%s (approved by %s, expires %s): %s\n",
+			f.Severity, f.RuleID, f.Package, f.Version, waiver.Approver, waiver.Expires, waiver.Justification)
+	}
+	return sb.String()
+}
+
+// VulnWaivers validates a vuln-waivers.yaml file and lists its waivers with expiry status
+func (m *SearchApi) VulnWaivers(
+	ctx context.Context,
+	// Waiver file (YAML or JSON)
+	// +defaultPath="/vuln-waivers.yaml"
+	waivers *dagger.File,
+) ([]*VulnWaiver, error) {
+	parsed, err := loadVulnWaivers(ctx, waivers, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*VulnWaiver, len(parsed.Waivers))
+	for i := range parsed.Waivers {
+		result[i] = &parsed.Waivers[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"dagger/search-api/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// decodeYAML unmarshals a YAML (or JSON) file into v
+// YAML is converted to JSON with yq so the module needs no YAML dependency
+func decodeYAML(ctx context.Context, file *dagger.File, v any) error {
+	content, err := file.Contents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// JSON is valid YAML; skip the conversion when it's already JSON
+	if trimmed := strings.TrimSpace(content); strings.HasPrefix(trimmed, "{") {
+		return json.Unmarshal([]byte(trimmed), v)
+	}
+
+	converted, err := dag.Container().
+		From(yqImage).
+		WithMountedFile("/work/input.yaml", file).
+		WithExec([]string{"yq", "--output-format=json", ".", "/work/input.yaml"}).
+		Stdout(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	return json.Unmarshal([]byte(converted), v)
+}
@@ -0,0 +1,60 @@
+using System.Globalization;
+using BenchmarkDotNet.Attributes;
+using Microsoft.Extensions.Logging.Abstractions;
+using Moq;
+using SearchApi.Models;
+using SearchApi.Services;
+using SolrNet;
+using SolrNet.Commands.Parameters;
+
+namespace SearchApi.Benchmarks;
+
+/// <summary>
+/// Overhead of the search service around a Solr client that answers instantly:
+/// query building, result mapping and allocations per request
+/// </summary>
+[MemoryDiagnoser]
+public class SearchServiceBenchmarks
+{
+    private SearchService _service = null!;
+    private SearchRequest _simpleRequest = null!;
+    private SearchRequest _filteredRequest = null!;
+
+    [GlobalSetup]
+    public void Setup()
+    {
+        var results = new SolrQueryResults<MetadataDocument>();
+        for (var i = 0; i < 10; i++)
+        {
+            results.Add(new MetadataDocument
+            {
+                Id = i.ToString(CultureInfo.InvariantCulture),
+                Title = $"Document {i}"
+            });
+        }
+        results.NumFound = 1000;
+
+        var solr = new Mock<ISolrOperations<MetadataDocument>>();
+        solr.Setup(s => s.Query(It.IsAny<string>(), It.IsAny<QueryOptions>()))
+            .Returns(results);
+        _service = new SearchService(solr.Object, NullLogger<SearchService>.Instance);
+
+        _simpleRequest = new SearchRequest { Query = "title:archive", Rows = 10 };
+        _filteredRequest = new SearchRequest
+        {
+            Query = "title:archive",
+            Rows = 10,
+            Start = 20,
+            SortField = "date",
+            SortOrder = "asc"
+        };
+        _filteredRequest.Filters["type"] = "letter";
+        _filteredRequest.Filters["language"] = "sv";
+    }
+
+    [Benchmark(Baseline = true)]
+    public Task<SearchResponse> Search() => _service.SearchAsync(_simpleRequest);
+
+    [Benchmark]
+    public Task<SearchResponse> SearchWithFiltersAndSort() => _service.SearchAsync(_filteredRequest);
+}
@@ -23,6 +23,16 @@ public class HealthCheckTests : IClassFixture<TestWebApplicationFactory>
         response.StatusCode.Should().Be(HttpStatusCode.OK);
     }
 
+    [Fact]
+    public async Task ReadinessCheck_ShouldReturnOk_WhenSolrIsAvailable()
+    {
+        // Act
+        var response = await _client.GetAsync("/ready");
+
+        // Assert
+        response.StatusCode.Should().Be(HttpStatusCode.OK);
+    }
+
     [Fact]
     public async Task Swagger_ShouldBeAccessible()
     {
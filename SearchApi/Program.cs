@@ -1,3 +1,4 @@
+using Microsoft.AspNetCore.Diagnostics.HealthChecks;
 using Serilog;
 using SearchApi.Services;
 using SearchApi.Models;
@@ -5,6 +6,15 @@ using SolrNet;
 
 var builder = WebApplication.CreateBuilder(args);
 
+// Deployment-specific settings mounted next to the app (non-secret overrides and
+// secret-backed settings); environment variables and command-line arguments are
+// re-added so they still win, in the default order
+builder.Configuration
+    .AddJsonFile("appsettings.Override.json", optional: true, reloadOnChange: false)
+    .AddJsonFile("appsettings.Secrets.json", optional: true, reloadOnChange: false)
+    .AddEnvironmentVariables()
+    .AddCommandLine(args);
+
 // Configure Serilog
 Log.Logger = new LoggerConfiguration()
     .ReadFrom.Configuration(builder.Configuration)
@@ -32,10 +42,9 @@ var solrUrl = builder.Configuration["Solr:Url"] ?? "http://solr:8983/solr/metada
 builder.Services.AddSolrNet<MetadataDocument>(solrUrl);
 builder.Services.AddScoped<ISearchService, SearchService>();
 
-// Add health checks
-builder.Services.AddHealthChecks();
-// Note: Solr health check has API compatibility issues, skipping for now
-// TODO: Fix Solr health check configuration once API is clarified
+// Add health checks: /health is liveness (the process is up), /ready also needs Solr
+builder.Services.AddHealthChecks()
+    .AddCheck<SolrHealthCheck>("solr", tags: new[] { "ready" });
 
 var app = builder.Build();
 
@@ -49,7 +58,8 @@ if (app.Environment.IsDevelopment())
 app.UseHttpsRedirection();
 app.UseAuthorization();
 app.MapControllers();
-app.MapHealthChecks("/health");
+app.MapHealthChecks("/health", new HealthCheckOptions { Predicate = _ => false });
+app.MapHealthChecks("/ready", new HealthCheckOptions { Predicate = check => check.Tags.Contains("ready") });
 
 Log.Information("Starting Search API");
 app.Run();
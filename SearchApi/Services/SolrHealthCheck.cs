@@ -0,0 +1,31 @@
+using Microsoft.Extensions.Diagnostics.HealthChecks;
+using SearchApi.Models;
+using SolrNet;
+
+namespace SearchApi.Services;
+
+/// <summary>
+/// Readiness check that pings the Solr core, so traffic only reaches instances that can search
+/// </summary>
+public class SolrHealthCheck : IHealthCheck
+{
+    private readonly ISolrOperations<MetadataDocument> _solr;
+
+    public SolrHealthCheck(ISolrOperations<MetadataDocument> solr)
+    {
+        _solr = solr;
+    }
+
+    public async Task<HealthCheckResult> CheckHealthAsync(HealthCheckContext context, CancellationToken cancellationToken = default)
+    {
+        try
+        {
+            await _solr.PingAsync().ConfigureAwait(false);
+            return HealthCheckResult.Healthy();
+        }
+        catch (SolrNet.Exceptions.SolrConnectionException ex)
+        {
+            return HealthCheckResult.Unhealthy("Solr is unreachable", ex);
+        }
+    }
+}
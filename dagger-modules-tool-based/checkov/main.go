@@ -28,6 +28,9 @@ func (m *Checkov) Scan(
 	// Skip checks (comma-separated check IDs)
 	// +optional
 	skipChecks []string,
+	// Output format: cli, json or sarif
+	// +default="cli"
+	output string,
 ) (string, error) {
 	args := []string{"checkov", "-d", directory}
 
@@ -46,7 +49,7 @@ func (m *Checkov) Scan(
 		args = append(args, "--skip-check", skip)
 	}
 
-	args = append(args, "--compact", "--quiet")
+	args = append(args, "--output", output, "--compact", "--quiet")
 
 	return dag.Container().
 		From("bridgecrew/checkov:latest").
@@ -66,8 +69,14 @@ func (m *Checkov) ScanKubernetes(
 	// Directory containing K8s manifests
 	// +default="k8s"
 	k8sDir string,
+	// Output format: cli, json or sarif
+	// +default="cli"
+	output string,
+	// Check IDs to skip (e.g., "CKV_K8S_43")
+	// +optional
+	skipChecks []string,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"kubernetes"}, k8sDir, "", nil)
+	return m.Scan(ctx, source, []string{"kubernetes"}, k8sDir, "", skipChecks, output)
 }
 
 // ScanTerraform scans Terraform configurations
@@ -81,7 +90,7 @@ func (m *Checkov) ScanTerraform(
 	// +default="terraform"
 	terraformDir string,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"terraform"}, terraformDir, "", nil)
+	return m.Scan(ctx, source, []string{"terraform"}, terraformDir, "", nil, "cli")
 }
 
 // ScanDockerfile scans Dockerfiles for security issues
@@ -92,7 +101,7 @@ func (m *Checkov) ScanDockerfile(
 	// +defaultPath="."
 	source *dagger.Directory,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"dockerfile"}, ".", "", nil)
+	return m.Scan(ctx, source, []string{"dockerfile"}, ".", "", nil, "cli")
 }
 
 // ScanHelm scans Helm charts
@@ -106,5 +115,5 @@ func (m *Checkov) ScanHelm(
 	// +default="helm"
 	helmDir string,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"helm"}, helmDir, "", nil)
+	return m.Scan(ctx, source, []string{"helm"}, helmDir, "", nil, "cli")
 }
@@ -8,6 +8,17 @@ import (
 
 type Cosign struct{}
 
+// withDockerConfig mounts registry credentials where cosign looks for them, so
+// signatures and attestations can be pushed to private registries
+func withDockerConfig(container *dagger.Container, dockerConfig *dagger.Secret) *dagger.Container {
+	if dockerConfig == nil {
+		return container
+	}
+	return container.
+		WithMountedSecret("/docker/config.json", dockerConfig).
+		WithEnvVariable("DOCKER_CONFIG", "/docker")
+}
+
 // Sign signs a container image with Cosign
 func (m *Cosign) Sign(
 	ctx context.Context,
@@ -22,6 +33,9 @@ func (m *Cosign) Sign(
 	// Upload to transparency log (Rekor)
 	// +default=false
 	tlogUpload bool,
+	// Docker config.json with credentials for the registry holding the image
+	// +optional
+	dockerConfig *dagger.Secret,
 ) (string, error) {
 	tarball := container.AsTarball()
 
@@ -30,8 +44,8 @@ func (m *Cosign) Sign(
 		tlogFlag = "--tlog-upload=true"
 	}
 
-	return dag.Container().
-		From("gcr.io/projectsigstore/cosign:latest").
+	return withDockerConfig(dag.Container().
+		From("gcr.io/projectsigstore/cosign:latest"), dockerConfig).
 		WithMountedFile("/image.tar", tarball).
 		WithMountedSecret("/cosign.key", privateKey).
 		WithSecretVariable("COSIGN_PASSWORD", password).
@@ -63,11 +77,71 @@ func (m *Cosign) Verify(
 		Stdout(ctx)
 }
 
+// SignKeyless signs a container image without key material: Fulcio issues a
+// short-lived certificate for the OIDC identity (e.g., a GitHub Actions workflow) and
+// the signature is recorded in Rekor, where verifiers check it
+func (m *Cosign) SignKeyless(
+	ctx context.Context,
+	// Image reference to sign, by digest (e.g., "ghcr.io/myorg/app@sha256:...")
+	imageRef string,
+	// OIDC identity token with the sigstore audience
+	oidcToken *dagger.Secret,
+	// Fulcio certificate authority
+	// +default="https://fulcio.sigstore.dev"
+	fulcioUrl string,
+	// Rekor transparency log
+	// +default="https://rekor.sigstore.dev"
+	rekorUrl string,
+	// Docker config.json with credentials for the registry holding the image
+	// +optional
+	dockerConfig *dagger.Secret,
+) (string, error) {
+	return withDockerConfig(dag.Container().
+		From("gcr.io/projectsigstore/cosign:latest"), dockerConfig).
+		// cosign reads the identity token from SIGSTORE_ID_TOKEN, keeping it out of the args
+		WithSecretVariable("SIGSTORE_ID_TOKEN", oidcToken).
+		WithExec([]string{
+			"cosign", "sign",
+			"--yes",
+			"--fulcio-url", fulcioUrl,
+			"--rekor-url", rekorUrl,
+			imageRef,
+		}).
+		Stdout(ctx)
+}
+
+// VerifyKeyless verifies a keyless signature against the identity that signed it
+func (m *Cosign) VerifyKeyless(
+	ctx context.Context,
+	// Image reference to verify
+	imageRef string,
+	// Expected signer identity, as a regular expression (e.g., the workflow URL
+	// "https://github.com/myorg/app/.github/workflows/ci.yml@refs/heads/main")
+	certificateIdentity string,
+	// Expected OIDC issuer
+	// +default="https://token.actions.githubusercontent.com"
+	certificateOidcIssuer string,
+	// Rekor transparency log
+	// +default="https://rekor.sigstore.dev"
+	rekorUrl string,
+) (string, error) {
+	return dag.Container().
+		From("gcr.io/projectsigstore/cosign:latest").
+		WithExec([]string{
+			"cosign", "verify",
+			"--certificate-identity-regexp", certificateIdentity,
+			"--certificate-oidc-issuer", certificateOidcIssuer,
+			"--rekor-url", rekorUrl,
+			imageRef,
+		}).
+		Stdout(ctx)
+}
+
 // Attest attaches an attestation to a container image
 func (m *Cosign) Attest(
 	ctx context.Context,
-	// Attestation data (e.g., SBOM, provenance)
-	attestation string,
+	// Attestation predicate document (e.g., SBOM, provenance)
+	attestation *dagger.File,
 	// Private key for signing
 	privateKey *dagger.Secret,
 	// Password for the private key
@@ -80,15 +154,18 @@ func (m *Cosign) Attest(
 	// Upload to transparency log
 	// +default=false
 	tlogUpload bool,
+	// Docker config.json with credentials for the registry holding the image
+	// +optional
+	dockerConfig *dagger.Secret,
 ) (string, error) {
 	tlogFlag := "--tlog-upload=false"
 	if tlogUpload {
 		tlogFlag = "--tlog-upload=true"
 	}
 
-	return dag.Container().
-		From("gcr.io/projectsigstore/cosign:latest").
-		WithNewFile("/attestation.json", attestation).
+	return withDockerConfig(dag.Container().
+		From("gcr.io/projectsigstore/cosign:latest"), dockerConfig).
+		WithMountedFile("/attestation.json", attestation).
 		WithMountedSecret("/cosign.key", privateKey).
 		WithSecretVariable("COSIGN_PASSWORD", password).
 		WithExec([]string{
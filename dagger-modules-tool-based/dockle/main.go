@@ -0,0 +1,43 @@
+// Dagger module for Dockle - container image linter for CIS Docker Benchmark best practices
+// Checks the image config and filesystem: user, healthcheck, credentials in env, setuid files, etc.
+package main
+
+import (
+	"context"
+	"dagger/dockle/internal/dagger"
+)
+
+type Dockle struct{}
+
+// Scan checks a container image against CIS Docker image best practices
+// Findings never fail the call; callers gate on the levels in the report
+func (m *Dockle) Scan(
+	ctx context.Context,
+	// Container to check
+	container *dagger.Container,
+	// Output format: json, sarif, list
+	// +default="json"
+	format string,
+	// Check codes to skip (e.g., "CIS-DI-0005")
+	// +optional
+	ignore []string,
+	// Environment variable names to accept as non-secret (e.g., "GPG_KEY")
+	// +optional
+	acceptKeys []string,
+) (string, error) {
+	args := []string{"dockle", "--input", "/image.tar", "--format", format, "--exit-code", "0"}
+
+	for _, code := range ignore {
+		args = append(args, "--ignore", code)
+	}
+
+	for _, key := range acceptKeys {
+		args = append(args, "--accept-key", key)
+	}
+
+	return dag.Container().
+		From("goodwithtech/dockle:latest").
+		WithMountedFile("/image.tar", container.AsTarball()).
+		WithExec(args).
+		Stdout(ctx)
+}
@@ -1,14 +1,35 @@
 // Dagger module for .NET SDK operations
-// Provides build, test, restore, publish, and format operations
+// Provides build, test, restore, publish, pack, and format operations
 package main
 
 import (
 	"context"
 	"dagger/dotnet/internal/dagger"
+	"time"
 )
 
 type Dotnet struct{}
 
+// nugetPackages is where the SDK images keep the global NuGet package folder
+const nugetPackages = "/root/.nuget/packages"
+
+// workspace is the container a function works in: the given base, which already
+// has the source restored and built at /src, or a fresh SDK container with the source
+// A NuGet cache is only mounted on a fresh container; over a base it would hide the
+// packages the base restored
+func workspace(base *dagger.Container, source *dagger.Directory, sdkImage string, nugetCache *dagger.CacheVolume) *dagger.Container {
+	if base != nil {
+		return base.WithWorkdir("/src")
+	}
+	container := dag.Container().From(sdkImage)
+	if nugetCache != nil {
+		container = container.WithMountedCache(nugetPackages, nugetCache)
+	}
+	return container.
+		WithDirectory("/src", source).
+		WithWorkdir("/src")
+}
+
 // Restore restores NuGet packages for a .NET solution or project
 func (m *Dotnet) Restore(
 	ctx context.Context,
@@ -22,11 +43,12 @@ func (m *Dotnet) Restore(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
 ) (*dagger.Container, error) {
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+	return workspace(nil, source, sdkImage, nugetCache).
 		WithExec([]string{"dotnet", "restore", project}), nil
 }
 
@@ -49,14 +71,15 @@ func (m *Dotnet) Build(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
 ) (*dagger.Container, error) {
 	args := []string{"dotnet", "build", project, "-c", configuration}
 	args = append(args, buildArgs...)
 
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+	return workspace(nil, source, sdkImage, nugetCache).
 		WithExec([]string{"dotnet", "restore", project}).
 		WithExec(args), nil
 }
@@ -82,6 +105,10 @@ func (m *Dotnet) Test(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
 ) (string, error) {
 	args := []string{"dotnet", "test", testProject, "-c", configuration}
 
@@ -91,10 +118,7 @@ func (m *Dotnet) Test(
 
 	args = append(args, testArgs...)
 
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+	return workspace(nil, source, sdkImage, nugetCache).
 		WithExec([]string{"dotnet", "restore"}).
 		WithExec([]string{"dotnet", "build", "-c", configuration, "--no-restore"}).
 		WithExec(args).
@@ -122,14 +146,15 @@ func (m *Dotnet) Publish(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
 ) (*dagger.Directory, error) {
 	args := []string{"dotnet", "publish", project, "-c", configuration, "-o", outputDir}
 	args = append(args, publishArgs...)
 
-	container := dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+	container := workspace(nil, source, sdkImage, nugetCache).
 		WithExec([]string{"dotnet", "restore"}).
 		WithExec([]string{"dotnet", "build", "-c", configuration, "--no-restore"}).
 		WithExec(args)
@@ -137,6 +162,88 @@ func (m *Dotnet) Publish(
 	return container.Directory(outputDir), nil
 }
 
+// Pack packs a project into NuGet packages (.nupkg, with a .snupkg symbol package
+// when symbols are included) and returns the directory with them
+func (m *Dotnet) Pack(
+	ctx context.Context,
+	// Source directory containing .NET project
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Project file to pack
+	project string,
+	// Package version (e.g., "1.4.0"); empty keeps the project's version
+	// +optional
+	version string,
+	// Build configuration
+	// +default="Release"
+	configuration string,
+	// Include a symbol package (.snupkg)
+	// +default=true
+	includeSymbols bool,
+	// SDK image version
+	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
+	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
+) (*dagger.Directory, error) {
+	args := []string{"dotnet", "pack", project, "-c", configuration, "-o", "/packages"}
+	if version != "" {
+		args = append(args, "/p:Version="+version)
+	}
+	if includeSymbols {
+		args = append(args, "--include-symbols", "/p:SymbolPackageFormat=snupkg")
+	}
+
+	return workspace(nil, source, sdkImage, nugetCache).
+		WithExec([]string{"dotnet", "restore", project}).
+		WithExec(args).
+		Directory("/packages"), nil
+}
+
+// nugetPushScript pushes every package in /packages; symbol packages next to them
+// are pushed by dotnet nuget push itself
+const nugetPushScript = `set -e
+ls /packages/*.nupkg >/dev/null 2>&1 || { echo "no .nupkg files to push" >&2; exit 1; }
+dotnet nuget push "/packages/*.nupkg" --source "$FEED_URL" --api-key "$NUGET_API_KEY" $PUSH_FLAGS
+`
+
+// PushNuget pushes NuGet packages (e.g., from Pack) to a feed
+func (m *Dotnet) PushNuget(
+	ctx context.Context,
+	// Directory with the .nupkg (and .snupkg) files
+	packages *dagger.Directory,
+	// Feed to push to (e.g., "https://api.nuget.org/v3/index.json" or a GitHub
+	// Packages feed)
+	feedUrl string,
+	// Feed API key or token
+	apiKey *dagger.Secret,
+	// Skip packages whose version is already on the feed instead of failing
+	// +default=true
+	skipDuplicate bool,
+	// SDK image version
+	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
+	sdkImage string,
+) (string, error) {
+	flags := ""
+	if skipDuplicate {
+		flags = "--skip-duplicate"
+	}
+
+	// Pushing changes the feed, so it must never be served from cache
+	return dag.Container().
+		From(sdkImage).
+		WithDirectory("/packages", packages).
+		WithEnvVariable("FEED_URL", feedUrl).
+		WithSecretVariable("NUGET_API_KEY", apiKey).
+		WithEnvVariable("PUSH_FLAGS", flags).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", nugetPushScript}).
+		Stdout(ctx)
+}
+
 // Format checks or applies code formatting using dotnet format
 func (m *Dotnet) Format(
 	ctx context.Context,
@@ -156,6 +263,10 @@ func (m *Dotnet) Format(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
 ) (string, error) {
 	args := []string{"dotnet", "format", project}
 
@@ -165,10 +276,7 @@ func (m *Dotnet) Format(
 
 	args = append(args, "--verbosity", verbosity)
 
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+	return workspace(nil, source, sdkImage, nugetCache).
 		WithExec([]string{"dotnet", "restore", project}).
 		WithExec(args).
 		Stdout(ctx)
@@ -189,13 +297,22 @@ func (m *Dotnet) GetCoverage(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again; ignored with a base
+	// +optional
+	nugetCache *dagger.CacheVolume,
+	// Container with the source restored and built at /src (e.g., from Build), so the
+	// solution isn't compiled again; source and sdkImage are ignored when set
+	// +optional
+	base *dagger.Container,
 ) (string, error) {
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{"dotnet", "restore"}).
-		WithExec([]string{"dotnet", "build", "-c", configuration, "--no-restore"}).
+	container := workspace(base, source, sdkImage, nugetCache)
+	if base == nil {
+		container = container.
+			WithExec([]string{"dotnet", "restore"}).
+			WithExec([]string{"dotnet", "build", "-c", configuration, "--no-restore"})
+	}
+	return container.
 		WithExec([]string{
 			"dotnet", "test", testProject,
 			"-c", configuration,
@@ -223,20 +340,103 @@ func (m *Dotnet) BuildWithAnalyzers(
 	// SDK image version
 	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
 	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again; ignored with a base
+	// +optional
+	nugetCache *dagger.CacheVolume,
+	// Container with the source restored at /src (e.g., from Build), so packages aren't
+	// restored again; source and sdkImage are ignored when set
+	// +optional
+	base *dagger.Container,
 ) (string, error) {
-	return dag.Container().
-		From(sdkImage).
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{"dotnet", "restore", project}).
-		WithExec([]string{
-			"dotnet", "build", project,
-			"-c", configuration,
-			"/p:TreatWarningsAsErrors=true",
-			"/p:EnforceCodeStyleInBuild=true",
-			"/p:EnableNETAnalyzers=true",
-			"/p:AnalysisLevel=latest",
-			"/p:AnalysisMode=AllEnabledByDefault",
-		}).
-		Stdout(ctx)
+	args := []string{
+		"dotnet", "build", project,
+		"-c", configuration,
+		"--no-restore",
+		"/p:TreatWarningsAsErrors=true",
+		"/p:EnforceCodeStyleInBuild=true",
+		"/p:EnableNETAnalyzers=true",
+		"/p:AnalysisLevel=latest",
+		"/p:AnalysisMode=AllEnabledByDefault",
+	}
+	container := workspace(base, source, sdkImage, nugetCache)
+	if base == nil {
+		container = container.WithExec([]string{"dotnet", "restore", project})
+	} else {
+		// An up-to-date incremental build skips the compiler and its analyzer warnings
+		args = append(args, "--no-incremental")
+	}
+	return container.WithExec(args).Stdout(ctx)
+}
+
+// securityAnalyzersTargets adds the security analyzer packages to every project and
+// writes one SARIF log per project, without modifying the source tree
+// It is imported through CustomBeforeMicrosoftCommonTargets for restore and build
+const securityAnalyzersTargets = `<Project>
+  <PropertyGroup>
+    <ErrorLog>/sarif/$(MSBuildProjectName).sarif,version=2.1</ErrorLog>
+  </PropertyGroup>
+  <ItemGroup>
+    <PackageReference Include="SecurityCodeScan.VS2019" Version="$(SecurityCodeScanVersion)" PrivateAssets="all" />
+    <PackageReference Include="Puma.Security.Rules.2022" Version="$(PumaScanVersion)" PrivateAssets="all" Condition="'$(PumaScanVersion)' != ''" />
+  </ItemGroup>
+</Project>
+`
+
+// BuildWithSecurityAnalyzers builds with SecurityCodeScan (and optionally Puma Scan)
+// injected at build time and returns a directory with a SARIF 2.1 log per project
+// Analyzer warnings don't fail the build; callers evaluate the SARIF themselves
+func (m *Dotnet) BuildWithSecurityAnalyzers(
+	ctx context.Context,
+	// Source directory containing .NET project
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Solution or project file
+	project string,
+	// Build configuration
+	// +default="Release"
+	configuration string,
+	// SecurityCodeScan.VS2019 package version
+	// +default="5.6.7"
+	securityCodeScanVersion string,
+	// Puma.Security.Rules.2022 package version; Puma Scan is skipped when empty
+	// +optional
+	pumaScanVersion string,
+	// SDK image version
+	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
+	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again; ignored with a base
+	// +optional
+	nugetCache *dagger.CacheVolume,
+	// Container with the source restored at /src (e.g., from Build); only the analyzer
+	// packages are restored on top of it; source and sdkImage are ignored when set
+	// +optional
+	base *dagger.Container,
+) (*dagger.Directory, error) {
+	props := []string{
+		"/p:CustomBeforeMicrosoftCommonTargets=/analyzers/SecurityAnalyzers.targets",
+		"/p:SecurityCodeScanVersion=" + securityCodeScanVersion,
+	}
+	if pumaScanVersion != "" {
+		props = append(props, "/p:PumaScanVersion="+pumaScanVersion)
+	}
+	build := []string{
+		"dotnet", "build", project,
+		"-c", configuration,
+		"--no-restore",
+		"/p:EnableNETAnalyzers=true",
+		"/p:TreatWarningsAsErrors=false",
+	}
+	if base != nil {
+		// An up-to-date incremental build wouldn't run the injected analyzers
+		build = append(build, "--no-incremental")
+	}
+
+	return workspace(base, source, sdkImage, nugetCache).
+		WithNewFile("/analyzers/SecurityAnalyzers.targets", securityAnalyzersTargets).
+		WithExec(append([]string{"dotnet", "restore", project}, props...)).
+		WithExec(append(build, props...)).
+		Directory("/sarif"), nil
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/dotnet/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// packageList is the JSON output of dotnet list package --format json
+type packageList struct {
+	Projects []struct {
+		Path       string `json:"path"`
+		Frameworks []struct {
+			Framework          string          `json:"framework"`
+			TopLevelPackages   []listedPackage `json:"topLevelPackages"`
+			TransitivePackages []listedPackage `json:"transitivePackages"`
+		} `json:"frameworks"`
+	} `json:"projects"`
+	Problems []struct {
+		Project string `json:"project"`
+		Level   string `json:"level"`
+		Text    string `json:"text"`
+	} `json:"problems"`
+}
+
+// listedPackage is one package of a project's framework in dotnet list package
+type listedPackage struct {
+	Id              string `json:"id"`
+	ResolvedVersion string `json:"resolvedVersion"`
+	LatestVersion   string `json:"latestVersion"`
+	// Advisories, listed with --vulnerable
+	Vulnerabilities []struct {
+		Severity    string `json:"severity"`
+		AdvisoryUrl string `json:"advisoryurl"`
+	} `json:"vulnerabilities"`
+}
+
+// listPackages restores the project and runs dotnet list package with the given
+// options; the feeds are queried on every call, so the result is never cached
+func listPackages(ctx context.Context, source *dagger.Directory, project, sdkImage string, nugetCache *dagger.CacheVolume, options ...string) (*packageList, error) {
+	args := append([]string{"dotnet", "list", project, "package", "--format", "json"}, options...)
+	output, err := workspace(nil, source, sdkImage, nugetCache).
+		WithExec([]string{"dotnet", "restore", project}).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec(args).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dotnet list package failed: %w", err)
+	}
+	list := &packageList{}
+	if err := json.Unmarshal([]byte(output), list); err != nil {
+		return nil, fmt.Errorf("invalid dotnet list package output: %w", err)
+	}
+	for _, problem := range list.Problems {
+		if strings.EqualFold(problem.Level, "error") {
+			return nil, fmt.Errorf("dotnet list package: %s: %s", problem.Project, problem.Text)
+		}
+	}
+	return list, nil
+}
+
+// Version drifts, from most to least behind
+var driftLevels = []string{"major", "minor", "patch", "unknown"}
+
+// versionDrift classifies how far the current version is behind the latest by the
+// first of major, minor and patch that differs; versions that don't parse are unknown
+func versionDrift(current, latest string) string {
+	parse := func(version string) []int {
+		version, _, _ = strings.Cut(version, "-")
+		var parts []int
+		for _, part := range strings.Split(version, ".") {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil
+			}
+			parts = append(parts, n)
+		}
+		for len(parts) < 3 {
+			parts = append(parts, 0)
+		}
+		return parts
+	}
+	c, l := parse(current), parse(latest)
+	if c == nil || l == nil {
+		return "unknown"
+	}
+	for i, level := range driftLevels[:3] {
+		if c[i] != l[i] {
+			return level
+		}
+	}
+	return "patch"
+}
+
+// OutdatedPackage is a package with a newer version on the feeds
+type OutdatedPackage struct {
+	Project   string
+	Framework string
+	Package   string
+	Current   string
+	Latest    string
+	// Referenced through another package rather than by the project
+	Transitive bool
+	// How far behind the current version is: major, minor, patch or unknown
+	Drift string
+}
+
+// OutdatedReport lists a solution's outdated packages, most behind first
+type OutdatedReport struct {
+	Major    int
+	Minor    int
+	Patch    int
+	Unknown  int
+	Packages []*OutdatedPackage
+}
+
+// Summary renders the report, one line per package
+func (r *OutdatedReport) Summary() string {
+	if len(r.Packages) == 0 {
+		return "✅ All packages are up to date\n"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📦 %d outdated package(s): %d major, %d minor, %d patch, %d unknown\n",
+		len(r.Packages), r.Major, r.Minor, r.Patch, r.Unknown)
+	for _, p := range r.Packages {
+		kind := ""
+		if p.Transitive {
+			kind = ", transitive"
+		}
+		fmt.Fprintf(&sb, "   • %s %s → %s (%s%s, %s %s)\n", p.Package, p.Current, p.Latest, p.Drift, kind, p.Project, p.Framework)
+	}
+	return sb.String()
+}
+
+// OutdatedPackages lists the packages with newer versions on the configured feeds,
+// with how far behind each one is, to track dependency freshness next to the
+// vulnerability scans
+func (m *Dotnet) OutdatedPackages(
+	ctx context.Context,
+	// Source directory containing .NET project
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Solution or project file
+	// +default="."
+	project string,
+	// Include the packages referenced through other packages
+	// +default=true
+	includeTransitive bool,
+	// SDK image version
+	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
+	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
+) (*OutdatedReport, error) {
+	options := []string{"--outdated"}
+	if includeTransitive {
+		options = append(options, "--include-transitive")
+	}
+	list, err := listPackages(ctx, source, project, sdkImage, nugetCache, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OutdatedReport{}
+	for _, p := range list.Projects {
+		for _, f := range p.Frameworks {
+			add := func(packages []listedPackage, transitive bool) {
+				for _, pkg := range packages {
+					drift := versionDrift(pkg.ResolvedVersion, pkg.LatestVersion)
+					switch drift {
+					case "major":
+						report.Major++
+					case "minor":
+						report.Minor++
+					case "patch":
+						report.Patch++
+					default:
+						report.Unknown++
+					}
+					report.Packages = append(report.Packages, &OutdatedPackage{
+						Project:    strings.TrimPrefix(p.Path, "/src/"),
+						Framework:  f.Framework,
+						Package:    pkg.Id,
+						Current:    pkg.ResolvedVersion,
+						Latest:     pkg.LatestVersion,
+						Transitive: transitive,
+						Drift:      drift,
+					})
+				}
+			}
+			add(f.TopLevelPackages, false)
+			add(f.TransitivePackages, true)
+		}
+	}
+	slices.SortStableFunc(report.Packages, func(a, b *OutdatedPackage) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(driftLevels, a.Drift), slices.Index(driftLevels, b.Drift)),
+			cmp.Compare(boolRank(a.Transitive), boolRank(b.Transitive)),
+			strings.Compare(a.Package, b.Package),
+		)
+	})
+	return report, nil
+}
+
+// Advisory severities as NuGet reports them, from least to most severe
+var advisorySeverities = []string{"low", "moderate", "high", "critical"}
+
+// PackageAdvisory is a known vulnerability of a resolved package
+type PackageAdvisory struct {
+	Project    string
+	Framework  string
+	Package    string
+	Version    string
+	Transitive bool
+	// low, moderate, high or critical
+	Severity    string
+	AdvisoryUrl string
+}
+
+// AuditReport lists the advisories of a solution's packages, most severe first
+type AuditReport struct {
+	Critical   int
+	High       int
+	Moderate   int
+	Low        int
+	Advisories []*PackageAdvisory
+}
+
+// Summary renders the report, one line per advisory
+func (r *AuditReport) Summary() string {
+	if len(r.Advisories) == 0 {
+		return "✅ No vulnerable packages\n"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🛡️  %d advisory(ies): %d critical, %d high, %d moderate, %d low\n",
+		len(r.Advisories), r.Critical, r.High, r.Moderate, r.Low)
+	for _, a := range r.Advisories {
+		kind := ""
+		if a.Transitive {
+			kind = ", transitive"
+		}
+		fmt.Fprintf(&sb, "   • %s %s: %s%s (%s %s) %s\n", a.Package, a.Version, a.Severity, kind, a.Project, a.Framework, a.AdvisoryUrl)
+	}
+	return sb.String()
+}
+
+// AuditPackages lists the resolved packages with known vulnerabilities from the
+// NuGet feeds' advisory data, a NuGet-native second opinion next to Trivy; with a
+// failOnSeverity, advisories at or above it fail the audit, returning the report too
+func (m *Dotnet) AuditPackages(
+	ctx context.Context,
+	// Source directory containing .NET project
+	// +optional
+	// +defaultPath="."
+	source *dagger.Directory,
+	// Lowest severity that fails the audit (low, moderate, high or critical); empty
+	// only reports
+	// +optional
+	failOnSeverity string,
+	// Solution or project file
+	// +default="."
+	project string,
+	// Include the packages referenced through other packages
+	// +default=true
+	includeTransitive bool,
+	// SDK image version
+	// +default="mcr.microsoft.com/dotnet/sdk:8.0"
+	sdkImage string,
+	// Cache volume for the NuGet packages (e.g., one shared across the pipeline), so
+	// repeated calls don't download the package graph again
+	// +optional
+	nugetCache *dagger.CacheVolume,
+) (*AuditReport, error) {
+	failOnSeverity = strings.ToLower(failOnSeverity)
+	threshold := slices.Index(advisorySeverities, failOnSeverity)
+	if failOnSeverity != "" && threshold < 0 {
+		return nil, fmt.Errorf("invalid failOnSeverity %q (expected %s)", failOnSeverity, strings.Join(advisorySeverities, ", "))
+	}
+	options := []string{"--vulnerable"}
+	if includeTransitive {
+		options = append(options, "--include-transitive")
+	}
+	list, err := listPackages(ctx, source, project, sdkImage, nugetCache, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{}
+	failing := 0
+	for _, p := range list.Projects {
+		for _, f := range p.Frameworks {
+			add := func(packages []listedPackage, transitive bool) {
+				for _, pkg := range packages {
+					for _, v := range pkg.Vulnerabilities {
+						severity := strings.ToLower(v.Severity)
+						switch severity {
+						case "critical":
+							report.Critical++
+						case "high":
+							report.High++
+						case "moderate":
+							report.Moderate++
+						case "low":
+							report.Low++
+						}
+						if threshold >= 0 && slices.Index(advisorySeverities, severity) >= threshold {
+							failing++
+						}
+						report.Advisories = append(report.Advisories, &PackageAdvisory{
+							Project:     strings.TrimPrefix(p.Path, "/src/"),
+							Framework:   f.Framework,
+							Package:     pkg.Id,
+							Version:     pkg.ResolvedVersion,
+							Transitive:  transitive,
+							Severity:    severity,
+							AdvisoryUrl: v.AdvisoryUrl,
+						})
+					}
+				}
+			}
+			add(f.TopLevelPackages, false)
+			add(f.TransitivePackages, true)
+		}
+	}
+	slices.SortStableFunc(report.Advisories, func(a, b *PackageAdvisory) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(advisorySeverities, b.Severity), slices.Index(advisorySeverities, a.Severity)),
+			strings.Compare(a.Package, b.Package),
+		)
+	})
+	if failing > 0 {
+		return report, fmt.Errorf("%d advisory(ies) at or above %s:\n%s", failing, failOnSeverity, report.Summary())
+	}
+	return report, nil
+}
+
+// boolRank orders false before true
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestVersionDrift(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		want            string
+	}{
+		{"12.0.3", "13.0.1", "major"},
+		{"6.0.0", "6.1.0", "minor"},
+		{"6.0.0", "6.0.5", "patch"},
+		{"8.0", "8.0.1", "patch"},
+		{"2", "2.1", "minor"},
+		{"1.2.3.4", "1.2.3.5", "patch"},
+		{"1.0.0-beta.1", "1.0.0", "patch"},
+		{"1.0.0-beta.1", "2.0.0-rc.1", "major"},
+		{"1.0.0", "latest", "unknown"},
+		{"", "1.0.0", "unknown"},
+		{"1..0", "1.0.0", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := versionDrift(tt.current, tt.latest); got != tt.want {
+			t.Errorf("versionDrift(%q, %q) = %s, want %s", tt.current, tt.latest, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Dagger module for Helm - chart linting, rendering, packaging and OCI publishing
+package main
+
+import (
+	"context"
+	"dagger/helm/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const helmImage = "alpine/helm:3.15.4"
+
+type Helm struct{}
+
+// helm is a Helm container with the chart at /chart
+func helm(chart *dagger.Directory) *dagger.Container {
+	return dag.Container().
+		From(helmImage).
+		WithDirectory("/chart", chart).
+		WithWorkdir("/chart")
+}
+
+// Lint checks a chart for problems
+func (m *Helm) Lint(
+	ctx context.Context,
+	// Chart directory (containing Chart.yaml)
+	chart *dagger.Directory,
+	// Fail on warnings as well as errors
+	// +default=true
+	strict bool,
+	// Values to set (e.g., "image.tag=v1.2.0")
+	// +optional
+	set []string,
+) (string, error) {
+	args := []string{"helm", "lint", "."}
+	if strict {
+		args = append(args, "--strict")
+	}
+	for _, s := range set {
+		args = append(args, "--set", s)
+	}
+	return helm(chart).WithExec(args).Stdout(ctx)
+}
+
+// Template renders a chart's manifests without a cluster
+func (m *Helm) Template(
+	ctx context.Context,
+	// Chart directory (containing Chart.yaml)
+	chart *dagger.Directory,
+	// Release name
+	// +default="release"
+	releaseName string,
+	// Namespace to render for
+	// +default="default"
+	namespace string,
+	// Values to set (e.g., "image.tag=v1.2.0")
+	// +optional
+	set []string,
+) (string, error) {
+	args := []string{"helm", "template", releaseName, ".", "--namespace", namespace}
+	for _, s := range set {
+		args = append(args, "--set", s)
+	}
+	return helm(chart).WithExec(args).Stdout(ctx)
+}
+
+// Package packages a chart into a versioned archive (<name>-<version>.tgz)
+func (m *Helm) Package(
+	ctx context.Context,
+	// Chart directory (containing Chart.yaml)
+	chart *dagger.Directory,
+	// Chart version (defaults to the version in Chart.yaml)
+	// +optional
+	version string,
+	// App version (defaults to the appVersion in Chart.yaml)
+	// +optional
+	appVersion string,
+) (*dagger.File, error) {
+	args := []string{"helm", "package", ".", "--destination", "/out"}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	if appVersion != "" {
+		args = append(args, "--app-version", appVersion)
+	}
+	out := helm(chart).WithExec(args).Directory("/out")
+
+	entries, err := out.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, ".tgz") {
+			return out.File(entry), nil
+		}
+	}
+	return nil, fmt.Errorf("helm package produced no chart archive")
+}
+
+// Push pushes a packaged chart to an OCI registry and returns helm's output,
+// which includes the pushed digest
+func (m *Helm) Push(
+	ctx context.Context,
+	// Chart archive (see Package)
+	chart *dagger.File,
+	// OCI repository to push to (e.g., "oci://ghcr.io/myorg/charts")
+	remote string,
+	// Registry host to log in to (e.g., "ghcr.io")
+	// +optional
+	registryUrl string,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password or token
+	// +optional
+	password *dagger.Secret,
+) (string, error) {
+	c := dag.Container().
+		From(helmImage).
+		WithMountedFile("/chart.tgz", chart)
+
+	if username != "" && password != nil {
+		// Credentials are expanded inside the shell so they never appear in the exec args
+		c = c.
+			WithEnvVariable("REGISTRY_URL", registryUrl).
+			WithEnvVariable("REGISTRY_USERNAME", username).
+			WithSecretVariable("REGISTRY_PASSWORD", password).
+			WithExec([]string{"sh", "-c", `echo "$REGISTRY_PASSWORD" | helm registry login "$REGISTRY_URL" -u "$REGISTRY_USERNAME" --password-stdin`})
+	}
+
+	// helm push reports the pushed reference and digest on stderr
+	return c.
+		WithExec([]string{"sh", "-c", `helm push /chart.tgz "$0" 2>&1`, remote}).
+		Stdout(ctx)
+}
+
+// Upgrade installs or upgrades a release and waits until its resources are ready
+// A release that doesn't become ready in time is rolled back (--atomic)
+func (m *Helm) Upgrade(
+	ctx context.Context,
+	// Chart directory (containing Chart.yaml)
+	chart *dagger.Directory,
+	// Release name
+	releaseName string,
+	// Namespace to deploy to (created when missing)
+	namespace string,
+	// Kubeconfig of the target cluster
+	kubeconfig *dagger.Secret,
+	// Values to set (e.g., "image.tag=v1.2.0")
+	// +optional
+	set []string,
+	// How long to wait for the release to become ready
+	// +default="5m"
+	timeout string,
+) (string, error) {
+	args := []string{"helm", "upgrade", releaseName, ".", "--install", "--namespace", namespace,
+		"--create-namespace", "--wait", "--atomic", "--timeout", timeout}
+	for _, s := range set {
+		args = append(args, "--set", s)
+	}
+	return helm(chart).
+		WithMountedSecret("/root/.kube/config", kubeconfig).
+		// Deploying must never be served from cache
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec(args).
+		Stdout(ctx)
+}
@@ -132,3 +132,110 @@ export default function () {
 		WithExec([]string{"k6", "run", "/test.js"}).
 		Stdout(ctx)
 }
+
+// Summary runs a k6 test script and returns the end-of-test summary as JSON
+// Threshold failures don't fail the call, so callers can evaluate the metrics themselves
+func (m *K6) Summary(
+	ctx context.Context,
+	// Service to test
+	apiService *dagger.Service,
+	// k6 test script (.js file)
+	testScript *dagger.File,
+) (string, error) {
+	return dag.Container().
+		From("grafana/k6:latest").
+		WithServiceBinding("api", apiService).
+		WithMountedFile("/test.js", testScript).
+		WithExec([]string{
+			"k6", "run",
+			"--summary-trend-stats", "avg,min,med,max,p(90),p(95),p(99)",
+			"--summary-export", "/tmp/summary.json",
+			"/test.js",
+		}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		File("/tmp/summary.json").
+		Contents(ctx)
+}
+
+// dataDrivenScript replays the requests in /requests.json at a constant arrival rate
+// Each request name gets its own latency trend (endpoint_<name>) in the summary;
+// 4xx responses are expected for replayed traffic, so only 5xx and connection errors fail
+const dataDrivenScript = `
+import http from 'k6/http';
+import { SharedArray } from 'k6/data';
+import { Trend } from 'k6/metrics';
+
+http.setResponseCallback(http.expectedStatuses({ min: 200, max: 499 }));
+
+const requests = new SharedArray('requests', () => JSON.parse(open('/requests.json')));
+const metricName = (name) => 'endpoint_' + (name || 'default').replace(/[^A-Za-z0-9_]/g, '_');
+const trends = {};
+for (const r of requests) {
+  const metric = metricName(r.name);
+  if (!trends[metric]) {
+    trends[metric] = new Trend(metric, true);
+  }
+}
+
+export const options = {
+  scenarios: {
+    replay: {
+      executor: 'constant-arrival-rate',
+      rate: Number(__ENV.RATE),
+      timeUnit: '1s',
+      duration: __ENV.DURATION,
+      preAllocatedVUs: Number(__ENV.VUS),
+    },
+  },
+};
+
+export default function () {
+  const r = requests[Math.floor(Math.random() * requests.length)];
+  const body = r.body ? JSON.stringify(r.body) : null;
+  const response = http.request(r.method || 'GET', __ENV.TARGET_URL + r.path, body, {
+    headers: { 'Content-Type': 'application/json' },
+    tags: { name: r.name || r.path },
+  });
+  trends[metricName(r.name)].add(response.timings.duration);
+}
+`
+
+// DataDriven replays requests from a JSON array ([{"name","method","path","body"}]) at
+// a constant arrival rate, picking one at random per iteration, and returns the
+// end-of-test summary as JSON with a latency trend per request name (endpoint_<name>)
+func (m *K6) DataDriven(
+	ctx context.Context,
+	// Service to test
+	apiService *dagger.Service,
+	// JSON array of requests
+	requests *dagger.File,
+	// Target URL
+	// +default="http://api:8080"
+	targetUrl string,
+	// Requests per second
+	// +default=20
+	rate int,
+	// Test duration (e.g., "30s", "2m")
+	// +default="1m"
+	duration string,
+	// Pre-allocated virtual users
+	// +default=20
+	vus int,
+) (string, error) {
+	return dag.Container().
+		From("grafana/k6:latest").
+		WithServiceBinding("api", apiService).
+		WithMountedFile("/requests.json", requests).
+		WithNewFile("/test.js", dataDrivenScript).
+		WithEnvVariable("TARGET_URL", targetUrl).
+		WithEnvVariable("RATE", fmt.Sprint(rate)).
+		WithEnvVariable("DURATION", duration).
+		WithEnvVariable("VUS", fmt.Sprint(vus)).
+		WithExec([]string{
+			"k6", "run",
+			"--summary-trend-stats", "avg,min,med,max,p(90),p(95),p(99)",
+			"--summary-export", "/tmp/summary.json",
+			"/test.js",
+		}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny}).
+		File("/tmp/summary.json").
+		Contents(ctx)
+}
@@ -22,11 +22,18 @@ func (m *Nuclei) Scan(
 	// Severity levels: info, low, medium, high, critical
 	// +default=["high", "critical"]
 	severity []string,
+	// Run the full template set, ignoring tags (slow; for scheduled deep scans)
+	// +optional
+	allTemplates bool,
+	// nuclei-templates directory to use instead of downloading the templates at scan
+	// time; for runners without internet access
+	// +optional
+	offlineTemplates *dagger.Directory,
 ) (string, error) {
 	args := []string{"nuclei", "-u", targetUrl}
 
 	// Add tags
-	if len(tags) > 0 {
+	if len(tags) > 0 && !allTemplates {
 		tagStr := ""
 		for i, tag := range tags {
 			if i > 0 {
@@ -51,11 +58,15 @@ func (m *Nuclei) Scan(
 
 	args = append(args, "-j", "-silent")
 
-	return dag.Container().
+	container := dag.Container().
 		From("projectdiscovery/nuclei:latest").
-		WithServiceBinding("api", apiService).
-		WithExec(args).
-		Stdout(ctx)
+		WithServiceBinding("api", apiService)
+	if offlineTemplates != nil {
+		container = container.WithDirectory("/templates", offlineTemplates)
+		args = append(args, "-t", "/templates", "-disable-update-check")
+	}
+
+	return container.WithExec(args).Stdout(ctx)
 }
 
 // ScanApi runs API-specific security tests
@@ -66,8 +77,12 @@ func (m *Nuclei) ScanApi(
 	// Target URL
 	// +default="http://api:8080"
 	targetUrl string,
+	// nuclei-templates directory to use instead of downloading the templates at scan
+	// time; for runners without internet access
+	// +optional
+	offlineTemplates *dagger.Directory,
 ) (string, error) {
-	return m.Scan(ctx, apiService, targetUrl, []string{"api", "owasp", "owasp-api-top-10"}, []string{"high", "critical"})
+	return m.Scan(ctx, apiService, targetUrl, []string{"api", "owasp", "owasp-api-top-10"}, []string{"high", "critical"}, false, offlineTemplates)
 }
 
 // ScanCve scans for known CVEs
@@ -79,7 +94,7 @@ func (m *Nuclei) ScanCve(
 	// +default="http://api:8080"
 	targetUrl string,
 ) (string, error) {
-	return m.Scan(ctx, apiService, targetUrl, []string{"cve"}, []string{"high", "critical"})
+	return m.Scan(ctx, apiService, targetUrl, []string{"cve"}, []string{"high", "critical"}, false, nil)
 }
 
 // ScanWithCustomTemplates scans with custom Nuclei templates
@@ -0,0 +1,60 @@
+// Dagger module for oasdiff - OpenAPI diff and breaking change detection
+// Classifies changes between two OpenAPI documents as breaking (ERR), potentially breaking (WARN) or non-breaking (INFO)
+package main
+
+import (
+	"context"
+	"dagger/oasdiff/internal/dagger"
+)
+
+type Oasdiff struct{}
+
+// Changelog lists every change from base to revision with its level
+func (m *Oasdiff) Changelog(
+	ctx context.Context,
+	// OpenAPI document of the previous version (JSON or YAML)
+	base *dagger.File,
+	// OpenAPI document of the new version
+	revision *dagger.File,
+	// Output format: json, yaml, text, markdown, html, githubactions, junit
+	// +default="json"
+	format string,
+	// Level that fails the call: ERR or WARN (empty never fails)
+	// +optional
+	failOn string,
+) (string, error) {
+	return oasdiff(ctx, "changelog", base, revision, format, failOn)
+}
+
+// Breaking lists only breaking and potentially breaking changes from base to revision
+func (m *Oasdiff) Breaking(
+	ctx context.Context,
+	// OpenAPI document of the previous version (JSON or YAML)
+	base *dagger.File,
+	// OpenAPI document of the new version
+	revision *dagger.File,
+	// Output format: json, yaml, text, markdown, html, githubactions, junit
+	// +default="text"
+	format string,
+	// Level that fails the call: ERR or WARN (empty never fails)
+	// +optional
+	failOn string,
+) (string, error) {
+	return oasdiff(ctx, "breaking", base, revision, format, failOn)
+}
+
+// oasdiff runs an oasdiff command on the two documents
+func oasdiff(ctx context.Context, command string, base *dagger.File, revision *dagger.File, format string, failOn string) (string, error) {
+	args := []string{"oasdiff", command, "/specs/base", "/specs/revision", "--format", format}
+
+	if failOn != "" {
+		args = append(args, "--fail-on", failOn)
+	}
+
+	return dag.Container().
+		From("tufin/oasdiff:latest").
+		WithMountedFile("/specs/base", base).
+		WithMountedFile("/specs/revision", revision).
+		WithExec(args).
+		Stdout(ctx)
+}
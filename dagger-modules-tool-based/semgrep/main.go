@@ -27,12 +27,23 @@ func (m *Semgrep) Scan(
 	// Exclude patterns (e.g., "*.Tests", "test/", "node_modules/")
 	// +optional
 	exclude []string,
+	// Rule IDs to suppress (e.g., "csharp.lang.security.sqli.csharp-sqli")
+	// +optional
+	excludeRules []string,
+	// Rule files to scan with instead of configs, which are downloaded from the
+	// registry at scan time; for runners without internet access
+	// +optional
+	offlineRules *dagger.Directory,
 ) (string, error) {
 	args := []string{"semgrep"}
 
 	// Add configs
-	for _, config := range configs {
-		args = append(args, "--config="+config)
+	if offlineRules != nil {
+		args = append(args, "--config=/rules", "--disable-version-check")
+	} else {
+		for _, config := range configs {
+			args = append(args, "--config="+config)
+		}
 	}
 
 	// Add severity levels
@@ -45,6 +56,11 @@ func (m *Semgrep) Scan(
 		args = append(args, "--exclude="+exc)
 	}
 
+	// Add rule excludes
+	for _, rule := range excludeRules {
+		args = append(args, "--exclude-rule="+rule)
+	}
+
 	// Add format
 	if format == "sarif" {
 		args = append(args, "--sarif", "--output=/tmp/semgrep-results.sarif")
@@ -58,8 +74,11 @@ func (m *Semgrep) Scan(
 	container := dag.Container().
 		From("returntocorp/semgrep:latest").
 		WithDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec(args)
+		WithWorkdir("/src")
+	if offlineRules != nil {
+		container = container.WithDirectory("/rules", offlineRules)
+	}
+	container = container.WithExec(args)
 
 	if format == "sarif" {
 		return container.
@@ -155,7 +174,7 @@ func (m *Semgrep) ScanLanguage(
 		configs = append(configs, "p/owasp-top-ten")
 	}
 
-	return m.Scan(ctx, source, configs, []string{"ERROR", "WARNING"}, format, nil)
+	return m.Scan(ctx, source, configs, []string{"ERROR", "WARNING"}, format, nil, nil, nil)
 }
 
 // ScanXss scans specifically for XSS vulnerabilities
@@ -169,7 +188,7 @@ func (m *Semgrep) ScanXss(
 	// +default="json"
 	format string,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"p/xss"}, []string{"ERROR", "WARNING"}, format, nil)
+	return m.Scan(ctx, source, []string{"p/xss"}, []string{"ERROR", "WARNING"}, format, nil, nil, nil)
 }
 
 // ScanSqlInjection scans for SQL injection vulnerabilities
@@ -183,5 +202,5 @@ func (m *Semgrep) ScanSqlInjection(
 	// +default="json"
 	format string,
 ) (string, error) {
-	return m.Scan(ctx, source, []string{"p/sql-injection"}, []string{"ERROR", "WARNING"}, format, nil)
+	return m.Scan(ctx, source, []string{"p/sql-injection"}, []string{"ERROR", "WARNING"}, format, nil, nil, nil)
 }
@@ -6,10 +6,14 @@ import (
 	"context"
 	"dagger/skopeo/internal/dagger"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type Skopeo struct{}
 
+const skopeoImage = "quay.io/skopeo/stable:latest"
+
 // Copy copies a container image from source to destination
 func (m *Skopeo) Copy(
 	ctx context.Context,
@@ -26,6 +30,15 @@ func (m *Skopeo) Copy(
 	// Source type
 	// +default="docker-archive"
 	sourceType string,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password or token
+	// +optional
+	password *dagger.Secret,
+	// CA certificate to trust for the destination registry (e.g., a self-signed local registry)
+	// +optional
+	caCertificate *dagger.File,
 ) (string, error) {
 	// Save container as tarball
 	tarball := container.AsTarball()
@@ -36,16 +49,29 @@ func (m *Skopeo) Copy(
 		args = append(args, "--dest-tls-verify=false")
 	}
 
-	args = append(args, fmt.Sprintf("%s:/image.tar", sourceType), destRef)
-
 	c := dag.Container().
-		From("quay.io/skopeo/stable:latest").
+		From(skopeoImage).
 		WithMountedFile("/image.tar", tarball)
 
+	if caCertificate != nil {
+		c = c.WithMountedFile("/certs/ca.crt", caCertificate)
+		args = append(args, "--dest-cert-dir=/certs")
+	}
+
+	args = append(args, fmt.Sprintf("%s:/image.tar", sourceType), destRef)
+
 	if registryService != nil {
 		c = c.WithServiceBinding("registry", registryService)
 	}
 
+	if username != "" && password != nil {
+		// Credentials are expanded inside the shell so they never appear in the exec args
+		c = c.
+			WithEnvVariable("REGISTRY_USERNAME", username).
+			WithSecretVariable("REGISTRY_PASSWORD", password)
+		args = append([]string{"sh", "-c", `exec skopeo copy --dest-creds="$REGISTRY_USERNAME:$REGISTRY_PASSWORD" "$@"`, "sh"}, args[2:]...)
+	}
+
 	return c.WithExec(args).Stdout(ctx)
 }
 
@@ -60,6 +86,12 @@ func (m *Skopeo) Inspect(
 	// Disable TLS verification
 	// +default=false
 	disableTLS bool,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password or token
+	// +optional
+	password *dagger.Secret,
 ) (string, error) {
 	args := []string{"skopeo", "inspect"}
 
@@ -70,12 +102,19 @@ func (m *Skopeo) Inspect(
 	args = append(args, imageRef)
 
 	c := dag.Container().
-		From("quay.io/skopeo/stable:latest")
+		From(skopeoImage)
 
 	if registryService != nil {
 		c = c.WithServiceBinding("registry", registryService)
 	}
 
+	if username != "" && password != nil {
+		c = c.
+			WithEnvVariable("REGISTRY_USERNAME", username).
+			WithSecretVariable("REGISTRY_PASSWORD", password)
+		args = append([]string{"sh", "-c", `exec skopeo inspect --creds="$REGISTRY_USERNAME:$REGISTRY_PASSWORD" "$@"`, "sh"}, args[2:]...)
+	}
+
 	return c.WithExec(args).Stdout(ctx)
 }
 
@@ -100,7 +139,7 @@ func (m *Skopeo) Delete(
 	args = append(args, imageRef)
 
 	c := dag.Container().
-		From("quay.io/skopeo/stable:latest")
+		From(skopeoImage)
 
 	if registryService != nil {
 		c = c.WithServiceBinding("registry", registryService)
@@ -127,7 +166,81 @@ func (m *Skopeo) PushToRegistry(
 	// Disable TLS verification
 	// +default=false
 	disableTLS bool,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password or token
+	// +optional
+	password *dagger.Secret,
+	// CA certificate to trust for the registry (e.g., a self-signed local registry)
+	// +optional
+	caCertificate *dagger.File,
 ) (string, error) {
 	destRef := fmt.Sprintf("docker://%s/%s:%s", registryHost, imageName, tag)
-	return m.Copy(ctx, container, destRef, registryService, disableTLS, "docker-archive")
+	return m.Copy(ctx, container, destRef, registryService, disableTLS, "docker-archive", username, password, caCertificate)
+}
+
+// Tag adds tags to an image already in a registry by copying it by digest
+// Only the manifest is written, so nothing is rebuilt or re-uploaded and the digest is preserved
+func (m *Skopeo) Tag(
+	ctx context.Context,
+	// Image repository without tag (e.g., "ghcr.io/myorg/search-api")
+	repository string,
+	// Digest of the existing image (e.g., "sha256:...")
+	digest string,
+	// Tags to add
+	tags []string,
+	// Registry username
+	// +optional
+	username string,
+	// Registry password or token
+	// +optional
+	password *dagger.Secret,
+	// Service binding for registry (optional)
+	// +optional
+	registryService *dagger.Service,
+	// Disable TLS verification
+	// +default=false
+	disableTLS bool,
+) (string, error) {
+	if len(tags) == 0 {
+		return "", fmt.Errorf("at least one tag is required")
+	}
+
+	script := `set -e
+src="docker://$REPOSITORY@$DIGEST"
+for tag in $TAGS; do
+  skopeo copy --all --preserve-digests $SKOPEO_FLAGS "$src" "docker://$REPOSITORY:$tag"
+  echo "$REPOSITORY:$tag -> $DIGEST"
+done
+`
+	flags := ""
+	if disableTLS {
+		flags += " --src-tls-verify=false --dest-tls-verify=false"
+	}
+
+	c := dag.Container().
+		From(skopeoImage).
+		WithEnvVariable("REPOSITORY", repository).
+		WithEnvVariable("DIGEST", digest).
+		WithEnvVariable("TAGS", strings.Join(tags, " "))
+
+	if username != "" && password != nil {
+		// Credentials are expanded inside the shell so they never appear in the exec args
+		c = c.
+			WithEnvVariable("REGISTRY_USERNAME", username).
+			WithSecretVariable("REGISTRY_PASSWORD", password)
+		script = `SKOPEO_FLAGS="$SKOPEO_FLAGS --src-creds=$REGISTRY_USERNAME:$REGISTRY_PASSWORD --dest-creds=$REGISTRY_USERNAME:$REGISTRY_PASSWORD"` + "\n" + script
+	}
+
+	if registryService != nil {
+		c = c.WithServiceBinding("registry", registryService)
+	}
+
+	// Tagging changes the registry, so it must never be served from cache
+	return c.
+		WithEnvVariable("SKOPEO_FLAGS", flags).
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", script}).
+		Stdout(ctx)
 }
@@ -5,10 +5,26 @@ package main
 import (
 	"context"
 	"dagger/trivy/internal/dagger"
+	"strings"
 )
 
 type Trivy struct{}
 
+// withOfflineDb points Trivy at a pre-downloaded cache and turns off every
+// download, for runners without internet access
+func withOfflineDb(c *dagger.Container, args []string, offlineDb *dagger.Directory) (*dagger.Container, []string) {
+	if offlineDb == nil {
+		return c, args
+	}
+	return c.WithDirectory("/trivy-cache", offlineDb), append(args,
+		"--cache-dir", "/trivy-cache",
+		"--skip-db-update",
+		"--skip-java-db-update",
+		"--skip-check-update",
+		"--offline-scan",
+	)
+}
+
 // ScanFilesystem scans source code for vulnerabilities, secrets, misconfigs, licenses
 func (m *Trivy) ScanFilesystem(
 	ctx context.Context,
@@ -28,6 +44,13 @@ func (m *Trivy) ScanFilesystem(
 	// Exit code when vulnerabilities are found (0 = no fail, 1 = fail)
 	// +default=0
 	exitCode int,
+	// Ignore file listing finding IDs to suppress (.trivyignore format)
+	// +optional
+	ignoreFile *dagger.File,
+	// Trivy cache with a pre-downloaded vulnerability DB (db/trivy.db, e.g. from
+	// "trivy image --download-db-only --cache-dir"); nothing is downloaded when set
+	// +optional
+	offlineDb *dagger.Directory,
 ) (string, error) {
 	scannersStr := ""
 	for i, s := range scanners {
@@ -56,14 +79,20 @@ func (m *Trivy) ScanFilesystem(
 		args = append(args, "--exit-code", "1")
 	}
 
-	args = append(args, ".")
-
-	return dag.Container().
+	c := dag.Container().
 		From("aquasec/trivy:latest").
 		WithDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec(args).
-		Stdout(ctx)
+		WithWorkdir("/src")
+
+	if ignoreFile != nil {
+		c = c.WithMountedFile("/config/.trivyignore", ignoreFile)
+		args = append(args, "--ignorefile", "/config/.trivyignore")
+	}
+	c, args = withOfflineDb(c, args, offlineDb)
+
+	args = append(args, ".")
+
+	return c.WithExec(args).Stdout(ctx)
 }
 
 // ScanContainer scans a container image for vulnerabilities
@@ -83,6 +112,16 @@ func (m *Trivy) ScanContainer(
 	// Exit code on findings
 	// +default=0
 	exitCode int,
+	// Scanners for the image config (misconfig, secret), e.g. root user or missing healthcheck
+	// +optional
+	imageConfigScanners []string,
+	// Ignore file listing finding IDs to suppress (.trivyignore format)
+	// +optional
+	ignoreFile *dagger.File,
+	// Trivy cache with a pre-downloaded vulnerability DB (db/trivy.db, e.g. from
+	// "trivy image --download-db-only --cache-dir"); nothing is downloaded when set
+	// +optional
+	offlineDb *dagger.Directory,
 ) (string, error) {
 	tarball := container.AsTarball()
 
@@ -110,15 +149,25 @@ func (m *Trivy) ScanContainer(
 		"--format", format,
 	}
 
+	if len(imageConfigScanners) > 0 {
+		args = append(args, "--image-config-scanners", strings.Join(imageConfigScanners, ","))
+	}
+
 	if exitCode > 0 {
 		args = append(args, "--exit-code", "1")
 	}
 
-	return dag.Container().
+	c := dag.Container().
 		From("aquasec/trivy:latest").
-		WithMountedFile("/image.tar", tarball).
-		WithExec(args).
-		Stdout(ctx)
+		WithMountedFile("/image.tar", tarball)
+
+	if ignoreFile != nil {
+		c = c.WithMountedFile("/config/.trivyignore", ignoreFile)
+		args = append(args, "--ignorefile", "/config/.trivyignore")
+	}
+	c, args = withOfflineDb(c, args, offlineDb)
+
+	return c.WithExec(args).Stdout(ctx)
 }
 
 // ScanVulnerabilities scans for package vulnerabilities (dependencies)
@@ -134,13 +183,20 @@ func (m *Trivy) ScanVulnerabilities(
 	// Fail build on findings
 	// +default=true
 	failOnFindings bool,
+	// Ignore file listing finding IDs to suppress (.trivyignore format)
+	// +optional
+	ignoreFile *dagger.File,
+	// Trivy cache with a pre-downloaded vulnerability DB (db/trivy.db, e.g. from
+	// "trivy image --download-db-only --cache-dir"); nothing is downloaded when set
+	// +optional
+	offlineDb *dagger.Directory,
 ) (string, error) {
 	exitCode := 0
 	if failOnFindings {
 		exitCode = 1
 	}
 
-	return m.ScanFilesystem(ctx, source, []string{"vuln"}, severity, "json", exitCode)
+	return m.ScanFilesystem(ctx, source, []string{"vuln"}, severity, "json", exitCode, ignoreFile, offlineDb)
 }
 
 // ScanLicenses scans for license compliance issues
@@ -156,13 +212,20 @@ func (m *Trivy) ScanLicenses(
 	// Fail build on problematic licenses
 	// +default=true
 	failOnFindings bool,
+	// Ignore file listing finding IDs to suppress (.trivyignore format)
+	// +optional
+	ignoreFile *dagger.File,
+	// Trivy cache with a pre-downloaded vulnerability DB (db/trivy.db, e.g. from
+	// "trivy image --download-db-only --cache-dir"); nothing is downloaded when set
+	// +optional
+	offlineDb *dagger.Directory,
 ) (string, error) {
 	exitCode := 0
 	if failOnFindings {
 		exitCode = 1
 	}
 
-	return m.ScanFilesystem(ctx, source, []string{"license"}, severity, "json", exitCode)
+	return m.ScanFilesystem(ctx, source, []string{"license"}, severity, "json", exitCode, ignoreFile, offlineDb)
 }
 
 // ScanSecrets scans for hardcoded secrets in source code
@@ -181,7 +244,7 @@ func (m *Trivy) ScanSecrets(
 		exitCode = 1
 	}
 
-	return m.ScanFilesystem(ctx, source, []string{"secret"}, []string{"HIGH", "CRITICAL"}, "json", exitCode)
+	return m.ScanFilesystem(ctx, source, []string{"secret"}, []string{"HIGH", "CRITICAL"}, "json", exitCode, nil, nil)
 }
 
 // ScanMisconfigs scans for IaC misconfigurations (Kubernetes, Terraform, Docker, etc.)
@@ -203,7 +266,7 @@ func (m *Trivy) ScanMisconfigs(
 		exitCode = 1
 	}
 
-	return m.ScanFilesystem(ctx, source, []string{"misconfig"}, severity, "json", exitCode)
+	return m.ScanFilesystem(ctx, source, []string{"misconfig"}, severity, "json", exitCode, nil, nil)
 }
 
 // ScanAll runs all Trivy scanners (vulnerabilities, secrets, misconfigs, licenses)
@@ -227,6 +290,8 @@ func (m *Trivy) ScanAll(
 		severity,
 		format,
 		0, // Don't fail, just report
+		nil,
+		nil,
 	)
 }
 
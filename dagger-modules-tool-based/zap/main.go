@@ -4,36 +4,68 @@ package main
 import (
 	"context"
 	"dagger/zap/internal/dagger"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"time"
 )
 
 type Zap struct{}
 
-// BaselineScan runs a ZAP baseline scan against a target (quick passive scan)
-func (m *Zap) BaselineScan(
+// withOfflineAddons installs pre-downloaded add-ons into ZAP's home, which ZAP
+// prefers over the ones bundled with the image
+func withOfflineAddons(c *dagger.Container, offlineAddons *dagger.Directory) *dagger.Container {
+	if offlineAddons == nil {
+		return c
+	}
+	return c.WithDirectory("/home/zap/.ZAP/plugin", offlineAddons, dagger.ContainerWithDirectoryOpts{Owner: "zap"})
+}
+
+// packagedScan runs one of ZAP's packaged scan scripts against a target and returns
+// its JSON report
+func packagedScan(
 	ctx context.Context,
-	// Service to scan
+	script string,
 	apiService *dagger.Service,
-	// Target URL (e.g., "http://api:8080")
-	// +default="http://api:8080"
 	targetUrl string,
+	extraArgs []string,
+	ignoreAlerts []string,
+	offlineAddons *dagger.Directory,
 ) (string, error) {
 	zapContainer := dag.Container().
 		From("ghcr.io/zaproxy/zaproxy:stable").
 		WithServiceBinding("api", apiService).
 		WithMountedCache("/zap/wrk", dag.CacheVolume("zap-reports"))
 
-	_, _ = zapContainer.
-		WithExec([]string{
-			"zap-baseline.py",
-			"-t", targetUrl,
-			"-r", "/zap/wrk/report.html",
-			"-J", "/zap/wrk/report.json",
-			"-w", "/zap/wrk/report.md",
-			"-d",
-			"-I", // Don't fail on warning
-			"-z", "-config api.disablekey=true",
-		}).
-		Stdout(ctx)
+	zapOptions := "-config api.disablekey=true"
+	if offlineAddons != nil {
+		// -silent keeps ZAP from making any request of its own, such as update checks
+		zapOptions += " -silent"
+	}
+	args := []string{
+		script,
+		"-t", targetUrl,
+		"-r", "/zap/wrk/report.html",
+		"-J", "/zap/wrk/report.json",
+		"-w", "/zap/wrk/report.md",
+		"-d",
+		"-I", // Don't fail on warning
+		"-z", zapOptions,
+	}
+	args = append(args, extraArgs...)
+	scan := withOfflineAddons(zapContainer, offlineAddons)
+	if len(ignoreAlerts) > 0 {
+		// The rules file must live in /zap/wrk, which is a cache volume, so it is
+		// written by the same exec that reads it
+		rules := ""
+		for _, id := range ignoreAlerts {
+			rules += id + "\tIGNORE\t(suppressed)\n"
+		}
+		scan = scan.WithEnvVariable("ZAP_RULES", rules)
+		args = append([]string{"sh", "-c", `printf '%s' "$ZAP_RULES" > /zap/wrk/rules.tsv && exec "$@"`, "sh"}, args...)
+		args = append(args, "-c", "rules.tsv")
+	}
+	_, _ = scan.WithExec(args).Stdout(ctx)
 
 	// Return JSON report
 	return zapContainer.
@@ -41,6 +73,25 @@ func (m *Zap) BaselineScan(
 		Stdout(ctx)
 }
 
+// BaselineScan runs a ZAP baseline scan against a target (quick passive scan)
+func (m *Zap) BaselineScan(
+	ctx context.Context,
+	// Service to scan
+	apiService *dagger.Service,
+	// Target URL (e.g., "http://api:8080")
+	// +default="http://api:8080"
+	targetUrl string,
+	// Alert (plugin) IDs to ignore (e.g., "10038")
+	// +optional
+	ignoreAlerts []string,
+	// Add-on (.zap) files to run with instead of checking for updates at start; for
+	// runners without internet access
+	// +optional
+	offlineAddons *dagger.Directory,
+) (string, error) {
+	return packagedScan(ctx, "zap-baseline.py", apiService, targetUrl, nil, ignoreAlerts, offlineAddons)
+}
+
 // FullScan runs a full active scan (slower, more comprehensive)
 func (m *Zap) FullScan(
 	ctx context.Context,
@@ -49,31 +100,18 @@ func (m *Zap) FullScan(
 	// Target URL
 	// +default="http://api:8080"
 	targetUrl string,
-	// Maximum scan duration in minutes
+	// Maximum spider duration in minutes
 	// +default=10
 	maxDuration int,
+	// Alert (plugin) IDs to ignore (e.g., "10038")
+	// +optional
+	ignoreAlerts []string,
+	// Add-on (.zap) files to run with instead of checking for updates at start; for
+	// runners without internet access
+	// +optional
+	offlineAddons *dagger.Directory,
 ) (string, error) {
-	zapContainer := dag.Container().
-		From("ghcr.io/zaproxy/zaproxy:stable").
-		WithServiceBinding("api", apiService).
-		WithMountedCache("/zap/wrk", dag.CacheVolume("zap-reports"))
-
-	_, _ = zapContainer.
-		WithExec([]string{
-			"zap-full-scan.py",
-			"-t", targetUrl,
-			"-r", "/zap/wrk/report.html",
-			"-J", "/zap/wrk/report.json",
-			"-w", "/zap/wrk/report.md",
-			"-d",
-			"-I",
-			"-z", "-config api.disablekey=true",
-		}).
-		Stdout(ctx)
-
-	return zapContainer.
-		WithExec([]string{"sh", "-c", "cat /zap/wrk/report.json 2>/dev/null || echo '{}'"}).
-		Stdout(ctx)
+	return packagedScan(ctx, "zap-full-scan.py", apiService, targetUrl, []string{"-m", strconv.Itoa(maxDuration)}, ignoreAlerts, offlineAddons)
 }
 
 // ApiScan runs an API-specific scan using OpenAPI/Swagger definition
@@ -111,3 +149,118 @@ func (m *Zap) ApiScan(
 		WithExec([]string{"sh", "-c", "cat /zap/wrk/report.json 2>/dev/null || echo '{}'"}).
 		Stdout(ctx)
 }
+
+// afPlan is a ZAP Automation Framework plan; JSON is valid YAML, so it is written as-is
+type afPlan struct {
+	Env  afEnv   `json:"env"`
+	Jobs []afJob `json:"jobs"`
+}
+
+type afEnv struct {
+	Contexts   []afContext    `json:"contexts"`
+	Parameters map[string]any `json:"parameters"`
+}
+
+type afContext struct {
+	Name         string   `json:"name"`
+	Urls         []string `json:"urls"`
+	IncludePaths []string `json:"includePaths,omitempty"`
+	ExcludePaths []string `json:"excludePaths,omitempty"`
+}
+
+type afJob struct {
+	Type       string         `json:"type"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// AutomationScan runs a full active scan through the ZAP Automation Framework:
+// the OpenAPI definition (if given) and the spider discover endpoints within the
+// include/exclude scope, then every discovered request is actively attacked
+// Returns the traditional JSON report
+func (m *Zap) AutomationScan(
+	ctx context.Context,
+	// Service to scan
+	apiService *dagger.Service,
+	// Target URL
+	// +default="http://api:8080"
+	targetUrl string,
+	// OpenAPI/Swagger definition to import requests from
+	// +optional
+	apiDefinition *dagger.File,
+	// Regexes of URLs in scope (default: everything under the target URL)
+	// +optional
+	includePaths []string,
+	// Regexes of URLs never to request
+	// +optional
+	excludePaths []string,
+	// Maximum spider duration in minutes
+	// +default=5
+	spiderMinutes int,
+	// Maximum active scan duration in minutes
+	// +default=30
+	scanMinutes int,
+	// Add-on (.zap) files to run with instead of checking for updates at start; for
+	// runners without internet access
+	// +optional
+	offlineAddons *dagger.Directory,
+) (string, error) {
+	const contextName = "target"
+	if len(includePaths) == 0 {
+		includePaths = []string{regexp.QuoteMeta(targetUrl) + ".*"}
+	}
+
+	var jobs []afJob
+	if apiDefinition != nil {
+		jobs = append(jobs, afJob{Type: "openapi", Parameters: map[string]any{
+			"apiFile":   "/zap/wrk/openapi.json",
+			"targetUrl": targetUrl,
+			"context":   contextName,
+		}})
+	}
+	jobs = append(jobs,
+		afJob{Type: "spider", Parameters: map[string]any{"context": contextName, "maxDuration": spiderMinutes}},
+		afJob{Type: "passiveScan-wait", Parameters: map[string]any{"maxDuration": 5}},
+		afJob{Type: "activeScan", Parameters: map[string]any{"context": contextName, "maxScanDurationInMins": scanMinutes}},
+		afJob{Type: "report", Parameters: map[string]any{
+			"template":   "traditional-json",
+			"reportDir":  "/zap/wrk",
+			"reportFile": "report.json",
+		}},
+	)
+
+	plan, err := json.MarshalIndent(afPlan{
+		Env: afEnv{
+			Contexts: []afContext{{
+				Name:         contextName,
+				Urls:         []string{targetUrl},
+				IncludePaths: includePaths,
+				ExcludePaths: excludePaths,
+			}},
+			Parameters: map[string]any{"failOnError": true, "progressToStdout": true},
+		},
+		Jobs: jobs,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	zapContainer := dag.Container().
+		From("ghcr.io/zaproxy/zaproxy:stable").
+		WithServiceBinding("api", apiService).
+		WithNewFile("/zap/wrk/plan.yaml", string(plan))
+	if apiDefinition != nil {
+		zapContainer = zapContainer.WithFile("/zap/wrk/openapi.json", apiDefinition)
+	}
+	args := []string{"zap.sh", "-cmd", "-autorun", "/zap/wrk/plan.yaml"}
+	if offlineAddons != nil {
+		zapContainer = withOfflineAddons(zapContainer, offlineAddons)
+		args = append(args, "-silent")
+	}
+
+	// Scan results depend on the running service, not just the inputs
+	return zapContainer.
+		WithEnvVariable("CACHEBUSTER", time.Now().String()).
+		WithExec(args).
+		File("/zap/wrk/report.json").
+		Contents(ctx)
+}